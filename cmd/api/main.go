@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,12 +14,31 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	_ "github.com/lib/pq"
+	"google.golang.org/grpc"
 
+	"github.com/testifysec/dropbox-clone/internal/accesskey"
+	"github.com/testifysec/dropbox-clone/internal/account"
+	"github.com/testifysec/dropbox-clone/internal/admin"
+	"github.com/testifysec/dropbox-clone/internal/apppassword"
+	"github.com/testifysec/dropbox-clone/internal/audit"
 	"github.com/testifysec/dropbox-clone/internal/auth"
 	"github.com/testifysec/dropbox-clone/internal/config"
+	"github.com/testifysec/dropbox-clone/internal/dav"
+	"github.com/testifysec/dropbox-clone/internal/events"
 	"github.com/testifysec/dropbox-clone/internal/file"
 	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/grpcapi"
+	"github.com/testifysec/dropbox-clone/internal/lockout"
+	"github.com/testifysec/dropbox-clone/internal/mail"
+	"github.com/testifysec/dropbox-clone/internal/openapi"
+	"github.com/testifysec/dropbox-clone/internal/realip"
+	"github.com/testifysec/dropbox-clone/internal/s3gw"
+	"github.com/testifysec/dropbox-clone/internal/scim"
+	"github.com/testifysec/dropbox-clone/internal/secretbox"
+	"github.com/testifysec/dropbox-clone/internal/sftpd"
+	"github.com/testifysec/dropbox-clone/internal/sshkey"
 	"github.com/testifysec/dropbox-clone/internal/user"
+	"github.com/testifysec/dropbox-clone/internal/webhook"
 )
 
 func main() {
@@ -66,14 +86,55 @@ func main() {
 	log.Println("Initialized S3 storage")
 
 	// Initialize repositories
+	adminRepo := admin.NewPostgresRepository(db)
+	auditRepo := audit.NewPostgresRepository(db)
 	userRepo := user.NewPostgresRepository(db)
 	groupRepo := group.NewPostgresRepository(db)
 	fileRepo := file.NewPostgresRepository(db)
+	webhookSecrets, err := secretbox.New(cfg.JWT.Secret, "webhook secrets")
+	if err != nil {
+		log.Fatalf("Failed to initialize webhook secrets: %v", err)
+	}
+	webhookRepo := webhook.NewPostgresRepository(db, webhookSecrets)
+	eventRepo := events.NewPostgresRepository(db)
+	appPasswordRepo := apppassword.NewPostgresRepository(db)
+	accessKeyRepo := accesskey.NewPostgresRepository(db)
+	sshKeyRepo := sshkey.NewPostgresRepository(db)
+	accountRepo := account.NewPostgresRepository(db)
 
 	// Initialize services
-	userService := user.NewService(userRepo)
-	groupService := group.NewService(groupRepo)
-	fileService := file.NewService(fileRepo, s3Storage, groupService)
+	passwordParams := user.DefaultArgon2Params()
+	passwordParams.Memory = uint32(cfg.Auth.Argon2MemoryKiB)
+	passwordParams.Iterations = uint32(cfg.Auth.Argon2Iterations)
+	passwordParams.Parallelism = uint8(cfg.Auth.Argon2Parallelism)
+	passwordHasher := user.NewPasswordHasher(passwordParams)
+
+	auditService := audit.NewService(auditRepo)
+	eventBus := events.NewBus()
+	eventBroker := events.NewBroker(eventRepo, cfg.Database.URL)
+	changeWatcher := file.NewWatcher(cfg.Database.URL)
+	eventBus.Subscribe(eventBroker.Publish)
+	userService := user.NewService(userRepo, passwordHasher, user.VerificationPolicy(cfg.Auth.EmailVerificationPolicy))
+	groupService := group.NewService(groupRepo, auditService, eventBus)
+	fileService := file.NewService(fileRepo, s3Storage, groupService, auditService, eventBus, changeWatcher)
+	adminService := admin.NewService(adminRepo, userService, groupService, fileService, auditService)
+	webhookService := webhook.NewService(webhookRepo, groupService, auditService)
+	appPasswordService := apppassword.NewService(appPasswordRepo, userService, auditService)
+	accessKeyService, err := accesskey.NewService(accessKeyRepo, userService, auditService, cfg.JWT.Secret)
+	if err != nil {
+		log.Fatalf("Failed to initialize access keys: %v", err)
+	}
+	sshKeyService := sshkey.NewService(sshKeyRepo, userService, auditService)
+	eventBus.Subscribe(webhookService.HandleEvent)
+
+	if err := userService.EnsureAdmins(ctx, cfg.Admin.BootstrapEmails); err != nil {
+		log.Fatalf("Failed to grant bootstrap admins: %v", err)
+	}
+	if n, err := webhookRepo.SealPlaintextSecrets(ctx); err != nil {
+		log.Fatalf("Failed to encrypt webhook secrets: %v", err)
+	} else if n > 0 {
+		log.Printf("Encrypted %d webhook secrets", n)
+	}
 
 	// Initialize JWT service
 	jwtService := auth.NewJWTService(
@@ -83,10 +144,148 @@ func main() {
 		cfg.JWT.Issuer,
 	)
 
+	// Initialize mailer
+	var mailer mail.Sender
+	if cfg.Mail.SMTPHost != "" {
+		mailer = mail.NewSMTPSender(&mail.SMTPConfig{
+			Host:     cfg.Mail.SMTPHost,
+			Port:     cfg.Mail.SMTPPort,
+			Username: cfg.Mail.SMTPUsername,
+			Password: cfg.Mail.SMTPPassword,
+			From:     cfg.Mail.From,
+		})
+	} else {
+		log.Println("SMTP_HOST not set, emails will be logged instead of sent")
+		mailer = mail.NewLogSender()
+	}
+	verifier := auth.NewVerifier(userService, jwtService, mailer, cfg.Server.PublicURL, cfg.Auth.EmailVerificationTTL)
+
+	// Initialize brute-force protection
+	var lockoutStore lockout.Store
+	if cfg.Lockout.Store == "memory" {
+		lockoutStore = lockout.NewMemoryStore()
+	} else {
+		lockoutStore = lockout.NewPostgresStore(db)
+	}
+	loginGuard := lockout.NewGuard(lockoutStore, lockout.Config{
+		Account: lockout.Policy{
+			FreeAttempts:    cfg.Lockout.FreeAttempts,
+			BaseDelay:       cfg.Lockout.BackoffBase,
+			MaxDelay:        cfg.Lockout.BackoffMax,
+			LockAfter:       cfg.Lockout.MaxFailures,
+			LockoutDuration: cfg.Lockout.LockoutDuration,
+		},
+		IP: lockout.Policy{
+			FreeAttempts:    cfg.Lockout.IPFreeAttempts,
+			BaseDelay:       cfg.Lockout.BackoffBase,
+			MaxDelay:        cfg.Lockout.BackoffMax,
+			LockAfter:       cfg.Lockout.IPMaxFailures,
+			LockoutDuration: cfg.Lockout.LockoutDuration,
+		},
+		Window: cfg.Lockout.FailureWindow,
+	})
+	authService := auth.NewService(userService, jwtService, verifier, loginGuard, auditService)
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := loginGuard.Prune(ctx); err != nil {
+				log.Printf("Failed to prune login attempts: %v", err)
+			}
+		}
+	}()
+
+	// Deliver queued webhooks
+	webhookDispatcher := webhook.NewDispatcher(webhookRepo, webhook.DispatcherConfig{
+		BatchSize:            16,
+		PollInterval:         cfg.Webhook.PollInterval,
+		Timeout:              cfg.Webhook.Timeout,
+		MaxAttempts:          cfg.Webhook.MaxAttempts,
+		BackoffBase:          cfg.Webhook.BackoffBase,
+		BackoffMax:           cfg.Webhook.BackoffMax,
+		AllowPrivateNetworks: cfg.Webhook.AllowPrivateNetworks,
+	})
+	dispatchCtx, stopDispatch := context.WithCancel(ctx)
+	defer stopDispatch()
+	go webhookDispatcher.Run(dispatchCtx)
+
+	// Index uploaded files' contents for search
+	if cfg.Indexing.Enabled {
+		indexer := file.NewIndexer(fileRepo, s3Storage, file.IndexerConfig{
+			BatchSize:    4,
+			PollInterval: cfg.Indexing.PollInterval,
+			MaxAttempts:  cfg.Indexing.MaxAttempts,
+			MaxFileSize:  cfg.Indexing.MaxFileSize,
+			MaxTextSize:  cfg.Indexing.MaxTextSize,
+		})
+		go indexer.Run(dispatchCtx)
+	}
+
+	// Render thumbnails of uploaded images
+	if cfg.Thumbnails.Enabled {
+		thumbnailer := file.NewThumbnailer(fileRepo, s3Storage, file.ThumbnailerConfig{
+			BatchSize:    2,
+			PollInterval: cfg.Thumbnails.PollInterval,
+			MaxAttempts:  cfg.Thumbnails.MaxAttempts,
+			MaxFileSize:  cfg.Thumbnails.MaxFileSize,
+			MaxPixels:    cfg.Thumbnails.MaxPixels,
+		})
+		go thumbnailer.Run(dispatchCtx)
+	}
+
+	// Fan stored events out to this replica's streams and prune old ones
+	go eventBroker.Run(dispatchCtx)
+	go changeWatcher.Run(dispatchCtx)
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := eventRepo.DeleteBefore(ctx, time.Now().Add(-cfg.Events.Retention)); err != nil {
+				log.Printf("Failed to prune events: %v", err)
+			}
+		}
+	}()
+
 	// Initialize handlers
-	authHandler := auth.NewHandler(userService, jwtService)
+	authHandler := auth.NewHandler(authService, userService, verifier, loginGuard, auditService)
 	groupHandler := group.NewHandler(groupService)
-	fileHandler := file.NewHandler(fileService)
+	fileHandler := file.NewHandler(fileService, cfg.Delta.LongpollMaxTimeout)
+	accountService := account.NewService(accountRepo, userService, groupService, fileService, verifier)
+	accountHandler := account.NewHandler(accountService, userService)
+	adminHandler := admin.NewHandler(adminService)
+	auditHandler := audit.NewHandler(auditService)
+	webhookHandler := webhook.NewHandler(webhookService)
+	eventsHandler := events.NewHandler(eventBroker, eventRepo, groupService, userService)
+	scimService := scim.NewService(userRepo, groupRepo, passwordHasher, fileService, auditService, eventBus, cfg.Server.PublicURL)
+	scimHandler := scim.NewHandler(scimService)
+	appPasswordHandler := apppassword.NewHandler(appPasswordService)
+	accessKeyHandler := accesskey.NewHandler(accessKeyService)
+	sshKeyHandler := sshkey.NewHandler(sshKeyService)
+
+	// The API document, which requests (and in test mode responses) are
+	// checked against
+	apiDoc, err := openapi.Load()
+	if err != nil {
+		log.Fatalf("Failed to load API document: %v", err)
+	}
+	apiDocHandler, err := openapi.NewHandler(apiDoc)
+	if err != nil {
+		log.Fatalf("Failed to load API document: %v", err)
+	}
+	apiValidator, err := openapi.NewValidator(apiDoc, cfg.OpenAPI.ValidateResponses)
+	if err != nil {
+		log.Fatalf("Failed to load API document: %v", err)
+	}
+
+	requireVerified := auth.RequireVerifiedEmail(userService)
+
+	// Client addresses are only taken from forwarding headers set by our
+	// own proxies
+	trustedProxies, err := realip.ParseProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+	realIP := realip.Middleware(trustedProxies)
 
 	// Setup router
 	r := chi.NewRouter()
@@ -95,8 +294,11 @@ func main() {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(realIP)
+	r.Use(audit.Middleware)
+
+	// Streaming and long-poll routes are exempt from the request timeout
+	requestTimeout := middleware.Timeout(60 * time.Second)
 
 	// Health check
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -112,38 +314,64 @@ func main() {
 	})
 	r.Handle("/static/*", http.StripPrefix("/static/", fileServer))
 
-	// API routes
-	r.Route("/api/v1", func(r chi.Router) {
-		// Auth routes (public)
-		r.Route("/auth", func(r chi.Router) {
-			r.Post("/register", authHandler.Register)
-			r.Post("/login", authHandler.Login)
-			r.Post("/refresh", authHandler.Refresh)
-		})
-
-		// Protected routes
-		r.Group(func(r chi.Router) {
-			r.Use(auth.Middleware(jwtService))
-
-			// Group routes
-			r.Route("/groups", func(r chi.Router) {
-				r.Post("/", groupHandler.Create)
-				r.Get("/", groupHandler.List)
-				r.Route("/{groupId}", func(r chi.Router) {
-					r.Post("/members", groupHandler.AddMember)
-					r.Delete("/members/{userId}", groupHandler.RemoveMember)
-
-					// File routes
-					r.Route("/files", func(r chi.Router) {
-						r.Post("/", fileHandler.Upload)
-						r.Get("/", fileHandler.List)
-						r.Get("/{fileId}", fileHandler.Download)
-						r.Delete("/{fileId}", fileHandler.Delete)
-					})
-				})
+	// SCIM provisioning routes, enabled when a token is configured
+	if cfg.SCIM.Token != "" {
+		r.Route("/scim/v2", func(r chi.Router) {
+			r.Use(requestTimeout)
+			r.Use(scim.RequireToken(cfg.SCIM.Token))
+			r.Get("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+			r.Get("/ResourceTypes", scimHandler.ResourceTypes)
+			r.Route("/Users", func(r chi.Router) {
+				r.Get("/", scimHandler.ListUsers)
+				r.Post("/", scimHandler.CreateUser)
+				r.Get("/{id}", scimHandler.GetUser)
+				r.Put("/{id}", scimHandler.ReplaceUser)
+				r.Patch("/{id}", scimHandler.PatchUser)
+				r.Delete("/{id}", scimHandler.DeleteUser)
+			})
+			r.Route("/Groups", func(r chi.Router) {
+				r.Get("/", scimHandler.ListGroups)
+				r.Post("/", scimHandler.CreateGroup)
+				r.Get("/{id}", scimHandler.GetGroup)
+				r.Put("/{id}", scimHandler.ReplaceGroup)
+				r.Patch("/{id}", scimHandler.PatchGroup)
+				r.Delete("/{id}", scimHandler.DeleteGroup)
 			})
 		})
-	})
+	}
+
+	// WebDAV access to groups. Transfers can be long, so the request
+	// timeout does not apply.
+	groupFileSystems := dav.NewFileSystems(userService, groupService, fileService)
+	if cfg.WebDAV.Enabled {
+		for _, method := range dav.Methods {
+			chi.RegisterMethod(method)
+		}
+		davHandler := dav.NewHandler("/dav", groupFileSystems, userService, appPasswordService, jwtService)
+		r.Handle("/dav", davHandler)
+		r.Handle("/dav/*", davHandler)
+	}
+
+	// API routes
+	api := &apiRoutes{
+		validator:       apiValidator,
+		authenticate:    auth.Middleware(jwtService, userService),
+		requireVerified: requireVerified,
+		requestTimeout:  requestTimeout,
+		docs:            apiDocHandler,
+		auth:            authHandler,
+		account:         accountHandler,
+		admin:           adminHandler,
+		audit:           auditHandler,
+		group:           groupHandler,
+		file:            fileHandler,
+		webhook:         webhookHandler,
+		events:          eventsHandler,
+		appPasswords:    appPasswordHandler,
+		accessKeys:      accessKeyHandler,
+		sshKeys:         sshKeyHandler,
+	}
+	r.Route("/api/v1", api.mount)
 
 	// Server configuration
 	srv := &http.Server{
@@ -162,14 +390,115 @@ func main() {
 		}
 	}()
 
+	// S3-compatible gateway on its own port. Like WebDAV, transfers can be
+	// long, so only header reads are bounded.
+	var s3Srv *http.Server
+	if cfg.S3Gateway.Port != "" {
+		s3Gateway := s3gw.NewServer(cfg.S3Gateway.Region, userService, groupService, fileService,
+			accessKeyService, s3Storage, s3gw.NewPostgresRepository(db))
+		s3Srv = &http.Server{
+			Addr: ":" + cfg.S3Gateway.Port,
+			Handler: chi.Chain(
+				middleware.Logger,
+				middleware.Recoverer,
+				middleware.RequestID,
+				realIP,
+				audit.Middleware,
+			).Handler(s3Gateway),
+			ReadHeaderTimeout: cfg.Server.ReadTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}
+		go func() {
+			log.Printf("Starting S3 gateway on port %s", cfg.S3Gateway.Port)
+			if err := s3Srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("S3 gateway failed: %v", err)
+			}
+		}()
+
+		// Discard multipart uploads clients abandoned
+		go func() {
+			ticker := time.NewTicker(time.Hour)
+			defer ticker.Stop()
+			for range ticker.C {
+				if _, err := s3Gateway.PruneUploads(ctx, time.Now().Add(-cfg.S3Gateway.UploadExpiry)); err != nil {
+					log.Printf("Failed to prune multipart uploads: %v", err)
+				}
+			}
+		}()
+	}
+
+	// SFTP access to groups, laid out as over WebDAV
+	var sftpSrv *sftpd.Server
+	if cfg.SFTP.Port != "" {
+		if len(cfg.SFTP.HostKeys) == 0 {
+			log.Println("SFTP_HOST_KEYS not set, using a temporary host key that changes on restart")
+		}
+		hostKeys, err := sftpd.LoadHostKeys(cfg.SFTP.HostKeys)
+		if err != nil {
+			log.Fatalf("Failed to load SFTP host keys: %v", err)
+		}
+		sftpSrv = sftpd.NewServer(hostKeys, groupFileSystems, authService, userService, appPasswordService, sshKeyService)
+		sftpListener, err := net.Listen("tcp", ":"+cfg.SFTP.Port)
+		if err != nil {
+			log.Fatalf("Failed to listen for SFTP: %v", err)
+		}
+		go func() {
+			log.Printf("Starting SFTP server on port %s", cfg.SFTP.Port)
+			if err := sftpSrv.Serve(sftpListener); err != nil && err != sftpd.ErrServerClosed {
+				log.Fatalf("SFTP server failed: %v", err)
+			}
+		}()
+	}
+
+	// gRPC API for internal services
+	var grpcSrv *grpc.Server
+	if cfg.GRPC.Port != "" {
+		grpcSrv = grpcapi.NewServer(userService, groupService, fileService, jwtService, authService)
+		grpcListener, err := net.Listen("tcp", ":"+cfg.GRPC.Port)
+		if err != nil {
+			log.Fatalf("Failed to listen for gRPC: %v", err)
+		}
+		go func() {
+			log.Printf("Starting gRPC server on port %s", cfg.GRPC.Port)
+			if err := grpcSrv.Serve(grpcListener); err != nil {
+				log.Fatalf("gRPC server failed: %v", err)
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Println("Shutting down server...")
+	stopDispatch() // Also closes open event streams
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if grpcSrv != nil {
+		// Streams can outlast the shutdown timeout, so stop them when it ends
+		stopped := make(chan struct{})
+		go func() {
+			grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			log.Println("gRPC server forced to shutdown")
+			grpcSrv.Stop()
+		}
+	}
+	if sftpSrv != nil {
+		if err := sftpSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("SFTP server forced to shutdown: %v", err)
+		}
+	}
+	if s3Srv != nil {
+		if err := s3Srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("S3 gateway forced to shutdown: %v", err)
+		}
+	}
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/testifysec/dropbox-clone/internal/accesskey"
+	"github.com/testifysec/dropbox-clone/internal/account"
+	"github.com/testifysec/dropbox-clone/internal/admin"
+	"github.com/testifysec/dropbox-clone/internal/apppassword"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/events"
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/openapi"
+	"github.com/testifysec/dropbox-clone/internal/sshkey"
+	"github.com/testifysec/dropbox-clone/internal/webhook"
+)
+
+// apiRoutes serves /api/v1, which the OpenAPI document describes
+type apiRoutes struct {
+	validator       *openapi.Validator
+	authenticate    func(http.Handler) http.Handler
+	requireVerified func(http.Handler) http.Handler // Unverified accounts may be blocked from uploads and invites by policy
+	requestTimeout  func(http.Handler) http.Handler // Streaming and long-poll routes are exempt
+
+	docs         *openapi.Handler
+	auth         *auth.Handler
+	account      *account.Handler
+	admin        *admin.Handler
+	audit        *audit.Handler
+	group        *group.Handler
+	file         *file.Handler
+	webhook      *webhook.Handler
+	events       *events.Handler
+	appPasswords *apppassword.Handler
+	accessKeys   *accesskey.Handler
+	sshKeys      *sshkey.Handler
+}
+
+// mount registers the API routes on r
+func (a *apiRoutes) mount(r chi.Router) {
+	r.Use(a.validator.Middleware)
+
+	// API document and docs page (public)
+	r.Get("/openapi.json", a.docs.Spec)
+	r.Get("/docs", a.docs.Docs)
+
+	// Real-time event stream (Server-Sent Events)
+	r.With(a.authenticate).Get("/events", a.events.Stream)
+
+	// Long poll for delta sync changes, bounded by its own timeout
+	r.With(a.authenticate).Post("/delta/longpoll", a.file.Longpoll)
+
+	r.Group(func(r chi.Router) {
+		r.Use(a.requestTimeout)
+
+		// Auth routes (public)
+		r.Route("/auth", func(r chi.Router) {
+			r.Post("/register", a.auth.Register)
+			r.Post("/login", a.auth.Login)
+			r.Post("/refresh", a.auth.Refresh)
+			r.Get("/verify-email", a.auth.VerifyEmail)
+		})
+
+		// Protected routes
+		r.Group(func(r chi.Router) {
+			r.Use(a.authenticate)
+
+			r.Post("/auth/verify-email/resend", a.auth.ResendVerification)
+
+			// Instance administration routes
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(auth.RequireAdmin())
+				r.Get("/stats", a.admin.Stats)
+				r.Get("/users", a.admin.ListUsers)
+				r.Route("/users/{userId}", func(r chi.Router) {
+					r.Get("/", a.admin.GetUser)
+					r.Post("/disable", a.admin.DisableUser)
+					r.Post("/enable", a.admin.EnableUser)
+					r.Put("/admin", a.admin.SetAdmin)
+					r.Post("/unlock", a.auth.UnlockAccount)
+				})
+				r.Get("/groups", a.admin.ListGroups)
+				r.Delete("/groups/{groupId}", a.admin.DeleteGroup)
+				r.Get("/audit", a.audit.List)
+				r.Get("/audit/verify", a.audit.Verify)
+			})
+
+			// Self-service account routes
+			r.Route("/me", func(r chi.Router) {
+				r.Get("/", a.account.Me)
+				r.Patch("/", a.account.UpdateProfile)
+				r.Delete("/", a.account.Delete)
+				r.Put("/password", a.account.ChangePassword)
+				r.Put("/email", a.account.ChangeEmail)
+
+				// App passwords for WebDAV and other Basic auth clients
+				r.Route("/app-passwords", func(r chi.Router) {
+					r.Post("/", a.appPasswords.Create)
+					r.Get("/", a.appPasswords.List)
+					r.Delete("/{appPasswordId}", a.appPasswords.Revoke)
+				})
+
+				// SSH keys for the SFTP listener
+				r.Route("/ssh-keys", func(r chi.Router) {
+					r.Post("/", a.sshKeys.Add)
+					r.Get("/", a.sshKeys.List)
+					r.Delete("/{sshKeyId}", a.sshKeys.Delete)
+				})
+
+				// Access keys for the S3 gateway
+				r.Route("/access-keys", func(r chi.Router) {
+					r.Post("/", a.accessKeys.Create)
+					r.Get("/", a.accessKeys.List)
+					r.Delete("/{accessKeyId}", a.accessKeys.Delete)
+				})
+			})
+
+			// Search across the caller's groups
+			r.Get("/search", a.file.Search)
+
+			// Group routes
+			r.Route("/groups", func(r chi.Router) {
+				r.Post("/", a.group.Create)
+				r.Get("/", a.group.List)
+				r.Route("/{groupId}", func(r chi.Router) {
+					r.Get("/members", a.group.ListMembers)
+					r.With(a.requireVerified).Post("/members", a.group.AddMember)
+					r.Delete("/members/{userId}", a.group.RemoveMember)
+					r.Post("/reindex", a.file.Reindex)
+					r.Get("/metadata-schema", a.file.GetMetadataSchema)
+					r.Put("/metadata-schema", a.file.SetMetadataSchema)
+
+					// File routes
+					r.Route("/files", func(r chi.Router) {
+						r.With(a.requireVerified).Post("/", a.file.Upload)
+						r.Get("/", a.file.List)
+						r.Get("/{fileId}", a.file.Download)
+						r.Patch("/{fileId}", a.file.Rename)
+						r.Delete("/{fileId}", a.file.Delete)
+						r.Get("/{fileId}/thumbnail", a.file.Thumbnail)
+						r.Get("/{fileId}/preview", a.file.Preview)
+						r.Post("/{fileId}/share", a.file.Share)
+						r.Put("/{fileId}/tags", a.file.UpdateTags)
+						r.Patch("/{fileId}/metadata", a.file.UpdateMetadata)
+					})
+
+					// Delta sync routes
+					r.Route("/delta", func(r chi.Router) {
+						r.Get("/", a.file.Delta)
+						r.Get("/continue", a.file.DeltaContinue)
+						r.Get("/latest_cursor", a.file.DeltaLatestCursor)
+					})
+
+					// Webhook routes
+					r.Route("/webhooks", func(r chi.Router) {
+						r.Post("/", a.webhook.Create)
+						r.Get("/", a.webhook.List)
+						r.Route("/{webhookId}", func(r chi.Router) {
+							r.Get("/", a.webhook.Get)
+							r.Patch("/", a.webhook.Update)
+							r.Delete("/", a.webhook.Delete)
+							r.Get("/deliveries", a.webhook.ListDeliveries)
+							r.Post("/deliveries/{deliveryId}/redeliver", a.webhook.Redeliver)
+						})
+					})
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/testifysec/dropbox-clone/internal/openapi"
+)
+
+// TestRoutesMatchDocument checks that every API route is documented and
+// every documented operation is routed
+func TestRoutesMatchDocument(t *testing.T) {
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := openapi.NewValidator(doc, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the routing is walked, so the handlers are never called
+	pass := func(next http.Handler) http.Handler { return next }
+	api := &apiRoutes{validator: validator, authenticate: pass, requireVerified: pass, requestTimeout: pass}
+	r := chi.NewRouter()
+	r.Route("/api/v1", api.mount)
+
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	routed := make(map[string]bool)
+	err = chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		// Routes mounted with r.Route serve their root with a trailing slash
+		path := strings.TrimPrefix(route, "/api/v1")
+		if len(path) > 1 {
+			path = strings.TrimSuffix(path, "/")
+		}
+		key := method + " " + path
+		routed[key] = true
+		if !documented[key] {
+			t.Errorf("%s is routed but not documented", key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key := range documented {
+		if !routed[key] {
+			t.Errorf("%s is documented but not routed", key)
+		}
+	}
+	if len(routed) == 0 {
+		t.Fatal("no routes were walked")
+	}
+}
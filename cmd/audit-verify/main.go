@@ -0,0 +1,49 @@
+// Command audit-verify checks the integrity of the audit log hash chain.
+//
+// It reads DATABASE_URL from the environment, recomputes every event's hash
+// and exits with status 1 if any event was modified, inserted or removed.
+// Record the printed last hash somewhere outside the database: a later run
+// whose chain no longer contains it shows the log was truncated or rewritten.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	_ "github.com/lib/pq"
+
+	"github.com/testifysec/dropbox-clone/internal/audit"
+)
+
+func main() {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}()
+
+	result, err := audit.NewService(audit.NewPostgresRepository(db)).Verify(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to verify audit log: %v", err)
+	}
+
+	if !result.Valid {
+		fmt.Printf("Audit log chain is BROKEN at event %d after %d valid events: %s\n",
+			result.BrokenAt, result.Checked, result.Reason)
+		os.Exit(1)
+	}
+	fmt.Printf("Audit log chain is valid: %d events, last event %d, last hash %s\n",
+		result.Checked, result.LastID, result.LastHash)
+}
@@ -0,0 +1,63 @@
+//go:build e2e
+
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/pkg/client"
+)
+
+// TestE2ESync syncs two folders through a real API server given by
+// DBX_E2E_SERVER, as a freshly registered user
+func TestE2ESync(t *testing.T) {
+	server := os.Getenv("DBX_E2E_SERVER")
+	if server == "" {
+		t.Skip("DBX_E2E_SERVER is not set")
+	}
+	ctx := context.Background()
+
+	c := client.New(server)
+	email := "dbx-sync-e2e-" + uuid.NewString() + "@example.com"
+	if _, err := c.Register(ctx, email, "e2e-password-"+uuid.NewString()); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	group, err := c.CreateGroup(ctx, "dbx-sync e2e")
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	r := &apiRemote{client: c, groupID: group.ID}
+	a, b := newTestSyncer(t, r), newTestSyncer(t, r)
+
+	writeFile(t, a, "docs/hello.txt", "hello")
+	writeFile(t, a, "top.txt", "top")
+	syncAll(t, a, b)
+	assertFiles(t, b, map[string]string{"docs/hello.txt": "hello", "top.txt": "top"})
+
+	// b's cursor is current, so a long poll waits until a changes something
+	cursor := b.state.cursor()
+	if changed, err := r.Wait(ctx, cursor, time.Second); err != nil || changed {
+		t.Fatalf("idle long poll = %v, %v; want no changes", changed, err)
+	}
+
+	writeFile(t, a, "top.txt", "top v2")
+	writeFile(t, b, "top.txt", "top from b")
+	if err := os.Remove(b.abs("docs/hello.txt")); err != nil {
+		t.Fatal(err)
+	}
+	syncAll(t, a)
+	if changed, err := r.Wait(ctx, cursor, 10*time.Second); err != nil || !changed {
+		t.Fatalf("long poll after upload = %v, %v; want changes", changed, err)
+	}
+	syncAll(t, b, a)
+
+	conflict := "top (test's conflicted copy " + b.now().Format("2006-01-02") + ").txt"
+	want := map[string]string{"top.txt": "top v2", conflict: "top from b"}
+	assertFiles(t, a, want)
+	assertFiles(t, b, want)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+)
+
+// filter implements selective sync. A pattern without a slash matches any
+// path component, e.g. "*.tmp" or "node_modules"; a pattern with a slash
+// matches a path from the sync root and everything beneath it, e.g.
+// "archive/2019".
+type filter struct {
+	patterns []string
+}
+
+func newFilter(patterns []string) (*filter, error) {
+	f := &filter{}
+	for _, p := range patterns {
+		p = strings.Trim(p, "/")
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", p, err)
+		}
+		f.patterns = append(f.patterns, p)
+	}
+	return f, nil
+}
+
+// excluded reports whether a slash-separated path relative to the sync
+// root is left out of the sync
+func (f *filter) excluded(rel string) bool {
+	if len(f.patterns) == 0 {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for _, p := range f.patterns {
+		anchored := strings.Contains(p, "/")
+		for i := range parts {
+			subject := parts[i]
+			if anchored {
+				subject = strings.Join(parts[:i+1], "/")
+			}
+			if ok, _ := path.Match(p, subject); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// uploadBurst is the most a rate-limited upload sends at once
+const uploadBurst = 64 << 10
+
+// rateReader limits the rate data is read from r. Every upload shares the
+// limiter, so the limit covers the daemon as a whole.
+type rateReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func newLimiter(bytesPerSec int64) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), uploadBurst)
+}
+
+func limitReader(ctx context.Context, r io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &rateReader{ctx: ctx, r: r, limiter: limiter}
+}
+
+func (r *rateReader) Read(p []byte) (int, error) {
+	if len(p) > uploadBurst {
+		p = p[:uploadBurst]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// parseRate parses a byte rate such as "500K" or "2M" (binary units)
+func parseRate(s string) (int64, error) {
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,168 @@
+// Command dbx-sync keeps a local folder and a group's files in two-way
+// sync.
+//
+// It uses the credentials cached by "dbx login". Local changes are picked
+// up by a file watcher and a periodic scan, remote ones by long-polling
+// the delta API. Sync state lives in a bbolt database in the folder's
+// .dbx-sync directory. When a file changed on both sides, the remote
+// version keeps the name and the local one is renamed to a "conflicted
+// copy", which is then uploaded as well.
+//
+// Usage:
+//
+//	dbx-sync [flags] GROUP_ID DIR
+//
+// Selective sync leaves out paths matching --exclude patterns; excluding a
+// path that was synced keeps both copies but stops syncing them.
+// --upload-limit caps upload bandwidth, e.g. "512K" or "2M" bytes per
+// second. --once syncs a single time and exits, for scripts and tests.
+//
+// The end-to-end tests run against a local API server, such as the one
+// started by docker-compose:
+//
+//	DBX_E2E_SERVER=http://localhost:8080 go test -tags e2e ./cmd/dbx-sync
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/pkg/client"
+)
+
+// listFlag is a repeatable string flag
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	var (
+		server       = flag.String("server", "", "API server URL (default $DBX_SERVER or the server logged in to)")
+		uploadLimit  = flag.String("upload-limit", "", "upload bandwidth limit in bytes per second, e.g. 512K or 2M")
+		scanInterval = flag.Duration("scan-interval", 5*time.Minute, "interval between full scans of the folder")
+		once         = flag.Bool("once", false, "sync once and exit")
+		excludes     listFlag
+	)
+	flag.Var(&excludes, "exclude", "leave out paths matching a pattern; repeatable")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dbx-sync [flags] GROUP_ID DIR")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	groupID := flag.Arg(0)
+	if _, err := uuid.Parse(groupID); err != nil {
+		log.Fatalf("Invalid group ID %q", groupID)
+	}
+	root, err := filepath.Abs(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		log.Fatalf("%s is not a directory", root)
+	}
+
+	limit, err := parseRate(*uploadLimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := newFilter(excludes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	api, err := newClient(*server)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, stateDirName), 0o700); err != nil {
+		log.Fatal(err)
+	}
+	st, err := openState(filepath.Join(root, stateDirName, "state.db"), groupID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := st.Close(); err != nil {
+			log.Printf("Error closing state database: %v", err)
+		}
+	}()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	s, err := newSyncer(root, &apiRemote{client: api, groupID: groupID}, st, f, newLimiter(limit), logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		if err := s.sync(ctx); err != nil {
+			log.Printf("Sync failed: %v", err)
+			stop()
+			_ = st.Close()
+			os.Exit(1)
+		}
+		return
+	}
+	logger.Printf("Syncing %s with group %s", root, groupID)
+	if err := s.run(ctx, *scanInterval); err != nil {
+		log.Printf("Sync stopped: %v", err)
+	}
+}
+
+// newClient creates an API client from the credentials cached by dbx,
+// saving refreshed tokens back
+func newClient(server string) (*client.Client, error) {
+	path, err := client.DefaultCredentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	creds, err := client.LoadCredentials(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading credentials: %w", err)
+	}
+	if creds.Token == nil {
+		return nil, fmt.Errorf("not logged in; run \"dbx login\" first")
+	}
+
+	if server == "" {
+		server = os.Getenv("DBX_SERVER")
+	}
+	if server == "" {
+		server = creds.Server
+	}
+	if creds.Server != "" && server != creds.Server {
+		return nil, fmt.Errorf("logged in to %s, not %s; run \"dbx --server %s login\"", creds.Server, server, server)
+	}
+
+	return client.New(server,
+		client.WithToken(creds.Token),
+		client.WithTokenHandler(func(token *client.Token) {
+			creds.Token = token
+			if err := creds.Save(path); err != nil {
+				log.Printf("Failed to save refreshed credentials: %v", err)
+			}
+		}),
+	), nil
+}
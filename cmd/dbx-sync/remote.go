@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/testifysec/dropbox-clone/pkg/client"
+)
+
+// remote is the group being synced. The daemon talks to the API through
+// it so tests can substitute an in-memory group.
+type remote interface {
+	// Delta lists the changes after cursor, or every file when cursor is ""
+	Delta(ctx context.Context, cursor string) (*client.DeltaPage, error)
+	// Wait blocks until there are changes after cursor or the timeout passes
+	Wait(ctx context.Context, cursor string, timeout time.Duration) (bool, error)
+	Upload(ctx context.Context, name string, r io.Reader) (*client.File, error)
+	Download(ctx context.Context, fileID string, w io.Writer) error
+	// Delete deletes a file; deleting a missing file is not an error
+	Delete(ctx context.Context, fileID string) error
+}
+
+// apiRemote is a group on an API server
+type apiRemote struct {
+	client  *client.Client
+	groupID string
+}
+
+func (r *apiRemote) Delta(ctx context.Context, cursor string) (*client.DeltaPage, error) {
+	if cursor == "" {
+		return r.client.ListDelta(ctx, r.groupID, 0)
+	}
+	return r.client.ContinueDelta(ctx, r.groupID, cursor, 0)
+}
+
+func (r *apiRemote) Wait(ctx context.Context, cursor string, timeout time.Duration) (bool, error) {
+	result, err := r.client.Longpoll(ctx, []string{cursor}, timeout)
+	if err != nil {
+		return false, err
+	}
+	return result.Changes, nil
+}
+
+func (r *apiRemote) Upload(ctx context.Context, name string, body io.Reader) (*client.File, error) {
+	return r.client.Upload(ctx, r.groupID, name, body)
+}
+
+func (r *apiRemote) Download(ctx context.Context, fileID string, w io.Writer) error {
+	_, err := r.client.Download(ctx, r.groupID, fileID, w)
+	return err
+}
+
+func (r *apiRemote) Delete(ctx context.Context, fileID string) error {
+	err := r.client.DeleteFile(ctx, r.groupID, fileID)
+	if errors.Is(err, client.ErrFileNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	filesBucket = []byte("files") // Local path -> entry
+	idsBucket   = []byte("ids")   // Remote file ID -> local path
+	metaBucket  = []byte("meta")
+
+	cursorKey = []byte("cursor")
+	groupKey  = []byte("group")
+)
+
+// entry records a synced file: the remote file it mirrors and the local
+// file's state when they last matched
+type entry struct {
+	FileID     string `json:"file_id"`
+	RemoteName string `json:"remote_name"`
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mod_time"` // Unix nanoseconds
+	Hash       string `json:"hash"`     // SHA-256 of the contents, hex
+}
+
+// state is the sync state database
+type state struct {
+	db *bolt.DB
+}
+
+// openState opens the state database at path, binding it to groupID on
+// first use. A database created for another group is refused, since its
+// entries would map this folder onto the wrong files.
+func openState(path, groupID string) (*state, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			return nil, fmt.Errorf("state database %s is locked; is another dbx-sync running?", path)
+		}
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{filesBucket, idsBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		meta := tx.Bucket(metaBucket)
+		switch bound := string(meta.Get(groupKey)); bound {
+		case "":
+			return meta.Put(groupKey, []byte(groupID))
+		case groupID:
+			return nil
+		default:
+			return fmt.Errorf("state database %s belongs to group %s", path, bound)
+		}
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &state{db: db}, nil
+}
+
+func (s *state) Close() error {
+	return s.db.Close()
+}
+
+// get returns the entry for a local path
+func (s *state) get(path string) (*entry, bool) {
+	var e *entry
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		e = decodeEntry(tx.Bucket(filesBucket).Get([]byte(path)))
+		return nil
+	})
+	return e, e != nil
+}
+
+// pathForID returns the local path mirroring a remote file
+func (s *state) pathForID(fileID string) (string, bool) {
+	var path string
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		path = string(tx.Bucket(idsBucket).Get([]byte(fileID)))
+		return nil
+	})
+	return path, path != ""
+}
+
+// put records the entry for a path, replacing any previous one
+func (s *state) put(path string, e *entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := unindex(tx, path); err != nil {
+			return err
+		}
+		if err := tx.Bucket(filesBucket).Put([]byte(path), data); err != nil {
+			return err
+		}
+		return tx.Bucket(idsBucket).Put([]byte(e.FileID), []byte(path))
+	})
+}
+
+// remove forgets a path
+func (s *state) remove(path string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := unindex(tx, path); err != nil {
+			return err
+		}
+		return tx.Bucket(filesBucket).Delete([]byte(path))
+	})
+}
+
+// unindex drops the ID index entry of the file recorded at path
+func unindex(tx *bolt.Tx, path string) error {
+	old := decodeEntry(tx.Bucket(filesBucket).Get([]byte(path)))
+	if old == nil {
+		return nil
+	}
+	ids := tx.Bucket(idsBucket)
+	if string(ids.Get([]byte(old.FileID))) != path {
+		return nil
+	}
+	return ids.Delete([]byte(old.FileID))
+}
+
+// all returns every recorded entry by path
+func (s *state) all() (map[string]*entry, error) {
+	entries := make(map[string]*entry)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(filesBucket).ForEach(func(k, v []byte) error {
+			if e := decodeEntry(v); e != nil {
+				entries[string(k)] = e
+			}
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// cursor returns the delta cursor the local folder is in sync with, or ""
+// before the first sync
+func (s *state) cursor() string {
+	var cursor string
+	_ = s.db.View(func(tx *bolt.Tx) error {
+		cursor = string(tx.Bucket(metaBucket).Get(cursorKey))
+		return nil
+	})
+	return cursor
+}
+
+func (s *state) setCursor(cursor string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(cursorKey, []byte(cursor))
+	})
+}
+
+func decodeEntry(data []byte) *entry {
+	if data == nil {
+		return nil
+	}
+	e := &entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil
+	}
+	return e
+}
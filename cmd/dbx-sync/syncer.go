@@ -0,0 +1,605 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/testifysec/dropbox-clone/pkg/client"
+)
+
+// stateDirName is the directory in the sync root holding the state
+// database and partial downloads. It is never synced.
+const stateDirName = ".dbx-sync"
+
+// settleTime is how long a file must go unmodified before it is uploaded,
+// so files still being written are not sent half-finished
+const settleTime = 2 * time.Second
+
+// maxNameLength is the longest file name the server accepts
+const maxNameLength = 255
+
+// fileStatus is a local file's state relative to its recorded entry
+type fileStatus int
+
+const (
+	statusMissing fileStatus = iota
+	statusUnchanged
+	statusChanged // Differs from the entry, or exists without one
+)
+
+// syncer mirrors a local folder to a group. Remote changes are applied
+// before local ones are uploaded; when both sides changed a file, the
+// remote version keeps the name and the local one is renamed to a
+// conflicted copy, which is uploaded in turn.
+type syncer struct {
+	root    string
+	tmpDir  string
+	remote  remote
+	state   *state
+	filter  *filter
+	limiter *rate.Limiter
+	host    string
+	logger  *log.Logger
+	now     func() time.Time
+
+	// unsettled is set when a scan skipped files still being written
+	unsettled bool
+}
+
+func newSyncer(root string, r remote, st *state, f *filter, limiter *rate.Limiter, logger *log.Logger) (*syncer, error) {
+	tmpDir := filepath.Join(root, stateDirName, "tmp")
+	if err := os.MkdirAll(tmpDir, 0o700); err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "dbx-sync"
+	}
+	return &syncer{
+		root:    root,
+		tmpDir:  tmpDir,
+		remote:  r,
+		state:   st,
+		filter:  f,
+		limiter: limiter,
+		host:    host,
+		logger:  logger,
+		now:     time.Now,
+	}, nil
+}
+
+// sync brings the folder and the group into agreement
+func (s *syncer) sync(ctx context.Context) error {
+	s.unsettled = false
+	if err := s.pull(ctx); err != nil {
+		return fmt.Errorf("applying remote changes: %w", err)
+	}
+	if err := s.push(ctx); err != nil {
+		return fmt.Errorf("uploading local changes: %w", err)
+	}
+	return nil
+}
+
+// pull applies the remote changes since the saved cursor. The cursor is
+// only saved once every change is applied, so an interrupted pull is
+// repeated in full; applying a change twice is harmless.
+func (s *syncer) pull(ctx context.Context) error {
+	cursor := s.state.cursor()
+	full := cursor == ""
+
+	var entries []client.DeltaEntry
+	for {
+		page, err := s.remote.Delta(ctx, cursor)
+		if err != nil {
+			if errors.Is(err, client.ErrCursorReset) && !full {
+				s.logger.Printf("Remote cursor is no longer valid; relisting the group")
+				cursor, full, entries = "", true, nil
+				continue
+			}
+			return err
+		}
+		entries = append(entries, page.Entries...)
+		cursor = page.Cursor
+		if !page.HasMore {
+			break
+		}
+	}
+
+	if err := s.apply(ctx, latestEntries(entries), full); err != nil {
+		return err
+	}
+	return s.state.setCursor(cursor)
+}
+
+// latestEntries keeps the last entry for each file, in the order of those
+// last entries
+func latestEntries(entries []client.DeltaEntry) []client.DeltaEntry {
+	last := make(map[string]int, len(entries))
+	for i, e := range entries {
+		last[e.ID] = i
+	}
+	latest := make([]client.DeltaEntry, 0, len(last))
+	for i, e := range entries {
+		if last[e.ID] == i {
+			latest = append(latest, e)
+		}
+	}
+	return latest
+}
+
+// apply applies remote changes. A full listing has no tombstones, so
+// recorded files missing from it were deleted remotely.
+func (s *syncer) apply(ctx context.Context, entries []client.DeltaEntry, full bool) error {
+	deleted := make(map[string]bool)
+	for _, e := range entries {
+		if e.Tag == client.TagDeleted {
+			deleted[e.ID] = true
+		}
+	}
+	if full {
+		listed := make(map[string]bool, len(entries))
+		for _, e := range entries {
+			listed[e.ID] = true
+		}
+		recorded, err := s.state.all()
+		if err != nil {
+			return err
+		}
+		for _, rec := range recorded {
+			if !listed[rec.FileID] {
+				deleted[rec.FileID] = true
+			}
+		}
+	}
+
+	for _, e := range entries {
+		if e.Tag == client.TagDeleted {
+			continue
+		}
+		if err := s.remoteAdded(ctx, e, deleted); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+	for id := range deleted {
+		if err := s.remoteDeleted(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remoteAdded applies a file that was added, renamed or re-listed
+// remotely. deleted holds files deleted in the same batch, which another
+// file may replace.
+func (s *syncer) remoteAdded(ctx context.Context, e client.DeltaEntry, deleted map[string]bool) error {
+	rel, ok := localPath(e.Name)
+	if !ok {
+		s.logger.Printf("Skipping remote file %q: not a valid local path", e.Name)
+		return nil
+	}
+	if s.filter.excluded(rel) {
+		return nil
+	}
+
+	if current, ok := s.state.pathForID(e.ID); ok {
+		rec, _ := s.state.get(current)
+		if rec.RemoteName == e.Name {
+			return nil // Already in sync, e.g. our own upload
+		}
+		return s.remoteRenamed(ctx, current, rel, e, deleted)
+	}
+	return s.fetch(ctx, rel, e, deleted)
+}
+
+// remoteRenamed moves a file renamed remotely, or fetches it afresh when
+// the local copy changed or the new name is taken
+func (s *syncer) remoteRenamed(ctx context.Context, from, to string, e client.DeltaEntry, deleted map[string]bool) error {
+	rec, _ := s.state.get(from)
+	status, err := s.localStatus(from, rec)
+	if err != nil {
+		return err
+	}
+	if err := s.state.remove(from); err != nil {
+		return err
+	}
+
+	_, taken := s.state.get(to)
+	if !taken {
+		taken = s.exists(to)
+	}
+	switch {
+	case status == statusUnchanged && !taken:
+		if err := s.move(from, to); err != nil {
+			return err
+		}
+		rec.RemoteName = e.Name
+		s.logger.Printf("Renamed %s to %s", from, to)
+		return s.state.put(to, rec)
+	case status == statusUnchanged:
+		if err := s.removeLocal(from); err != nil {
+			return err
+		}
+	case status == statusChanged:
+		// The local edits are uploaded as a new file by the next scan
+		s.logger.Printf("Kept %s, renamed remotely but changed locally", from)
+	}
+	return s.fetch(ctx, to, e, deleted)
+}
+
+// remoteDeleted removes the local copy of a file deleted remotely, unless
+// it has changed since, in which case it is kept and uploaded again
+func (s *syncer) remoteDeleted(fileID string) error {
+	rel, ok := s.state.pathForID(fileID)
+	if !ok {
+		return nil
+	}
+	rec, _ := s.state.get(rel)
+	status, err := s.localStatus(rel, rec)
+	if err != nil {
+		return err
+	}
+	if err := s.state.remove(rel); err != nil {
+		return err
+	}
+
+	switch status {
+	case statusUnchanged:
+		s.logger.Printf("Deleted %s", rel)
+		return s.removeLocal(rel)
+	case statusChanged:
+		s.logger.Printf("Kept %s, deleted remotely but changed locally", rel)
+	}
+	return nil
+}
+
+// fetch downloads a remote file to rel. A local file in the way is kept as
+// a conflicted copy unless it is identical or an unchanged copy of a file
+// the new one replaces.
+func (s *syncer) fetch(ctx context.Context, rel string, e client.DeltaEntry, deleted map[string]bool) error {
+	if rec, bound := s.state.get(rel); bound && !deleted[rec.FileID] {
+		// Another remote file has the same name; keep both
+		rel = s.conflictPath(rel)
+	}
+
+	tmp, hash, err := s.download(ctx, e.ID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp) }()
+
+	rec, _ := s.state.get(rel)
+	status, err := s.localStatus(rel, rec)
+	if err != nil {
+		return err
+	}
+	if status == statusChanged {
+		localHash, err := hashFile(s.abs(rel))
+		if err != nil {
+			return err
+		}
+		if localHash != hash {
+			conflict := s.conflictPath(rel)
+			if err := s.move(rel, conflict); err != nil {
+				return err
+			}
+			s.logger.Printf("Kept local changes to %s as %s", rel, conflict)
+			if err := s.state.remove(rel); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.abs(rel)), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.abs(rel)); err != nil {
+		return err
+	}
+	info, err := os.Lstat(s.abs(rel))
+	if err != nil {
+		return err
+	}
+	s.logger.Printf("Downloaded %s", rel)
+	return s.state.put(rel, &entry{
+		FileID:     e.ID,
+		RemoteName: e.Name,
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		Hash:       hash,
+	})
+}
+
+// push uploads new and changed local files and deletes remote files whose
+// local copies were deleted
+func (s *syncer) push(ctx context.Context) error {
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p != s.root && errors.Is(err, fs.ErrNotExist) {
+				return nil // Deleted during the scan
+			}
+			return err
+		}
+		if p == s.root {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel == stateDirName || s.filter.excluded(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || s.filter.excluded(rel) {
+			return nil
+		}
+		if len(rel) > maxNameLength {
+			s.logger.Printf("Skipping %s: path is longer than %d bytes", rel, maxNameLength)
+			return nil
+		}
+		seen[rel] = true
+		return s.pushFile(ctx, rel)
+	})
+	if err != nil {
+		// Without a complete scan, missing files cannot be told from
+		// unscanned ones, so nothing is deleted
+		return err
+	}
+
+	recorded, err := s.state.all()
+	if err != nil {
+		return err
+	}
+	for rel, rec := range recorded {
+		if seen[rel] {
+			continue
+		}
+		if s.filter.excluded(rel) {
+			// Deselected from sync: forget it but keep the remote file
+			if err := s.state.remove(rel); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.exists(rel) {
+			continue // Created during the scan
+		}
+		if err := s.remote.Delete(ctx, rec.FileID); err != nil {
+			return fmt.Errorf("deleting %s: %w", rel, err)
+		}
+		s.logger.Printf("Deleted remote %s", rel)
+		if err := s.state.remove(rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushFile uploads a local file if it is new or changed. A changed file is
+// uploaded as a new file that replaces the old one.
+func (s *syncer) pushFile(ctx context.Context, rel string) error {
+	info, err := os.Lstat(s.abs(rel))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rec, bound := s.state.get(rel)
+	if bound && info.Size() == rec.Size && info.ModTime().UnixNano() == rec.ModTime {
+		return nil
+	}
+	if s.now().Sub(info.ModTime()) < settleTime {
+		s.unsettled = true
+		return nil
+	}
+	if bound {
+		hash, err := hashFile(s.abs(rel))
+		if err != nil {
+			return err
+		}
+		if hash == rec.Hash {
+			// Touched but not changed
+			rec.Size, rec.ModTime = info.Size(), info.ModTime().UnixNano()
+			return s.state.put(rel, rec)
+		}
+	}
+
+	file, hash, err := s.upload(ctx, rel)
+	if err != nil {
+		return fmt.Errorf("uploading %s: %w", rel, err)
+	}
+	s.logger.Printf("Uploaded %s", rel)
+	// The size and time are from before the upload, so a file modified
+	// during it is uploaded again by the next scan
+	err = s.state.put(rel, &entry{
+		FileID:     file.ID,
+		RemoteName: file.Name,
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		Hash:       hash,
+	})
+	if err != nil {
+		return err
+	}
+	if bound {
+		if err := s.remote.Delete(ctx, rec.FileID); err != nil {
+			return fmt.Errorf("replacing %s: %w", rel, err)
+		}
+	}
+	return nil
+}
+
+// upload sends a local file and returns the hash of the contents sent
+func (s *syncer) upload(ctx context.Context, rel string) (*client.File, string, error) {
+	f, err := os.Open(s.abs(rel))
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	body := limitReader(ctx, io.TeeReader(f, h), s.limiter)
+	file, err := s.remote.Upload(ctx, rel, body)
+	if err != nil {
+		return nil, "", err
+	}
+	return file, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// download fetches a remote file into a temporary file and returns its
+// path and the hash of its contents
+func (s *syncer) download(ctx context.Context, fileID string) (string, string, error) {
+	f, err := os.CreateTemp(s.tmpDir, "download-*")
+	if err != nil {
+		return "", "", err
+	}
+	fail := func(err error) (string, string, error) {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", "", err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		return fail(err)
+	}
+
+	h := sha256.New()
+	if err := s.remote.Download(ctx, fileID, io.MultiWriter(f, h)); err != nil {
+		return fail(err)
+	}
+	if err := f.Close(); err != nil {
+		return fail(err)
+	}
+	return f.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// localStatus compares a local file with its recorded entry, which may be
+// nil
+func (s *syncer) localStatus(rel string, rec *entry) (fileStatus, error) {
+	info, err := os.Lstat(s.abs(rel))
+	if errors.Is(err, fs.ErrNotExist) {
+		return statusMissing, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if rec == nil || !info.Mode().IsRegular() {
+		return statusChanged, nil
+	}
+	if info.Size() == rec.Size && info.ModTime().UnixNano() == rec.ModTime {
+		return statusUnchanged, nil
+	}
+	hash, err := hashFile(s.abs(rel))
+	if err != nil {
+		return 0, err
+	}
+	if hash == rec.Hash {
+		return statusUnchanged, nil
+	}
+	return statusChanged, nil
+}
+
+// conflictPath returns a free name for a conflicted copy of rel, e.g.
+// "notes (laptop's conflicted copy 2024-05-01).txt"
+func (s *syncer) conflictPath(rel string) string {
+	ext := path.Ext(rel)
+	base := strings.TrimSuffix(rel, ext)
+	if base == "" || strings.HasSuffix(base, "/") {
+		base, ext = rel, "" // A dotfile such as ".env"
+	}
+	date := s.now().Format("2006-01-02")
+	for i := 1; ; i++ {
+		suffix := fmt.Sprintf(" (%s's conflicted copy %s)", s.host, date)
+		if i > 1 {
+			suffix = fmt.Sprintf(" (%s's conflicted copy %s %d)", s.host, date, i)
+		}
+		candidate := base + suffix + ext
+		if _, bound := s.state.get(candidate); !bound && !s.exists(candidate) {
+			return candidate
+		}
+	}
+}
+
+// move renames a local file, creating the target's directory
+func (s *syncer) move(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(s.abs(to)), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(s.abs(from), s.abs(to)); err != nil {
+		return err
+	}
+	s.removeEmptyDirs(from)
+	return nil
+}
+
+// removeLocal deletes a local file and any directories it leaves empty
+func (s *syncer) removeLocal(rel string) error {
+	if err := os.Remove(s.abs(rel)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	s.removeEmptyDirs(rel)
+	return nil
+}
+
+func (s *syncer) removeEmptyDirs(rel string) {
+	for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if os.Remove(s.abs(dir)) != nil {
+			return // Not empty
+		}
+	}
+}
+
+func (s *syncer) exists(rel string) bool {
+	_, err := os.Lstat(s.abs(rel))
+	return err == nil
+}
+
+func (s *syncer) abs(rel string) string {
+	return filepath.Join(s.root, filepath.FromSlash(rel))
+}
+
+// localPath validates a remote file name as a path inside the sync root
+func localPath(name string) (string, bool) {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") || strings.ContainsRune(name, 0) {
+		return "", false
+	}
+	clean := path.Clean(name)
+	if clean != name || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	if clean == stateDirName || strings.HasPrefix(clean, stateDirName+"/") {
+		return "", false
+	}
+	return clean, true
+}
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/pkg/client"
+)
+
+// fakeRemote is an in-memory group whose cursor is a journal position
+type fakeRemote struct {
+	mu      sync.Mutex
+	files   map[string]*client.File
+	data    map[string][]byte
+	journal []client.DeltaEntry
+}
+
+func newFakeRemote() *fakeRemote {
+	return &fakeRemote{files: make(map[string]*client.File), data: make(map[string][]byte)}
+}
+
+func (r *fakeRemote) Delta(_ context.Context, cursor string) (*client.DeltaPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	page := &client.DeltaPage{Cursor: strconv.Itoa(len(r.journal))}
+	if cursor == "" {
+		for _, f := range r.files {
+			page.Entries = append(page.Entries, client.DeltaEntry{Tag: client.TagAdded, ID: f.ID, Name: f.Name})
+		}
+		return page, nil
+	}
+	pos, err := strconv.Atoi(cursor)
+	if err != nil || pos > len(r.journal) {
+		return nil, &client.APIError{StatusCode: http.StatusGone, Message: "cursor reset", Err: client.ErrCursorReset}
+	}
+	page.Entries = append(page.Entries, r.journal[pos:]...)
+	return page, nil
+}
+
+func (r *fakeRemote) Wait(_ context.Context, cursor string, _ time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pos, _ := strconv.Atoi(cursor)
+	return len(r.journal) > pos, nil
+}
+
+func (r *fakeRemote) Upload(_ context.Context, name string, body io.Reader) (*client.File, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := &client.File{ID: uuid.NewString(), Name: name, SizeBytes: int64(len(data))}
+	r.files[f.ID] = f
+	r.data[f.ID] = data
+	r.journal = append(r.journal, client.DeltaEntry{Tag: client.TagAdded, ID: f.ID, Name: name})
+	return f, nil
+}
+
+func (r *fakeRemote) Download(_ context.Context, fileID string, w io.Writer) error {
+	r.mu.Lock()
+	data, ok := r.data[fileID]
+	r.mu.Unlock()
+	if !ok {
+		return &client.APIError{StatusCode: http.StatusNotFound, Message: "File not found", Err: client.ErrFileNotFound}
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func (r *fakeRemote) Delete(_ context.Context, fileID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.files[fileID]
+	if !ok {
+		return nil
+	}
+	delete(r.files, fileID)
+	delete(r.data, fileID)
+	r.journal = append(r.journal, client.DeltaEntry{Tag: client.TagDeleted, ID: fileID, Name: f.Name})
+	return nil
+}
+
+func (r *fakeRemote) rename(fileID, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files[fileID].Name = name
+	r.journal = append(r.journal, client.DeltaEntry{Tag: client.TagModified, ID: fileID, Name: name})
+}
+
+func (r *fakeRemote) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for _, f := range r.files {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newTestSyncer(t *testing.T, r remote, excludes ...string) *syncer {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, stateDirName), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	st, err := openState(filepath.Join(root, stateDirName, "state.db"), "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	f, err := newFilter(excludes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newSyncer(root, r, st, f, nil, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.host = "test"
+	// Files written by the test have settled as far as the syncer knows
+	s.now = func() time.Time { return time.Now().Add(time.Hour) }
+	return s
+}
+
+func syncAll(t *testing.T, syncers ...*syncer) {
+	t.Helper()
+	for _, s := range syncers {
+		if err := s.sync(context.Background()); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+}
+
+func writeFile(t *testing.T, s *syncer, rel, content string) {
+	t.Helper()
+	p := s.abs(rel)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// localFiles returns the synced folder's files and their contents
+func localFiles(t *testing.T, s *syncer) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(s.root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == stateDirName {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(s.root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func assertFiles(t *testing.T, s *syncer, want map[string]string) {
+	t.Helper()
+	got := localFiles(t, s)
+	if len(got) != len(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Fatalf("files = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSyncPropagatesChanges(t *testing.T) {
+	r := newFakeRemote()
+	a, b := newTestSyncer(t, r), newTestSyncer(t, r)
+
+	writeFile(t, a, "notes.txt", "hello")
+	writeFile(t, a, "docs/plan.md", "plan")
+	syncAll(t, a, b)
+	assertFiles(t, b, map[string]string{"notes.txt": "hello", "docs/plan.md": "plan"})
+
+	// Modified and deleted in b
+	writeFile(t, b, "notes.txt", "hello again")
+	if err := os.Remove(b.abs("docs/plan.md")); err != nil {
+		t.Fatal(err)
+	}
+	syncAll(t, b, a)
+	assertFiles(t, a, map[string]string{"notes.txt": "hello again"})
+	if _, err := os.Stat(a.abs("docs")); !os.IsNotExist(err) {
+		t.Error("empty directory left behind after remote delete")
+	}
+	if names := r.names(); len(names) != 1 || names[0] != "notes.txt" {
+		t.Errorf("remote files = %v, want [notes.txt]", names)
+	}
+
+	// A second pass changes nothing
+	journal := len(r.journal)
+	syncAll(t, a, b)
+	if len(r.journal) != journal {
+		t.Errorf("idle sync made %d remote changes", len(r.journal)-journal)
+	}
+}
+
+func TestSyncRemoteRename(t *testing.T) {
+	r := newFakeRemote()
+	a := newTestSyncer(t, r)
+	f, _ := r.Upload(context.Background(), "old.txt", strings.NewReader("data"))
+	syncAll(t, a)
+
+	r.rename(f.ID, "dir/new.txt")
+	syncAll(t, a)
+	assertFiles(t, a, map[string]string{"dir/new.txt": "data"})
+	if names := r.names(); len(names) != 1 || names[0] != "dir/new.txt" {
+		t.Errorf("remote files = %v, want [dir/new.txt]", names)
+	}
+}
+
+func TestSyncConflictKeepsBothVersions(t *testing.T) {
+	r := newFakeRemote()
+	a, b := newTestSyncer(t, r), newTestSyncer(t, r)
+	writeFile(t, a, "report.txt", "v1")
+	syncAll(t, a, b)
+
+	writeFile(t, a, "report.txt", "from a")
+	writeFile(t, b, "report.txt", "from b!")
+	syncAll(t, a, b, a)
+
+	conflict := "report (test's conflicted copy " + b.now().Format("2006-01-02") + ").txt"
+	want := map[string]string{"report.txt": "from a", conflict: "from b!"}
+	assertFiles(t, a, want)
+	assertFiles(t, b, want)
+}
+
+func TestSyncEditWinsOverRemoteDelete(t *testing.T) {
+	r := newFakeRemote()
+	a, b := newTestSyncer(t, r), newTestSyncer(t, r)
+	writeFile(t, a, "keep.txt", "v1")
+	syncAll(t, a, b)
+
+	if err := os.Remove(a.abs("keep.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, b, "keep.txt", "edited")
+	syncAll(t, a, b, a)
+
+	assertFiles(t, a, map[string]string{"keep.txt": "edited"})
+	assertFiles(t, b, map[string]string{"keep.txt": "edited"})
+}
+
+func TestSyncExcludes(t *testing.T) {
+	r := newFakeRemote()
+	a := newTestSyncer(t, r, "*.tmp", "build/cache")
+	writeFile(t, a, "a.txt", "a")
+	writeFile(t, a, "scratch.tmp", "x")
+	writeFile(t, a, "build/cache/obj", "x")
+	writeFile(t, a, "build/out", "x")
+	_, _ = r.Upload(context.Background(), "remote.tmp", strings.NewReader("x"))
+	syncAll(t, a)
+
+	if names := r.names(); strings.Join(names, ",") != "a.txt,build/out,remote.tmp" {
+		t.Errorf("remote files = %v", names)
+	}
+	if _, err := os.Stat(a.abs("remote.tmp")); !os.IsNotExist(err) {
+		t.Error("excluded remote file was downloaded")
+	}
+}
+
+func TestSyncRelistsAfterCursorReset(t *testing.T) {
+	r := newFakeRemote()
+	a := newTestSyncer(t, r)
+	keep, _ := r.Upload(context.Background(), "keep.txt", strings.NewReader("k"))
+	gone, _ := r.Upload(context.Background(), "gone.txt", strings.NewReader("g"))
+	syncAll(t, a)
+
+	// Lose the journal: the cursor is now ahead of it
+	_ = r.Delete(context.Background(), gone.ID)
+	r.journal = nil
+	syncAll(t, a)
+	assertFiles(t, a, map[string]string{"keep.txt": "k"})
+	if _, ok := a.state.pathForID(keep.ID); !ok {
+		t.Error("kept file lost its state entry")
+	}
+}
+
+func TestFilterExcluded(t *testing.T) {
+	f, err := newFilter([]string{"*.tmp", "node_modules", "/archive/2019/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"a.tmp":                 true,
+		"dir/b.tmp":             true,
+		"src/node_modules/x.js": true,
+		"archive/2019/q1.pdf":   true,
+		"archive/2020/q1.pdf":   false,
+		"other/archive/2019/a":  false,
+		"notes.txt":             false,
+		"node_modules_backup/a": false,
+		"tmp/readme":            false,
+	}
+	for rel, want := range tests {
+		if got := f.excluded(rel); got != want {
+			t.Errorf("excluded(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	valid := []string{"a.txt", "dir/a.txt", ".env"}
+	invalid := []string{"", "/etc/passwd", "../x", "a/../../x", "a//b", `a\b`, ".dbx-sync/state.db", "."}
+	for _, name := range valid {
+		if _, ok := localPath(name); !ok {
+			t.Errorf("localPath(%q) rejected", name)
+		}
+	}
+	for _, name := range invalid {
+		if _, ok := localPath(name); ok {
+			t.Errorf("localPath(%q) accepted", name)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]int64{"": 0, "100": 100, "512K": 512 << 10, "2m": 2 << 20}
+	for in, want := range tests {
+		if got, err := parseRate(in); err != nil || got != want {
+			t.Errorf("parseRate(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := parseRate("fast"); err == nil {
+		t.Error("parseRate(\"fast\") succeeded")
+	}
+}
+
+func TestLimitReader(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 3*uploadBurst)
+	got, err := io.ReadAll(limitReader(context.Background(), bytes.NewReader(data), newLimiter(1<<30)))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("limited read = %d bytes, %v", len(got), err)
+	}
+}
+
+func TestRunSyncsWatchedChanges(t *testing.T) {
+	r := newFakeRemote()
+	a := newTestSyncer(t, r)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- a.run(ctx, time.Hour) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("run: %v", err)
+		}
+	}()
+
+	// Let the initial sync finish so the change is picked up by the watcher
+	time.Sleep(200 * time.Millisecond)
+	writeFile(t, a, "sub/watched.txt", "data")
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if names := r.names(); len(names) == 1 && names[0] == "sub/watched.txt" {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("remote files = %v, want [sub/watched.txt]", r.names())
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/testifysec/dropbox-clone/pkg/client"
+)
+
+const (
+	// debounce is how long after a change notification the sync runs, so
+	// bursts of changes are handled together
+	debounce = time.Second
+
+	// longpollTimeout is how long each wait for remote changes lasts
+	longpollTimeout = 60 * time.Second
+
+	maxRetryDelay = 5 * time.Minute
+)
+
+// run syncs until ctx is cancelled: after local changes reported by the
+// file watcher, remote changes reported by a long poll, and every
+// scanInterval to catch anything the watcher missed
+func (s *syncer) run(ctx context.Context, scanInterval time.Duration) error {
+	remoteChanged := make(chan struct{}, 1)
+	synced := make(chan struct{}, 1)
+	go s.watchRemote(ctx, remoteChanged, synced)
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		s.logger.Printf("File watching unavailable, relying on periodic scans: %v", err)
+	} else {
+		defer func() { _ = watcher.Close() }()
+		s.watchTree(watcher, s.root)
+		events, watchErrors = watcher.Events, watcher.Errors
+	}
+
+	ticker := time.NewTicker(scanInterval)
+	defer ticker.Stop()
+
+	// The timer fires when a sync is due; armed means one is scheduled
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	armed := true
+	schedule := func(d time.Duration) {
+		if !armed {
+			timer.Reset(d)
+			armed = true
+		}
+	}
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-timer.C:
+			armed = false
+			if err := s.sync(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				failures++
+				delay := min(time.Duration(1<<min(failures, 10))*time.Second, maxRetryDelay)
+				s.logger.Printf("Sync failed, retrying in %s: %v", delay, err)
+				schedule(delay)
+				continue
+			}
+			failures = 0
+			select {
+			case synced <- struct{}{}:
+			default:
+			}
+			if s.unsettled {
+				schedule(settleTime)
+			}
+
+		case <-ticker.C:
+			schedule(0)
+
+		case <-remoteChanged:
+			schedule(0)
+
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if s.ignored(ev.Name) {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Lstat(ev.Name); err == nil && info.IsDir() {
+					s.watchTree(watcher, ev.Name)
+				}
+			}
+			schedule(debounce)
+
+		case err, ok := <-watchErrors:
+			if !ok {
+				watchErrors = nil
+				continue
+			}
+			// Usually an event queue overflow; rescan to catch up
+			s.logger.Printf("File watcher error: %v", err)
+			schedule(0)
+		}
+	}
+}
+
+// watchTree adds watches for dir and every directory beneath it
+func (s *syncer) watchTree(watcher *fsnotify.Watcher, dir string) {
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if s.ignored(p) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(p); err != nil {
+			s.logger.Printf("Cannot watch %s, relying on periodic scans: %v", p, err)
+		}
+		return nil
+	})
+}
+
+// ignored reports whether changes to a local path are irrelevant to sync
+func (s *syncer) ignored(p string) bool {
+	rel, err := filepath.Rel(s.root, p)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	return rel == stateDirName || strings.HasPrefix(rel, stateDirName+"/") || s.filter.excluded(rel)
+}
+
+// watchRemote long-polls for remote changes after the saved cursor and
+// signals changed when there are some. It then waits for the sync to
+// advance the cursor, or a while if it fails, before polling again.
+func (s *syncer) watchRemote(ctx context.Context, changed chan<- struct{}, synced <-chan struct{}) {
+	wait := func(d time.Duration) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-synced:
+		case <-time.After(d):
+		}
+		return true
+	}
+
+	for ctx.Err() == nil {
+		cursor := s.state.cursor()
+		if cursor == "" {
+			if !wait(time.Second) {
+				return
+			}
+			continue
+		}
+
+		found, err := s.remote.Wait(ctx, cursor, longpollTimeout)
+		if err != nil && !errors.Is(err, client.ErrCursorReset) {
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Printf("Waiting for remote changes failed: %v", err)
+			if !wait(10 * time.Second) {
+				return
+			}
+			continue
+		}
+		if found || err != nil {
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+			if !wait(30 * time.Second) {
+				return
+			}
+		}
+	}
+}
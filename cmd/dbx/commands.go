@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/term"
+
+	"github.com/testifysec/dropbox-clone/pkg/client"
+)
+
+func runLogin(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("login")
+	email := fs.String("email", a.creds.Email, "account email")
+	if args, err := a.parse(fs, args); err != nil {
+		return err
+	} else if len(args) != 0 {
+		return errUsage
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	if *email == "" {
+		fmt.Fprint(os.Stderr, "Email: ")
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("reading email: %w", err)
+		}
+		*email = strings.TrimSpace(line)
+	}
+	password, err := readPassword(stdin)
+	if err != nil {
+		return fmt.Errorf("reading password: %w", err)
+	}
+
+	a.creds.Email = *email
+	resp, err := a.client.Login(ctx, *email, password)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return printJSON(resp.User)
+	}
+	fmt.Printf("Logged in to %s as %s\n", a.server, resp.User.Email)
+	return nil
+}
+
+// readPassword prompts for a password without echo on a terminal, or
+// reads a line from stdin so it can be piped in scripts
+func readPassword(stdin *bufio.Reader) (string, error) {
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func runLogout(_ context.Context, a *app, args []string) error {
+	if args, err := a.parse(a.flags("logout"), args); err != nil {
+		return err
+	} else if len(args) != 0 {
+		return errUsage
+	}
+	return client.RemoveCredentials(a.credsPath)
+}
+
+func runGroups(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flags("groups"), args)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(args) == 1 && args[0] == "ls":
+		groups, err := a.client.ListGroups(ctx)
+		if err != nil {
+			return err
+		}
+		return a.printGroups(groups)
+	case len(args) == 2 && args[0] == "create":
+		group, err := a.client.CreateGroup(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		return a.printGroups([]client.Group{*group})
+	default:
+		return errUsage
+	}
+}
+
+func runMembers(ctx context.Context, a *app, args []string) error {
+	fs := a.flags("members")
+	role := fs.String("role", "member", "role for added members: admin or member")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 3 {
+		return errUsage
+	}
+
+	groupID, err := a.resolveGroup(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "add":
+		membership, err := a.client.AddMember(ctx, groupID, args[2], *role)
+		if err != nil {
+			return err
+		}
+		if a.json {
+			return printJSON(membership)
+		}
+		return printTable([]string{"USER", "GROUP", "ROLE", "JOINED"},
+			[][]string{{membership.UserID, membership.GroupID, membership.Role, membership.JoinedAt}})
+	case "rm":
+		return a.client.RemoveMember(ctx, groupID, args[2])
+	default:
+		return errUsage
+	}
+}
+
+func runList(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flags("ls"), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	groupID, err := a.resolveGroup(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	files, err := a.client.ListFiles(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	return a.printFiles(files)
+}
+
+func runPut(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flags("put"), args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	paths, err := expandPaths(args[1:])
+	if err != nil {
+		return err
+	}
+	groupID, err := a.resolveGroup(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	uploaded := make([]client.File, 0, len(paths))
+	for _, path := range paths {
+		file, err := a.upload(ctx, groupID, path)
+		if err != nil {
+			return fmt.Errorf("uploading %s: %w", path, err)
+		}
+		uploaded = append(uploaded, *file)
+	}
+	return a.printFiles(uploaded)
+}
+
+func (a *app) upload(ctx context.Context, groupID, path string) (*client.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(path)
+	p := newProgress(name, info.Size(), a.progress)
+	file, err := a.client.Upload(ctx, groupID, name, p.reader(f))
+	p.finish()
+	return file, err
+}
+
+// expandPaths expands glob patterns to regular files. A pattern that
+// matches nothing is an error, as is naming a directory.
+func expandPaths(patterns []string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no such file", pattern)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				// Directories matched by a wildcard are skipped; naming one
+				// directly is a mistake worth reporting
+				if match == pattern {
+					return nil, fmt.Errorf("%s is a directory", match)
+				}
+				continue
+			}
+			paths = append(paths, match)
+		}
+	}
+	return paths, nil
+}
+
+func runGet(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flags("get"), args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return errUsage
+	}
+
+	groupID, err := a.resolveGroup(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	file, err := a.resolveFile(ctx, groupID, args[1])
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Base(file.Name)
+	if len(args) == 3 {
+		dest = args[2]
+	}
+	if dest == "-" {
+		_, err := a.client.Download(ctx, groupID, file.ID, os.Stdout)
+		return err
+	}
+	if info, err := os.Stat(dest); err == nil && info.IsDir() {
+		dest = filepath.Join(dest, filepath.Base(file.Name))
+	}
+
+	n, err := a.download(ctx, groupID, file, dest)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return printJSON(map[string]interface{}{"path": dest, "size_bytes": n})
+	}
+	fmt.Printf("Downloaded %s (%s)\n", dest, formatBytes(n))
+	return nil
+}
+
+// download writes the file to a temporary file next to dest and renames it
+// into place, so an interrupted download never leaves a partial file
+func (a *app) download(ctx context.Context, groupID string, file *client.File, dest string) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".dbx-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	// CreateTemp makes the file private; give it the usual permissions
+	if err := tmp.Chmod(0o644); err != nil {
+		_ = tmp.Close()
+		return 0, err
+	}
+
+	p := newProgress(file.Name, file.SizeBytes, a.progress)
+	n, err := a.client.Download(ctx, groupID, file.ID, p.writer(tmp))
+	p.finish()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), dest)
+}
+
+func runRemove(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flags("rm"), args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	groupID, err := a.resolveGroup(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	for _, ref := range args[1:] {
+		file, err := a.resolveFile(ctx, groupID, ref)
+		if err != nil {
+			return err
+		}
+		if err := a.client.DeleteFile(ctx, groupID, file.ID); err != nil {
+			return fmt.Errorf("deleting %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+func runShare(ctx context.Context, a *app, args []string) error {
+	args, err := a.parse(a.flags("share"), args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	groupID, err := a.resolveGroup(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	file, err := a.resolveFile(ctx, groupID, args[1])
+	if err != nil {
+		return err
+	}
+	link, err := a.client.ShareFile(ctx, groupID, file.ID)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return printJSON(link)
+	}
+	fmt.Println(link.URL)
+	return nil
+}
+
+// resolveGroup returns the ID of the group named by ref, which is either
+// an ID or a group name
+func (a *app) resolveGroup(ctx context.Context, ref string) (string, error) {
+	if _, err := uuid.Parse(ref); err == nil {
+		return ref, nil
+	}
+	groups, err := a.client.ListGroups(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var match *client.Group
+	for i := range groups {
+		if groups[i].Name != ref {
+			continue
+		}
+		if match != nil {
+			return "", fmt.Errorf("several groups are named %q; use the group ID", ref)
+		}
+		match = &groups[i]
+	}
+	if match == nil {
+		return "", fmt.Errorf("group %q not found", ref)
+	}
+	return match.ID, nil
+}
+
+// resolveFile returns the file named by ref, which is either an ID or a
+// file name
+func (a *app) resolveFile(ctx context.Context, groupID, ref string) (*client.File, error) {
+	files, err := a.client.ListFiles(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var match *client.File
+	for i := range files {
+		if files[i].ID == ref {
+			return &files[i], nil
+		}
+		if files[i].Name != ref {
+			continue
+		}
+		if match != nil {
+			return nil, fmt.Errorf("several files are named %q; use the file ID", ref)
+		}
+		match = &files[i]
+	}
+	if match == nil {
+		return nil, fmt.Errorf("file %q not found", ref)
+	}
+	return match, nil
+}
+
+func (a *app) printGroups(groups []client.Group) error {
+	if a.json {
+		return printJSON(groups)
+	}
+	rows := make([][]string, 0, len(groups))
+	for _, g := range groups {
+		rows = append(rows, []string{g.ID, g.Name, g.CreatedAt})
+	}
+	return printTable([]string{"ID", "NAME", "CREATED"}, rows)
+}
+
+func (a *app) printFiles(files []client.File) error {
+	if a.json {
+		return printJSON(files)
+	}
+	rows := make([][]string, 0, len(files))
+	for _, f := range files {
+		rows = append(rows, []string{f.ID, f.Name, formatBytes(f.SizeBytes), f.CreatedAt})
+	}
+	return printTable([]string{"ID", "NAME", "SIZE", "CREATED"}, rows)
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testifysec/dropbox-clone/pkg/client"
+)
+
+const testGroupID = "6f1c7a2e-3b4d-4e5f-8a9b-0c1d2e3f4a5b"
+
+// fakeServer is an in-memory API serving one user and one group, "team"
+type fakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	access   string // The only access token accepted
+	issued   int
+	logins   int
+	auths    []string // Authorization headers of authenticated requests
+	files    []client.File
+	contents map[string]string
+	broken   map[string]bool // Files whose download is cut short
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	s := &fakeServer{contents: make(map[string]string), broken: make(map[string]bool)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/auth/login", s.login)
+	mux.HandleFunc("POST /api/v1/auth/refresh", s.refresh)
+	mux.HandleFunc("GET /api/v1/groups", s.authed(s.listGroups))
+	mux.HandleFunc("GET /api/v1/groups/{id}/files", s.authed(s.listFiles))
+	mux.HandleFunc("POST /api/v1/groups/{id}/files", s.authed(s.upload))
+	mux.HandleFunc("GET /api/v1/groups/{id}/files/{fileID}", s.authed(s.download))
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func respond(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func respondErr(w http.ResponseWriter, status int, message string) {
+	respond(w, status, map[string]string{"error": message})
+}
+
+// issue returns a new token pair, invalidating the previous access token
+func (s *fakeServer) issue() client.AuthResponse {
+	s.issued++
+	s.access = fmt.Sprintf("access-%d", s.issued)
+	return client.AuthResponse{
+		User:         &client.User{ID: "u1", Email: "a@example.com"},
+		AccessToken:  s.access,
+		RefreshToken: "refresh-" + s.access,
+		ExpiresAt:    time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	}
+}
+
+// revoke invalidates the current access token but not its refresh token
+func (s *fakeServer) revoke() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.access += "-revoked"
+}
+
+func (s *fakeServer) login(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	if body["email"] != "a@example.com" || body["password"] != "secret" {
+		respondErr(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logins++
+	respond(w, http.StatusOK, s.issue())
+}
+
+func (s *fakeServer) refresh(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if body["refresh_token"] != "refresh-"+strings.TrimSuffix(s.access, "-revoked") {
+		respondErr(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	respond(w, http.StatusOK, s.issue())
+}
+
+func (s *fakeServer) authed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		s.mu.Lock()
+		s.auths = append(s.auths, header)
+		ok := header == "Bearer "+s.access
+		s.mu.Unlock()
+		if !ok {
+			respondErr(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *fakeServer) listGroups(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, []client.Group{{ID: testGroupID, Name: "team"}})
+}
+
+func (s *fakeServer) listFiles(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	respond(w, http.StatusOK, s.files)
+}
+
+func (s *fakeServer) upload(w http.ResponseWriter, r *http.Request) {
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		respondErr(w, http.StatusBadRequest, "File is required")
+		return
+	}
+	data, _ := io.ReadAll(f)
+	respond(w, http.StatusCreated, s.add(r.FormValue("name"), string(data)))
+}
+
+func (s *fakeServer) add(name, content string) client.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file := client.File{
+		ID:        fmt.Sprintf("f%d", len(s.files)+1),
+		Name:      name,
+		SizeBytes: int64(len(content)),
+		GroupID:   testGroupID,
+	}
+	s.files = append(s.files, file)
+	s.contents[file.ID] = content
+	return file
+}
+
+func (s *fakeServer) download(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	content, ok := s.contents[r.PathValue("fileID")]
+	broken := s.broken[r.PathValue("fileID")]
+	s.mu.Unlock()
+	if !ok {
+		respondErr(w, http.StatusNotFound, "File not found")
+		return
+	}
+	if broken {
+		// Promise more than is sent so the client sees the connection drop
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)+100))
+	}
+	_, _ = io.WriteString(w, content)
+}
+
+func (s *fakeServer) fileNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.files))
+	for _, f := range s.files {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newTestApp returns an app for server using the credentials cached in
+// the test's config directory, as main does
+func newTestApp(t *testing.T, server string) *app {
+	t.Helper()
+	a := &app{serverFlag: server}
+	if err := a.init(); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	return a
+}
+
+// setup isolates the test's config directory and silences the commands'
+// output
+func setup(t *testing.T) {
+	t.Helper()
+	t.Setenv("DBX_CONFIG_DIR", t.TempDir())
+	t.Setenv("DBX_SERVER", "")
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		_ = devNull.Close()
+	})
+}
+
+// setStdin feeds input to the commands' standard input
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, input); err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = r.Close()
+	})
+}
+
+// login logs a in to the fake server
+func login(t *testing.T, a *app) {
+	t.Helper()
+	setStdin(t, "secret\n")
+	if err := runLogin(context.Background(), a, []string{"--email", "a@example.com"}); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+}
+
+func TestLoginCachesToken(t *testing.T) {
+	setup(t)
+	srv := newFakeServer(t)
+	ctx := context.Background()
+
+	a := newTestApp(t, srv.URL)
+	setStdin(t, "wrong\n")
+	if err := runLogin(ctx, a, []string{"--email", "a@example.com"}); !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("login with wrong password error = %v, want ErrUnauthorized", err)
+	}
+	if _, err := os.Stat(a.credsPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("failed login saved credentials: %v", err)
+	}
+
+	login(t, a)
+	creds, err := client.LoadCredentials(a.credsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Server != srv.URL || creds.Email != "a@example.com" || creds.Token == nil || creds.Token.AccessToken != "access-1" {
+		t.Fatalf("saved credentials = %+v", creds)
+	}
+
+	// A later run reuses the cached token without logging in again
+	if err := runGroups(ctx, newTestApp(t, srv.URL), []string{"ls"}); err != nil {
+		t.Fatalf("groups ls: %v", err)
+	}
+	if srv.logins != 1 || srv.auths[len(srv.auths)-1] != "Bearer access-1" {
+		t.Errorf("logins = %d, auths = %v; want the cached token reused", srv.logins, srv.auths)
+	}
+
+	// The token is never sent to another server
+	other := newFakeServer(t)
+	if err := runGroups(ctx, newTestApp(t, other.URL), []string{"ls"}); !errors.Is(err, client.ErrNotLoggedIn) {
+		t.Errorf("groups ls on another server error = %v, want ErrNotLoggedIn", err)
+	}
+	if len(other.auths) != 0 {
+		t.Errorf("other server received %v", other.auths)
+	}
+
+	if err := runLogout(ctx, newTestApp(t, srv.URL), nil); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if err := runGroups(ctx, newTestApp(t, srv.URL), []string{"ls"}); !errors.Is(err, client.ErrNotLoggedIn) {
+		t.Errorf("groups ls after logout error = %v, want ErrNotLoggedIn", err)
+	}
+}
+
+func TestRefreshSavesToken(t *testing.T) {
+	setup(t)
+	srv := newFakeServer(t)
+	ctx := context.Background()
+	login(t, newTestApp(t, srv.URL))
+
+	srv.revoke()
+	if err := runGroups(ctx, newTestApp(t, srv.URL), []string{"ls"}); err != nil {
+		t.Fatalf("groups ls with a rejected token: %v", err)
+	}
+	a := newTestApp(t, srv.URL)
+	if a.creds.Token == nil || a.creds.Token.AccessToken != "access-2" {
+		t.Fatalf("cached token = %+v, want the refreshed one", a.creds.Token)
+	}
+
+	// The refreshed token is used from then on
+	if err := runGroups(ctx, a, []string{"ls"}); err != nil {
+		t.Fatalf("groups ls: %v", err)
+	}
+	if srv.issued != 2 || srv.auths[len(srv.auths)-1] != "Bearer access-2" {
+		t.Errorf("issued = %d, auths = %v", srv.issued, srv.auths)
+	}
+}
+
+func TestPutExpandsGlobs(t *testing.T) {
+	setup(t)
+	srv := newFakeServer(t)
+	a := newTestApp(t, srv.URL)
+	login(t, a)
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "d.txt"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runPut(context.Background(), a, []string{"team", filepath.Join(dir, "*.txt")}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if names := srv.fileNames(); strings.Join(names, ",") != "a.txt,b.txt" {
+		t.Errorf("uploaded %v, want a.txt and b.txt", names)
+	}
+	if got := srv.contents["f1"] + srv.contents["f2"]; got != "a.txtb.txt" && got != "b.txta.txt" {
+		t.Errorf("uploaded contents %q", got)
+	}
+}
+
+func TestExpandPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := expandPaths([]string{filepath.Join(dir, "*"), filepath.Join(dir, "a.txt")})
+	if err != nil {
+		t.Fatalf("expandPaths: %v", err)
+	}
+	want := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "a.txt")}
+	if strings.Join(paths, "\n") != strings.Join(want, "\n") {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+
+	for _, tc := range []struct {
+		pattern string
+		want    string
+	}{
+		{filepath.Join(dir, "*.log"), "no such file"},
+		{filepath.Join(dir, "missing.txt"), "no such file"},
+		{sub, "is a directory"},
+		{filepath.Join(dir, "["), "invalid pattern"},
+	} {
+		if _, err := expandPaths([]string{tc.pattern}); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("expandPaths(%q) error = %v, want %q", tc.pattern, err, tc.want)
+		}
+	}
+}
+
+func TestGetRenamesIntoPlace(t *testing.T) {
+	setup(t)
+	srv := newFakeServer(t)
+	a := newTestApp(t, srv.URL)
+	login(t, a)
+	ctx := context.Background()
+
+	srv.add("report.txt", "hello")
+	dir := t.TempDir()
+	if err := runGet(ctx, a, []string{"team", "report.txt", dir}); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "report.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("downloaded %q, %v", data, err)
+	}
+	info, _ := os.Stat(filepath.Join(dir, "report.txt"))
+	if perm := info.Mode().Perm(); perm != 0o644 {
+		t.Errorf("downloaded file mode = %v, want 0644", perm)
+	}
+
+	// A download cut short leaves neither the file nor its temporary copy
+	broken := srv.add("broken.bin", "partial")
+	srv.mu.Lock()
+	srv.broken[broken.ID] = true
+	srv.mu.Unlock()
+	dest := filepath.Join(dir, "broken.bin")
+	if err := runGet(ctx, a, []string{"team", "broken.bin", dest}); err == nil {
+		t.Fatal("get of a truncated download succeeded")
+	}
+	if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("truncated download left %s: %v", dest, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "report.txt" {
+			t.Errorf("unexpected file %s left in %s", entry.Name(), dir)
+		}
+	}
+}
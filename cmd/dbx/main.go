@@ -0,0 +1,181 @@
+// Command dbx is a command-line client for the dropbox-clone API.
+//
+// Log in once with "dbx login"; the tokens are cached in the user's config
+// directory and refreshed automatically. Groups and files may be named by
+// ID or by name. Every command prints a table, or JSON with --json.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/testifysec/dropbox-clone/pkg/client"
+)
+
+const defaultServer = "http://localhost:8080"
+
+// command is a dbx subcommand
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, a *app, args []string) error
+}
+
+var commands = map[string]command{
+	"login":   {"login [--email EMAIL]", "Log in and cache credentials", runLogin},
+	"logout":  {"logout", "Forget cached credentials", runLogout},
+	"groups":  {"groups ls | groups create NAME", "List or create groups", runGroups},
+	"members": {"members add GROUP USER_ID [--role ROLE] | members rm GROUP USER_ID", "Add or remove group members", runMembers},
+	"ls":      {"ls GROUP", "List files in a group", runList},
+	"put":     {"put GROUP PATH...", "Upload files; paths may be glob patterns", runPut},
+	"get":     {"get GROUP FILE [DEST]", "Download a file; DEST may be a directory or - for stdout", runGet},
+	"rm":      {"rm GROUP FILE...", "Delete files", runRemove},
+	"share":   {"share GROUP FILE", "Create a temporary download link", runShare},
+}
+
+// errUsage reports invalid arguments; the command's usage is printed
+var errUsage = errors.New("invalid usage")
+
+// app is the state shared by all commands
+type app struct {
+	server     string
+	serverFlag string
+	json       bool
+	progress   bool
+	credsPath  string
+	creds      *client.Credentials
+	client     *client.Client
+}
+
+func main() {
+	a := &app{}
+	global := flag.NewFlagSet("dbx", flag.ContinueOnError)
+	global.StringVar(&a.serverFlag, "server", "", "API server URL (default $DBX_SERVER or the server logged in to)")
+	global.BoolVar(&a.json, "json", false, "print JSON instead of tables")
+	global.Usage = usage
+	if err := global.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+	if global.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := global.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "dbx: unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	if err := a.init(); err != nil {
+		fmt.Fprintf(os.Stderr, "dbx: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := cmd.run(ctx, a, global.Args()[1:])
+	stop()
+
+	switch {
+	case errors.Is(err, errUsage), errors.Is(err, flag.ErrHelp):
+		fmt.Fprintf(os.Stderr, "usage: dbx %s\n", cmd.usage)
+		os.Exit(2)
+	case errors.Is(err, client.ErrNotLoggedIn):
+		fmt.Fprintln(os.Stderr, "dbx: not logged in; run \"dbx login\"")
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "dbx: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dbx [--server URL] [--json] COMMAND [ARGS]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].help)
+	}
+}
+
+// init loads cached credentials and creates the API client
+func (a *app) init() error {
+	path, err := client.DefaultCredentialsPath()
+	if err != nil {
+		return err
+	}
+	creds, err := client.LoadCredentials(path)
+	if err != nil {
+		return fmt.Errorf("loading credentials: %w", err)
+	}
+	a.credsPath = path
+	a.creds = creds
+
+	a.server = a.serverFlag
+	if a.server == "" {
+		a.server = os.Getenv("DBX_SERVER")
+	}
+	if a.server == "" {
+		a.server = creds.Server
+	}
+	if a.server == "" {
+		a.server = defaultServer
+	}
+	a.progress = !a.json && isTerminal(os.Stderr)
+
+	opts := []client.Option{client.WithTokenHandler(a.saveToken)}
+	// Cached tokens are only valid for the server that issued them
+	if creds.Token != nil && (creds.Server == "" || creds.Server == a.server) {
+		opts = append(opts, client.WithToken(creds.Token))
+	}
+	a.client = client.New(a.server, opts...)
+	return nil
+}
+
+// saveToken persists tokens issued by a login or refresh
+func (a *app) saveToken(token *client.Token) {
+	a.creds.Server = a.server
+	a.creds.Token = token
+	if err := a.creds.Save(a.credsPath); err != nil {
+		fmt.Fprintf(os.Stderr, "dbx: warning: saving credentials: %v\n", err)
+	}
+}
+
+// flags returns a flag set for a subcommand that also accepts --json after
+// the command name
+func (a *app) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("dbx "+name, flag.ContinueOnError)
+	fs.BoolVar(&a.json, "json", a.json, "print JSON instead of tables")
+	return fs
+}
+
+// parse parses a subcommand's flags, which may appear between its
+// arguments, and returns the arguments
+func (a *app) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	a.progress = a.progress && !a.json
+	return positional, nil
+}
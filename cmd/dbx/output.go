@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable writes rows to stdout as aligned columns under a header
+func printTable(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progress reports transfer progress on stderr. It counts the bytes
+// written to it, so it can be teed off either side of a copy. A nil
+// *progress reports nothing.
+type progress struct {
+	name  string
+	total int64
+
+	mu      sync.Mutex
+	done    int64
+	lastOut time.Time
+}
+
+// newProgress returns a progress reporter, or nil when progress output is
+// disabled
+func newProgress(name string, total int64, enabled bool) *progress {
+	if !enabled {
+		return nil
+	}
+	return &progress{name: name, total: total}
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += int64(len(b))
+	if time.Since(p.lastOut) >= 100*time.Millisecond {
+		p.lastOut = time.Now()
+		p.print()
+	}
+	return len(b), nil
+}
+
+// finish prints the final state and ends the progress line
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.print()
+	_, _ = fmt.Fprintln(os.Stderr)
+}
+
+// reader returns r counting into p
+func (p *progress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return io.TeeReader(r, p)
+}
+
+// writer returns w counting into p
+func (p *progress) writer(w io.Writer) io.Writer {
+	if p == nil {
+		return w
+	}
+	return io.MultiWriter(w, p)
+}
+
+func (p *progress) print() {
+	percent := int64(100)
+	if p.total > 0 {
+		percent = min(p.done*100/p.total, 100)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "\r%-40s %3d%%  %s / %s", truncate(p.name, 40), percent,
+		formatBytes(p.done), formatBytes(p.total))
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "…" + s[len(s)-n+1:]
+}
@@ -0,0 +1,10 @@
+package accesskey
+
+import "errors"
+
+var (
+	ErrAccessKeyNotFound = errors.New("access key not found")
+	ErrNameRequired      = errors.New("name is required")
+	ErrNameTooLong       = errors.New("name must be at most 255 characters")
+	ErrInvalidAccessKey  = errors.New("invalid access key")
+)
@@ -0,0 +1,133 @@
+package accesskey
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+)
+
+// Handler handles access key requests under /me/access-keys
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new access key handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// AccessKeyResponse represents an access key in API responses
+type AccessKeyResponse struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"` // Only returned on creation
+	Name            string `json:"name"`
+	CreatedAt       string `json:"created_at"`
+	LastUsedAt      string `json:"last_used_at,omitempty"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Create handles POST /me/access-keys
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input CreateAccessKeyInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	k, secret, err := h.service.Create(r.Context(), userID, &input)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	response := toAccessKeyResponse(k)
+	response.SecretAccessKey = secret
+	respondJSON(w, http.StatusCreated, response)
+}
+
+// List handles GET /me/access-keys
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	response := make([]AccessKeyResponse, len(keys))
+	for i, k := range keys {
+		response[i] = toAccessKeyResponse(k)
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// Delete handles DELETE /me/access-keys/{accessKeyId}
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), userID, chi.URLParam(r, "accessKeyId")); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Helper functions
+
+func handleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrAccessKeyNotFound):
+		respondError(w, "Access key not found", http.StatusNotFound)
+	case errors.Is(err, ErrNameRequired), errors.Is(err, ErrNameTooLong):
+		respondError(w, err.Error(), http.StatusBadRequest)
+	default:
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func toAccessKeyResponse(k *AccessKey) AccessKeyResponse {
+	response := AccessKeyResponse{
+		AccessKeyID: k.ID,
+		Name:        k.Name,
+		CreatedAt:   k.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if k.LastUsedAt != nil {
+		response.LastUsedAt = k.LastUsedAt.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func respondError(w http.ResponseWriter, message string, status int) {
+	respondJSON(w, status, ErrorResponse{Error: message})
+}
@@ -0,0 +1,37 @@
+package accesskey
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IDPrefix starts every access key ID, as "AKIA" does for AWS keys
+const IDPrefix = "DBX"
+
+// AccessKey is an S3-style credential pair a user creates for a client of
+// the S3 gateway. The secret is only returned at creation.
+type AccessKey struct {
+	ID               string     `json:"id" db:"id"` // The access key ID clients sign with
+	UserID           uuid.UUID  `json:"user_id" db:"user_id"`
+	Name             string     `json:"name" db:"name"`
+	SecretCiphertext []byte     `json:"-" db:"secret_ciphertext"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+}
+
+// CreateAccessKeyInput represents the input for creating an access key
+type CreateAccessKeyInput struct {
+	Name string `json:"name"` // Describes the client, e.g. "DuckDB notebook"
+}
+
+// Validate validates the create access key input
+func (c *CreateAccessKeyInput) Validate() error {
+	if c.Name == "" {
+		return ErrNameRequired
+	}
+	if len(c.Name) > 255 {
+		return ErrNameTooLong
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package accesskey
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Repository defines the interface for access key storage
+type Repository interface {
+	Create(ctx context.Context, k *AccessKey) error
+	GetByID(ctx context.Context, id string) (*AccessKey, error)
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]*AccessKey, error)
+	// Delete removes one of the user's access keys
+	Delete(ctx context.Context, id string, userID uuid.UUID) error
+	TouchLastUsed(ctx context.Context, id string, at time.Time) error
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const accessKeyColumns = `id, user_id, name, secret_ciphertext, created_at, last_used_at`
+
+// Create inserts a new access key
+func (r *PostgresRepository) Create(ctx context.Context, k *AccessKey) error {
+	query := `
+		INSERT INTO access_keys (id, user_id, name, secret_ciphertext, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.ExecContext(ctx, query, k.ID, k.UserID, k.Name, k.SecretCiphertext, k.CreatedAt)
+	return err
+}
+
+// GetByID retrieves an access key by its ID
+func (r *PostgresRepository) GetByID(ctx context.Context, id string) (*AccessKey, error) {
+	query := `SELECT ` + accessKeyColumns + ` FROM access_keys WHERE id = $1`
+	k, err := scanAccessKey(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAccessKeyNotFound
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+// ListByUserID retrieves a user's access keys, oldest first
+func (r *PostgresRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*AccessKey, error) {
+	query := `SELECT ` + accessKeyColumns + ` FROM access_keys WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var keys []*AccessKey
+	for rows.Next() {
+		k, err := scanAccessKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Delete removes one of a user's access keys
+func (r *PostgresRepository) Delete(ctx context.Context, id string, userID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM access_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrAccessKeyNotFound
+	}
+	return nil
+}
+
+// TouchLastUsed records when an access key was last used
+func (r *PostgresRepository) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE access_keys SET last_used_at = $1 WHERE id = $2`, at, id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAccessKey(row scanner) (*AccessKey, error) {
+	k := &AccessKey{}
+	var lastUsedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.SecretCiphertext, &k.CreatedAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	return k, nil
+}
@@ -0,0 +1,143 @@
+package accesskey
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/secretbox"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// lastUsedResolution limits how often use of an access key is written back,
+// since S3 clients sign every request
+const lastUsedResolution = 5 * time.Minute
+
+// Service manages access keys and resolves them for signature checks
+type Service struct {
+	repo        Repository
+	userService *user.Service
+	audit       audit.Recorder
+	secrets     *secretbox.Box
+}
+
+// NewService creates a new access key service. Secrets are encrypted at
+// rest with a key derived from serverSecret, so changing it invalidates
+// existing access keys.
+func NewService(repo Repository, userService *user.Service, recorder audit.Recorder, serverSecret string) (*Service, error) {
+	secrets, err := secretbox.New(serverSecret, "access key secrets")
+	if err != nil {
+		return nil, err
+	}
+	return &Service{repo: repo, userService: userService, audit: recorder, secrets: secrets}, nil
+}
+
+// Create generates a new access key for the user. The returned secret is
+// not shown again.
+func (s *Service) Create(ctx context.Context, userID uuid.UUID, input *CreateAccessKeyInput) (*AccessKey, string, error) {
+	if err := input.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	idBytes := make([]byte, 11)
+	secretBytes := make([]byte, 30)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", err
+	}
+	id := IDPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(idBytes)[:17]
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	ciphertext, err := s.secrets.Seal(id, secret)
+	if err != nil {
+		return nil, "", err
+	}
+
+	k := &AccessKey{
+		ID:               id,
+		UserID:           userID,
+		Name:             input.Name,
+		SecretCiphertext: ciphertext,
+		CreatedAt:        time.Now(),
+	}
+	if err := s.repo.Create(ctx, k); err != nil {
+		return nil, "", err
+	}
+
+	s.record(ctx, audit.ActionAccessKeyCreated, k)
+
+	return k, secret, nil
+}
+
+// List lists the user's access keys
+func (s *Service) List(ctx context.Context, userID uuid.UUID) ([]*AccessKey, error) {
+	return s.repo.ListByUserID(ctx, userID)
+}
+
+// Delete deletes one of the user's access keys
+func (s *Service) Delete(ctx context.Context, userID uuid.UUID, id string) error {
+	if err := s.repo.Delete(ctx, id, userID); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.ActionAccessKeyDeleted, &AccessKey{ID: id, UserID: userID})
+
+	return nil
+}
+
+// Resolve returns the owner and secret of an access key, for verifying a
+// request signed with it. It returns ErrInvalidAccessKey for unknown keys
+// and user.ErrAccountDisabled for keys of disabled accounts.
+func (s *Service) Resolve(ctx context.Context, id string) (uuid.UUID, string, error) {
+	k, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrAccessKeyNotFound) {
+			return uuid.Nil, "", ErrInvalidAccessKey
+		}
+		return uuid.Nil, "", err
+	}
+
+	if err := s.userService.CheckActive(ctx, k.UserID); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return uuid.Nil, "", ErrInvalidAccessKey
+		}
+		return uuid.Nil, "", err
+	}
+
+	secret, err := s.secrets.Open(k.ID, k.SecretCiphertext)
+	if err != nil {
+		log.Printf("Failed to decrypt access key %s: %v", k.ID, err)
+		return uuid.Nil, "", ErrInvalidAccessKey
+	}
+
+	now := time.Now()
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) > lastUsedResolution {
+		if err := s.repo.TouchLastUsed(ctx, k.ID, now); err != nil {
+			log.Printf("Failed to record use of access key %s: %v", k.ID, err)
+		}
+	}
+
+	return k.UserID, secret, nil
+}
+
+// record writes an audit event for a change to an access key
+func (s *Service) record(ctx context.Context, action string, k *AccessKey) {
+	event := &audit.Event{
+		ActorID:    k.UserID,
+		Action:     action,
+		TargetType: audit.TargetAccessKey,
+		TargetID:   k.ID,
+	}
+	if k.Name != "" {
+		event.Metadata = map[string]string{"name": k.Name}
+	}
+	s.audit.Record(ctx, event)
+}
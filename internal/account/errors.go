@@ -0,0 +1,7 @@
+package account
+
+import "errors"
+
+var (
+	ErrMembershipsChanged = errors.New("group memberships changed while the account was being deleted")
+)
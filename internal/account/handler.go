@@ -0,0 +1,253 @@
+package account
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// Handler handles self-service account HTTP requests under /me
+type Handler struct {
+	service     *Service
+	userService *user.Service
+}
+
+// NewHandler creates a new account handler
+func NewHandler(service *Service, userService *user.Service) *Handler {
+	return &Handler{service: service, userService: userService}
+}
+
+// UpdateProfileRequest represents a profile update request
+type UpdateProfileRequest struct {
+	DisplayName string `json:"display_name"`
+}
+
+// ChangePasswordRequest represents a password change request
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangeEmailRequest represents an email change request
+type ChangeEmailRequest struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+// DeleteAccountRequest represents an account deletion request
+type DeleteAccountRequest struct {
+	CurrentPassword string `json:"current_password"`
+}
+
+// ProfileResponse represents the current user's profile
+type ProfileResponse struct {
+	ID            string               `json:"id"`
+	Email         string               `json:"email"`
+	EmailVerified bool                 `json:"email_verified"`
+	DisplayName   string               `json:"display_name"`
+	CreatedAt     string               `json:"created_at"`
+	Groups        []MembershipResponse `json:"groups"`
+}
+
+// MembershipResponse represents one of the current user's groups
+type MembershipResponse struct {
+	GroupID   string `json:"group_id"`
+	GroupName string `json:"group_name"`
+	Role      string `json:"role"`
+	JoinedAt  string `json:"joined_at"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Me returns the current user's profile and group memberships
+func (h *Handler) Me(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.respondProfile(w, r, userID)
+}
+
+// UpdateProfile updates the current user's display name
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	_, err := h.userService.UpdateProfile(r.Context(), userID, &user.UpdateProfileInput{DisplayName: req.DisplayName})
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrDisplayNameTooLong):
+			respondError(w, "Display name must be at most 255 characters", http.StatusBadRequest)
+		case errors.Is(err, user.ErrUserNotFound):
+			respondError(w, "User not found", http.StatusNotFound)
+		default:
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.respondProfile(w, r, userID)
+}
+
+// ChangePassword changes the current user's password
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		respondError(w, "Current and new password are required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.userService.ChangePassword(r.Context(), userID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		respondCredentialError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangeEmail changes the current user's email and sends a new verification link
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.service.ChangeEmail(r.Context(), userID, req.CurrentPassword, req.Email); err != nil {
+		switch {
+		case errors.Is(err, user.ErrEmailRequired):
+			respondError(w, "Email is required", http.StatusBadRequest)
+		case errors.Is(err, user.ErrEmailExists):
+			respondError(w, "Email already exists", http.StatusConflict)
+		default:
+			respondCredentialError(w, err)
+		}
+		return
+	}
+
+	h.respondProfile(w, r, userID)
+}
+
+// Delete deletes the current user's account. See Service.Delete for what
+// happens to the user's groups and files.
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), userID, req.CurrentPassword); err != nil {
+		respondCredentialError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) respondProfile(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	u, memberships, err := h.service.Profile(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			respondError(w, "User not found", http.StatusNotFound)
+			return
+		}
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newProfileResponse(u, memberships))
+}
+
+func newProfileResponse(u *user.User, memberships []*group.UserMembership) ProfileResponse {
+	groups := make([]MembershipResponse, len(memberships))
+	for i, m := range memberships {
+		groups[i] = MembershipResponse{
+			GroupID:   m.Group.ID.String(),
+			GroupName: m.Group.Name,
+			Role:      m.Role,
+			JoinedAt:  m.JoinedAt.Format("2006-01-02T15:04:05Z"),
+		}
+	}
+
+	return ProfileResponse{
+		ID:            u.ID.String(),
+		Email:         u.Email,
+		EmailVerified: u.IsEmailVerified(),
+		DisplayName:   u.DisplayName,
+		CreatedAt:     u.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		Groups:        groups,
+	}
+}
+
+// Helper functions
+
+func respondCredentialError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, user.ErrPasswordRequired):
+		respondError(w, "Password is required", http.StatusBadRequest)
+	case errors.Is(err, user.ErrInvalidPassword):
+		respondError(w, "Current password is incorrect", http.StatusForbidden)
+	case errors.Is(err, user.ErrPasswordTooShort):
+		respondError(w, "Password must be at least 8 characters", http.StatusBadRequest)
+	case errors.Is(err, user.ErrUserNotFound):
+		respondError(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, ErrMembershipsChanged):
+		respondError(w, "Your groups changed while deleting the account; try again", http.StatusConflict)
+	default:
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func respondError(w http.ResponseWriter, message string, status int) {
+	respondJSON(w, status, ErrorResponse{Error: message})
+}
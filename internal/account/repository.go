@@ -0,0 +1,138 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// Repository defines the interface for account data operations
+type Repository interface {
+	// DeleteUser applies an account deletion plan in a single transaction:
+	// it promotes the successors, deletes the orphaned groups with their
+	// files, and deletes the user. Files the user uploaded to other groups
+	// are kept with no uploader. It returns the deleted files, whose stored
+	// content the caller removes, and fails with ErrMembershipsChanged if
+	// the groups no longer match the plan.
+	DeleteUser(ctx context.Context, plan *group.UserDeletion) ([]*file.File, error)
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// DeleteUser applies an account deletion plan in a single transaction
+func (r *PostgresRepository) DeleteUser(ctx context.Context, plan *group.UserDeletion) ([]*file.File, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for groupID, successorID := range plan.Successors {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE user_groups SET role = $1 WHERE group_id = $2 AND user_id = $3`,
+			group.RoleAdmin, groupID, successorID)
+		if err != nil {
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if rowsAffected != 1 {
+			return nil, ErrMembershipsChanged // The successor left the group
+		}
+	}
+
+	var files []*file.File
+	if len(plan.Orphaned) > 0 {
+		orphaned := make([]string, len(plan.Orphaned))
+		for i, id := range plan.Orphaned {
+			orphaned[i] = id.String()
+		}
+
+		// Locking the groups holds off new members and uploads, which
+		// reference them, until the groups are gone
+		rows, err := tx.QueryContext(ctx, `
+			SELECT g.id FROM groups g
+			WHERE g.id = ANY($1::uuid[])
+				AND NOT EXISTS (SELECT 1 FROM user_groups m WHERE m.group_id = g.id AND m.user_id <> $2)
+			FOR UPDATE
+		`, pq.Array(orphaned), plan.UserID)
+		if err != nil {
+			return nil, err
+		}
+		locked := 0
+		for rows.Next() {
+			locked++
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		_ = rows.Close()
+		if locked != len(plan.Orphaned) {
+			return nil, ErrMembershipsChanged
+		}
+
+		if files, err = deleteGroupFiles(ctx, tx, orphaned); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM groups WHERE id = ANY($1::uuid[])`, pq.Array(orphaned)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Memberships go with the user; files.uploaded_by and groups.created_by
+	// are set to NULL
+	result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, plan.UserID)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, user.ErrUserNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// deleteGroupFiles deletes the files in the groups, returning what is needed
+// to remove their stored content
+func deleteGroupFiles(ctx context.Context, tx *sql.Tx, groupIDs []string) ([]*file.File, error) {
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM files WHERE group_id = ANY($1::uuid[])
+		RETURNING id, name, s3_key, content_type, group_id
+	`, pq.Array(groupIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var files []*file.File
+	for rows.Next() {
+		f := &file.File{}
+		if err := rows.Scan(&f.ID, &f.Name, &f.S3Key, &f.ContentType, &f.GroupID); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
@@ -0,0 +1,94 @@
+package account
+
+import (
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// Service provides self-service account operations that span users, groups
+// and files
+type Service struct {
+	repo         Repository
+	userService  *user.Service
+	groupService *group.Service
+	fileService  *file.Service
+	verifier     *auth.Verifier
+}
+
+// NewService creates a new account service
+func NewService(repo Repository, userService *user.Service, groupService *group.Service, fileService *file.Service,
+	verifier *auth.Verifier) *Service {
+	return &Service{
+		repo:         repo,
+		userService:  userService,
+		groupService: groupService,
+		fileService:  fileService,
+		verifier:     verifier,
+	}
+}
+
+// Profile returns the user together with their group memberships
+func (s *Service) Profile(ctx context.Context, userID uuid.UUID) (*user.User, []*group.UserMembership, error) {
+	u, err := s.userService.GetByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	memberships, err := s.groupService.ListUserMemberships(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return u, memberships, nil
+}
+
+// ChangeEmail changes the user's email and sends a verification link to the
+// new address
+func (s *Service) ChangeEmail(ctx context.Context, userID uuid.UUID, currentPassword, newEmail string) (*user.User, error) {
+	u, err := s.userService.ChangeEmail(ctx, userID, currentPassword, newEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	if !u.IsEmailVerified() {
+		if err := s.verifier.Send(ctx, u); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", u.ID, err)
+		}
+	}
+
+	return u, nil
+}
+
+// Delete deletes the user's account after confirming their password.
+//
+// Groups the user is the only member of are deleted along with their files.
+// In groups where the user is the only admin, the longest-standing remaining
+// member becomes admin. Files the user uploaded to surviving groups stay in
+// those groups with no uploader recorded. The database changes are made in
+// one transaction, so a failure leaves the account and its groups as they
+// were.
+func (s *Service) Delete(ctx context.Context, userID uuid.UUID, currentPassword string) error {
+	if err := s.userService.CheckPassword(ctx, userID, currentPassword); err != nil {
+		return err
+	}
+
+	plan, err := s.groupService.PlanUserDeletion(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.repo.DeleteUser(ctx, plan)
+	if err != nil {
+		return err
+	}
+
+	s.fileService.RemoveStored(ctx, deleted)
+	s.groupService.RecordUserDeletion(ctx, plan)
+	return nil
+}
@@ -0,0 +1,415 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/events"
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/lockout"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+const testPassword = "correct horse battery staple"
+
+// world is the database the in-memory repositories share
+type world struct {
+	users       map[uuid.UUID]*user.User
+	groups      map[uuid.UUID]*group.Group
+	memberships []*group.Membership
+	files       map[uuid.UUID]*file.File
+	stored      map[string]bool // Storage keys
+	events      []*audit.Event
+}
+
+// memUsers implements the user operations the tests need
+type memUsers struct {
+	user.Repository
+	w *world
+}
+
+func (r *memUsers) GetByID(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	u, ok := r.w.users[id]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (r *memUsers) Update(ctx context.Context, u *user.User) error {
+	existing, ok := r.w.users[u.ID]
+	if !ok {
+		return user.ErrUserNotFound
+	}
+	// Like the database, updates leave the token generation alone
+	generation := existing.TokenGeneration
+	*existing = *u
+	existing.TokenGeneration = generation
+	return nil
+}
+
+func (r *memUsers) RevokeTokens(ctx context.Context, id uuid.UUID) error {
+	u, ok := r.w.users[id]
+	if !ok {
+		return user.ErrUserNotFound
+	}
+	u.TokenGeneration++
+	return nil
+}
+
+// memGroups implements the group operations the tests need
+type memGroups struct {
+	group.Repository
+	w *world
+}
+
+func (r *memGroups) ListUserMemberships(ctx context.Context, userID uuid.UUID) ([]*group.UserMembership, error) {
+	var memberships []*group.UserMembership
+	for _, m := range r.w.memberships {
+		if m.UserID == userID {
+			memberships = append(memberships, &group.UserMembership{Group: r.w.groups[m.GroupID], Role: m.Role, JoinedAt: m.JoinedAt})
+		}
+	}
+	return memberships, nil
+}
+
+func (r *memGroups) ListMembers(ctx context.Context, groupID uuid.UUID, opts *group.MembersOptions) (*group.MemberPage, error) {
+	var members []*group.Membership
+	for _, m := range r.w.memberships {
+		if m.GroupID == groupID {
+			copied := *m
+			members = append(members, &copied)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].JoinedAt.Before(members[j].JoinedAt) })
+	return &group.MemberPage{Members: members}, nil
+}
+
+// memAccounts applies deletion plans to the world all at once, checking the
+// plan before changing anything as the transaction would
+type memAccounts struct {
+	w *world
+}
+
+func (r *memAccounts) DeleteUser(ctx context.Context, plan *group.UserDeletion) ([]*file.File, error) {
+	w := r.w
+	if _, ok := w.users[plan.UserID]; !ok {
+		return nil, user.ErrUserNotFound
+	}
+	for groupID, successorID := range plan.Successors {
+		if w.membership(groupID, successorID) == nil {
+			return nil, ErrMembershipsChanged
+		}
+	}
+	orphaned := make(map[uuid.UUID]bool)
+	for _, groupID := range plan.Orphaned {
+		for _, m := range w.memberships {
+			if m.GroupID == groupID && m.UserID != plan.UserID {
+				return nil, ErrMembershipsChanged
+			}
+		}
+		orphaned[groupID] = true
+	}
+
+	for groupID, successorID := range plan.Successors {
+		w.membership(groupID, successorID).Role = group.RoleAdmin
+	}
+	var deleted []*file.File
+	for id, f := range w.files {
+		switch {
+		case orphaned[f.GroupID]:
+			deleted = append(deleted, f)
+			delete(w.files, id)
+		case f.UploadedBy == plan.UserID:
+			f.UploadedBy = uuid.Nil // ON DELETE SET NULL
+		}
+	}
+	var kept []*group.Membership
+	for _, m := range w.memberships {
+		if m.UserID != plan.UserID && !orphaned[m.GroupID] {
+			kept = append(kept, m)
+		}
+	}
+	w.memberships = kept
+	for groupID := range orphaned {
+		delete(w.groups, groupID)
+	}
+	delete(w.users, plan.UserID)
+	return deleted, nil
+}
+
+func (w *world) membership(groupID, userID uuid.UUID) *group.Membership {
+	for _, m := range w.memberships {
+		if m.GroupID == groupID && m.UserID == userID {
+			return m
+		}
+	}
+	return nil
+}
+
+// memStorage tracks which keys are stored
+type memStorage struct {
+	file.Storage
+	w *world
+}
+
+func (s *memStorage) Delete(ctx context.Context, key string) error {
+	delete(s.w.stored, key)
+	return nil
+}
+
+// recorder collects audit events
+type recorder struct {
+	w *world
+}
+
+func (r *recorder) Record(ctx context.Context, event *audit.Event) {
+	r.w.events = append(r.w.events, event)
+}
+
+// fixture holds an account service over an in-memory world with three
+// users. Alice is the only member of Solo, the only admin of Team (which
+// Bob joined before Carol), and one of two admins of Shared.
+type fixture struct {
+	w                  *world
+	service            *Service
+	userService        *user.Service
+	alice, bob, carol  *user.User
+	solo, team, shared *group.Group
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	w := &world{
+		users:  make(map[uuid.UUID]*user.User),
+		groups: make(map[uuid.UUID]*group.Group),
+		files:  make(map[uuid.UUID]*file.File),
+		stored: make(map[string]bool),
+	}
+	hasher := user.NewPasswordHasher(user.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	hash, err := hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fixture{w: w}
+	newUser := func(email string) *user.User {
+		u := &user.User{ID: uuid.New(), Email: email, PasswordHash: hash, CreatedAt: time.Now()}
+		w.users[u.ID] = u
+		return u
+	}
+	f.alice, f.bob, f.carol = newUser("alice@example.com"), newUser("bob@example.com"), newUser("carol@example.com")
+
+	joined := time.Now().Add(-time.Hour)
+	newGroup := func(name string, members ...*group.Membership) *group.Group {
+		g := &group.Group{ID: uuid.New(), Name: name, CreatedBy: f.alice.ID}
+		w.groups[g.ID] = g
+		for _, m := range members {
+			m.GroupID = g.ID
+			m.JoinedAt = joined
+			joined = joined.Add(time.Minute)
+			w.memberships = append(w.memberships, m)
+		}
+		return g
+	}
+	f.solo = newGroup("Solo", &group.Membership{UserID: f.alice.ID, Role: group.RoleAdmin})
+	f.team = newGroup("Team",
+		&group.Membership{UserID: f.alice.ID, Role: group.RoleAdmin},
+		&group.Membership{UserID: f.bob.ID, Role: group.RoleMember},
+		&group.Membership{UserID: f.carol.ID, Role: group.RoleMember})
+	f.shared = newGroup("Shared",
+		&group.Membership{UserID: f.alice.ID, Role: group.RoleAdmin},
+		&group.Membership{UserID: f.carol.ID, Role: group.RoleAdmin})
+
+	groupService := group.NewService(&memGroups{w: w}, &recorder{w: w}, events.NewBus())
+	fileService := file.NewService(nil, &memStorage{w: w}, groupService, audit.Nop{}, events.NewBus(), nil)
+	f.userService = user.NewService(&memUsers{w: w}, hasher, user.VerificationPolicyOff)
+	f.service = NewService(&memAccounts{w: w}, f.userService, groupService, fileService, nil)
+	return f
+}
+
+// addFile stores a file in the group, uploaded by the user
+func (f *fixture) addFile(g *group.Group, uploader *user.User, name string) *file.File {
+	stored := &file.File{ID: uuid.New(), Name: name, GroupID: g.ID, UploadedBy: uploader.ID}
+	stored.S3Key = g.ID.String() + "/" + stored.ID.String()
+	f.w.files[stored.ID] = stored
+	f.w.stored[stored.S3Key] = true
+	return stored
+}
+
+func TestDelete_DeletesSoleMemberGroups(t *testing.T) {
+	f := newFixture(t)
+	photo := f.addFile(f.solo, f.alice, "photo.png")
+	thumbnail := "thumbnails/" + f.solo.ID.String() + "/" + photo.ID.String() + "/256"
+	f.w.stored[thumbnail] = true
+
+	if err := f.service.Delete(context.Background(), f.alice.ID, testPassword); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, ok := f.w.groups[f.solo.ID]; ok {
+		t.Error("expected the group Alice was the only member of to be deleted")
+	}
+	if _, ok := f.w.files[photo.ID]; ok {
+		t.Error("expected the group's files to be deleted")
+	}
+	if f.w.stored[photo.S3Key] || f.w.stored[thumbnail] {
+		t.Error("expected the file's content and thumbnails to be removed from storage")
+	}
+	if _, ok := f.w.users[f.alice.ID]; ok {
+		t.Error("expected the user to be deleted")
+	}
+	if !f.recorded(audit.ActionGroupDeleted, f.solo.ID) {
+		t.Error("expected the group deletion to be audited")
+	}
+	for _, g := range []*group.Group{f.team, f.shared} {
+		if _, ok := f.w.groups[g.ID]; !ok {
+			t.Errorf("expected %s, which has other members, to survive", g.Name)
+		}
+	}
+}
+
+func TestDelete_PromotesSuccessor(t *testing.T) {
+	f := newFixture(t)
+
+	if err := f.service.Delete(context.Background(), f.alice.ID, testPassword); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// Bob has been in Team longest
+	if m := f.w.membership(f.team.ID, f.bob.ID); m.Role != group.RoleAdmin {
+		t.Errorf("Bob's role in Team = %s, want admin", m.Role)
+	}
+	if m := f.w.membership(f.team.ID, f.carol.ID); m.Role != group.RoleMember {
+		t.Errorf("Carol's role in Team = %s, want member", m.Role)
+	}
+	if !f.recorded(audit.ActionRoleChanged, f.team.ID) {
+		t.Error("expected the promotion to be audited")
+	}
+	// Shared still has an admin, so nobody is promoted there
+	if f.recorded(audit.ActionRoleChanged, f.shared.ID) {
+		t.Error("expected no promotion in a group with another admin")
+	}
+	if f.w.membership(f.team.ID, f.alice.ID) != nil {
+		t.Error("expected Alice's memberships to be removed")
+	}
+}
+
+func TestDelete_KeepsUploadsWithoutUploader(t *testing.T) {
+	f := newFixture(t)
+	report := f.addFile(f.team, f.alice, "report.pdf")
+	notes := f.addFile(f.team, f.bob, "notes.txt")
+
+	if err := f.service.Delete(context.Background(), f.alice.ID, testPassword); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	kept, ok := f.w.files[report.ID]
+	if !ok {
+		t.Fatal("expected Alice's upload to a surviving group to be kept")
+	}
+	if kept.UploadedBy != uuid.Nil {
+		t.Errorf("uploaded_by = %s, want none", kept.UploadedBy)
+	}
+	if !f.w.stored[report.S3Key] {
+		t.Error("expected the kept file's content to stay in storage")
+	}
+	if f.w.files[notes.ID].UploadedBy != f.bob.ID {
+		t.Error("expected other members' uploads to keep their uploader")
+	}
+}
+
+func TestDelete_ChangesNothingWhenRejected(t *testing.T) {
+	f := newFixture(t)
+	photo := f.addFile(f.solo, f.alice, "photo.png")
+
+	err := f.service.Delete(context.Background(), f.alice.ID, "wrong password")
+	if !errors.Is(err, user.ErrInvalidPassword) {
+		t.Fatalf("expected ErrInvalidPassword, got %v", err)
+	}
+
+	if _, ok := f.w.users[f.alice.ID]; !ok {
+		t.Error("expected the user to be kept")
+	}
+	if _, ok := f.w.files[photo.ID]; !ok || !f.w.stored[photo.S3Key] {
+		t.Error("expected the file to be kept")
+	}
+	if m := f.w.membership(f.team.ID, f.bob.ID); m.Role != group.RoleMember {
+		t.Error("expected nobody to be promoted")
+	}
+	if len(f.w.events) != 0 {
+		t.Errorf("expected no audit events, got %d", len(f.w.events))
+	}
+}
+
+func (f *fixture) recorded(action string, groupID uuid.UUID) bool {
+	for _, e := range f.w.events {
+		if e.Action == action && e.GroupID == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestChangePassword_RevokesRefreshTokens(t *testing.T) {
+	f := newFixture(t)
+	jwtService := auth.NewJWTService("test-secret-key-that-is-long-enough", 15*time.Minute, time.Hour, "test-issuer")
+	guard := lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{
+		Account: lockout.Policy{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, LockAfter: 10, LockoutDuration: time.Minute},
+		IP:      lockout.Policy{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, LockAfter: 10, LockoutDuration: time.Minute},
+		Window:  time.Hour,
+	})
+	authHandler := auth.NewHandler(auth.NewService(f.userService, jwtService, nil, guard, audit.Nop{}), f.userService, nil, guard, audit.Nop{})
+	refresh := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader(`{"refresh_token":"`+token+`"}`))
+		rec := httptest.NewRecorder()
+		authHandler.Refresh(rec, req)
+		return rec.Code
+	}
+
+	before, err := jwtService.GenerateUserTokenPair(f.alice, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := refresh(before.RefreshToken); code != http.StatusOK {
+		t.Fatalf("refresh before the change: status = %d", code)
+	}
+
+	handler := NewHandler(f.service, f.userService)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/me/password",
+		strings.NewReader(`{"current_password":"`+testPassword+`","new_password":"a new passphrase"}`))
+	req = req.WithContext(context.WithValue(req.Context(), auth.UserIDKey, f.alice.ID))
+	rec := httptest.NewRecorder()
+	handler.ChangePassword(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("change password: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	if code := refresh(before.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh with a token from before the change: status = %d, want 401", code)
+	}
+
+	u, err := f.userService.GetByID(context.Background(), f.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := jwtService.GenerateUserTokenPair(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := refresh(after.RefreshToken); code != http.StatusOK {
+		t.Errorf("refresh with a token from after the change: status = %d", code)
+	}
+}
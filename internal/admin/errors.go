@@ -0,0 +1,8 @@
+package admin
+
+import "errors"
+
+var (
+	ErrCannotDisableSelf = errors.New("cannot disable your own account")
+	ErrCannotDemoteSelf  = errors.New("cannot revoke your own admin rights")
+)
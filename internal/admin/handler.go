@@ -0,0 +1,286 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// Handler handles instance administration HTTP requests
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new admin handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// SetAdminRequest represents a request to grant or revoke site admin rights
+type SetAdminRequest struct {
+	IsAdmin bool `json:"is_admin"`
+}
+
+// UserResponse represents a user account in admin API responses
+type UserResponse struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	DisplayName   string `json:"display_name"`
+	EmailVerified bool   `json:"email_verified"`
+	IsAdmin       bool   `json:"is_admin"`
+	Disabled      bool   `json:"disabled"`
+	DisabledAt    string `json:"disabled_at,omitempty"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// UserListResponse represents a page of users
+type UserListResponse struct {
+	Users []UserResponse `json:"users"`
+	Total int            `json:"total"`
+}
+
+// GroupResponse represents a group with usage in admin API responses
+type GroupResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	CreatedBy   string `json:"created_by"`
+	CreatedAt   string `json:"created_at"`
+	MemberCount int    `json:"member_count"`
+	FileCount   int    `json:"file_count"`
+	TotalBytes  int64  `json:"total_bytes"`
+}
+
+// GroupListResponse represents a page of groups
+type GroupListResponse struct {
+	Groups []GroupResponse `json:"groups"`
+	Total  int             `json:"total"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ListUsers handles listing and searching users (?q=&limit=&offset=)
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r)
+	users, total, err := h.service.ListUsers(r.Context(), &user.ListOptions{
+		Query:  r.URL.Query().Get("q"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := UserListResponse{Users: make([]UserResponse, len(users)), Total: total}
+	for i, u := range users {
+		response.Users[i] = newUserResponse(u)
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// GetUser handles retrieving a single user
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userId"))
+	if err != nil {
+		respondError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.service.GetUser(r.Context(), userID)
+	if err != nil {
+		respondUserError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newUserResponse(u))
+}
+
+// DisableUser handles disabling a user's account
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+// EnableUser handles re-enabling a user's account
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *Handler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	requestingUserID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "userId"))
+	if err != nil {
+		respondError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.service.SetUserDisabled(r.Context(), userID, disabled, requestingUserID)
+	if err != nil {
+		respondUserError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newUserResponse(u))
+}
+
+// SetAdmin handles granting or revoking site admin rights
+func (h *Handler) SetAdmin(w http.ResponseWriter, r *http.Request) {
+	requestingUserID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "userId"))
+	if err != nil {
+		respondError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req SetAdminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.service.SetUserAdmin(r.Context(), userID, req.IsAdmin, requestingUserID)
+	if err != nil {
+		respondUserError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newUserResponse(u))
+}
+
+// ListGroups handles listing all groups with usage (?q=&limit=&offset=)
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	limit, offset := pageParams(r)
+	groups, total, err := h.service.ListGroups(r.Context(), &GroupListOptions{
+		Query:  r.URL.Query().Get("q"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := GroupListResponse{Groups: make([]GroupResponse, len(groups)), Total: total}
+	for i, g := range groups {
+		createdBy := ""
+		if g.CreatedBy != uuid.Nil {
+			createdBy = g.CreatedBy.String()
+		}
+		response.Groups[i] = GroupResponse{
+			ID:          g.ID.String(),
+			Name:        g.Name,
+			CreatedBy:   createdBy,
+			CreatedAt:   g.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			MemberCount: g.MemberCount,
+			FileCount:   g.FileCount,
+			TotalBytes:  g.TotalBytes,
+		}
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// DeleteGroup handles force-deleting a group and its files
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	requestingUserID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupId"))
+	if err != nil {
+		respondError(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeleteGroup(r.Context(), groupID, requestingUserID); err != nil {
+		switch {
+		case errors.Is(err, group.ErrGroupNotFound):
+			respondError(w, "Group not found", http.StatusNotFound)
+		default:
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stats handles retrieving instance-wide statistics
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.service.Stats(r.Context())
+	if err != nil {
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+func newUserResponse(u *user.User) UserResponse {
+	response := UserResponse{
+		ID:            u.ID.String(),
+		Email:         u.Email,
+		DisplayName:   u.DisplayName,
+		EmailVerified: u.IsEmailVerified(),
+		IsAdmin:       u.IsAdmin,
+		Disabled:      u.IsDisabled(),
+		CreatedAt:     u.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if u.DisabledAt != nil {
+		response.DisabledAt = u.DisabledAt.Format("2006-01-02T15:04:05Z")
+	}
+	return response
+}
+
+// Helper functions
+
+func pageParams(r *http.Request) (limit, offset int) {
+	limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+	return limit, offset
+}
+
+func respondUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, user.ErrUserNotFound):
+		respondError(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, ErrCannotDisableSelf):
+		respondError(w, "Cannot disable your own account", http.StatusBadRequest)
+	case errors.Is(err, ErrCannotDemoteSelf):
+		respondError(w, "Cannot revoke your own admin rights", http.StatusBadRequest)
+	default:
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func respondError(w http.ResponseWriter, message string, status int) {
+	respondJSON(w, status, ErrorResponse{Error: message})
+}
@@ -0,0 +1,36 @@
+package admin
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GroupUsage represents a group with its membership and storage usage
+type GroupUsage struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	CreatedBy   uuid.UUID `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	MemberCount int       `json:"member_count"`
+	FileCount   int       `json:"file_count"`
+	TotalBytes  int64     `json:"total_bytes"`
+}
+
+// GroupListOptions controls group listing and search
+type GroupListOptions struct {
+	Query  string // Case-insensitive substring of the group name
+	Limit  int
+	Offset int
+}
+
+// Stats represents instance-wide usage statistics
+type Stats struct {
+	Users         int   `json:"users"`
+	DisabledUsers int   `json:"disabled_users"`
+	Admins        int   `json:"admins"`
+	VerifiedUsers int   `json:"verified_users"`
+	Groups        int   `json:"groups"`
+	Files         int   `json:"files"`
+	TotalBytes    int64 `json:"total_bytes"`
+}
@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/testifysec/dropbox-clone/internal/pagination"
+)
+
+// Repository defines the interface for instance-wide reporting queries
+type Repository interface {
+	ListGroups(ctx context.Context, opts *GroupListOptions) ([]*GroupUsage, int, error)
+	Stats(ctx context.Context) (*Stats, error)
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// ListGroups retrieves groups with their usage, newest first, along with the
+// total number of matches
+func (r *PostgresRepository) ListGroups(ctx context.Context, opts *GroupListOptions) ([]*GroupUsage, int, error) {
+	query := `
+		SELECT g.id, g.name, g.created_by, g.created_at,
+			(SELECT COUNT(*) FROM user_groups ug WHERE ug.group_id = g.id),
+			(SELECT COUNT(*) FROM files f WHERE f.group_id = g.id),
+			(SELECT COALESCE(SUM(f.size_bytes), 0) FROM files f WHERE f.group_id = g.id),
+			COUNT(*) OVER()
+		FROM groups g
+		WHERE $1 = '' OR g.name ILIKE $1
+		ORDER BY g.created_at DESC, g.id
+		LIMIT $2 OFFSET $3
+	`
+	pattern := ""
+	if opts.Query != "" {
+		pattern = "%" + pagination.EscapeLike(opts.Query) + "%"
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, pattern, opts.Limit, opts.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var groups []*GroupUsage
+	total := 0
+	for rows.Next() {
+		g := &GroupUsage{}
+		if err := rows.Scan(&g.ID, &g.Name, &g.CreatedBy, &g.CreatedAt,
+			&g.MemberCount, &g.FileCount, &g.TotalBytes, &total); err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, total, rows.Err()
+}
+
+// Stats computes instance-wide usage statistics
+func (r *PostgresRepository) Stats(ctx context.Context) (*Stats, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM users WHERE disabled_at IS NOT NULL),
+			(SELECT COUNT(*) FROM users WHERE is_admin),
+			(SELECT COUNT(*) FROM users WHERE email_verified_at IS NOT NULL),
+			(SELECT COUNT(*) FROM groups),
+			(SELECT COUNT(*) FROM files),
+			(SELECT COALESCE(SUM(size_bytes), 0) FROM files)
+	`
+	stats := &Stats{}
+	err := r.db.QueryRowContext(ctx, query).Scan(
+		&stats.Users, &stats.DisabledUsers, &stats.Admins, &stats.VerifiedUsers,
+		&stats.Groups, &stats.Files, &stats.TotalBytes)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
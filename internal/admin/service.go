@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// Service provides instance administration operations. Callers must have
+// already verified that the requesting user is a site administrator.
+type Service struct {
+	repo         Repository
+	userService  *user.Service
+	groupService *group.Service
+	fileService  *file.Service
+	audit        audit.Recorder
+}
+
+// NewService creates a new admin service
+func NewService(repo Repository, userService *user.Service, groupService *group.Service, fileService *file.Service, recorder audit.Recorder) *Service {
+	return &Service{
+		repo:         repo,
+		userService:  userService,
+		groupService: groupService,
+		fileService:  fileService,
+		audit:        recorder,
+	}
+}
+
+// ListUsers lists and searches user accounts
+func (s *Service) ListUsers(ctx context.Context, opts *user.ListOptions) ([]*user.User, int, error) {
+	return s.userService.List(ctx, opts)
+}
+
+// GetUser retrieves a user account
+func (s *Service) GetUser(ctx context.Context, userID uuid.UUID) (*user.User, error) {
+	return s.userService.GetByID(ctx, userID)
+}
+
+// SetUserDisabled disables or re-enables an account. Administrators cannot
+// disable themselves.
+func (s *Service) SetUserDisabled(ctx context.Context, userID uuid.UUID, disabled bool, requestingUserID uuid.UUID) (*user.User, error) {
+	if disabled && userID == requestingUserID {
+		return nil, ErrCannotDisableSelf
+	}
+	u, err := s.userService.SetDisabled(ctx, userID, disabled)
+	if err != nil {
+		return nil, err
+	}
+
+	action := audit.ActionUserEnabled
+	if disabled {
+		action = audit.ActionUserDisabled
+	}
+	s.audit.Record(ctx, &audit.Event{
+		ActorID:    requestingUserID,
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   userID.String(),
+	})
+
+	return u, nil
+}
+
+// SetUserAdmin grants or revokes site administrator rights. Administrators
+// cannot revoke their own rights, so the instance always keeps one.
+func (s *Service) SetUserAdmin(ctx context.Context, userID uuid.UUID, isAdmin bool, requestingUserID uuid.UUID) (*user.User, error) {
+	if !isAdmin && userID == requestingUserID {
+		return nil, ErrCannotDemoteSelf
+	}
+	return s.userService.SetAdmin(ctx, userID, isAdmin)
+}
+
+// ListGroups lists all groups with their usage
+func (s *Service) ListGroups(ctx context.Context, opts *GroupListOptions) ([]*GroupUsage, int, error) {
+	if opts.Limit <= 0 || opts.Limit > 200 {
+		opts.Limit = 50
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+	return s.repo.ListGroups(ctx, opts)
+}
+
+// DeleteGroup deletes a group and all of its files regardless of membership
+func (s *Service) DeleteGroup(ctx context.Context, groupID, requestingUserID uuid.UUID) error {
+	if _, err := s.groupService.GetByID(ctx, groupID); err != nil {
+		return err
+	}
+	if err := s.fileService.DeleteGroupFiles(ctx, groupID); err != nil {
+		return err
+	}
+	return s.groupService.ForceDelete(ctx, groupID, requestingUserID)
+}
+
+// Stats returns instance-wide usage statistics
+func (s *Service) Stats(ctx context.Context) (*Stats, error) {
+	return s.repo.Stats(ctx)
+}
@@ -0,0 +1,218 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// memUsers is an in-memory user.Repository
+type memUsers struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]*user.User
+}
+
+func (m *memUsers) add(u *user.User) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[u.ID] = u
+}
+
+func (m *memUsers) Create(ctx context.Context, u *user.User) error {
+	m.add(u)
+	return nil
+}
+
+func (m *memUsers) GetByID(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (m *memUsers) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Email == email {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, user.ErrUserNotFound
+}
+
+func (m *memUsers) Update(ctx context.Context, u *user.User) error {
+	m.add(u)
+	return nil
+}
+
+func (m *memUsers) Delete(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.users, id)
+	return nil
+}
+
+func (m *memUsers) List(ctx context.Context, opts *user.ListOptions) ([]*user.User, int, error) {
+	return nil, 0, nil
+}
+
+func (m *memUsers) SetAdmin(ctx context.Context, id uuid.UUID, isAdmin bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return user.ErrUserNotFound
+	}
+	u.IsAdmin = isAdmin
+	return nil
+}
+
+func (m *memUsers) SetDisabledAt(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return user.ErrUserNotFound
+	}
+	u.DisabledAt = disabledAt
+	return nil
+}
+
+func (m *memUsers) RevokeTokens(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return user.ErrUserNotFound
+	}
+	u.TokenGeneration++
+	return nil
+}
+
+func (m *memUsers) RehashPassword(ctx context.Context, id uuid.UUID, oldHash, newHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.users[id]; ok && u.PasswordHash == oldHash {
+		u.PasswordHash = newHash
+	}
+	return nil
+}
+
+// newTestService returns an admin service over in-memory users, along with
+// an administrator and a regular user
+func newTestService(t *testing.T) (*Service, *user.Service, *user.User, *user.User) {
+	t.Helper()
+	repo := &memUsers{users: make(map[uuid.UUID]*user.User)}
+	admin := &user.User{ID: uuid.New(), Email: "admin@example.com", IsAdmin: true}
+	member := &user.User{ID: uuid.New(), Email: "member@example.com"}
+	repo.add(admin)
+	repo.add(member)
+	users := user.NewService(repo, nil, user.VerificationPolicyOff)
+	return NewService(nil, users, nil, nil, audit.Nop{}), users, admin, member
+}
+
+func TestSetUserDisabledRejectsSelf(t *testing.T) {
+	svc, users, admin, member := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.SetUserDisabled(ctx, admin.ID, true, admin.ID); !errors.Is(err, ErrCannotDisableSelf) {
+		t.Fatalf("SetUserDisabled(self) error = %v, want ErrCannotDisableSelf", err)
+	}
+	if err := users.CheckActive(ctx, admin.ID); err != nil {
+		t.Errorf("admin was disabled: %v", err)
+	}
+
+	// Re-enabling oneself is harmless, and others can be disabled
+	if _, err := svc.SetUserDisabled(ctx, admin.ID, false, admin.ID); err != nil {
+		t.Errorf("SetUserDisabled(self, false) error = %v", err)
+	}
+	u, err := svc.SetUserDisabled(ctx, member.ID, true, admin.ID)
+	if err != nil || !u.IsDisabled() {
+		t.Fatalf("SetUserDisabled(member) = %+v, %v", u, err)
+	}
+	if err := users.CheckActive(ctx, member.ID); !errors.Is(err, user.ErrAccountDisabled) {
+		t.Errorf("CheckActive(member) error = %v, want ErrAccountDisabled", err)
+	}
+}
+
+func TestSetUserAdminRejectsSelf(t *testing.T) {
+	svc, users, admin, member := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.SetUserAdmin(ctx, admin.ID, false, admin.ID); !errors.Is(err, ErrCannotDemoteSelf) {
+		t.Fatalf("SetUserAdmin(self) error = %v, want ErrCannotDemoteSelf", err)
+	}
+	if u, _ := users.GetByID(ctx, admin.ID); !u.IsAdmin {
+		t.Error("admin lost their rights")
+	}
+
+	u, err := svc.SetUserAdmin(ctx, member.ID, true, admin.ID)
+	if err != nil || !u.IsAdmin {
+		t.Fatalf("SetUserAdmin(member, true) = %+v, %v", u, err)
+	}
+}
+
+func TestDemotionRevokesAccess(t *testing.T) {
+	svc, users, admin, member := newTestService(t)
+	ctx := context.Background()
+	jwtService := auth.NewJWTService("test-secret-key-that-is-long-enough", 15*time.Minute, time.Hour, "test")
+
+	handler := auth.Middleware(jwtService, users)(auth.RequireAdmin()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	get := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	promoted, err := svc.SetUserAdmin(ctx, member.ID, true, admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := jwtService.GenerateUserTokenPair(promoted, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := get(pair.AccessToken); code != http.StatusNoContent {
+		t.Fatalf("admin request status = %d, want %d", code, http.StatusNoContent)
+	}
+
+	// The token still claims admin rights, but the account no longer has them
+	if _, err := svc.SetUserAdmin(ctx, member.ID, false, admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(pair.AccessToken); code != http.StatusForbidden {
+		t.Errorf("demoted admin request status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// Disabling an admin locks them out entirely
+	pair, err = jwtService.GenerateUserTokenPair(admin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := svc.SetUserAdmin(ctx, member.ID, true, admin.ID)
+	if _, err := svc.SetUserDisabled(ctx, admin.ID, true, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(pair.AccessToken); code != http.StatusForbidden {
+		t.Errorf("disabled admin request status = %d, want %d", code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,10 @@
+package apppassword
+
+import "errors"
+
+var (
+	ErrAppPasswordNotFound = errors.New("app password not found")
+	ErrNameRequired        = errors.New("name is required")
+	ErrNameTooLong         = errors.New("name must be at most 255 characters")
+	ErrInvalidCredentials  = errors.New("invalid email or app password")
+)
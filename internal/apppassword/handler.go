@@ -0,0 +1,140 @@
+package apppassword
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+)
+
+// Handler handles app password requests under /me/app-passwords
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new app password handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// AppPasswordResponse represents an app password in API responses
+type AppPasswordResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Password   string `json:"password,omitempty"` // Only returned on creation
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Create handles POST /me/app-passwords
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input CreateAppPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	p, password, err := h.service.Create(r.Context(), userID, &input)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	response := toAppPasswordResponse(p)
+	response.Password = password
+	respondJSON(w, http.StatusCreated, response)
+}
+
+// List handles GET /me/app-passwords
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	passwords, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	response := make([]AppPasswordResponse, len(passwords))
+	for i, p := range passwords {
+		response[i] = toAppPasswordResponse(p)
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// Revoke handles DELETE /me/app-passwords/{appPasswordId}
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "appPasswordId"))
+	if err != nil {
+		respondError(w, "Invalid app password ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Revoke(r.Context(), userID, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Helper functions
+
+func handleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrAppPasswordNotFound):
+		respondError(w, "App password not found", http.StatusNotFound)
+	case errors.Is(err, ErrNameRequired), errors.Is(err, ErrNameTooLong):
+		respondError(w, err.Error(), http.StatusBadRequest)
+	default:
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func toAppPasswordResponse(p *AppPassword) AppPasswordResponse {
+	response := AppPasswordResponse{
+		ID:        p.ID.String(),
+		Name:      p.Name,
+		CreatedAt: p.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if p.LastUsedAt != nil {
+		response.LastUsedAt = p.LastUsedAt.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func respondError(w http.ResponseWriter, message string, status int) {
+	respondJSON(w, status, ErrorResponse{Error: message})
+}
@@ -0,0 +1,38 @@
+package apppassword
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Prefix starts every generated app password, so they are recognizable in
+// configuration files and secret scanners
+const Prefix = "dbxp_"
+
+// AppPassword is a revocable credential a user creates for one client. The
+// password itself is only known at creation; the hash identifies it.
+type AppPassword struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	UserID       uuid.UUID  `json:"user_id" db:"user_id"`
+	Name         string     `json:"name" db:"name"`
+	PasswordHash string     `json:"-" db:"password_hash"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+}
+
+// CreateAppPasswordInput represents the input for creating an app password
+type CreateAppPasswordInput struct {
+	Name string `json:"name"` // Describes the client, e.g. "Laptop WebDAV"
+}
+
+// Validate validates the create app password input
+func (c *CreateAppPasswordInput) Validate() error {
+	if c.Name == "" {
+		return ErrNameRequired
+	}
+	if len(c.Name) > 255 {
+		return ErrNameTooLong
+	}
+	return nil
+}
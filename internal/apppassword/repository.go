@@ -0,0 +1,113 @@
+package apppassword
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Repository defines the interface for app password storage
+type Repository interface {
+	Create(ctx context.Context, p *AppPassword) error
+	GetByHash(ctx context.Context, passwordHash string) (*AppPassword, error)
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]*AppPassword, error)
+	// Delete removes one of the user's app passwords
+	Delete(ctx context.Context, id, userID uuid.UUID) error
+	TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const appPasswordColumns = `id, user_id, name, password_hash, created_at, last_used_at`
+
+// Create inserts a new app password
+func (r *PostgresRepository) Create(ctx context.Context, p *AppPassword) error {
+	query := `
+		INSERT INTO app_passwords (id, user_id, name, password_hash, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.ExecContext(ctx, query, p.ID, p.UserID, p.Name, p.PasswordHash, p.CreatedAt)
+	return err
+}
+
+// GetByHash retrieves an app password by the hash of its value
+func (r *PostgresRepository) GetByHash(ctx context.Context, passwordHash string) (*AppPassword, error) {
+	query := `SELECT ` + appPasswordColumns + ` FROM app_passwords WHERE password_hash = $1`
+	p, err := scanAppPassword(r.db.QueryRowContext(ctx, query, passwordHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAppPasswordNotFound
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// ListByUserID retrieves a user's app passwords, oldest first
+func (r *PostgresRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*AppPassword, error) {
+	query := `SELECT ` + appPasswordColumns + ` FROM app_passwords WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var passwords []*AppPassword
+	for rows.Next() {
+		p, err := scanAppPassword(rows)
+		if err != nil {
+			return nil, err
+		}
+		passwords = append(passwords, p)
+	}
+	return passwords, rows.Err()
+}
+
+// Delete removes one of a user's app passwords
+func (r *PostgresRepository) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM app_passwords WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrAppPasswordNotFound
+	}
+	return nil
+}
+
+// TouchLastUsed records when an app password was last used
+func (r *PostgresRepository) TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE app_passwords SET last_used_at = $1 WHERE id = $2`, at, id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAppPassword(row scanner) (*AppPassword, error) {
+	p := &AppPassword{}
+	var lastUsedAt sql.NullTime
+	if err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.PasswordHash, &p.CreatedAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		p.LastUsedAt = &lastUsedAt.Time
+	}
+	return p, nil
+}
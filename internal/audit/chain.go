@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// canonicalEvent is the hashed form of an event. Field order is fixed by the
+// struct and map keys are sorted by encoding/json, so the encoding is stable.
+type canonicalEvent struct {
+	PrevHash   string            `json:"prev_hash"`
+	OccurredAt string            `json:"occurred_at"`
+	ActorID    string            `json:"actor_id"`
+	Action     string            `json:"action"`
+	GroupID    string            `json:"group_id"`
+	TargetType string            `json:"target_type"`
+	TargetID   string            `json:"target_id"`
+	IP         string            `json:"ip"`
+	UserAgent  string            `json:"user_agent"`
+	RequestID  string            `json:"request_id"`
+	Metadata   map[string]string `json:"metadata"`
+}
+
+// normalizeTime rounds a timestamp to what PostgreSQL stores, so the hash
+// computed before insert matches the one recomputed after reading it back
+func normalizeTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// ComputeHash returns the hex-encoded SHA-256 hash of an event chained to
+// prevHash
+func ComputeHash(prevHash string, e *Event) string {
+	metadata := e.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	data, _ := json.Marshal(canonicalEvent{
+		PrevHash:   prevHash,
+		OccurredAt: normalizeTime(e.OccurredAt).Format(time.RFC3339Nano),
+		ActorID:    e.ActorID.String(),
+		Action:     e.Action,
+		GroupID:    e.GroupID.String(),
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		RequestID:  e.RequestID,
+		Metadata:   metadata,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyChain checks that events, in ID order, link to prevHash and to each
+// other and that each stored hash matches its content. It returns the hash
+// of the last event, or the event that breaks the chain.
+func VerifyChain(prevHash string, events []*Event) (lastHash string, broken *Event, reason string) {
+	for _, e := range events {
+		if e.PrevHash != prevHash {
+			return prevHash, e, fmt.Sprintf("previous hash %s does not match %s", e.PrevHash, prevHash)
+		}
+		if want := ComputeHash(prevHash, e); e.Hash != want {
+			return prevHash, e, fmt.Sprintf("hash %s does not match content (expected %s)", e.Hash, want)
+		}
+		prevHash = e.Hash
+	}
+	return prevHash, nil, ""
+}
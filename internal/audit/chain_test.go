@@ -0,0 +1,157 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryRepository is an in-memory Repository for tests
+type memoryRepository struct {
+	events []*Event
+}
+
+func (m *memoryRepository) Append(_ context.Context, event *Event) error {
+	prevHash := GenesisHash
+	if n := len(m.events); n > 0 {
+		prevHash = m.events[n-1].Hash
+	}
+	event.ID = int64(len(m.events) + 1)
+	event.OccurredAt = normalizeTime(event.OccurredAt)
+	event.PrevHash = prevHash
+	event.Hash = ComputeHash(prevHash, event)
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *memoryRepository) List(context.Context, *QueryOptions) ([]*Event, int, error) {
+	return m.events, len(m.events), nil
+}
+
+func (m *memoryRepository) ListAfter(_ context.Context, afterID int64, limit int) ([]*Event, error) {
+	var events []*Event
+	for _, e := range m.events {
+		if e.ID > afterID && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func newTestChain(t *testing.T, n int) (*Service, *memoryRepository) {
+	t.Helper()
+	repo := &memoryRepository{}
+	s := NewService(repo)
+	base := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	for i := 0; i < n; i++ {
+		s.now = func() time.Time { return base.Add(time.Duration(i) * time.Second) }
+		s.Record(context.Background(), &Event{
+			ActorID:    uuid.New(),
+			Action:     ActionFileDownloaded,
+			GroupID:    uuid.New(),
+			TargetType: TargetFile,
+			TargetID:   uuid.NewString(),
+			Metadata:   map[string]string{"name": "report.pdf"},
+		})
+	}
+	return s, repo
+}
+
+func TestVerifyValidChain(t *testing.T) {
+	s, repo := newTestChain(t, 5)
+
+	result, err := s.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !result.Valid || result.Checked != 5 || result.LastID != 5 {
+		t.Errorf("Verify() = %+v, want valid with 5 events", result)
+	}
+	if result.LastHash != repo.events[4].Hash {
+		t.Errorf("LastHash = %s, want %s", result.LastHash, repo.events[4].Hash)
+	}
+	if repo.events[0].PrevHash != GenesisHash {
+		t.Errorf("first PrevHash = %s, want genesis", repo.events[0].PrevHash)
+	}
+}
+
+func TestVerifyEmptyChain(t *testing.T) {
+	s := NewService(&memoryRepository{})
+
+	result, err := s.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !result.Valid || result.Checked != 0 || result.LastHash != GenesisHash {
+		t.Errorf("Verify() = %+v, want valid empty chain", result)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func(repo *memoryRepository)
+		brokenAt int64
+	}{
+		{
+			name:     "edited metadata",
+			tamper:   func(repo *memoryRepository) { repo.events[2].Metadata["name"] = "other.pdf" },
+			brokenAt: 3,
+		},
+		{
+			name:     "changed actor",
+			tamper:   func(repo *memoryRepository) { repo.events[1].ActorID = uuid.New() },
+			brokenAt: 2,
+		},
+		{
+			name:     "changed time",
+			tamper:   func(repo *memoryRepository) { repo.events[3].OccurredAt = repo.events[3].OccurredAt.Add(time.Hour) },
+			brokenAt: 4,
+		},
+		{
+			name:     "deleted event",
+			tamper:   func(repo *memoryRepository) { repo.events = append(repo.events[:1], repo.events[2:]...) },
+			brokenAt: 3,
+		},
+		{
+			name: "rehashed event",
+			tamper: func(repo *memoryRepository) {
+				e := repo.events[1]
+				e.Action = ActionFileDeleted
+				e.Hash = ComputeHash(e.PrevHash, e)
+			},
+			brokenAt: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, repo := newTestChain(t, 5)
+			tt.tamper(repo)
+
+			result, err := s.Verify(context.Background())
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if result.Valid {
+				t.Fatal("Verify() reported a tampered chain as valid")
+			}
+			if result.BrokenAt != tt.brokenAt {
+				t.Errorf("BrokenAt = %d, want %d (%s)", result.BrokenAt, tt.brokenAt, result.Reason)
+			}
+		})
+	}
+}
+
+func TestComputeHashNormalizesTime(t *testing.T) {
+	e := &Event{Action: ActionLoginSucceeded, OccurredAt: time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)}
+	stored := *e
+	// PostgreSQL keeps microseconds and may return another time zone
+	stored.OccurredAt = time.Date(2024, 5, 1, 14, 0, 0, 123456000, time.FixedZone("CEST", 2*60*60))
+
+	if ComputeHash(GenesisHash, e) != ComputeHash(GenesisHash, &stored) {
+		t.Error("ComputeHash() differs after a database round trip")
+	}
+}
@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Handler handles audit log HTTP requests. Routes must be restricted to site
+// administrators.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new audit handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// EventResponse represents an audit event in API responses
+type EventResponse struct {
+	ID         int64             `json:"id"`
+	OccurredAt string            `json:"occurred_at"`
+	ActorID    string            `json:"actor_id,omitempty"`
+	Action     string            `json:"action"`
+	GroupID    string            `json:"group_id,omitempty"`
+	TargetType string            `json:"target_type,omitempty"`
+	TargetID   string            `json:"target_id,omitempty"`
+	IP         string            `json:"ip,omitempty"`
+	UserAgent  string            `json:"user_agent,omitempty"`
+	RequestID  string            `json:"request_id,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Hash       string            `json:"hash"`
+}
+
+// EventListResponse represents a page of audit events
+type EventListResponse struct {
+	Events []EventResponse `json:"events"`
+	Total  int             `json:"total"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// List handles querying the audit log
+// (?group_id=&actor_id=&action=&since=&until=&limit=&offset=, times in RFC 3339)
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	opts := &QueryOptions{Action: params.Get("action")}
+
+	var err error
+	if opts.GroupID, err = parseOptionalUUID(params.Get("group_id")); err != nil {
+		respondError(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	if opts.ActorID, err = parseOptionalUUID(params.Get("actor_id")); err != nil {
+		respondError(w, "Invalid actor ID", http.StatusBadRequest)
+		return
+	}
+	if opts.Since, err = parseOptionalTime(params.Get("since")); err != nil {
+		respondError(w, "Invalid since time", http.StatusBadRequest)
+		return
+	}
+	if opts.Until, err = parseOptionalTime(params.Get("until")); err != nil {
+		respondError(w, "Invalid until time", http.StatusBadRequest)
+		return
+	}
+	opts.Limit, _ = strconv.Atoi(params.Get("limit"))
+	opts.Offset, _ = strconv.Atoi(params.Get("offset"))
+
+	events, total, err := h.service.Query(r.Context(), opts)
+	if err != nil {
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := EventListResponse{Events: make([]EventResponse, len(events)), Total: total}
+	for i, e := range events {
+		response.Events[i] = newEventResponse(e)
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// Verify handles checking the integrity of the whole chain
+func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
+	result, err := h.service.Verify(r.Context())
+	if err != nil {
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// Helper functions
+
+func newEventResponse(e *Event) EventResponse {
+	return EventResponse{
+		ID:         e.ID,
+		OccurredAt: e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		ActorID:    formatUUID(e.ActorID),
+		Action:     e.Action,
+		GroupID:    formatUUID(e.GroupID),
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		RequestID:  e.RequestID,
+		Metadata:   e.Metadata,
+		Hash:       e.Hash,
+	}
+}
+
+func formatUUID(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
+
+func parseOptionalUUID(s string) (uuid.UUID, error) {
+	if s == "" {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(s)
+}
+
+func parseOptionalTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func respondError(w http.ResponseWriter, message string, status int) {
+	respondJSON(w, status, ErrorResponse{Error: message})
+}
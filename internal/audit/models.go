@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionLoginSucceeded = "auth.login_succeeded"
+	ActionLoginFailed    = "auth.login_failed"
+	ActionAccountUnlock  = "auth.account_unlocked"
+
+	ActionGroupCreated          = "group.created"
+	ActionGroupDeleted          = "group.deleted"
+	ActionMemberAdded           = "group.member_added"
+	ActionMemberRemoved         = "group.member_removed"
+	ActionRoleChanged           = "group.role_changed"
+	ActionMetadataSchemaChanged = "group.metadata_schema_changed"
+
+	ActionFileUploaded        = "file.uploaded"
+	ActionFileDownloaded      = "file.downloaded"
+	ActionFileShared          = "file.shared" // A presigned download link was issued
+	ActionFileRenamed         = "file.renamed"
+	ActionFileDeleted         = "file.deleted"
+	ActionFileMetadataChanged = "file.metadata_changed" // Tags or metadata were edited
+
+	ActionUserDisabled = "user.disabled"
+	ActionUserEnabled  = "user.enabled"
+
+	ActionWebhookCreated = "webhook.created"
+	ActionWebhookDeleted = "webhook.deleted"
+
+	ActionAppPasswordCreated = "app_password.created"
+	ActionAppPasswordRevoked = "app_password.revoked"
+
+	ActionAccessKeyCreated = "access_key.created"
+	ActionAccessKeyDeleted = "access_key.deleted"
+
+	ActionSSHKeyAdded   = "ssh_key.added"
+	ActionSSHKeyDeleted = "ssh_key.deleted"
+)
+
+// Target types
+const (
+	TargetUser        = "user"
+	TargetGroup       = "group"
+	TargetFile        = "file"
+	TargetWebhook     = "webhook"
+	TargetAppPassword = "app_password"
+	TargetAccessKey   = "access_key"
+	TargetSSHKey      = "ssh_key"
+)
+
+// GenesisHash is the previous hash of the first event in the chain
+const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Event is a single audit log entry. Each event's Hash covers its content
+// and the previous event's hash, so editing, inserting or removing an event
+// breaks the chain from that point on.
+type Event struct {
+	ID         int64             `json:"id"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	ActorID    uuid.UUID         `json:"actor_id"` // uuid.Nil for anonymous or system actions
+	Action     string            `json:"action"`
+	GroupID    uuid.UUID         `json:"group_id"` // uuid.Nil when not group-scoped
+	TargetType string            `json:"target_type,omitempty"`
+	TargetID   string            `json:"target_id,omitempty"`
+	IP         string            `json:"ip,omitempty"`
+	UserAgent  string            `json:"user_agent,omitempty"`
+	RequestID  string            `json:"request_id,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	PrevHash   string            `json:"prev_hash"`
+	Hash       string            `json:"hash"`
+}
+
+// QueryOptions filters audit events. Zero values match everything.
+type QueryOptions struct {
+	GroupID uuid.UUID
+	ActorID uuid.UUID
+	Action  string
+	Since   time.Time // Inclusive
+	Until   time.Time // Exclusive
+	Limit   int
+	Offset  int
+}
+
+// VerifyResult reports the outcome of a chain integrity check
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	LastID   int64  `json:"last_id"`
+	LastHash string `json:"last_hash"`
+	BrokenAt int64  `json:"broken_at,omitempty"` // ID of the first event that fails verification
+	Reason   string `json:"reason,omitempty"`
+}
@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// chainLockKey is the advisory lock that serializes appends across replicas
+const chainLockKey = 0x61756469 // "audi"
+
+// Repository defines the interface for audit log storage
+type Repository interface {
+	// Append links the event to the current end of the chain and stores it,
+	// setting its ID, PrevHash and Hash
+	Append(ctx context.Context, event *Event) error
+	// List returns events matching the options, newest first, along with the
+	// total number of matches
+	List(ctx context.Context, opts *QueryOptions) ([]*Event, int, error)
+	// ListAfter returns up to limit events with IDs greater than afterID in
+	// chain order
+	ListAfter(ctx context.Context, afterID int64, limit int) ([]*Event, error)
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// Append inserts an event at the end of the chain. Appends are serialized
+// with a transaction-scoped advisory lock so concurrent writers cannot fork
+// the chain.
+func (r *PostgresRepository) Append(ctx context.Context, event *Event) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, chainLockKey); err != nil {
+		return err
+	}
+
+	prevHash := GenesisHash
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	event.OccurredAt = normalizeTime(event.OccurredAt)
+	event.PrevHash = prevHash
+	event.Hash = ComputeHash(prevHash, event)
+
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+	if event.Metadata == nil {
+		metadata = []byte("{}")
+	}
+
+	query := `
+		INSERT INTO audit_events (occurred_at, actor_id, action, group_id, target_type, target_id,
+			ip, user_agent, request_id, metadata, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id
+	`
+	err = tx.QueryRowContext(ctx, query,
+		event.OccurredAt, nullUUID(event.ActorID), event.Action, nullUUID(event.GroupID), event.TargetType,
+		event.TargetID, event.IP, event.UserAgent, event.RequestID, metadata, event.PrevHash, event.Hash,
+	).Scan(&event.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// List retrieves events matching the options, newest first
+func (r *PostgresRepository) List(ctx context.Context, opts *QueryOptions) ([]*Event, int, error) {
+	query := `
+		SELECT id, occurred_at, actor_id, action, group_id, target_type, target_id,
+			ip, user_agent, request_id, metadata, prev_hash, hash, COUNT(*) OVER()
+		FROM audit_events
+		WHERE ($1::uuid IS NULL OR group_id = $1)
+			AND ($2::uuid IS NULL OR actor_id = $2)
+			AND ($3 = '' OR action = $3)
+			AND ($4::timestamptz IS NULL OR occurred_at >= $4)
+			AND ($5::timestamptz IS NULL OR occurred_at < $5)
+		ORDER BY id DESC
+		LIMIT $6 OFFSET $7
+	`
+	rows, err := r.db.QueryContext(ctx, query,
+		nullUUID(opts.GroupID), nullUUID(opts.ActorID), opts.Action, nullTime(opts.Since), nullTime(opts.Until),
+		opts.Limit, opts.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []*Event
+	total := 0
+	for rows.Next() {
+		event, err := scanEvent(rows, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
+
+// ListAfter retrieves a batch of events in chain order
+func (r *PostgresRepository) ListAfter(ctx context.Context, afterID int64, limit int) ([]*Event, error) {
+	query := `
+		SELECT id, occurred_at, actor_id, action, group_id, target_type, target_id,
+			ip, user_agent, request_id, metadata, prev_hash, hash
+		FROM audit_events
+		WHERE id > $1
+		ORDER BY id ASC
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []*Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// scanEvent scans an event row, followed by any extra columns in dest
+func scanEvent(rows *sql.Rows, dest ...interface{}) (*Event, error) {
+	event := &Event{}
+	var metadata []byte
+	columns := append([]interface{}{
+		&event.ID, &event.OccurredAt, &event.ActorID, &event.Action, &event.GroupID, &event.TargetType,
+		&event.TargetID, &event.IP, &event.UserAgent, &event.RequestID, &metadata, &event.PrevHash, &event.Hash,
+	}, dest...)
+	if err := rows.Scan(columns...); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+		return nil, err
+	}
+	if len(event.Metadata) == 0 {
+		event.Metadata = nil
+	}
+	return event, nil
+}
+
+// nullUUID maps uuid.Nil to SQL NULL
+func nullUUID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+// nullTime maps the zero time to SQL NULL
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// verifyBatch is the number of events loaded per query while verifying
+const verifyBatch = 1000
+
+// Recorder records audit events. Recording never fails the caller's
+// operation; implementations log storage errors instead.
+type Recorder interface {
+	Record(ctx context.Context, event *Event)
+}
+
+// Nop is a Recorder that discards events
+type Nop struct{}
+
+// Record discards the event
+func (Nop) Record(context.Context, *Event) {}
+
+// Service writes, queries and verifies the audit log
+type Service struct {
+	repo Repository
+	now  func() time.Time
+}
+
+// NewService creates a new audit service
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo, now: time.Now}
+}
+
+// Record appends an event, filling in the time and the client details of
+// the request in ctx
+func (s *Service) Record(ctx context.Context, event *Event) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = s.now()
+	}
+	if info, ok := RequestInfoFromContext(ctx); ok {
+		if event.IP == "" {
+			event.IP = info.IP
+		}
+		if event.UserAgent == "" {
+			event.UserAgent = info.UserAgent
+		}
+		if event.RequestID == "" {
+			event.RequestID = info.RequestID
+		}
+	}
+
+	// Record even if the request was cancelled after the action completed
+	if err := s.repo.Append(context.WithoutCancel(ctx), event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// Query lists events matching the options
+func (s *Service) Query(ctx context.Context, opts *QueryOptions) ([]*Event, int, error) {
+	if opts.Limit <= 0 || opts.Limit > 500 {
+		opts.Limit = 100
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+	return s.repo.List(ctx, opts)
+}
+
+// Verify walks the whole chain and checks every link and hash
+func (s *Service) Verify(ctx context.Context) (*VerifyResult, error) {
+	result := &VerifyResult{Valid: true, LastHash: GenesisHash}
+	for {
+		events, err := s.repo.ListAfter(ctx, result.LastID, verifyBatch)
+		if err != nil {
+			return nil, err
+		}
+
+		lastHash, broken, reason := VerifyChain(result.LastHash, events)
+		if broken != nil {
+			result.Valid = false
+			result.BrokenAt = broken.ID
+			result.Reason = reason
+			return result, nil
+		}
+		if len(events) > 0 {
+			result.Checked += len(events)
+			result.LastID = events[len(events)-1].ID
+			result.LastHash = lastHash
+		}
+		if len(events) < verifyBatch {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// UnaryInterceptor returns a gRPC interceptor that validates JWT tokens as
+// Middleware does, reading them from the "authorization" metadata. Methods
+// matching public, either a full method name or a service prefix ending in
+// "/", are served without a token.
+func UnaryInterceptor(jwtService *JWTService, userService *user.Service, public ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if isPublic(info.FullMethod, public) {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticateRPC(ctx, jwtService, userService)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor returns the streaming counterpart of UnaryInterceptor
+func StreamInterceptor(jwtService *JWTService, userService *user.Service, public ...string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isPublic(info.FullMethod, public) {
+			return handler(srv, ss)
+		}
+		ctx, err := authenticateRPC(ss.Context(), jwtService, userService)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticateRPC validates a call's token and adds its claims to ctx
+func authenticateRPC(ctx context.Context, jwtService *JWTService, userService *user.Service) (context.Context, error) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+
+	claims, u, err := authenticate(ctx, jwtService, userService, authorization)
+	if err != nil {
+		switch {
+		case errors.Is(err, errMissingAuthorization):
+			return nil, status.Error(codes.Unauthenticated, "Authorization header required")
+		case errors.Is(err, errMalformedAuthorization):
+			return nil, status.Error(codes.Unauthenticated, "Invalid authorization header format")
+		case errors.Is(err, ErrExpiredToken):
+			return nil, status.Error(codes.Unauthenticated, "Token has expired")
+		case errors.Is(err, ErrInvalidToken):
+			return nil, status.Error(codes.Unauthenticated, "Invalid token")
+		case errors.Is(err, user.ErrAccountDisabled):
+			return nil, status.Error(codes.PermissionDenied, "Account is disabled")
+		default:
+			log.Printf("Failed to authenticate gRPC call: %v", err)
+			return nil, status.Error(codes.Internal, "Internal server error")
+		}
+	}
+	return withClaims(ctx, claims, u), nil
+}
+
+func isPublic(fullMethod string, public []string) bool {
+	for _, p := range public {
+		if fullMethod == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(fullMethod, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticatedStream is a server stream whose context carries the caller's
+// claims
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// userRepo serves and updates users from a map
+type userRepo struct {
+	user.Repository
+	users map[uuid.UUID]*user.User
+}
+
+func (r *userRepo) GetByID(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (r *userRepo) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, user.ErrUserNotFound
+}
+
+func (r *userRepo) Update(ctx context.Context, u *user.User) error {
+	r.users[u.ID] = u
+	return nil
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	jwtService := NewJWTService("test-secret-key-that-is-long-enough", 15*time.Minute, time.Hour, "test-issuer")
+	now := time.Now()
+	active := &user.User{ID: uuid.New(), Email: "active@example.com"}
+	disabled := &user.User{ID: uuid.New(), Email: "disabled@example.com", DisabledAt: &now}
+	repo := &userRepo{users: map[uuid.UUID]*user.User{active.ID: active, disabled.ID: disabled}}
+	userService := user.NewService(repo, nil, user.VerificationPolicyOff)
+	interceptor := UnaryInterceptor(jwtService, userService, "/test.Public/")
+
+	token := func(u *user.User) string {
+		pair, err := jwtService.GenerateUserTokenPair(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + pair.AccessToken
+	}
+	gone := &user.User{ID: uuid.New(), Email: "gone@example.com"}
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		code          codes.Code
+	}{
+		{"public method", "/test.Public/Call", "", codes.OK},
+		{"missing token", "/test.Private/Call", "", codes.Unauthenticated},
+		{"malformed header", "/test.Private/Call", "Token abc", codes.Unauthenticated},
+		{"invalid token", "/test.Private/Call", "Bearer abc", codes.Unauthenticated},
+		{"deleted user", "/test.Private/Call", token(gone), codes.Unauthenticated},
+		{"disabled user", "/test.Private/Call", token(disabled), codes.PermissionDenied},
+		{"active user", "/test.Private/Call", token(active), codes.OK},
+		{"prefix is not a service", "/test.PublicOther/Call", "", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.authorization != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.authorization))
+			}
+			var gotUserID uuid.UUID
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				gotUserID, _ = GetUserID(ctx)
+				return nil, nil
+			}
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v (%v)", code, tt.code, err)
+			}
+			if tt.name == "active user" && gotUserID != active.ID {
+				t.Errorf("user ID in context = %v, want %v", gotUserID, active.ID)
+			}
+		})
+	}
+}
@@ -3,22 +3,34 @@ package auth
 import (
 	"encoding/json"
 	"errors"
+	"net"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/lockout"
 	"github.com/testifysec/dropbox-clone/internal/user"
 )
 
 // Handler handles authentication-related HTTP requests
 type Handler struct {
+	service     *Service
 	userService *user.Service
-	jwtService  *JWTService
+	verifier    *Verifier
+	guard       *lockout.Guard
+	audit       audit.Recorder
 }
 
 // NewHandler creates a new auth handler
-func NewHandler(userService *user.Service, jwtService *JWTService) *Handler {
+func NewHandler(service *Service, userService *user.Service, verifier *Verifier, guard *lockout.Guard, recorder audit.Recorder) *Handler {
 	return &Handler{
+		service:     service,
 		userService: userService,
-		jwtService:  jwtService,
+		verifier:    verifier,
+		guard:       guard,
+		audit:       recorder,
 	}
 }
 
@@ -49,9 +61,16 @@ type AuthResponse struct {
 
 // UserResponse represents a user in API responses
 type UserResponse struct {
-	ID        string `json:"id"`
-	Email     string `json:"email"`
-	CreatedAt string `json:"created_at"`
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// VerifyEmailResponse represents the result of verifying an email address
+type VerifyEmailResponse struct {
+	Email      string `json:"email"`
+	VerifiedAt string `json:"verified_at"`
 }
 
 // ErrorResponse represents an error response
@@ -67,12 +86,7 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	input := &user.CreateUserInput{
-		Email:    req.Email,
-		Password: req.Password,
-	}
-
-	newUser, err := h.userService.Register(r.Context(), input)
+	session, err := h.service.Register(r.Context(), req.Email, req.Password)
 	if err != nil {
 		switch {
 		case errors.Is(err, user.ErrEmailExists):
@@ -89,23 +103,7 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate tokens
-	tokens, err := h.jwtService.GenerateTokenPair(newUser.ID, newUser.Email, nil)
-	if err != nil {
-		respondError(w, "Failed to generate tokens", http.StatusInternalServerError)
-		return
-	}
-
-	respondJSON(w, http.StatusCreated, AuthResponse{
-		User: &UserResponse{
-			ID:        newUser.ID.String(),
-			Email:     newUser.Email,
-			CreatedAt: newUser.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		},
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
-		ExpiresAt:    tokens.ExpiresAt.Format("2006-01-02T15:04:05Z"),
-	})
+	respondJSON(w, http.StatusCreated, newAuthResponse(session))
 }
 
 // Login handles user login
@@ -116,17 +114,17 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Email == "" || req.Password == "" {
-		respondError(w, "Email and password are required", http.StatusBadRequest)
-		return
-	}
-
-	authenticatedUser, err := h.userService.Authenticate(r.Context(), req.Email, req.Password)
+	session, err := h.service.Login(r.Context(), req.Email, req.Password, clientIP(r))
 	if err != nil {
+		var blocked *lockout.BlockedError
 		switch {
-		case errors.Is(err, user.ErrUserNotFound):
-			respondError(w, "Invalid email or password", http.StatusUnauthorized)
-		case errors.Is(err, user.ErrInvalidPassword):
+		case errors.As(err, &blocked):
+			respondBlocked(w, blocked)
+		case errors.Is(err, ErrCredentialsRequired):
+			respondError(w, "Email and password are required", http.StatusBadRequest)
+		case errors.Is(err, user.ErrAccountDisabled):
+			respondError(w, "Account is disabled", http.StatusForbidden)
+		case errors.Is(err, ErrInvalidCredentials):
 			respondError(w, "Invalid email or password", http.StatusUnauthorized)
 		default:
 			respondError(w, "Internal server error", http.StatusInternalServerError)
@@ -134,23 +132,7 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate tokens (TODO: include actual group IDs)
-	tokens, err := h.jwtService.GenerateTokenPair(authenticatedUser.ID, authenticatedUser.Email, nil)
-	if err != nil {
-		respondError(w, "Failed to generate tokens", http.StatusInternalServerError)
-		return
-	}
-
-	respondJSON(w, http.StatusOK, AuthResponse{
-		User: &UserResponse{
-			ID:        authenticatedUser.ID.String(),
-			Email:     authenticatedUser.Email,
-			CreatedAt: authenticatedUser.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		},
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
-		ExpiresAt:    tokens.ExpiresAt.Format("2006-01-02T15:04:05Z"),
-	})
+	respondJSON(w, http.StatusOK, newAuthResponse(session))
 }
 
 // Refresh handles token refresh
@@ -161,25 +143,88 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.RefreshToken == "" {
-		respondError(w, "Refresh token is required", http.StatusBadRequest)
+	session, err := h.service.Refresh(r.Context(), req.RefreshToken, clientIP(r))
+	if err != nil {
+		var blocked *lockout.BlockedError
+		switch {
+		case errors.As(err, &blocked):
+			respondBlocked(w, blocked)
+		case errors.Is(err, ErrRefreshTokenRequired):
+			respondError(w, "Refresh token is required", http.StatusBadRequest)
+		case errors.Is(err, ErrExpiredToken):
+			respondError(w, "Refresh token has expired", http.StatusUnauthorized)
+		case errors.Is(err, ErrInvalidToken):
+			respondError(w, "Invalid refresh token", http.StatusUnauthorized)
+		case errors.Is(err, user.ErrUserNotFound):
+			respondError(w, "User not found", http.StatusUnauthorized)
+		case errors.Is(err, user.ErrAccountDisabled):
+			respondError(w, "Account is disabled", http.StatusForbidden)
+		case errors.Is(err, ErrRevokedToken):
+			respondError(w, "Refresh token has been revoked", http.StatusUnauthorized)
+		default:
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	// Validate the refresh token
-	claims, err := h.jwtService.ValidateRefreshToken(req.RefreshToken)
+	respondJSON(w, http.StatusOK, newAuthResponse(session))
+}
+
+// newAuthResponse describes a session's user and tokens
+func newAuthResponse(session *Session) AuthResponse {
+	return AuthResponse{
+		User: &UserResponse{
+			ID:            session.User.ID.String(),
+			Email:         session.User.Email,
+			EmailVerified: session.User.IsEmailVerified(),
+			CreatedAt:     session.User.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		},
+		AccessToken:  session.Tokens.AccessToken,
+		RefreshToken: session.Tokens.RefreshToken,
+		ExpiresAt:    session.Tokens.ExpiresAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+// VerifyEmail handles the signed link sent to the user's email address
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		respondError(w, "Verification token is required", http.StatusBadRequest)
+		return
+	}
+
+	verifiedUser, err := h.verifier.Verify(r.Context(), token)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrExpiredToken):
-			respondError(w, "Refresh token has expired", http.StatusUnauthorized)
+			respondError(w, "Verification link has expired", http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidToken):
+			respondError(w, "Invalid verification link", http.StatusBadRequest)
+		case errors.Is(err, user.ErrUserNotFound):
+			respondError(w, "User not found", http.StatusNotFound)
+		case errors.Is(err, user.ErrEmailMismatch):
+			respondError(w, "Verification link is for a previous email address", http.StatusConflict)
 		default:
-			respondError(w, "Invalid refresh token", http.StatusUnauthorized)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	// Get the user to ensure they still exist
-	existingUser, err := h.userService.GetByID(r.Context(), claims.UserID)
+	respondJSON(w, http.StatusOK, VerifyEmailResponse{
+		Email:      verifiedUser.Email,
+		VerifiedAt: verifiedUser.EmailVerifiedAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// ResendVerification sends a new verification link to the current user
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	existingUser, err := h.userService.GetByID(r.Context(), userID)
 	if err != nil {
 		if errors.Is(err, user.ErrUserNotFound) {
 			respondError(w, "User not found", http.StatusUnauthorized)
@@ -189,27 +234,76 @@ func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate new tokens (TODO: include actual group IDs)
-	tokens, err := h.jwtService.GenerateTokenPair(existingUser.ID, existingUser.Email, nil)
+	if err := h.verifier.Send(r.Context(), existingUser); err != nil {
+		switch {
+		case errors.Is(err, user.ErrEmailAlreadyVerified):
+			respondError(w, "Email is already verified", http.StatusConflict)
+		default:
+			respondError(w, "Failed to send verification email", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// UnlockAccount clears any login backoff or lockout on a user's account
+func (h *Handler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userId"))
 	if err != nil {
-		respondError(w, "Failed to generate tokens", http.StatusInternalServerError)
+		respondError(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, AuthResponse{
-		User: &UserResponse{
-			ID:        existingUser.ID.String(),
-			Email:     existingUser.Email,
-			CreatedAt: existingUser.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		},
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
-		ExpiresAt:    tokens.ExpiresAt.Format("2006-01-02T15:04:05Z"),
+	existingUser, err := h.userService.GetByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			respondError(w, "User not found", http.StatusNotFound)
+			return
+		}
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.guard.Clear(r.Context(), existingUser.Email, ""); err != nil {
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	requestingUserID, _ := GetUserID(r.Context())
+	h.audit.Record(r.Context(), &audit.Event{
+		ActorID:    requestingUserID,
+		Action:     audit.ActionAccountUnlock,
+		TargetType: audit.TargetUser,
+		TargetID:   existingUser.ID.String(),
 	})
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // Helper functions
 
+// clientIP returns the client address without the port. realip.Middleware
+// has already replaced RemoteAddr with the forwarded address when the
+// request came through a trusted proxy.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// respondBlocked reports a login attempt rejected by brute-force protection
+func respondBlocked(w http.ResponseWriter, blocked *lockout.BlockedError) {
+	seconds := int(blocked.RetryAfter.Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	if blocked.Locked {
+		respondError(w, "Account is temporarily locked due to too many failed attempts", http.StatusTooManyRequests)
+		return
+	}
+	respondError(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+}
+
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -6,6 +6,7 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/user"
 )
 
 var (
@@ -17,8 +18,9 @@ var (
 type TokenType string
 
 const (
-	AccessToken  TokenType = "access"
-	RefreshToken TokenType = "refresh"
+	AccessToken            TokenType = "access"
+	RefreshToken           TokenType = "refresh"
+	EmailVerificationToken TokenType = "email_verification"
 )
 
 // Claims represents the JWT claims
@@ -26,7 +28,11 @@ type Claims struct {
 	UserID   uuid.UUID `json:"user_id"`
 	Email    string    `json:"email"`
 	GroupIDs []string  `json:"group_ids,omitempty"`
-	Type     TokenType `json:"type"`
+	IsAdmin  bool      `json:"admin,omitempty"`
+	// Generation is the user's token generation when a refresh token was
+	// issued; it stops working once the generation moves on
+	Generation int       `json:"gen,omitempty"`
+	Type       TokenType `json:"type"`
 	jwt.RegisteredClaims
 }
 
@@ -57,12 +63,28 @@ type TokenPair struct {
 
 // GenerateTokenPair creates a new access and refresh token pair
 func (s *JWTService) GenerateTokenPair(userID uuid.UUID, email string, groupIDs []string) (*TokenPair, error) {
-	accessToken, accessExp, err := s.generateToken(userID, email, groupIDs, AccessToken, s.accessTokenTTL)
+	return s.generateTokenPair(&Claims{UserID: userID, Email: email, GroupIDs: groupIDs}, 0)
+}
+
+// GenerateUserTokenPair creates a token pair for a user, carrying their site
+// admin flag in the access token and their token generation in the refresh
+// token
+func (s *JWTService) GenerateUserTokenPair(u *user.User, groupIDs []string) (*TokenPair, error) {
+	access := &Claims{UserID: u.ID, Email: u.Email, GroupIDs: groupIDs, IsAdmin: u.IsAdmin}
+	return s.generateTokenPair(access, u.TokenGeneration)
+}
+
+func (s *JWTService) generateTokenPair(access *Claims, generation int) (*TokenPair, error) {
+	access.Type = AccessToken
+	accessToken, accessExp, err := s.generateToken(access, s.accessTokenTTL)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, _, err := s.generateToken(userID, email, nil, RefreshToken, s.refreshTokenTTL)
+	// Refresh tokens carry identity only; privileges are re-read from the
+	// database when they are exchanged
+	refresh := &Claims{UserID: access.UserID, Email: access.Email, Generation: generation, Type: RefreshToken}
+	refreshToken, _, err := s.generateToken(refresh, s.refreshTokenTTL)
 	if err != nil {
 		return nil, err
 	}
@@ -74,23 +96,17 @@ func (s *JWTService) GenerateTokenPair(userID uuid.UUID, email string, groupIDs
 	}, nil
 }
 
-// generateToken creates a single JWT token
-func (s *JWTService) generateToken(userID uuid.UUID, email string, groupIDs []string, tokenType TokenType, ttl time.Duration) (string, time.Time, error) {
+// generateToken signs a single JWT token for the given claims
+func (s *JWTService) generateToken(claims *Claims, ttl time.Duration) (string, time.Time, error) {
 	now := time.Now()
 	expiresAt := now.Add(ttl)
 
-	claims := &Claims{
-		UserID:   userID,
-		Email:    email,
-		GroupIDs: groupIDs,
-		Type:     tokenType,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(now),
-			NotBefore: jwt.NewNumericDate(now),
-			Issuer:    s.issuer,
-			Subject:   userID.String(),
-		},
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Issuer:    s.issuer,
+		Subject:   claims.UserID.String(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -153,3 +169,24 @@ func (s *JWTService) ValidateRefreshToken(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// GenerateEmailVerificationToken creates a token proving ownership of email
+func (s *JWTService) GenerateEmailVerificationToken(userID uuid.UUID, email string, ttl time.Duration) (string, error) {
+	claims := &Claims{UserID: userID, Email: email, Type: EmailVerificationToken}
+	token, _, err := s.generateToken(claims, ttl)
+	return token, err
+}
+
+// ValidateEmailVerificationToken validates an email verification token
+func (s *JWTService) ValidateEmailVerificationToken(tokenString string) (*Claims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != EmailVerificationToken {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/user"
 )
 
 func TestJWTService_GenerateAndValidate(t *testing.T) {
@@ -129,3 +130,83 @@ func TestJWTService_DifferentSecret(t *testing.T) {
 		t.Error("expected error when validating with different secret")
 	}
 }
+
+func TestJWTService_EmailVerificationToken(t *testing.T) {
+	svc := NewJWTService("test-secret-key-that-is-long-enough", 15*time.Minute, 7*24*time.Hour, "test-issuer")
+
+	userID := uuid.New()
+	token, err := svc.GenerateEmailVerificationToken(userID, "test@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to generate verification token: %v", err)
+	}
+
+	claims, err := svc.ValidateEmailVerificationToken(token)
+	if err != nil {
+		t.Fatalf("failed to validate verification token: %v", err)
+	}
+	if claims.UserID != userID {
+		t.Errorf("expected user ID %s, got %s", userID, claims.UserID)
+	}
+	if claims.Email != "test@example.com" {
+		t.Errorf("expected email test@example.com, got %s", claims.Email)
+	}
+
+	// A verification token must not be usable as an access token
+	if _, err := svc.ValidateAccessToken(token); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+
+	// And an access token must not verify an email
+	pair, err := svc.GenerateTokenPair(userID, "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to generate token pair: %v", err)
+	}
+	if _, err := svc.ValidateEmailVerificationToken(pair.AccessToken); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestJWTService_AdminClaim(t *testing.T) {
+	svc := NewJWTService("test-secret-key-that-is-long-enough", 15*time.Minute, 7*24*time.Hour, "test-issuer")
+
+	u := &user.User{ID: uuid.New(), Email: "admin@example.com", IsAdmin: true}
+	pair, err := svc.GenerateUserTokenPair(u, nil)
+	if err != nil {
+		t.Fatalf("failed to generate token pair: %v", err)
+	}
+
+	claims, err := svc.ValidateAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to validate access token: %v", err)
+	}
+	if !claims.IsAdmin {
+		t.Error("expected admin flag in access token")
+	}
+
+	// Refresh tokens do not carry privileges
+	refreshClaims, err := svc.ValidateRefreshToken(pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("failed to validate refresh token: %v", err)
+	}
+	if refreshClaims.IsAdmin {
+		t.Error("expected no admin flag in refresh token")
+	}
+}
+
+func TestJWTService_RefreshGeneration(t *testing.T) {
+	svc := NewJWTService("test-secret-key-that-is-long-enough", 15*time.Minute, 7*24*time.Hour, "test-issuer")
+
+	u := &user.User{ID: uuid.New(), Email: "test@example.com", TokenGeneration: 3}
+	pair, err := svc.GenerateUserTokenPair(u, nil)
+	if err != nil {
+		t.Fatalf("failed to generate token pair: %v", err)
+	}
+
+	claims, err := svc.ValidateRefreshToken(pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("failed to validate refresh token: %v", err)
+	}
+	if claims.Generation != 3 {
+		t.Errorf("expected generation 3 in refresh token, got %d", claims.Generation)
+	}
+}
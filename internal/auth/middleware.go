@@ -2,10 +2,12 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/user"
 )
 
 // ContextKey is a custom type for context keys
@@ -20,47 +22,132 @@ const (
 	GroupIDsKey ContextKey = "group_ids"
 	// ClaimsKey is the context key for the full claims
 	ClaimsKey ContextKey = "claims"
+	// UserKey is the context key for the user's account as loaded for the
+	// request
+	UserKey ContextKey = "user"
 )
 
-// Middleware returns an HTTP middleware that validates JWT tokens
-func Middleware(jwtService *JWTService) func(http.Handler) http.Handler {
+var (
+	errMissingAuthorization   = errors.New("authorization header required")
+	errMalformedAuthorization = errors.New("invalid authorization header format")
+)
+
+// Middleware returns an HTTP middleware that validates JWT tokens and rejects
+// users whose accounts have been disabled or deleted since the token was issued
+func Middleware(jwtService *JWTService, userService *user.Service) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get the Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			claims, u, err := authenticate(r.Context(), jwtService, userService, r.Header.Get("Authorization"))
+			if err != nil {
+				switch {
+				case errors.Is(err, errMissingAuthorization):
+					http.Error(w, "Authorization header required", http.StatusUnauthorized)
+				case errors.Is(err, errMalformedAuthorization):
+					http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+				case errors.Is(err, ErrExpiredToken):
+					http.Error(w, "Token has expired", http.StatusUnauthorized)
+				case errors.Is(err, ErrInvalidToken):
+					http.Error(w, "Invalid token", http.StatusUnauthorized)
+				case errors.Is(err, user.ErrAccountDisabled):
+					http.Error(w, "Account is disabled", http.StatusForbidden)
+				default:
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+				}
 				return
 			}
 
-			// Check for Bearer prefix
-			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims, u)))
+		})
+	}
+}
+
+// authenticate validates the bearer token in an Authorization value and
+// loads its user, checking that the account is still active. Every token
+// failure, including a deleted user, is reported as ErrInvalidToken or
+// ErrExpiredToken.
+func authenticate(ctx context.Context, jwtService *JWTService, userService *user.Service, authorization string) (*Claims, *user.User, error) {
+	if authorization == "" {
+		return nil, nil, errMissingAuthorization
+	}
+
+	// Check for Bearer prefix
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return nil, nil, errMalformedAuthorization
+	}
+
+	claims, err := jwtService.ValidateAccessToken(parts[1])
+	if err != nil {
+		if err == ErrExpiredToken {
+			return nil, nil, ErrExpiredToken
+		}
+		return nil, nil, ErrInvalidToken
+	}
+
+	u, err := userService.GetActive(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+	return claims, u, nil
+}
+
+// withClaims adds a token's claims and its user to a context, where
+// handlers read them with GetUserID and the other getters
+func withClaims(ctx context.Context, claims *Claims, u *user.User) context.Context {
+	ctx = context.WithValue(ctx, UserIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, EmailKey, claims.Email)
+	ctx = context.WithValue(ctx, GroupIDsKey, claims.GroupIDs)
+	ctx = context.WithValue(ctx, ClaimsKey, claims)
+	ctx = context.WithValue(ctx, UserKey, u)
+	return ctx
+}
+
+// RequireVerifiedEmail returns a middleware that rejects requests from users
+// whose email address must be verified before performing the action. It must
+// be mounted after Middleware.
+func RequireVerifiedEmail(userService *user.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := GetUserID(r.Context())
+			if !ok {
+				respondError(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
-			tokenString := parts[1]
-
-			// Validate the token
-			claims, err := jwtService.ValidateAccessToken(tokenString)
-			if err != nil {
-				if err == ErrExpiredToken {
-					http.Error(w, "Token has expired", http.StatusUnauthorized)
-					return
+			if err := userService.RequireVerifiedEmail(r.Context(), userID); err != nil {
+				switch {
+				case errors.Is(err, user.ErrEmailNotVerified):
+					respondError(w, "Email address must be verified", http.StatusForbidden)
+				case errors.Is(err, user.ErrUserNotFound):
+					respondError(w, "Unauthorized", http.StatusUnauthorized)
+				default:
+					respondError(w, "Internal server error", http.StatusInternalServerError)
 				}
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
 				return
 			}
 
-			// Add claims to context
-			ctx := r.Context()
-			ctx = context.WithValue(ctx, UserIDKey, claims.UserID)
-			ctx = context.WithValue(ctx, EmailKey, claims.Email)
-			ctx = context.WithValue(ctx, GroupIDsKey, claims.GroupIDs)
-			ctx = context.WithValue(ctx, ClaimsKey, claims)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAdmin returns a middleware that only admits site administrators.
+// It checks the account loaded for the request rather than the token's
+// admin claim, so a demoted admin loses access at once. It must be mounted
+// after Middleware.
+func RequireAdmin() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, ok := GetUser(r.Context())
+			if !ok || !u.IsAdmin {
+				respondError(w, "Site administrator access required", http.StatusForbidden)
+				return
+			}
 
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r)
 		})
 	}
 }
@@ -88,3 +175,10 @@ func GetClaims(ctx context.Context) (*Claims, bool) {
 	claims, ok := ctx.Value(ClaimsKey).(*Claims)
 	return claims, ok
 }
+
+// GetUser extracts the authenticated user's account from the request
+// context
+func GetUser(ctx context.Context) (*user.User, bool) {
+	u, ok := ctx.Value(UserKey).(*user.User)
+	return u, ok && u != nil
+}
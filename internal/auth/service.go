@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/lockout"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+var (
+	// ErrCredentialsRequired is returned for a login without an email or
+	// password
+	ErrCredentialsRequired = errors.New("email and password are required")
+	// ErrInvalidCredentials is returned for an unknown email or a wrong
+	// password, which are not told apart
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrRefreshTokenRequired is returned for a refresh without a token
+	ErrRefreshTokenRequired = errors.New("refresh token is required")
+	// ErrRevokedToken is returned for a refresh token issued before the
+	// user's tokens were revoked
+	ErrRevokedToken = errors.New("token has been revoked")
+)
+
+// Session is a signed-in user and the tokens issued to them
+type Session struct {
+	User   *user.User
+	Tokens *TokenPair
+}
+
+// Service signs users in. The REST handler, the gRPC server and the SFTP
+// listener all go through it, so brute-force protection, audit events and
+// token checks behave the same everywhere; frontends only translate its
+// errors. Blocked attempts are reported as *lockout.BlockedError.
+type Service struct {
+	users    *user.Service
+	jwt      *JWTService
+	verifier *Verifier
+	guard    *lockout.Guard
+	audit    audit.Recorder
+}
+
+// NewService creates a new sign-in service
+func NewService(userService *user.Service, jwtService *JWTService, verifier *Verifier, guard *lockout.Guard, recorder audit.Recorder) *Service {
+	return &Service{
+		users:    userService,
+		jwt:      jwtService,
+		verifier: verifier,
+		guard:    guard,
+		audit:    recorder,
+	}
+}
+
+// Register creates an account, emails its verification link and signs it in
+func (s *Service) Register(ctx context.Context, email, password string) (*Session, error) {
+	newUser, err := s.users.Register(ctx, &user.CreateUserInput{Email: email, Password: password})
+	if err != nil {
+		return nil, err
+	}
+
+	// Send the verification link; the user can request another if this fails
+	if err := s.verifier.Send(ctx, newUser); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", newUser.ID, err)
+	}
+
+	return s.session(newUser)
+}
+
+// Login checks an email and password like Authenticate and issues a token
+// pair
+func (s *Service) Login(ctx context.Context, email, password, ip string) (*Session, error) {
+	u, err := s.Authenticate(ctx, email, password, ip)
+	if err != nil {
+		return nil, err
+	}
+	return s.session(u)
+}
+
+// Authenticate checks an email and password from a client at ip and
+// returns the account. Attempts are throttled per account and per IP, and
+// every outcome is audited.
+func (s *Service) Authenticate(ctx context.Context, email, password, ip string) (*user.User, error) {
+	if email == "" || password == "" {
+		return nil, ErrCredentialsRequired
+	}
+
+	// Count the attempt, and reject it while the account or client is in
+	// backoff, before spending any time on password hashing
+	if err := s.guard.Attempt(ctx, email, ip); err != nil {
+		return nil, err
+	}
+
+	u, err := s.users.Authenticate(ctx, email, password)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrAccountDisabled):
+			s.recordLoginFailure(ctx, email, "account disabled")
+			return nil, err
+		case errors.Is(err, user.ErrUserNotFound), errors.Is(err, user.ErrInvalidPassword):
+			s.recordLoginFailure(ctx, email, "invalid credentials")
+			return nil, ErrInvalidCredentials
+		default:
+			// The credentials were never judged, so the attempt does not
+			// count against the account or the client
+			if releaseErr := s.guard.Release(ctx, email, ip); releaseErr != nil {
+				log.Printf("Failed to release login attempt: %v", releaseErr)
+			}
+			return nil, err
+		}
+	}
+
+	if err := s.guard.Clear(ctx, email, ip); err != nil {
+		log.Printf("Failed to reset login failures: %v", err)
+	}
+
+	s.audit.Record(ctx, &audit.Event{
+		ActorID:    u.ID,
+		Action:     audit.ActionLoginSucceeded,
+		TargetType: audit.TargetUser,
+		TargetID:   u.ID.String(),
+	})
+	return u, nil
+}
+
+// Refresh exchanges a refresh token from a client at ip for a new token
+// pair. The account must still be active, and its tokens not revoked since
+// the refresh token was issued.
+func (s *Service) Refresh(ctx context.Context, refreshToken, ip string) (*Session, error) {
+	if refreshToken == "" {
+		return nil, ErrRefreshTokenRequired
+	}
+
+	// Refresh tokens are not tied to an account until validated, so only the
+	// client IP is throttled here
+	if err := s.guard.Attempt(ctx, "", ip); err != nil {
+		return nil, err
+	}
+
+	claims, err := s.jwt.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.guard.Clear(ctx, "", ip); err != nil {
+		log.Printf("Failed to release refresh attempt: %v", err)
+	}
+
+	// Get the user to ensure they still exist
+	u, err := s.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsDisabled() {
+		return nil, user.ErrAccountDisabled
+	}
+	if claims.Generation != u.TokenGeneration {
+		return nil, ErrRevokedToken
+	}
+
+	return s.session(u)
+}
+
+// session issues a token pair for u (TODO: include actual group IDs)
+func (s *Service) session(u *user.User) (*Session, error) {
+	tokens, err := s.jwt.GenerateUserTokenPair(u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{User: u, Tokens: tokens}, nil
+}
+
+// recordLoginFailure audits a rejected login. The attempted email is kept in
+// metadata because it may not belong to any account.
+func (s *Service) recordLoginFailure(ctx context.Context, email, reason string) {
+	s.audit.Record(ctx, &audit.Event{
+		Action:   audit.ActionLoginFailed,
+		Metadata: map[string]string{"email": email, "reason": reason},
+	})
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/lockout"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// auditLog records the actions of the events sent to it
+type auditLog struct {
+	mu      sync.Mutex
+	actions []string
+}
+
+func (l *auditLog) Record(ctx context.Context, event *audit.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.actions = append(l.actions, event.Action)
+}
+
+func (l *auditLog) last() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.actions) == 0 {
+		return ""
+	}
+	return l.actions[len(l.actions)-1]
+}
+
+// newTestService returns a sign-in service for u, whose password is
+// "password123", that locks accounts after three failures
+func newTestService(t *testing.T, u *user.User) (*Service, *JWTService, *auditLog) {
+	t.Helper()
+	hasher := user.NewPasswordHasher(user.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	hash, err := hasher.Hash("password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.PasswordHash = hash
+
+	users := user.NewService(&userRepo{users: map[uuid.UUID]*user.User{u.ID: u}}, hasher, user.VerificationPolicyOff)
+	jwtService := NewJWTService("test-secret-key-that-is-long-enough", 15*time.Minute, time.Hour, "test")
+	policy := lockout.Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, LockAfter: 3, LockoutDuration: time.Hour}
+	guard := lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{Account: policy, IP: policy, Window: time.Hour})
+	log := &auditLog{}
+	return NewService(users, jwtService, nil, guard, log), jwtService, log
+}
+
+func TestServiceLogin(t *testing.T) {
+	u := &user.User{ID: uuid.New(), Email: "a@example.com"}
+	svc, jwtService, log := newTestService(t, u)
+	ctx := context.Background()
+
+	if _, err := svc.Login(ctx, "a@example.com", "", "192.0.2.1"); !errors.Is(err, ErrCredentialsRequired) {
+		t.Errorf("Login(no password) error = %v, want ErrCredentialsRequired", err)
+	}
+	for _, email := range []string{"a@example.com", "nobody@example.com"} {
+		if _, err := svc.Login(ctx, email, "wrong-password", "192.0.2.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Login(%s, wrong password) error = %v, want ErrInvalidCredentials", email, err)
+		}
+		if log.last() != audit.ActionLoginFailed {
+			t.Errorf("failed login audited as %q", log.last())
+		}
+	}
+
+	session, err := svc.Login(ctx, "a@example.com", "password123", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if session.User.ID != u.ID || log.last() != audit.ActionLoginSucceeded {
+		t.Errorf("session user = %v, audited as %q", session.User.ID, log.last())
+	}
+	if claims, err := jwtService.ValidateAccessToken(session.Tokens.AccessToken); err != nil || claims.UserID != u.ID {
+		t.Errorf("access token claims = %+v, %v", claims, err)
+	}
+
+	// The successful login cleared the account's failures, so it takes
+	// three more to lock it
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Login(ctx, "a@example.com", "wrong-password", "192.0.2.2"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Login(wrong password) error = %v, want ErrInvalidCredentials", err)
+		}
+	}
+	var blocked *lockout.BlockedError
+	if _, err := svc.Login(ctx, "a@example.com", "password123", "192.0.2.2"); !errors.As(err, &blocked) {
+		t.Errorf("Login in backoff error = %v, want *lockout.BlockedError", err)
+	}
+
+	// Disabled accounts are refused with the right password
+	now := time.Now()
+	u.DisabledAt = &now
+	svc, _, _ = newTestService(t, u)
+	if _, err := svc.Authenticate(ctx, "a@example.com", "password123", ""); !errors.Is(err, user.ErrAccountDisabled) {
+		t.Errorf("Authenticate(disabled) error = %v, want ErrAccountDisabled", err)
+	}
+}
+
+func TestServiceLoginReleasesAttemptOnError(t *testing.T) {
+	u := &user.User{ID: uuid.New(), Email: "a@example.com"}
+	svc, _, log := newTestService(t, u)
+	ctx := context.Background()
+	hash := u.PasswordHash
+
+	// Two failures are free, and the next would lock the account
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Login(ctx, "a@example.com", "wrong-password", "192.0.2.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Login(wrong password) error = %v, want ErrInvalidCredentials", err)
+		}
+	}
+
+	// An unreadable stored hash fails like a database error would, before
+	// the password is checked, so none of these attempts count
+	u.PasswordHash = "corrupt"
+	audited := len(log.actions)
+	var blocked *lockout.BlockedError
+	for i := 0; i < 3; i++ {
+		_, err := svc.Login(ctx, "a@example.com", "password123", "192.0.2.1")
+		if err == nil || errors.As(err, &blocked) || errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Login(internal error) %d error = %v, want the internal error", i, err)
+		}
+	}
+	if len(log.actions) != audited {
+		t.Errorf("internal errors were audited as %q", log.actions[audited:])
+	}
+
+	u.PasswordHash = hash
+	if _, err := svc.Login(ctx, "a@example.com", "password123", "192.0.2.1"); err != nil {
+		t.Errorf("Login after internal errors: %v", err)
+	}
+}
+
+func TestServiceRefresh(t *testing.T) {
+	u := &user.User{ID: uuid.New(), Email: "a@example.com"}
+	svc, jwtService, _ := newTestService(t, u)
+	ctx := context.Background()
+
+	pair, err := jwtService.GenerateUserTokenPair(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := svc.Refresh(ctx, pair.RefreshToken, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if session.User.ID != u.ID {
+		t.Errorf("session user = %v, want %v", session.User.ID, u.ID)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"missing", "", ErrRefreshTokenRequired},
+		{"access token", pair.AccessToken, ErrInvalidToken},
+		{"garbage", "not-a-token", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		if _, err := svc.Refresh(ctx, tt.token, ""); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Refresh error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	u.TokenGeneration++
+	if _, err := svc.Refresh(ctx, pair.RefreshToken, ""); !errors.Is(err, ErrRevokedToken) {
+		t.Errorf("Refresh(revoked) error = %v, want ErrRevokedToken", err)
+	}
+	pair, _ = jwtService.GenerateUserTokenPair(u, nil)
+	now := time.Now()
+	u.DisabledAt = &now
+	if _, err := svc.Refresh(ctx, pair.RefreshToken, ""); !errors.Is(err, user.ErrAccountDisabled) {
+		t.Errorf("Refresh(disabled) error = %v, want ErrAccountDisabled", err)
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/testifysec/dropbox-clone/internal/mail"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// Verifier issues and checks signed email verification links
+type Verifier struct {
+	userService *user.Service
+	jwtService  *JWTService
+	mailer      mail.Sender
+	baseURL     string
+	ttl         time.Duration
+}
+
+// NewVerifier creates a new email verifier. baseURL is the public URL of the
+// API, used to build the link sent to the user.
+func NewVerifier(userService *user.Service, jwtService *JWTService, mailer mail.Sender, baseURL string, ttl time.Duration) *Verifier {
+	return &Verifier{
+		userService: userService,
+		jwtService:  jwtService,
+		mailer:      mailer,
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		ttl:         ttl,
+	}
+}
+
+// Send emails a verification link to the user's current address
+func (v *Verifier) Send(ctx context.Context, u *user.User) error {
+	if u.IsEmailVerified() {
+		return user.ErrEmailAlreadyVerified
+	}
+
+	token, err := v.jwtService.GenerateEmailVerificationToken(u.ID, u.Email, v.ttl)
+	if err != nil {
+		return err
+	}
+
+	link := v.baseURL + "/api/v1/auth/verify-email?token=" + url.QueryEscape(token)
+	return v.mailer.Send(ctx, &mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not create an account, you can ignore this email.\n",
+			link, v.ttl),
+	})
+}
+
+// Verify checks a verification token and marks the user's email as verified
+func (v *Verifier) Verify(ctx context.Context, token string) (*user.User, error) {
+	claims, err := v.jwtService.ValidateEmailVerificationToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return v.userService.VerifyEmail(ctx, claims.UserID, claims.Email)
+}
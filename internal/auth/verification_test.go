@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/mail"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// outbox records the messages sent to it
+type outbox struct {
+	mu       sync.Mutex
+	messages []*mail.Message
+}
+
+func (o *outbox) Send(ctx context.Context, msg *mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// lastToken returns the verification token linked to in the last message
+func (o *outbox) lastToken(t *testing.T, to string) string {
+	t.Helper()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.messages) == 0 {
+		t.Fatal("no verification email was sent")
+	}
+	msg := o.messages[len(o.messages)-1]
+	if msg.To != to {
+		t.Fatalf("verification email sent to %s, want %s", msg.To, to)
+	}
+	for _, field := range strings.Fields(msg.Body) {
+		if link, err := url.Parse(field); err == nil && link.Query().Get("token") != "" {
+			return link.Query().Get("token")
+		}
+	}
+	t.Fatalf("no verification link in %q", msg.Body)
+	return ""
+}
+
+// verificationServer serves the verification routes and an upload route
+// that requires a verified email, under policy
+type verificationServer struct {
+	router     http.Handler
+	jwtService *JWTService
+	users      *user.Service
+	outbox     *outbox
+}
+
+func newVerificationServer(t *testing.T, policy user.VerificationPolicy, u *user.User) *verificationServer {
+	t.Helper()
+	hasher := user.NewPasswordHasher(user.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	hash, err := hasher.Hash("password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.PasswordHash = hash
+
+	s := &verificationServer{
+		jwtService: NewJWTService("test-secret-key-that-is-long-enough", 15*time.Minute, time.Hour, "test"),
+		users:      user.NewService(&userRepo{users: map[uuid.UUID]*user.User{u.ID: u}}, hasher, policy),
+		outbox:     &outbox{},
+	}
+	verifier := NewVerifier(s.users, s.jwtService, s.outbox, "https://dbx.example.com/", time.Hour)
+	h := NewHandler(NewService(s.users, s.jwtService, verifier, nil, audit.Nop{}), s.users, verifier, nil, audit.Nop{})
+
+	r := chi.NewRouter()
+	r.Get("/auth/verify-email", h.VerifyEmail)
+	r.Group(func(r chi.Router) {
+		r.Use(Middleware(s.jwtService, s.users))
+		r.Post("/auth/verify-email/resend", h.ResendVerification)
+		r.With(RequireVerifiedEmail(s.users)).Post("/upload", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+	s.router = r
+	return s
+}
+
+// do sends a request as u, or anonymously if u is nil, and returns the
+// status and error message
+func (s *verificationServer) do(t *testing.T, method, target string, u *user.User) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if u != nil {
+		pair, err := s.jwtService.GenerateUserTokenPair(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	var resp ErrorResponse
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec.Code, resp.Error
+}
+
+func (s *verificationServer) verify(t *testing.T, token string) (int, string) {
+	t.Helper()
+	return s.do(t, http.MethodGet, "/auth/verify-email?token="+url.QueryEscape(token), nil)
+}
+
+func TestVerifyEmailFlow(t *testing.T) {
+	u := &user.User{ID: uuid.New(), Email: "old@example.com"}
+	s := newVerificationServer(t, user.VerificationPolicyRestricted, u)
+	ctx := context.Background()
+
+	if code, _ := s.do(t, http.MethodPost, "/upload", u); code != http.StatusForbidden {
+		t.Fatalf("unverified upload status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	// A link sent before the address changed cannot verify the new one
+	if code, _ := s.do(t, http.MethodPost, "/auth/verify-email/resend", u); code != http.StatusAccepted {
+		t.Fatalf("resend status = %d, want %d", code, http.StatusAccepted)
+	}
+	stale := s.outbox.lastToken(t, "old@example.com")
+	if _, err := s.users.ChangeEmail(ctx, u.ID, "password123", "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if code, msg := s.verify(t, stale); code != http.StatusConflict {
+		t.Fatalf("stale link status = %d (%s), want %d", code, msg, http.StatusConflict)
+	}
+	if code, _ := s.do(t, http.MethodPost, "/upload", u); code != http.StatusForbidden {
+		t.Fatalf("upload after stale link status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	if code, _ := s.do(t, http.MethodPost, "/auth/verify-email/resend", u); code != http.StatusAccepted {
+		t.Fatalf("resend status = %d, want %d", code, http.StatusAccepted)
+	}
+	if code, msg := s.verify(t, s.outbox.lastToken(t, "new@example.com")); code != http.StatusOK {
+		t.Fatalf("verify status = %d (%s), want %d", code, msg, http.StatusOK)
+	}
+	if code, _ := s.do(t, http.MethodPost, "/upload", u); code != http.StatusNoContent {
+		t.Errorf("verified upload status = %d, want %d", code, http.StatusNoContent)
+	}
+
+	// Nothing is sent for an address that is already verified
+	sent := len(s.outbox.messages)
+	if code, _ := s.do(t, http.MethodPost, "/auth/verify-email/resend", u); code != http.StatusConflict {
+		t.Errorf("resend when verified status = %d, want %d", code, http.StatusConflict)
+	}
+	if len(s.outbox.messages) != sent {
+		t.Error("verification email sent for a verified address")
+	}
+}
+
+func TestVerifyEmailRejectsBadTokens(t *testing.T) {
+	u := &user.User{ID: uuid.New(), Email: "a@example.com"}
+	s := newVerificationServer(t, user.VerificationPolicyRestricted, u)
+
+	expired, err := s.jwtService.GenerateEmailVerificationToken(u.ID, u.Email, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := s.jwtService.GenerateUserTokenPair(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone, err := s.jwtService.GenerateEmailVerificationToken(uuid.New(), "gone@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		code  int
+		msg   string
+	}{
+		{"missing", "", http.StatusBadRequest, "Verification token is required"},
+		{"expired", expired, http.StatusBadRequest, "Verification link has expired"},
+		{"access token", access.AccessToken, http.StatusBadRequest, "Invalid verification link"},
+		{"refresh token", access.RefreshToken, http.StatusBadRequest, "Invalid verification link"},
+		{"garbage", "not-a-token", http.StatusBadRequest, "Invalid verification link"},
+		{"deleted user", gone, http.StatusNotFound, "User not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, msg := s.verify(t, tt.token)
+			if code != tt.code || msg != tt.msg {
+				t.Errorf("verify = %d %q, want %d %q", code, msg, tt.code, tt.msg)
+			}
+		})
+	}
+	if u.IsEmailVerified() {
+		t.Error("a rejected token verified the address")
+	}
+}
+
+func TestRequireVerifiedEmailPolicyOff(t *testing.T) {
+	u := &user.User{ID: uuid.New(), Email: "a@example.com"}
+	s := newVerificationServer(t, user.VerificationPolicyOff, u)
+
+	if code, _ := s.do(t, http.MethodPost, "/upload", u); code != http.StatusNoContent {
+		t.Errorf("unverified upload status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code, _ := s.do(t, http.MethodPost, "/upload", nil); code != http.StatusUnauthorized {
+		t.Errorf("anonymous upload status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -4,23 +4,44 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/testifysec/dropbox-clone/internal/realip"
+	"github.com/testifysec/dropbox-clone/internal/user"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	S3       S3Config
+	Server     ServerConfig
+	Database   DatabaseConfig
+	JWT        JWTConfig
+	S3         S3Config
+	Auth       AuthConfig
+	Mail       MailConfig
+	Lockout    LockoutConfig
+	Admin      AdminConfig
+	SCIM       SCIMConfig
+	Webhook    WebhookConfig
+	Events     EventsConfig
+	Delta      DeltaConfig
+	Indexing   IndexingConfig
+	Thumbnails ThumbnailsConfig
+	WebDAV     WebDAVConfig
+	S3Gateway  S3GatewayConfig
+	SFTP       SFTPConfig
+	GRPC       GRPCConfig
+	OpenAPI    OpenAPIConfig
 }
 
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
-	Port         string
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	IdleTimeout  time.Duration
+	Port           string
+	PublicURL      string // Externally reachable base URL, used in emailed links
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+	TrustedProxies []string // Proxies whose X-Forwarded-For and X-Real-IP headers are believed
 }
 
 // DatabaseConfig holds database connection configuration
@@ -49,14 +70,127 @@ type S3Config struct {
 	UsePathStyle    bool   // Required for MinIO
 }
 
+// AuthConfig holds account policy configuration
+type AuthConfig struct {
+	EmailVerificationPolicy string // "off" or "restricted"
+	EmailVerificationTTL    time.Duration
+	Argon2MemoryKiB         int // Argon2id memory cost for new password hashes
+	Argon2Iterations        int
+	Argon2Parallelism       int
+}
+
+// LockoutConfig holds brute-force protection configuration
+type LockoutConfig struct {
+	Store           string // "postgres" (shared by replicas) or "memory"
+	FreeAttempts    int    // Failures per account before backoff starts
+	MaxFailures     int    // Failures per account before lockout
+	LockoutDuration time.Duration
+	BackoffBase     time.Duration
+	BackoffMax      time.Duration
+	IPFreeAttempts  int
+	IPMaxFailures   int
+	FailureWindow   time.Duration // Failures older than this are forgotten
+}
+
+// AdminConfig holds instance administration configuration
+type AdminConfig struct {
+	BootstrapEmails []string // Accounts granted site admin at startup
+}
+
+// SCIMConfig holds SCIM provisioning configuration
+type SCIMConfig struct {
+	Token string // Bearer token for the identity provider; empty disables SCIM
+}
+
+// WebhookConfig holds outgoing webhook delivery configuration
+type WebhookConfig struct {
+	MaxAttempts  int           // Attempts before a delivery is marked failed
+	BackoffBase  time.Duration // Retry delay after the first failure, doubled per attempt
+	BackoffMax   time.Duration
+	Timeout      time.Duration // Per-request timeout
+	PollInterval time.Duration
+	// AllowPrivateNetworks permits deliveries to loopback and private
+	// addresses, for development receivers
+	AllowPrivateNetworks bool
+}
+
+// EventsConfig holds real-time event stream configuration
+type EventsConfig struct {
+	Retention time.Duration // How long clients can resume a stream with Last-Event-ID
+}
+
+// DeltaConfig holds delta sync configuration
+type DeltaConfig struct {
+	LongpollMaxTimeout time.Duration // Longest a long poll may wait for changes
+}
+
+// IndexingConfig holds file content indexing configuration
+type IndexingConfig struct {
+	Enabled      bool // Run an indexer in this replica
+	PollInterval time.Duration
+	MaxAttempts  int   // Attempts before a file is left unindexed
+	MaxFileSize  int64 // Documents parsed as a whole, such as docx, are skipped above this size
+	MaxTextSize  int   // Bytes of extracted text indexed per file
+}
+
+// ThumbnailsConfig holds image thumbnail generation configuration
+type ThumbnailsConfig struct {
+	Enabled      bool // Run a thumbnailer in this replica
+	PollInterval time.Duration
+	MaxAttempts  int   // Attempts before an image is left without thumbnails
+	MaxFileSize  int64 // Larger images get no thumbnails
+	MaxPixels    int64 // Images with more pixels get no thumbnails, bounding decode memory
+}
+
+// WebDAVConfig holds WebDAV access configuration
+type WebDAVConfig struct {
+	Enabled bool // Serve groups over WebDAV under /dav
+}
+
+// S3GatewayConfig holds S3-compatible gateway configuration
+type S3GatewayConfig struct {
+	Port         string        // Port for the gateway's listener; empty disables it
+	Region       string        // Region clients sign requests for
+	UploadExpiry time.Duration // Unfinished multipart uploads older than this are discarded
+}
+
+// SFTPConfig holds SFTP listener configuration
+type SFTPConfig struct {
+	Port     string   // Port for the SFTP listener; empty disables it
+	HostKeys []string // PEM private key files; a temporary key is generated if none are given
+}
+
+// GRPCConfig holds gRPC server configuration
+type GRPCConfig struct {
+	Port string // Port for the gRPC listener; empty disables it
+}
+
+// OpenAPIConfig holds API document validation configuration
+type OpenAPIConfig struct {
+	// ValidateResponses checks JSON responses against the document and
+	// replaces mismatches with errors, for tests and development
+	ValidateResponses bool
+}
+
+// MailConfig holds outgoing email configuration
+type MailConfig struct {
+	SMTPHost     string // Empty logs emails instead of sending them
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	From         string
+}
+
 // Load reads configuration from environment variables
 func Load() (*Config, error) {
 	cfg := &Config{
 		Server: ServerConfig{
-			Port:         getEnv("PORT", "8080"),
-			ReadTimeout:  getDurationEnv("SERVER_READ_TIMEOUT", 15*time.Second),
-			WriteTimeout: getDurationEnv("SERVER_WRITE_TIMEOUT", 15*time.Second),
-			IdleTimeout:  getDurationEnv("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			Port:           getEnv("PORT", "8080"),
+			PublicURL:      getEnv("PUBLIC_URL", "http://localhost:8080"),
+			ReadTimeout:    getDurationEnv("SERVER_READ_TIMEOUT", 15*time.Second),
+			WriteTimeout:   getDurationEnv("SERVER_WRITE_TIMEOUT", 15*time.Second),
+			IdleTimeout:    getDurationEnv("SERVER_IDLE_TIMEOUT", 60*time.Second),
+			TrustedProxies: getListEnv("TRUSTED_PROXIES"),
 		},
 		Database: DatabaseConfig{
 			URL:             getEnv("DATABASE_URL", ""),
@@ -78,6 +212,83 @@ func Load() (*Config, error) {
 			SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
 			UsePathStyle:    getBoolEnv("S3_USE_PATH_STYLE", false),
 		},
+		Auth: AuthConfig{
+			EmailVerificationPolicy: getEnv("EMAIL_VERIFICATION_POLICY", "off"),
+			EmailVerificationTTL:    getDurationEnv("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+			Argon2MemoryKiB:         getIntEnv("PASSWORD_ARGON2_MEMORY_KIB", 64*1024),
+			Argon2Iterations:        getIntEnv("PASSWORD_ARGON2_ITERATIONS", 3),
+			Argon2Parallelism:       getIntEnv("PASSWORD_ARGON2_PARALLELISM", 2),
+		},
+		Lockout: LockoutConfig{
+			Store:           getEnv("LOCKOUT_STORE", "postgres"),
+			FreeAttempts:    getIntEnv("LOCKOUT_FREE_ATTEMPTS", 3),
+			MaxFailures:     getIntEnv("LOCKOUT_MAX_FAILURES", 10),
+			LockoutDuration: getDurationEnv("LOCKOUT_DURATION", 15*time.Minute),
+			BackoffBase:     getDurationEnv("LOCKOUT_BACKOFF_BASE", time.Second),
+			BackoffMax:      getDurationEnv("LOCKOUT_BACKOFF_MAX", 5*time.Minute),
+			IPFreeAttempts:  getIntEnv("LOCKOUT_IP_FREE_ATTEMPTS", 20),
+			IPMaxFailures:   getIntEnv("LOCKOUT_IP_MAX_FAILURES", 100),
+			FailureWindow:   getDurationEnv("LOCKOUT_FAILURE_WINDOW", time.Hour),
+		},
+		Admin: AdminConfig{
+			BootstrapEmails: getListEnv("ADMIN_EMAILS"),
+		},
+		SCIM: SCIMConfig{
+			Token: getEnv("SCIM_TOKEN", ""),
+		},
+		Webhook: WebhookConfig{
+			MaxAttempts:          getIntEnv("WEBHOOK_MAX_ATTEMPTS", 10),
+			BackoffBase:          getDurationEnv("WEBHOOK_BACKOFF_BASE", 30*time.Second),
+			BackoffMax:           getDurationEnv("WEBHOOK_BACKOFF_MAX", 6*time.Hour),
+			Timeout:              getDurationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+			PollInterval:         getDurationEnv("WEBHOOK_POLL_INTERVAL", 2*time.Second),
+			AllowPrivateNetworks: getBoolEnv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", false),
+		},
+		Events: EventsConfig{
+			Retention: getDurationEnv("EVENTS_RETENTION", 7*24*time.Hour),
+		},
+		Delta: DeltaConfig{
+			LongpollMaxTimeout: getDurationEnv("DELTA_LONGPOLL_MAX_TIMEOUT", 5*time.Minute),
+		},
+		Indexing: IndexingConfig{
+			Enabled:      getBoolEnv("INDEXING_ENABLED", true),
+			PollInterval: getDurationEnv("INDEXING_POLL_INTERVAL", 2*time.Second),
+			MaxAttempts:  getIntEnv("INDEXING_MAX_ATTEMPTS", 5),
+			MaxFileSize:  int64(getIntEnv("INDEXING_MAX_FILE_SIZE", 20<<20)),
+			MaxTextSize:  getIntEnv("INDEXING_MAX_TEXT_SIZE", 256<<10),
+		},
+		Thumbnails: ThumbnailsConfig{
+			Enabled:      getBoolEnv("THUMBNAILS_ENABLED", true),
+			PollInterval: getDurationEnv("THUMBNAILS_POLL_INTERVAL", 2*time.Second),
+			MaxAttempts:  getIntEnv("THUMBNAILS_MAX_ATTEMPTS", 5),
+			MaxFileSize:  int64(getIntEnv("THUMBNAILS_MAX_FILE_SIZE", 50<<20)),
+			MaxPixels:    int64(getIntEnv("THUMBNAILS_MAX_PIXELS", 50_000_000)),
+		},
+		WebDAV: WebDAVConfig{
+			Enabled: getBoolEnv("WEBDAV_ENABLED", true),
+		},
+		S3Gateway: S3GatewayConfig{
+			Port:         getEnv("S3_GATEWAY_PORT", ""),
+			Region:       getEnv("S3_GATEWAY_REGION", "us-east-1"),
+			UploadExpiry: getDurationEnv("S3_GATEWAY_UPLOAD_EXPIRY", 7*24*time.Hour),
+		},
+		SFTP: SFTPConfig{
+			Port:     getEnv("SFTP_PORT", ""),
+			HostKeys: getListEnv("SFTP_HOST_KEYS"),
+		},
+		GRPC: GRPCConfig{
+			Port: getEnv("GRPC_PORT", ""),
+		},
+		OpenAPI: OpenAPIConfig{
+			ValidateResponses: getBoolEnv("OPENAPI_VALIDATE_RESPONSES", false),
+		},
+		Mail: MailConfig{
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnv("SMTP_PORT", "587"),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			From:         getEnv("MAIL_FROM", "no-reply@localhost"),
+		},
 	}
 
 	if err := cfg.Validate(); err != nil {
@@ -101,6 +312,58 @@ func (c *Config) Validate() error {
 	if c.S3.Bucket == "" {
 		return fmt.Errorf("S3_BUCKET is required")
 	}
+	if !user.VerificationPolicy(c.Auth.EmailVerificationPolicy).Valid() {
+		return fmt.Errorf("EMAIL_VERIFICATION_POLICY must be \"off\" or \"restricted\"")
+	}
+	if c.Auth.Argon2MemoryKiB < 8*1024 {
+		return fmt.Errorf("PASSWORD_ARGON2_MEMORY_KIB must be at least 8192")
+	}
+	if c.Auth.Argon2Iterations < 1 {
+		return fmt.Errorf("PASSWORD_ARGON2_ITERATIONS must be at least 1")
+	}
+	if c.Auth.Argon2Parallelism < 1 || c.Auth.Argon2Parallelism > 255 {
+		return fmt.Errorf("PASSWORD_ARGON2_PARALLELISM must be between 1 and 255")
+	}
+	if _, err := realip.ParseProxies(c.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	if s := c.Lockout.Store; s != "postgres" && s != "memory" {
+		return fmt.Errorf("LOCKOUT_STORE must be \"postgres\" or \"memory\"")
+	}
+	if c.SCIM.Token != "" && len(c.SCIM.Token) < 32 {
+		return fmt.Errorf("SCIM_TOKEN must be at least 32 characters")
+	}
+	if c.Webhook.MaxAttempts < 1 {
+		return fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1")
+	}
+	if c.Webhook.Timeout <= 0 || c.Webhook.PollInterval <= 0 {
+		return fmt.Errorf("WEBHOOK_TIMEOUT and WEBHOOK_POLL_INTERVAL must be positive")
+	}
+	if c.Delta.LongpollMaxTimeout <= 0 {
+		return fmt.Errorf("DELTA_LONGPOLL_MAX_TIMEOUT must be positive")
+	}
+	if c.Indexing.PollInterval <= 0 || c.Indexing.MaxAttempts < 1 || c.Indexing.MaxFileSize < 1 {
+		return fmt.Errorf("INDEXING_POLL_INTERVAL, INDEXING_MAX_ATTEMPTS and INDEXING_MAX_FILE_SIZE must be positive")
+	}
+	// A tsvector holds at most 1 MB
+	if c.Indexing.MaxTextSize < 1 || c.Indexing.MaxTextSize > 512<<10 {
+		return fmt.Errorf("INDEXING_MAX_TEXT_SIZE must be between 1 and 524288")
+	}
+	if c.Thumbnails.PollInterval <= 0 || c.Thumbnails.MaxAttempts < 1 || c.Thumbnails.MaxFileSize < 1 || c.Thumbnails.MaxPixels < 1 {
+		return fmt.Errorf("THUMBNAILS_POLL_INTERVAL, THUMBNAILS_MAX_ATTEMPTS, THUMBNAILS_MAX_FILE_SIZE and THUMBNAILS_MAX_PIXELS must be positive")
+	}
+	if c.S3Gateway.Port != "" && c.S3Gateway.Port == c.Server.Port {
+		return fmt.Errorf("S3_GATEWAY_PORT must differ from PORT")
+	}
+	if c.S3Gateway.UploadExpiry <= 0 {
+		return fmt.Errorf("S3_GATEWAY_UPLOAD_EXPIRY must be positive")
+	}
+	if c.SFTP.Port != "" && (c.SFTP.Port == c.Server.Port || c.SFTP.Port == c.S3Gateway.Port) {
+		return fmt.Errorf("SFTP_PORT must differ from PORT and S3_GATEWAY_PORT")
+	}
+	if c.GRPC.Port != "" && (c.GRPC.Port == c.Server.Port || c.GRPC.Port == c.S3Gateway.Port || c.GRPC.Port == c.SFTP.Port) {
+		return fmt.Errorf("GRPC_PORT must differ from PORT, S3_GATEWAY_PORT and SFTP_PORT")
+	}
 	return nil
 }
 
@@ -131,6 +394,16 @@ func getBoolEnv(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if d, err := time.ParseDuration(value); err == nil {
@@ -0,0 +1,465 @@
+package dav
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+)
+
+// memBackend is an in-memory backend for one user
+type memBackend struct {
+	mu      sync.Mutex
+	userID  uuid.UUID
+	groups  []*group.Group
+	members map[uuid.UUID]bool
+	files   map[uuid.UUID]*file.File
+	content map[uuid.UUID][]byte
+	opens   []int64 // Offsets of each Open
+}
+
+func newMemBackend(userID uuid.UUID) *memBackend {
+	return &memBackend{
+		userID:  userID,
+		members: make(map[uuid.UUID]bool),
+		files:   make(map[uuid.UUID]*file.File),
+		content: make(map[uuid.UUID][]byte),
+	}
+}
+
+func (m *memBackend) addGroup(name string, member bool) *group.Group {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g := &group.Group{ID: uuid.New(), Name: name, CreatedAt: time.Now()}
+	m.groups = append(m.groups, g)
+	m.members[g.ID] = member
+	return g
+}
+
+func (m *memBackend) checkMember(groupID, userID uuid.UUID) error {
+	if userID != m.userID || !m.members[groupID] {
+		return group.ErrNotMember
+	}
+	return nil
+}
+
+func (m *memBackend) ListGroups(ctx context.Context, userID uuid.UUID) ([]*group.Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var groups []*group.Group
+	for _, g := range m.groups {
+		if m.members[g.ID] {
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+func (m *memBackend) CreateGroup(ctx context.Context, userID uuid.UUID, name string) (*group.Group, error) {
+	return m.addGroup(name, true), nil
+}
+
+func (m *memBackend) ListFiles(ctx context.Context, groupID, userID uuid.UUID) ([]*file.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkMember(groupID, userID); err != nil {
+		return nil, err
+	}
+	var files []*file.File
+	for _, f := range m.files {
+		if f.GroupID == groupID {
+			copied := *f
+			files = append(files, &copied)
+		}
+	}
+	return files, nil
+}
+
+func (m *memBackend) Open(ctx context.Context, fileID, userID uuid.UUID, offset int64) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileID]
+	if !ok {
+		return nil, file.ErrFileNotFound
+	}
+	if err := m.checkMember(f.GroupID, userID); err != nil {
+		return nil, err
+	}
+	m.opens = append(m.opens, offset)
+	return io.NopCloser(bytes.NewReader(m.content[fileID][offset:])), nil
+}
+
+func (m *memBackend) CheckUpload(ctx context.Context, groupID, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.checkMember(groupID, userID)
+}
+
+func (m *memBackend) Upload(ctx context.Context, input *file.UploadFileInput, body io.Reader) (*file.File, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkMember(input.GroupID, input.UploadedBy); err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != input.SizeBytes {
+		return nil, file.ErrUploadFailed
+	}
+	f := &file.File{
+		ID:          uuid.New(),
+		Name:        input.Name,
+		SizeBytes:   input.SizeBytes,
+		ContentType: input.ContentType,
+		GroupID:     input.GroupID,
+		UploadedBy:  input.UploadedBy,
+		CreatedAt:   time.Now(),
+	}
+	m.files[f.ID] = f
+	m.content[f.ID] = data
+	return f, nil
+}
+
+func (m *memBackend) Rename(ctx context.Context, fileID, userID uuid.UUID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileID]
+	if !ok {
+		return file.ErrFileNotFound
+	}
+	if err := m.checkMember(f.GroupID, userID); err != nil {
+		return err
+	}
+	f.Name = name
+	return nil
+}
+
+func (m *memBackend) Delete(ctx context.Context, fileID, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileID]
+	if !ok {
+		return file.ErrFileNotFound
+	}
+	if err := m.checkMember(f.GroupID, userID); err != nil {
+		return err
+	}
+	delete(m.files, fileID)
+	delete(m.content, fileID)
+	return nil
+}
+
+// names lists the names of a group's files, sorted
+func (m *memBackend) names(g *group.Group) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for _, f := range m.files {
+		if f.GroupID == g.ID {
+			names = append(names, f.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *memBackend) read(g *group.Group, name string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range m.files {
+		if f.GroupID == g.ID && f.Name == name {
+			return string(m.content[f.ID])
+		}
+	}
+	return ""
+}
+
+type davTest struct {
+	t       *testing.T
+	backend *memBackend
+	server  *httptest.Server
+}
+
+func newDAVTest(t *testing.T) *davTest {
+	userID := uuid.New()
+	b := newMemBackend(userID)
+	h := newHandler("/dav", newFileSystems(b), func(r *http.Request) (uuid.UUID, string, error) {
+		if _, password, ok := r.BasicAuth(); ok && password == "secret" {
+			return userID, "user@example.com", nil
+		}
+		return uuid.Nil, "", errUnauthenticated
+	})
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	return &davTest{t: t, backend: b, server: server}
+}
+
+func (d *davTest) do(method, p string, body string, header map[string]string) (*http.Response, string) {
+	d.t.Helper()
+	req, err := http.NewRequest(method, d.server.URL+p, strings.NewReader(body))
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	req.SetBasicAuth("user@example.com", "secret")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func (d *davTest) expect(method, p, body string, header map[string]string, status int) string {
+	d.t.Helper()
+	resp, data := d.do(method, p, body, header)
+	if resp.StatusCode != status {
+		d.t.Fatalf("%s %s: status %d, want %d: %s", method, p, resp.StatusCode, status, data)
+	}
+	return data
+}
+
+func TestRequiresAuthentication(t *testing.T) {
+	d := newDAVTest(t)
+	resp, err := http.Get(d.server.URL + "/dav/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic ") {
+		t.Errorf("status %d, WWW-Authenticate %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+}
+
+func TestOutlivesServerTimeouts(t *testing.T) {
+	d := newDAVTest(t)
+	team := d.backend.addGroup("Team", true)
+
+	// The same handler behind a server whose timeouts suit API calls
+	server := httptest.NewUnstartedServer(d.server.Config.Handler)
+	server.Config.ReadTimeout = 100 * time.Millisecond
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+
+	// A slow upload takes longer than the read timeout
+	body, writer := io.Pipe()
+	go func() {
+		for i := 0; i < 5; i++ {
+			time.Sleep(50 * time.Millisecond)
+			_, _ = writer.Write([]byte("chunk "))
+		}
+		_ = writer.Close()
+	}()
+	req, err := http.NewRequest("PUT", server.URL+"/dav/Team/slow.txt", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("user@example.com", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("slow upload failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("slow upload status %d", resp.StatusCode)
+	}
+	if got := d.backend.read(team, "slow.txt"); got != strings.Repeat("chunk ", 5) {
+		t.Errorf("uploaded %q", got)
+	}
+}
+
+func TestGroupsAreTopLevelDirectories(t *testing.T) {
+	d := newDAVTest(t)
+	d.backend.addGroup("Team", true)
+	d.backend.addGroup("Secret", false)
+	d.backend.addGroup("Dup", true)
+	dup := d.backend.addGroup("Dup", true)
+
+	listing := d.expect("PROPFIND", "/dav/", "", map[string]string{"Depth": "1"}, http.StatusMultiStatus)
+	for _, want := range []string{"/dav/Team/", "/dav/Dup%20%28" + dup.ID.String()[:8] + "%29/"} {
+		if !strings.Contains(listing, want) {
+			t.Errorf("listing lacks %s:\n%s", want, listing)
+		}
+	}
+	if strings.Contains(listing, "Secret") {
+		t.Errorf("listing shows a group the user is not in:\n%s", listing)
+	}
+
+	d.expect("PUT", "/dav/Secret/x.txt", "x", nil, http.StatusConflict)
+	d.expect("GET", "/dav/Secret/", "", nil, http.StatusNotFound)
+}
+
+func TestPutGetAndRanges(t *testing.T) {
+	d := newDAVTest(t)
+	team := d.backend.addGroup("Team", true)
+
+	resp, _ := d.do("PUT", "/dav/Team/docs/notes.txt", "hello, world", nil)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("ETag") == "" {
+		t.Fatalf("PUT: status %d, ETag %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if got := d.backend.names(team); len(got) != 1 || got[0] != "docs/notes.txt" {
+		t.Fatalf("files = %v", got)
+	}
+
+	listing := d.expect("PROPFIND", "/dav/Team/", "", map[string]string{"Depth": "1"}, http.StatusMultiStatus)
+	if !strings.Contains(listing, "/dav/Team/docs/") {
+		t.Errorf("group listing lacks the implied directory:\n%s", listing)
+	}
+	listing = d.expect("PROPFIND", "/dav/Team/docs/", "", map[string]string{"Depth": "1"}, http.StatusMultiStatus)
+	if !strings.Contains(listing, "/dav/Team/docs/notes.txt") || !strings.Contains(listing, "<D:getcontentlength>12</D:getcontentlength>") {
+		t.Errorf("directory listing lacks the file:\n%s", listing)
+	}
+
+	if got := d.expect("GET", "/dav/Team/docs/notes.txt", "", nil, http.StatusOK); got != "hello, world" {
+		t.Errorf("GET = %q", got)
+	}
+	resp, got := d.do("GET", "/dav/Team/docs/notes.txt", "", map[string]string{"Range": "bytes=7-"})
+	if resp.StatusCode != http.StatusPartialContent || got != "world" {
+		t.Errorf("ranged GET: status %d, body %q", resp.StatusCode, got)
+	}
+	if opens := d.backend.opens; opens[len(opens)-1] != 7 {
+		t.Errorf("ranged GET opened at offsets %v, want the last at 7", opens)
+	}
+	if resp.Header.Get("Content-Security-Policy") == "" {
+		t.Error("content served without a Content-Security-Policy")
+	}
+
+	// Writing to the path replaces the file
+	d.expect("PUT", "/dav/Team/docs/notes.txt", "replaced", nil, http.StatusCreated)
+	if got := d.backend.names(team); len(got) != 1 || d.backend.read(team, "docs/notes.txt") != "replaced" {
+		t.Errorf("after overwrite files = %v, content %q", got, d.backend.read(team, "docs/notes.txt"))
+	}
+}
+
+func TestMoveCopyAndDelete(t *testing.T) {
+	d := newDAVTest(t)
+	team := d.backend.addGroup("Team", true)
+	other := d.backend.addGroup("Other", true)
+
+	d.expect("PUT", "/dav/Team/a/one.txt", "1", nil, http.StatusCreated)
+	d.expect("PUT", "/dav/Team/a/b/two.txt", "2", nil, http.StatusCreated)
+
+	d.expect("MOVE", "/dav/Team/a/one.txt", "", map[string]string{"Destination": "/dav/Team/one.txt"}, http.StatusCreated)
+	d.expect("COPY", "/dav/Team/one.txt", "", map[string]string{"Destination": "/dav/Team/copy.txt"}, http.StatusCreated)
+	d.expect("MOVE", "/dav/Team/a", "", map[string]string{"Destination": "/dav/Team/c"}, http.StatusCreated)
+	want := []string{"c/b/two.txt", "copy.txt", "one.txt"}
+	if got := d.backend.names(team); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("after moves files = %v, want %v", got, want)
+	}
+	if got := d.backend.read(team, "copy.txt"); got != "1" {
+		t.Errorf("copy content = %q", got)
+	}
+
+	// Between groups, files are copied and the originals deleted
+	d.expect("MOVE", "/dav/Team/c", "", map[string]string{"Destination": "/dav/Other/c"}, http.StatusCreated)
+	if got := d.backend.names(other); len(got) != 1 || got[0] != "c/b/two.txt" || d.backend.read(other, "c/b/two.txt") != "2" {
+		t.Errorf("other group files = %v", got)
+	}
+
+	d.expect("DELETE", "/dav/Team/one.txt", "", nil, http.StatusNoContent)
+	d.expect("DELETE", "/dav/Other/c", "", nil, http.StatusNoContent)
+	d.expect("DELETE", "/dav/Other/c", "", nil, http.StatusNotFound)
+	if got := append(d.backend.names(team), d.backend.names(other)...); len(got) != 1 || got[0] != "copy.txt" {
+		t.Errorf("after deletes files = %v", got)
+	}
+
+	// Groups themselves cannot be deleted or renamed
+	d.expect("DELETE", "/dav/Team", "", nil, http.StatusMethodNotAllowed)
+	d.expect("MOVE", "/dav/Team", "", map[string]string{"Destination": "/dav/Renamed"}, http.StatusForbidden)
+}
+
+func TestMkcol(t *testing.T) {
+	d := newDAVTest(t)
+	team := d.backend.addGroup("Team", true)
+
+	d.expect("MKCOL", "/dav/Team/empty", "", nil, http.StatusCreated)
+	d.expect("MKCOL", "/dav/Team/empty", "", nil, http.StatusMethodNotAllowed)
+	listing := d.expect("PROPFIND", "/dav/Team/", "", map[string]string{"Depth": "1"}, http.StatusMultiStatus)
+	if !strings.Contains(listing, "/dav/Team/empty/") {
+		t.Errorf("listing lacks the new directory:\n%s", listing)
+	}
+	d.expect("PUT", "/dav/Team/empty/f.txt", "f", nil, http.StatusCreated)
+	if got := d.backend.names(team); len(got) != 1 || got[0] != "empty/f.txt" {
+		t.Errorf("files = %v", got)
+	}
+
+	// A new top-level directory is a new group
+	d.expect("MKCOL", "/dav/Fresh", "", nil, http.StatusCreated)
+	d.expect("PUT", "/dav/Fresh/x.txt", "x", nil, http.StatusCreated)
+}
+
+func TestLocks(t *testing.T) {
+	d := newDAVTest(t)
+	d.backend.addGroup("Team", true)
+	d.expect("PUT", "/dav/Team/doc.txt", "v1", nil, http.StatusCreated)
+
+	lockBody := `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+	resp, _ := d.do("LOCK", "/dav/Team/doc.txt", lockBody, map[string]string{"Timeout": "Second-60"})
+	token := resp.Header.Get("Lock-Token")
+	if resp.StatusCode != http.StatusOK || token == "" {
+		t.Fatalf("LOCK: status %d, token %q", resp.StatusCode, token)
+	}
+
+	d.expect("PUT", "/dav/Team/doc.txt", "v2", nil, http.StatusLocked)
+	d.expect("PUT", "/dav/Team/doc.txt", "v2", map[string]string{"If": "(" + token + ")"}, http.StatusCreated)
+	d.expect("UNLOCK", "/dav/Team/doc.txt", "", map[string]string{"Lock-Token": token}, http.StatusNoContent)
+}
+
+func TestGroupIndex(t *testing.T) {
+	now := time.Now()
+	older := &file.File{ID: uuid.New(), Name: "report.pdf", CreatedAt: now.Add(-time.Hour)}
+	newer := &file.File{ID: uuid.New(), Name: "report.pdf", CreatedAt: now}
+	nested := &file.File{ID: uuid.New(), Name: "a/b/c.txt", CreatedAt: now}
+	odd := &file.File{ID: uuid.New(), Name: "/abs//path", CreatedAt: now}
+	clash := &file.File{ID: uuid.New(), Name: "a", CreatedAt: now}
+
+	ix := newGroupIndex([]*file.File{older, newer, nested, odd, clash}, map[string]time.Time{"empty/dir": now})
+
+	if ix.files["report.pdf"] != newer {
+		t.Error("the newest duplicate should keep the name")
+	}
+	if ix.files["report ("+older.ID.String()[:8]+").pdf"] != older {
+		t.Errorf("older duplicate not disambiguated: %v", ix.files)
+	}
+	if ix.files["a/b/c.txt"] != nested || ix.files["_abs__path"] != odd {
+		t.Errorf("files = %v", ix.files)
+	}
+	if ix.files["a ("+clash.ID.String()[:8]+")"] != clash {
+		t.Errorf("file named like a directory not disambiguated: %v", ix.files)
+	}
+	for _, dir := range []string{"a", "a/b", "empty", "empty/dir"} {
+		if _, ok := ix.dirs[dir]; !ok {
+			t.Errorf("missing directory %s", dir)
+		}
+	}
+
+	var names []string
+	for _, fi := range ix.children("") {
+		names = append(names, fi.Name())
+	}
+	want := "_abs__path,a,a (" + clash.ID.String()[:8] + "),empty,report (" + older.ID.String()[:8] + ").pdf,report.pdf"
+	if strings.Join(names, ",") != want {
+		t.Errorf("children = %v, want %s", names, want)
+	}
+	if under := ix.under("a"); len(under) != 1 || under[0].rel != "b/c.txt" {
+		t.Errorf("under(a) = %v", under)
+	}
+}
@@ -0,0 +1,347 @@
+package dav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/testifysec/dropbox-clone/internal/file"
+)
+
+// sniffLen is how much of a file's start is kept after reading it, since
+// content type sniffing reads it and then seeks back
+const sniffLen = 512
+
+// fileInfo describes a file or directory. It implements webdav.ETager and
+// webdav.ContentTyper so listings need not open files.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	file    *file.File // nil for directories and files not yet uploaded
+}
+
+func newFileInfo(name string, f *file.File) *fileInfo {
+	return &fileInfo{name: name, size: f.SizeBytes, modTime: f.CreatedAt, file: f}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.dir }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// ETag implements webdav.ETager. A file's content never changes; writing
+// to its path uploads a new file with a new ID.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.file == nil {
+		return "", webdav.ErrNotImplemented
+	}
+	return fmt.Sprintf("%q", fi.file.ID.String()), nil
+}
+
+// ContentType implements webdav.ContentTyper
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.file == nil || fi.file.ContentType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.file.ContentType, nil
+}
+
+// dirFile is an open directory
+type dirFile struct {
+	ctx     context.Context
+	fs      *fileSystem
+	loc     *location
+	info    *fileInfo
+	entries []os.FileInfo // nil until read
+	offset  int
+}
+
+func (d *dirFile) Stat() (os.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+
+func (d *dirFile) Read(p []byte) (int, error) {
+	return 0, pathError("read", d.loc.name, errors.New("is a directory"))
+}
+
+func (d *dirFile) Write(p []byte) (int, error) {
+	return 0, pathError("write", d.loc.name, os.ErrPermission)
+}
+
+func (d *dirFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, pathError("seek", d.loc.name, errors.New("is a directory"))
+}
+
+// Readdir lists the directory in the manner of os.File.Readdir
+func (d *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if d.entries == nil {
+		entries, err := d.list()
+		if err != nil {
+			return nil, pathError("readdir", d.loc.name, err)
+		}
+		d.entries = entries
+	}
+
+	remaining := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(remaining))
+	d.offset += n
+	return remaining[:n], nil
+}
+
+func (d *dirFile) list() ([]os.FileInfo, error) {
+	if d.loc.isRoot() {
+		groups, err := d.fs.loadGroups(d.ctx)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]os.FileInfo, 0, len(groups))
+		for name, g := range groups {
+			entries = append(entries, &fileInfo{name: name, dir: true, modTime: g.CreatedAt})
+		}
+		sortInfos(entries)
+		return entries, nil
+	}
+
+	ix, err := d.fs.index(d.ctx, d.loc.group)
+	if err != nil {
+		return nil, err
+	}
+	return ix.children(d.loc.path), nil
+}
+
+// readFile is a file open for reading. The content is streamed from
+// storage; seeking reopens the stream at the new offset when it is next
+// read.
+type readFile struct {
+	ctx     context.Context
+	fs      *fileSystem
+	info    *fileInfo
+	pos     int64         // Offset of the next Read
+	body    io.ReadCloser // Content from bodyPos on; nil until read
+	bodyPos int64
+	head    []byte // The start of the content, once read
+}
+
+func (r *readFile) Stat() (os.FileInfo, error) { return r.info, nil }
+
+func (r *readFile) Read(p []byte) (int, error) {
+	if r.pos >= r.info.size {
+		return 0, io.EOF
+	}
+	if r.pos < int64(len(r.head)) {
+		n := copy(p, r.head[r.pos:])
+		r.pos += int64(n)
+		return n, nil
+	}
+
+	if r.body == nil || r.bodyPos != r.pos {
+		if r.body != nil {
+			_ = r.body.Close()
+			r.body = nil
+		}
+		body, err := r.fs.backend.Open(r.ctx, r.info.file.ID, r.fs.userID, r.pos)
+		if err != nil {
+			return 0, pathError("read", r.info.name, err)
+		}
+		r.body, r.bodyPos = body, r.pos
+	}
+
+	n, err := r.body.Read(p)
+	if r.bodyPos == int64(len(r.head)) && len(r.head) < sniffLen {
+		r.head = append(r.head, p[:min(n, sniffLen-len(r.head))]...)
+	}
+	r.bodyPos += int64(n)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *readFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.info.size
+	}
+	if offset < 0 {
+		return 0, pathError("seek", r.info.name, os.ErrInvalid)
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+func (r *readFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, pathError("readdir", r.info.name, errors.New("not a directory"))
+}
+
+func (r *readFile) Write(p []byte) (int, error) {
+	return 0, pathError("write", r.info.name, os.ErrPermission)
+}
+
+func (r *readFile) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
+
+// writeFile is a file open for writing. Its content is spooled to a
+// temporary file and uploaded on Close, replacing any file at its path.
+type writeFile struct {
+	ctx  context.Context
+	fs   *fileSystem
+	loc  *location
+	tmp  *os.File
+	info *fileInfo // Given the uploaded file on Close, for the ETag
+	err  error     // The first write error, which fails Close
+}
+
+// Stat returns the file's info. The same info is updated when the file is
+// uploaded, so it can report the new file's ETag.
+func (w *writeFile) Stat() (os.FileInfo, error) { return w.info, nil }
+
+func (w *writeFile) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.info.size+int64(len(p)) > file.MaxFileSize {
+		w.err = pathError("write", w.loc.name, file.ErrFileTooLarge)
+		return 0, w.err
+	}
+	n, err := w.tmp.Write(p)
+	w.info.size += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// WriteAt writes at an offset, for protocols such as SFTP whose clients
+// send blocks out of order. Skipped ranges read as zeros.
+func (w *writeFile) WriteAt(p []byte, off int64) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if off < 0 {
+		return 0, pathError("write", w.loc.name, os.ErrInvalid)
+	}
+	if off+int64(len(p)) > file.MaxFileSize {
+		w.err = pathError("write", w.loc.name, file.ErrFileTooLarge)
+		return 0, w.err
+	}
+	n, err := w.tmp.WriteAt(p, off)
+	w.info.size = max(w.info.size, off+int64(n))
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *writeFile) Close() error {
+	if w.tmp == nil {
+		return w.err
+	}
+	defer func() {
+		_ = w.tmp.Close()
+		_ = os.Remove(w.tmp.Name())
+		w.tmp = nil
+	}()
+	if w.err != nil {
+		return w.err
+	}
+
+	contentType, err := w.contentType()
+	if err != nil {
+		return err
+	}
+
+	// Note what the upload replaces before the listing changes
+	ix, err := w.fs.index(w.ctx, w.loc.group)
+	if err != nil {
+		return pathError("close", w.loc.name, err)
+	}
+	replaced := ix.files[w.loc.path]
+
+	input := &file.UploadFileInput{
+		Name:        w.loc.path,
+		ContentType: contentType,
+		SizeBytes:   w.info.size,
+		GroupID:     w.loc.group.ID,
+		UploadedBy:  w.fs.userID,
+	}
+	if replaced != nil {
+		// Clients cannot set tags or metadata, so keep the old version's
+		input.Tags, input.Metadata = replaced.Tags, replaced.Metadata
+	}
+	uploaded, err := w.fs.backend.Upload(w.ctx, input, w.tmp)
+	w.fs.changed(w.loc.group)
+	if err != nil {
+		return pathError("close", w.loc.name, err)
+	}
+	w.info.file = uploaded
+	w.info.modTime = uploaded.CreatedAt
+
+	if replaced != nil {
+		if err := w.fs.backend.Delete(w.ctx, replaced.ID, w.fs.userID); err != nil && !errors.Is(err, file.ErrFileNotFound) {
+			log.Printf("Failed to delete file %s replaced over WebDAV: %v", replaced.ID, err)
+		}
+	}
+	return nil
+}
+
+// contentType guesses the content type from the extension, or else the
+// content, and rewinds the spooled content for upload
+func (w *writeFile) contentType() (string, error) {
+	if contentType := mime.TypeByExtension(path.Ext(w.loc.path)); contentType != "" {
+		_, err := w.tmp.Seek(0, io.SeekStart)
+		return contentType, err
+	}
+	buf := make([]byte, sniffLen)
+	n, err := w.tmp.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if _, err := w.tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "application/octet-stream", nil
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+func (w *writeFile) Read(p []byte) (int, error) {
+	return 0, pathError("read", w.loc.name, os.ErrPermission)
+}
+
+func (w *writeFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, pathError("seek", w.loc.name, os.ErrInvalid)
+}
+
+func (w *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, pathError("readdir", w.loc.name, errors.New("not a directory"))
+}
@@ -0,0 +1,542 @@
+package dav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+)
+
+// fileSystem is one user's view of their groups for the duration of a
+// request. Each group is a top-level directory, and slashes in file names
+// form subdirectories beneath it. Listings are cached for the request,
+// since a PROPFIND opens every entry it reports.
+type fileSystem struct {
+	backend backend
+	userID  uuid.UUID
+	empty   *emptyDirs
+
+	groups  map[string]*group.Group // By directory name; nil until loaded
+	indexes map[uuid.UUID]*groupIndex
+}
+
+func newFileSystem(b backend, userID uuid.UUID, empty *emptyDirs) *fileSystem {
+	return &fileSystem{backend: b, userID: userID, empty: empty, indexes: make(map[uuid.UUID]*groupIndex)}
+}
+
+// location is a path resolved to a group and a path within it
+type location struct {
+	name  string       // The full path, for errors
+	group *group.Group // nil for the root
+	path  string       // "" for the group's directory
+}
+
+func (l *location) isRoot() bool     { return l.group == nil }
+func (l *location) isGroupDir() bool { return l.group != nil && l.path == "" }
+
+// splitPath splits a WebDAV path into the group directory and the path
+// within the group
+func splitPath(name string) (string, string) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	dir, rest, _ := strings.Cut(name, "/")
+	return dir, rest
+}
+
+func (fs *fileSystem) locate(ctx context.Context, op, name string) (*location, error) {
+	dir, rest := splitPath(name)
+	if dir == "" {
+		return &location{name: name}, nil
+	}
+	groups, err := fs.loadGroups(ctx)
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+	g, ok := groups[dir]
+	if !ok {
+		return nil, pathError(op, name, os.ErrNotExist)
+	}
+	return &location{name: name, group: g, path: rest}, nil
+}
+
+func (fs *fileSystem) loadGroups(ctx context.Context) (map[string]*group.Group, error) {
+	if fs.groups != nil {
+		return fs.groups, nil
+	}
+	groups, err := fs.backend.ListGroups(ctx, fs.userID)
+	if err != nil {
+		return nil, err
+	}
+	fs.groups = groupDirs(groups)
+	return fs.groups, nil
+}
+
+// index returns the group's files and directories by path
+func (fs *fileSystem) index(ctx context.Context, g *group.Group) (*groupIndex, error) {
+	if ix, ok := fs.indexes[g.ID]; ok {
+		return ix, nil
+	}
+	files, err := fs.backend.ListFiles(ctx, g.ID, fs.userID)
+	if err != nil {
+		return nil, err
+	}
+	ix := newGroupIndex(files, fs.empty.list(g.ID))
+	fs.indexes[g.ID] = ix
+	return ix, nil
+}
+
+// changed drops the cached listing of a group after a change to it
+func (fs *fileSystem) changed(g *group.Group) {
+	delete(fs.indexes, g.ID)
+}
+
+// stat returns the entry at a location
+func (fs *fileSystem) stat(ctx context.Context, op string, loc *location) (*fileInfo, error) {
+	switch {
+	case loc.isRoot():
+		return &fileInfo{name: "/", dir: true}, nil
+	case loc.isGroupDir():
+		return &fileInfo{name: path.Base(loc.name), dir: true, modTime: loc.group.CreatedAt}, nil
+	}
+
+	ix, err := fs.index(ctx, loc.group)
+	if err != nil {
+		return nil, pathError(op, loc.name, err)
+	}
+	if f, ok := ix.files[loc.path]; ok {
+		return newFileInfo(path.Base(loc.path), f), nil
+	}
+	if modTime, ok := ix.dirs[loc.path]; ok {
+		return &fileInfo{name: path.Base(loc.path), dir: true, modTime: modTime}, nil
+	}
+	return nil, pathError(op, loc.name, os.ErrNotExist)
+}
+
+// Stat implements webdav.FileSystem
+func (fs *fileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	loc, err := fs.locate(ctx, "stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.stat(ctx, "stat", loc)
+}
+
+// OpenFile implements webdav.FileSystem. Opening for writing always
+// replaces the file's content, which is uploaded when the file is closed.
+func (fs *fileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	loc, err := fs.locate(ctx, "open", name)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return fs.create(ctx, loc)
+	}
+
+	info, err := fs.stat(ctx, "open", loc)
+	if err != nil {
+		return nil, err
+	}
+	if info.dir {
+		return &dirFile{ctx: ctx, fs: fs, loc: loc, info: info}, nil
+	}
+	return &readFile{ctx: ctx, fs: fs, info: info}, nil
+}
+
+// create opens a file for writing. Missing parent directories are implied
+// by the file's name, so they need not be created first.
+func (fs *fileSystem) create(ctx context.Context, loc *location) (*writeFile, error) {
+	if loc.isRoot() || loc.isGroupDir() {
+		return nil, pathError("open", loc.name, os.ErrPermission)
+	}
+	info, err := fs.stat(ctx, "open", loc)
+	if err == nil && info.dir {
+		return nil, pathError("open", loc.name, os.ErrExist)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := fs.backend.CheckUpload(ctx, loc.group.ID, fs.userID); err != nil {
+		return nil, pathError("open", loc.name, err)
+	}
+
+	tmp, err := os.CreateTemp("", "dav-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	return &writeFile{
+		ctx:  ctx,
+		fs:   fs,
+		loc:  loc,
+		tmp:  tmp,
+		info: &fileInfo{name: path.Base(loc.path)},
+	}, nil
+}
+
+// Mkdir implements webdav.FileSystem. A new top-level directory creates a
+// group; other directories exist only until files are put in them.
+func (fs *fileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	dir, rest := splitPath(name)
+	if dir == "" {
+		return pathError("mkdir", name, os.ErrExist)
+	}
+	if rest == "" {
+		groups, err := fs.loadGroups(ctx)
+		if err != nil {
+			return pathError("mkdir", name, err)
+		}
+		if _, ok := groups[dir]; ok {
+			return pathError("mkdir", name, os.ErrExist)
+		}
+		if _, err := fs.backend.CreateGroup(ctx, fs.userID, dir); err != nil {
+			return pathError("mkdir", name, err)
+		}
+		fs.groups = nil
+		return nil
+	}
+
+	loc, err := fs.locate(ctx, "mkdir", name)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.stat(ctx, "mkdir", loc); err == nil {
+		return pathError("mkdir", name, os.ErrExist)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	fs.empty.add(loc.group.ID, loc.path)
+	fs.changed(loc.group)
+	return nil
+}
+
+// RemoveAll implements webdav.FileSystem. Groups cannot be deleted over
+// WebDAV.
+func (fs *fileSystem) RemoveAll(ctx context.Context, name string) error {
+	loc, err := fs.locate(ctx, "remove", name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if loc.isRoot() || loc.isGroupDir() {
+		return pathError("remove", name, os.ErrPermission)
+	}
+
+	ix, err := fs.index(ctx, loc.group)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	defer fs.changed(loc.group)
+
+	for _, e := range ix.under(loc.path) {
+		if err := fs.backend.Delete(ctx, e.file.ID, fs.userID); err != nil && !errors.Is(err, file.ErrFileNotFound) {
+			return pathError("remove", path.Join(name, e.rel), err)
+		}
+	}
+	fs.empty.remove(loc.group.ID, loc.path)
+	return nil
+}
+
+// Rename implements webdav.FileSystem. Files moved between groups are
+// copied and then deleted.
+func (fs *fileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	src, err := fs.locate(ctx, "rename", oldName)
+	if err != nil {
+		return err
+	}
+	dst, err := fs.locate(ctx, "rename", newName)
+	if err != nil {
+		return err
+	}
+	if src.isRoot() || src.isGroupDir() || dst.isRoot() || dst.isGroupDir() {
+		return pathError("rename", oldName, os.ErrPermission)
+	}
+	sameGroup := src.group.ID == dst.group.ID
+	if sameGroup && strings.HasPrefix(dst.path+"/", src.path+"/") {
+		return pathError("rename", newName, os.ErrInvalid)
+	}
+
+	info, err := fs.stat(ctx, "rename", src)
+	if err != nil {
+		return err
+	}
+	ix, err := fs.index(ctx, src.group)
+	if err != nil {
+		return pathError("rename", oldName, err)
+	}
+	defer fs.changed(src.group)
+	defer fs.changed(dst.group)
+
+	for _, e := range ix.under(src.path) {
+		target := dst.path
+		if info.dir {
+			target = path.Join(dst.path, e.rel)
+		}
+		if sameGroup {
+			err = fs.backend.Rename(ctx, e.file.ID, fs.userID, target)
+		} else {
+			err = fs.move(ctx, e.file, &location{name: path.Join(newName, e.rel), group: dst.group, path: target})
+		}
+		if err != nil {
+			return pathError("rename", path.Join(oldName, e.rel), err)
+		}
+	}
+	if info.dir {
+		fs.empty.rename(src.group.ID, src.path, dst.group.ID, dst.path)
+	}
+	return nil
+}
+
+// move copies a file to another group and deletes the original
+func (fs *fileSystem) move(ctx context.Context, f *file.File, dst *location) error {
+	r := &readFile{ctx: ctx, fs: fs, info: newFileInfo(path.Base(dst.path), f)}
+	defer func() { _ = r.Close() }()
+
+	w, err := fs.create(ctx, dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return fs.backend.Delete(ctx, f.ID, fs.userID)
+}
+
+// pathError wraps err as the os package would, so webdav.Handler maps
+// missing files and denied access to the right status codes
+func pathError(op, name string, err error) error {
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return err
+	}
+	switch {
+	case errors.Is(err, file.ErrFileNotFound), errors.Is(err, group.ErrGroupNotFound):
+		err = os.ErrNotExist
+	case errors.Is(err, group.ErrNotMember):
+		err = os.ErrPermission
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// groupDirs names each group's directory after the group. Slashes are
+// replaced, and groups that share a name are told apart by their IDs.
+func groupDirs(groups []*group.Group) map[string]*group.Group {
+	counts := make(map[string]int, len(groups))
+	for _, g := range groups {
+		counts[flatName(g.Name)]++
+	}
+	dirs := make(map[string]*group.Group, len(groups))
+	for _, g := range groups {
+		name := flatName(g.Name)
+		if counts[name] > 1 {
+			name = fmt.Sprintf("%s (%s)", name, g.ID.String()[:8])
+		}
+		dirs[name] = g
+	}
+	return dirs
+}
+
+// flatName makes a name usable as a single path element
+func flatName(name string) string {
+	name = strings.ReplaceAll(name, "/", "_")
+	if name == "" || name == "." || name == ".." {
+		name = "_" + name
+	}
+	return name
+}
+
+// groupIndex is a group's files arranged as a tree
+type groupIndex struct {
+	files map[string]*file.File // By path within the group
+	dirs  map[string]time.Time  // Subdirectories by path, with their newest file's time
+}
+
+// indexEntry is a file found beneath a path
+type indexEntry struct {
+	rel  string // Path relative to the searched path; "" for the path itself
+	file *file.File
+}
+
+// newGroupIndex arranges a group's files by path. Names that are not
+// valid paths are flattened into the group's directory. When names
+// collide, the newest file keeps the name and the others are told apart
+// by their IDs.
+func newGroupIndex(files []*file.File, empty map[string]time.Time) *groupIndex {
+	ix := &groupIndex{
+		files: make(map[string]*file.File, len(files)),
+		dirs:  make(map[string]time.Time),
+	}
+
+	sorted := make([]*file.File, len(files))
+	copy(sorted, files)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].CreatedAt.After(sorted[j].CreatedAt) })
+
+	for _, f := range sorted {
+		ix.addParents(filePath(f.Name), f.CreatedAt)
+	}
+	for p, modTime := range empty {
+		ix.addParents(p+"/", modTime)
+	}
+
+	for _, f := range sorted {
+		p := filePath(f.Name)
+		if _, taken := ix.files[p]; taken {
+			p = withID(p, f.ID)
+		} else if _, taken := ix.dirs[p]; taken {
+			p = withID(p, f.ID)
+		}
+		ix.files[p] = f
+	}
+	return ix
+}
+
+// addParents records the directories containing p
+func (ix *groupIndex) addParents(p string, modTime time.Time) {
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if t, ok := ix.dirs[dir]; !ok || modTime.After(t) {
+			ix.dirs[dir] = modTime
+		}
+	}
+}
+
+// children lists the entries directly inside a directory ("" for the
+// group's directory)
+func (ix *groupIndex) children(dir string) []os.FileInfo {
+	var infos []os.FileInfo
+	for p, f := range ix.files {
+		if parentDir(p) == dir {
+			infos = append(infos, newFileInfo(path.Base(p), f))
+		}
+	}
+	for p, modTime := range ix.dirs {
+		if parentDir(p) == dir {
+			infos = append(infos, &fileInfo{name: path.Base(p), dir: true, modTime: modTime})
+		}
+	}
+	sortInfos(infos)
+	return infos
+}
+
+func sortInfos(infos []os.FileInfo) {
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+}
+
+// under lists the file at p, or every file beneath the directory p
+func (ix *groupIndex) under(p string) []indexEntry {
+	if f, ok := ix.files[p]; ok {
+		return []indexEntry{{file: f}}
+	}
+	var entries []indexEntry
+	for fp, f := range ix.files {
+		if rel, ok := strings.CutPrefix(fp, p+"/"); ok {
+			entries = append(entries, indexEntry{rel: rel, file: f})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].rel < entries[j].rel })
+	return entries
+}
+
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// filePath returns the path a file name is shown at
+func filePath(name string) string {
+	if iofs.ValidPath(name) && name != "." {
+		return name
+	}
+	return flatName(name)
+}
+
+// withID inserts the start of a file's ID before its extension
+func withID(p string, id uuid.UUID) string {
+	ext := path.Ext(p)
+	if ext == path.Base(p) {
+		ext = ""
+	}
+	return fmt.Sprintf("%s (%s)%s", strings.TrimSuffix(p, ext), id.String()[:8], ext)
+}
+
+// emptyDirs remembers directories created with MKCOL until files are put in
+// them. File names are the only record of directories, so empty ones exist
+// only in this replica's memory.
+type emptyDirs struct {
+	mu   sync.Mutex
+	dirs map[uuid.UUID]map[string]time.Time
+}
+
+func newEmptyDirs() *emptyDirs {
+	return &emptyDirs{dirs: make(map[uuid.UUID]map[string]time.Time)}
+}
+
+func (e *emptyDirs) add(groupID uuid.UUID, p string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dirs[groupID] == nil {
+		e.dirs[groupID] = make(map[string]time.Time)
+	}
+	e.dirs[groupID][p] = time.Now()
+}
+
+func (e *emptyDirs) list(groupID uuid.UUID) map[string]time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	dirs := make(map[string]time.Time, len(e.dirs[groupID]))
+	for p, t := range e.dirs[groupID] {
+		dirs[p] = t
+	}
+	return dirs
+}
+
+// remove forgets p and the directories beneath it
+func (e *emptyDirs) remove(groupID uuid.UUID, p string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for dir := range e.dirs[groupID] {
+		if dir == p || strings.HasPrefix(dir, p+"/") {
+			delete(e.dirs[groupID], dir)
+		}
+	}
+}
+
+// rename moves p and the directories beneath it
+func (e *emptyDirs) rename(oldGroupID uuid.UUID, oldPath string, newGroupID uuid.UUID, newPath string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	moved := make(map[string]time.Time)
+	for dir, t := range e.dirs[oldGroupID] {
+		if rel, ok := strings.CutPrefix(dir+"/", oldPath+"/"); ok {
+			moved[path.Join(newPath, rel)] = t
+			delete(e.dirs[oldGroupID], dir)
+		}
+	}
+	if len(moved) == 0 {
+		return
+	}
+	if e.dirs[newGroupID] == nil {
+		e.dirs[newGroupID] = make(map[string]time.Time)
+	}
+	for dir, t := range moved {
+		e.dirs[newGroupID][dir] = t
+	}
+}
@@ -0,0 +1,179 @@
+// Package dav serves users' groups over WebDAV, so they can be mounted in
+// Finder, Windows Explorer, rclone and other WebDAV clients. Each group the
+// user belongs to is a top-level directory.
+package dav
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+
+	"github.com/testifysec/dropbox-clone/internal/apppassword"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// Methods are the WebDAV methods beyond those of plain HTTP, which routers
+// must be told about
+var Methods = []string{"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"}
+
+const realm = "dropbox-clone"
+
+var errUnauthenticated = errors.New("missing or invalid credentials")
+
+// authenticateFunc identifies the user making a request
+type authenticateFunc func(r *http.Request) (userID uuid.UUID, email string, err error)
+
+// Handler serves WebDAV requests under a path prefix
+type Handler struct {
+	prefix       string
+	fileSystems  *FileSystems
+	authenticate authenticateFunc
+	locks        webdav.LockSystem
+}
+
+// NewHandler creates a WebDAV handler for requests under prefix. Clients
+// sign in with HTTP Basic auth, using the account email and an app
+// password, or with an access token as the password or as a Bearer token.
+// Account passwords are not accepted.
+func NewHandler(prefix string, fileSystems *FileSystems, userService *user.Service,
+	appPasswords *apppassword.Service, jwtService *auth.JWTService) *Handler {
+	authenticator := &authenticator{users: userService, appPasswords: appPasswords, jwt: jwtService}
+	return newHandler(prefix, fileSystems, authenticator.authenticate)
+}
+
+func newHandler(prefix string, fileSystems *FileSystems, authenticate authenticateFunc) *Handler {
+	return &Handler{
+		prefix:       prefix,
+		fileSystems:  fileSystems,
+		authenticate: authenticate,
+		locks:        webdav.NewMemLS(),
+	}
+}
+
+// FileSystems hands out users' views of their groups. Besides WebDAV, they
+// serve other protocols that present the same tree, such as SFTP, and
+// directories created through any of them are shared.
+type FileSystems struct {
+	backend backend
+	empty   *emptyDirs
+}
+
+// NewFileSystems creates file systems over the API's services, so every
+// operation gets the same permission checks, audit events and change
+// notifications
+func NewFileSystems(userService *user.Service, groupService *group.Service, fileService *file.Service) *FileSystems {
+	return newFileSystems(&services{users: userService, groups: groupService, files: fileService})
+}
+
+func newFileSystems(b backend) *FileSystems {
+	return &FileSystems{backend: b, empty: newEmptyDirs()}
+}
+
+// ForUser returns the user's view of their groups. It caches listings, so
+// it should serve a single request or operation and then be discarded.
+func (f *FileSystems) ForUser(userID uuid.UUID) webdav.FileSystem {
+	return newFileSystem(f.backend, userID, f.empty)
+}
+
+// ServeHTTP authenticates the request and serves it from the user's groups
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	userID, email, err := h.authenticate(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnauthenticated):
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+		case errors.Is(err, user.ErrAccountDisabled):
+			http.Error(w, "Account is disabled", http.StatusForbidden)
+		default:
+			log.Printf("WebDAV authentication failed: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Uploads and downloads of large files outlive the server's read and
+	// write timeouts, which are meant for API calls. Only authenticated
+	// requests get to hold a connection this long.
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	// Uploaded content is served from the app's origin, so it must never
+	// be rendered as an active document
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	ctx := context.WithValue(r.Context(), auth.UserIDKey, userID)
+	ctx = context.WithValue(ctx, auth.EmailKey, email)
+
+	dav := &webdav.Handler{
+		Prefix:     h.prefix,
+		FileSystem: h.fileSystems.ForUser(userID),
+		LockSystem: h.locks,
+		Logger:     logError,
+	}
+	dav.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func logError(r *http.Request, err error) {
+	if err != nil && !os.IsNotExist(err) && !errors.Is(err, os.ErrExist) {
+		log.Printf("WebDAV %s %s: %v", r.Method, r.URL.Path, err)
+	}
+}
+
+// authenticator checks WebDAV credentials
+type authenticator struct {
+	users        *user.Service
+	appPasswords *apppassword.Service
+	jwt          *auth.JWTService
+}
+
+func (a *authenticator) authenticate(r *http.Request) (uuid.UUID, string, error) {
+	ctx := r.Context()
+
+	if email, password, ok := r.BasicAuth(); ok {
+		if strings.HasPrefix(password, apppassword.Prefix) {
+			u, err := a.appPasswords.Authenticate(ctx, email, password)
+			if err != nil {
+				if errors.Is(err, apppassword.ErrInvalidCredentials) {
+					return uuid.Nil, "", errUnauthenticated
+				}
+				return uuid.Nil, "", err
+			}
+			return u.ID, u.Email, nil
+		}
+		// Clients that cannot send Bearer tokens pass them as the password
+		return a.accessToken(ctx, password)
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "bearer") {
+		return a.accessToken(ctx, token)
+	}
+	return uuid.Nil, "", errUnauthenticated
+}
+
+func (a *authenticator) accessToken(ctx context.Context, token string) (uuid.UUID, string, error) {
+	claims, err := a.jwt.ValidateAccessToken(token)
+	if err != nil {
+		return uuid.Nil, "", errUnauthenticated
+	}
+	if err := a.users.CheckActive(ctx, claims.UserID); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return uuid.Nil, "", errUnauthenticated
+		}
+		return uuid.Nil, "", err
+	}
+	return claims.UserID, claims.Email, nil
+}
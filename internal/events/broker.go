@@ -0,0 +1,167 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before it is dropped
+const subscriberBuffer = 64
+
+// Broker persists published events and fans stored events out to local
+// subscribers. Replicas learn about each other's events through Postgres
+// LISTEN/NOTIFY and read them back from the event log, so every subscriber
+// sees every event in Seq order regardless of which replica handled the
+// change.
+type Broker struct {
+	repo        Repository
+	databaseURL string
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives events accepted by its filter on C. C is closed
+// when the subscription falls too far behind or the broker stops; the
+// subscriber should reconnect and resume from the last Seq it saw.
+type Subscription struct {
+	C      <-chan *Event
+	ch     chan *Event
+	filter func(*Event) bool
+	broker *Broker
+	closed bool
+}
+
+// NewBroker creates a new Broker that listens for notifications on the
+// database at databaseURL
+func NewBroker(repo Repository, databaseURL string) *Broker {
+	return &Broker{
+		repo:        repo,
+		databaseURL: databaseURL,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish stores the event. It is registered with the event bus; fan-out
+// happens when the notification comes back from Postgres.
+func (b *Broker) Publish(ctx context.Context, event *Event) {
+	if err := b.repo.Append(ctx, event); err != nil {
+		log.Printf("Failed to store %s event: %v", event.Type, err)
+	}
+}
+
+// Subscribe registers a subscriber for events accepted by filter. Filters
+// run on the broker's goroutine, one event at a time.
+func (b *Broker) Subscribe(filter func(*Event) bool) *Subscription {
+	ch := make(chan *Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, filter: filter, broker: b}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+// Close unregisters the subscription
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.close()
+}
+
+// close must be called with the broker's lock held
+func (s *Subscription) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(s.broker.subscribers, s)
+	close(s.ch)
+}
+
+// Run listens for event notifications and dispatches new events until ctx
+// is cancelled
+func (b *Broker) Run(ctx context.Context) {
+	listener := pq.NewListener(b.databaseURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Event listener: %v", err)
+		}
+	})
+	defer func() { _ = listener.Close() }()
+	if err := listener.Listen(NotifyChannel); err != nil {
+		log.Printf("Failed to listen for events: %v", err)
+	}
+
+	defer func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for sub := range b.subscribers {
+			sub.close()
+		}
+	}()
+
+	lastSeq, err := b.repo.LatestSeq(ctx)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Failed to read event log position: %v", err)
+	}
+
+	// Notifications only say that something changed. Reading the log after
+	// the last dispatched Seq also covers notifications lost while the
+	// listener was reconnecting, which pq reports as a nil notification.
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-listener.Notify:
+		case <-ticker.C:
+			go func() { _ = listener.Ping() }()
+		}
+		lastSeq = b.dispatchAfter(ctx, lastSeq)
+	}
+}
+
+// dispatchAfter sends every stored event after seq to the subscribers and
+// returns the last Seq dispatched
+func (b *Broker) dispatchAfter(ctx context.Context, seq int64) int64 {
+	const batchSize = 500
+	for {
+		events, err := b.repo.ListAfter(ctx, seq, nil, batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to read events: %v", err)
+			}
+			return seq
+		}
+		for _, event := range events {
+			b.dispatch(event)
+			seq = event.Seq
+		}
+		if len(events) < batchSize {
+			return seq
+		}
+	}
+}
+
+func (b *Broker) dispatch(event *Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		if !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// Dropping the subscriber rather than the event keeps delivery
+			// gap-free: the client resumes from the log when it reconnects
+			sub.close()
+		}
+	}
+}
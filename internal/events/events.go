@@ -0,0 +1,99 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types
+const (
+	TypeFileCreated         = "file.created"
+	TypeFileDeleted         = "file.deleted"
+	TypeFileRenamed         = "file.renamed"
+	TypeFileMetadataChanged = "file.metadata_changed" // Tags or metadata were edited
+	TypeMemberAdded         = "member.added"
+	TypeMemberRemoved       = "member.removed"
+)
+
+// Types lists every event type
+var Types = []string{
+	TypeFileCreated,
+	TypeFileDeleted,
+	TypeFileRenamed,
+	TypeFileMetadataChanged,
+	TypeMemberAdded,
+	TypeMemberRemoved,
+}
+
+// ValidType reports whether t is a known event type
+func ValidType(t string) bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is something that happened in a group
+type Event struct {
+	Seq        int64                  `json:"-"` // Position in the stored event log, set once persisted
+	ID         uuid.UUID              `json:"id"`
+	Type       string                 `json:"type"`
+	GroupID    uuid.UUID              `json:"group_id"`
+	ActorID    uuid.UUID              `json:"actor_id"` // uuid.Nil for system or provisioning changes
+	OccurredAt time.Time              `json:"occurred_at"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// Publisher publishes events. Publishing never fails the caller's operation;
+// subscribers handle and log their own errors.
+type Publisher interface {
+	Publish(ctx context.Context, event *Event)
+}
+
+// HandlerFunc handles a published event
+type HandlerFunc func(ctx context.Context, event *Event)
+
+// Bus is an in-process Publisher that hands each event to every subscriber
+// in turn
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []HandlerFunc
+}
+
+// NewBus creates a new Bus
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers a handler for all events
+func (b *Bus) Subscribe(handler HandlerFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish assigns the event an ID and time if unset and delivers it to the
+// subscribers. Handlers run synchronously and should only enqueue work.
+func (b *Bus) Publish(ctx context.Context, event *Event) {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	// Keep delivering even if the request was cancelled after the change
+	ctx = context.WithoutCancel(ctx)
+	for _, handler := range handlers {
+		handler(ctx, event)
+	}
+}
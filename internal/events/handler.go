@@ -0,0 +1,218 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// heartbeatInterval keeps idle streams alive through proxies that close
+// quiet connections
+const heartbeatInterval = 25 * time.Second
+
+// MembershipLister lists the groups a user belongs to
+type MembershipLister interface {
+	GetUserGroupIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// ActiveChecker checks that a user's account still exists and is not
+// disabled
+type ActiveChecker interface {
+	CheckActive(ctx context.Context, userID uuid.UUID) error
+}
+
+// Handler streams group events to clients over Server-Sent Events
+type Handler struct {
+	broker      *Broker
+	repo        Repository
+	memberships MembershipLister
+	users       ActiveChecker
+	heartbeat   time.Duration
+}
+
+// NewHandler creates a new events handler
+func NewHandler(broker *Broker, repo Repository, memberships MembershipLister, users ActiveChecker) *Handler {
+	return &Handler{broker: broker, repo: repo, memberships: memberships, users: users, heartbeat: heartbeatInterval}
+}
+
+// Stream handles GET /events. It streams events for every group the user
+// belongs to. Clients that send Last-Event-ID, or the last_event_id query
+// parameter, first receive the stored events they missed. The stream ends
+// when the access token it was opened with expires, or at the next
+// heartbeat after the account is disabled or deleted; the client then
+// reconnects with a fresh token.
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var lastSeq int64
+	if lastID != "" {
+		var err error
+		if lastSeq, err = strconv.ParseInt(lastID, 10, 64); err != nil || lastSeq < 0 {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	groupIDs, err := h.memberships.GetUserGroupIDs(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	groups := newGroupSet(userID, groupIDs)
+
+	// Subscribe before replaying so nothing falls between the two
+	sub := h.broker.Subscribe(groups.allows)
+	defer sub.Close()
+
+	// Streams outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, "retry: 3000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	if lastSeq > 0 {
+		const batchSize = 500
+		for {
+			missed, err := h.repo.ListAfter(r.Context(), lastSeq, groups.snapshot(), batchSize)
+			if err != nil {
+				log.Printf("Failed to replay events: %v", err)
+				return
+			}
+			for _, event := range missed {
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+				lastSeq = event.Seq
+			}
+			if len(missed) < batchSize {
+				break
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+
+	var expired <-chan time.Time
+	if claims, ok := auth.GetClaims(r.Context()); ok && claims.ExpiresAt != nil {
+		expiry := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+		defer expiry.Stop()
+		expired = expiry.C
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expired:
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				return // Fell behind; the client resumes with Last-Event-ID
+			}
+			if event.Seq <= lastSeq {
+				continue // Already sent during replay
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			lastSeq = event.Seq
+		case <-heartbeat.C:
+			if err := h.users.CheckActive(r.Context(), userID); err != nil {
+				if !errors.Is(err, user.ErrAccountDisabled) && !errors.Is(err, user.ErrUserNotFound) {
+					log.Printf("Failed to check account %s for event stream: %v", userID, err)
+				}
+				return
+			}
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Helper functions
+
+func writeEvent(w http.ResponseWriter, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+	return err
+}
+
+// groupSet tracks the groups a streaming user belongs to, following the
+// user's own membership changes while the stream is open
+type groupSet struct {
+	userID string
+	mu     sync.Mutex
+	groups map[uuid.UUID]struct{}
+}
+
+func newGroupSet(userID uuid.UUID, groupIDs []uuid.UUID) *groupSet {
+	s := &groupSet{userID: userID.String(), groups: make(map[uuid.UUID]struct{}, len(groupIDs))}
+	for _, id := range groupIDs {
+		s.groups[id] = struct{}{}
+	}
+	return s
+}
+
+// allows reports whether the event belongs to one of the user's groups. The
+// user is told about their own removal before the group is dropped.
+func (s *groupSet) allows(event *Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	self := event.Data["user_id"] == s.userID
+	switch {
+	case event.Type == TypeMemberAdded && self:
+		s.groups[event.GroupID] = struct{}{}
+	case event.Type == TypeMemberRemoved && self:
+		_, ok := s.groups[event.GroupID]
+		delete(s.groups, event.GroupID)
+		return ok
+	}
+	_, ok := s.groups[event.GroupID]
+	return ok
+}
+
+func (s *groupSet) snapshot() []uuid.UUID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]uuid.UUID, 0, len(s.groups))
+	for id := range s.groups {
+		ids = append(ids, id)
+	}
+	return ids
+}
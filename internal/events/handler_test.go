@@ -0,0 +1,100 @@
+package events
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+func TestGroupSetFollowsOwnMembership(t *testing.T) {
+	userID, other := uuid.New(), uuid.New()
+	member, joined := uuid.New(), uuid.New()
+	groups := newGroupSet(userID, []uuid.UUID{member})
+
+	steps := []struct {
+		name  string
+		event *Event
+		want  bool
+	}{
+		{"member group", &Event{Type: TypeFileCreated, GroupID: member}, true},
+		{"other group", &Event{Type: TypeFileCreated, GroupID: joined}, false},
+		{"someone else joins", &Event{Type: TypeMemberAdded, GroupID: joined, Data: map[string]interface{}{"user_id": other.String()}}, false},
+		{"user joins", &Event{Type: TypeMemberAdded, GroupID: joined, Data: map[string]interface{}{"user_id": userID.String()}}, true},
+		{"joined group", &Event{Type: TypeFileCreated, GroupID: joined}, true},
+		{"user removed", &Event{Type: TypeMemberRemoved, GroupID: member, Data: map[string]interface{}{"user_id": userID.String()}}, true},
+		{"removed group", &Event{Type: TypeFileCreated, GroupID: member}, false},
+	}
+
+	for _, step := range steps {
+		if got := groups.allows(step.event); got != step.want {
+			t.Errorf("%s: allows() = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	if ids := groups.snapshot(); len(ids) != 1 || ids[0] != joined {
+		t.Errorf("snapshot() = %v, want [%s]", ids, joined)
+	}
+}
+
+type noGroups struct{}
+
+func (noGroups) GetUserGroupIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	return nil, nil
+}
+
+// accountState reports a fixed result for every check
+type accountState struct{ err error }
+
+func (a accountState) CheckActive(ctx context.Context, userID uuid.UUID) error { return a.err }
+
+func TestStreamEnds(t *testing.T) {
+	tests := []struct {
+		name          string
+		account       error
+		expiresIn     time.Duration
+		wantHeartbeat bool
+	}{
+		{"token expires", nil, 50 * time.Millisecond, true},
+		{"account disabled", user.ErrAccountDisabled, time.Hour, false},
+		{"account deleted", user.ErrUserNotFound, time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(NewBroker(nil, ""), nil, noGroups{}, accountState{err: tt.account})
+			h.heartbeat = 10 * time.Millisecond
+
+			userID := uuid.New()
+			claims := &auth.Claims{UserID: userID}
+			claims.ExpiresAt = &jwt.NumericDate{Time: time.Now().Add(tt.expiresIn)}
+			ctx := context.WithValue(context.Background(), auth.UserIDKey, userID)
+			ctx = context.WithValue(ctx, auth.ClaimsKey, claims)
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/events", nil).WithContext(ctx)
+			rec := httptest.NewRecorder()
+
+			done := make(chan struct{})
+			go func() {
+				h.Stream(rec, req)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("stream did not end")
+			}
+
+			if got := strings.Contains(rec.Body.String(), ": heartbeat"); got != tt.wantHeartbeat {
+				t.Errorf("heartbeat sent = %v, want %v", got, tt.wantHeartbeat)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// NotifyChannel is the Postgres channel on which appended event sequence
+// numbers are announced
+const NotifyChannel = "group_events"
+
+// appendLockKey is the advisory lock that serializes appends, so sequence
+// numbers become visible in order and readers never skip a late commit
+const appendLockKey = 0x65766e74 // "evnt"
+
+// Repository defines the interface for the stored event log
+type Repository interface {
+	// Append stores the event, sets its Seq and notifies listeners
+	Append(ctx context.Context, event *Event) error
+	// ListAfter returns up to limit events with Seq greater than afterSeq in
+	// order. A nil groupIDs matches every group.
+	ListAfter(ctx context.Context, afterSeq int64, groupIDs []uuid.UUID, limit int) ([]*Event, error)
+	// LatestSeq returns the highest stored Seq, or 0 when the log is empty
+	LatestSeq(ctx context.Context) (int64, error)
+	// DeleteBefore prunes events that occurred before t
+	DeleteBefore(ctx context.Context, t time.Time) (int64, error)
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// Append inserts the event and issues a NOTIFY carrying its Seq, which
+// Postgres delivers to listeners on every replica once the insert commits
+func (r *PostgresRepository) Append(ctx context.Context, event *Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	if event.Data == nil {
+		data = []byte("{}")
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, appendLockKey); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO group_events (id, type, group_id, actor_id, occurred_at, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING seq
+	`
+	var actorID interface{}
+	if event.ActorID != uuid.Nil {
+		actorID = event.ActorID
+	}
+	err = tx.QueryRowContext(ctx, query, event.ID, event.Type, event.GroupID, actorID, event.OccurredAt, data).
+		Scan(&event.Seq)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, NotifyChannel, strconv.FormatInt(event.Seq, 10)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListAfter retrieves events after a sequence number
+func (r *PostgresRepository) ListAfter(ctx context.Context, afterSeq int64, groupIDs []uuid.UUID, limit int) ([]*Event, error) {
+	query := `
+		SELECT seq, id, type, group_id, actor_id, occurred_at, data
+		FROM group_events
+		WHERE seq > $1 AND ($2::uuid[] IS NULL OR group_id = ANY($2))
+		ORDER BY seq
+		LIMIT $3
+	`
+	var groups interface{}
+	if groupIDs != nil {
+		ids := make([]string, len(groupIDs))
+		for i, id := range groupIDs {
+			ids[i] = id.String()
+		}
+		groups = pq.Array(ids)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, afterSeq, groups, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var events []*Event
+	for rows.Next() {
+		event := &Event{}
+		var data []byte
+		if err := rows.Scan(&event.Seq, &event.ID, &event.Type, &event.GroupID, &event.ActorID, &event.OccurredAt,
+			&data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &event.Data); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// LatestSeq retrieves the highest stored sequence number
+func (r *PostgresRepository) LatestSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM group_events`).Scan(&seq)
+	return seq, err
+}
+
+// DeleteBefore removes events older than t
+func (r *PostgresRepository) DeleteBefore(ctx context.Context, t time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM group_events WHERE occurred_at < $1`, t)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
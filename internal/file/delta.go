@@ -0,0 +1,284 @@
+package file
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/group"
+)
+
+// Delta page sizes
+const (
+	DefaultDeltaLimit = 500
+	MaxDeltaLimit     = 2000
+)
+
+// Long poll limits
+const (
+	MaxLongpollCursors     = 100 // Cursors one long poll may watch
+	DefaultLongpollTimeout = 30 * time.Second
+)
+
+// cursor is the decoded form of a delta cursor. While Listing, the client
+// is still paging through the group's files as of journal position Seq;
+// afterwards it follows the journal from Seq. Cursors only hold journal
+// positions, so they stay valid across server restarts.
+type cursor struct {
+	GroupID uuid.UUID `json:"g"`
+	Seq     int64     `json:"s"`
+	Listing bool      `json:"l,omitempty"`
+	After   uuid.UUID `json:"a,omitempty"` // Last file ID listed
+}
+
+func (c *cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(b, c); err != nil || c.GroupID == uuid.Nil || c.Seq < 0 {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ListDelta starts a delta sync of a group. The first page lists the
+// group's current files; the returned cursor continues the listing and then
+// follows changes made after it started.
+func (s *Service) ListDelta(ctx context.Context, groupID, userID uuid.UUID, limit int) (*DeltaPage, error) {
+	if err := s.requireMember(ctx, groupID, userID); err != nil {
+		return nil, err
+	}
+
+	// Files changed while the listing is paged are also replayed from the
+	// journal, so applying both leaves the client in the latest state
+	seq, err := s.repo.CurrentChangeSeq(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return s.listPage(ctx, &cursor{GroupID: groupID, Seq: seq, Listing: true}, clampDeltaLimit(limit))
+}
+
+// ContinueDelta returns the next page after a cursor: the rest of the
+// initial listing, then files added, modified or deleted since the cursor
+func (s *Service) ContinueDelta(ctx context.Context, groupID, userID uuid.UUID, token string, limit int) (*DeltaPage, error) {
+	c, err := decodeCursor(token)
+	if err != nil {
+		return nil, err
+	}
+	if c.GroupID != groupID {
+		return nil, ErrInvalidCursor
+	}
+	if err := s.requireMember(ctx, groupID, userID); err != nil {
+		return nil, err
+	}
+
+	limit = clampDeltaLimit(limit)
+	if c.Listing {
+		return s.listPage(ctx, c, limit)
+	}
+
+	current, err := s.repo.CurrentChangeSeq(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Seq > current {
+		// The journal is behind the cursor, e.g. after a database restore
+		return nil, ErrCursorReset
+	}
+
+	changes, err := s.repo.ListChanges(ctx, groupID, c.Seq, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	hasMore := len(changes) > limit
+	if hasMore {
+		changes = changes[:limit]
+	}
+
+	next := &cursor{GroupID: groupID, Seq: c.Seq}
+	if len(changes) > 0 {
+		next.Seq = changes[len(changes)-1].Seq
+	}
+	return &DeltaPage{Entries: collapseChanges(changes), Cursor: next.encode(), HasMore: hasMore}, nil
+}
+
+// LatestCursor returns a cursor at the end of the group's journal, for
+// clients that only want changes from now on
+func (s *Service) LatestCursor(ctx context.Context, groupID, userID uuid.UUID) (string, error) {
+	if err := s.requireMember(ctx, groupID, userID); err != nil {
+		return "", err
+	}
+	seq, err := s.repo.CurrentChangeSeq(ctx, groupID)
+	if err != nil {
+		return "", err
+	}
+	return (&cursor{GroupID: groupID, Seq: seq}).encode(), nil
+}
+
+// Longpoll waits up to timeout for changes after any of the cursors and
+// returns the groups that have them. It returns as soon as one does, and
+// returns no groups if the timeout passes first. The database is only
+// queried to check positions, never held while waiting.
+func (s *Service) Longpoll(ctx context.Context, userID uuid.UUID, tokens []string, timeout time.Duration) ([]uuid.UUID, error) {
+	if len(tokens) == 0 || len(tokens) > MaxLongpollCursors {
+		return nil, ErrInvalidCursor
+	}
+
+	positions := make(map[uuid.UUID]int64, len(tokens))
+	var listing []uuid.UUID
+	for _, token := range tokens {
+		c, err := decodeCursor(token)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.requireMember(ctx, c.GroupID, userID); err != nil {
+			return nil, err
+		}
+		if c.Listing {
+			// The rest of the listing is available now
+			listing = append(listing, c.GroupID)
+			continue
+		}
+		if pos, ok := positions[c.GroupID]; !ok || c.Seq < pos {
+			positions[c.GroupID] = c.Seq
+		}
+	}
+	if len(listing) > 0 {
+		return listing, nil
+	}
+
+	// Register before checking so a change committed in between still wakes us
+	watch := s.watcher.Watch(positions)
+	defer watch.Close()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		changed, err := s.changedGroups(ctx, positions)
+		if err != nil || len(changed) > 0 {
+			return changed, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-timer.C:
+			return nil, nil
+		case <-watch.C:
+		}
+	}
+}
+
+func (s *Service) changedGroups(ctx context.Context, positions map[uuid.UUID]int64) ([]uuid.UUID, error) {
+	var changed []uuid.UUID
+	for groupID, pos := range positions {
+		seq, err := s.repo.CurrentChangeSeq(ctx, groupID)
+		if err != nil {
+			return nil, err
+		}
+		// A journal behind the cursor also reports a change, so the client's
+		// continue call learns that the cursor was reset
+		if seq != pos {
+			changed = append(changed, groupID)
+		}
+	}
+	return changed, nil
+}
+
+func (s *Service) listPage(ctx context.Context, c *cursor, limit int) (*DeltaPage, error) {
+	files, err := s.repo.ListPage(ctx, c.GroupID, c.After, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &DeltaPage{Entries: make([]*DeltaEntry, 0, min(len(files), limit))}
+	next := &cursor{GroupID: c.GroupID, Seq: c.Seq}
+	if len(files) > limit {
+		files = files[:limit]
+		page.HasMore = true
+		next.Listing = true
+		next.After = files[len(files)-1].ID
+	}
+	for _, f := range files {
+		page.Entries = append(page.Entries, &DeltaEntry{Tag: TagAdded, File: f})
+	}
+	page.Cursor = next.encode()
+	return page, nil
+}
+
+func (s *Service) requireMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	isMember, err := s.groupService.IsMember(ctx, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return group.ErrNotMember
+	}
+	return nil
+}
+
+// collapseChanges reduces journal entries to one entry per file holding its
+// latest state, ordered by each file's last change. A file created within
+// the entries is tagged added even if it was modified afterwards.
+func collapseChanges(changes []*Change) []*DeltaEntry {
+	type state struct {
+		last  *Change
+		added bool
+	}
+	files := make(map[uuid.UUID]*state)
+	for _, c := range changes {
+		st, ok := files[c.FileID]
+		if !ok {
+			st = &state{}
+			files[c.FileID] = st
+		}
+		st.last = c
+		st.added = st.added || c.Change == ChangeAdd
+	}
+
+	states := make([]*state, 0, len(files))
+	for _, st := range files {
+		states = append(states, st)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].last.Seq < states[j].last.Seq })
+
+	entries := make([]*DeltaEntry, len(states))
+	for i, st := range states {
+		c := st.last
+		entry := &DeltaEntry{Tag: TagModified, File: &File{
+			ID:          c.FileID,
+			Name:        c.Name,
+			SizeBytes:   c.SizeBytes,
+			ContentType: c.ContentType,
+			GroupID:     c.GroupID,
+			UploadedBy:  c.UploadedBy,
+			CreatedAt:   c.CreatedAt,
+		}}
+		switch {
+		case c.Change == ChangeDelete:
+			entry.Tag = TagDeleted
+			entry.File = &File{ID: c.FileID, Name: c.Name, GroupID: c.GroupID}
+		case st.added:
+			entry.Tag = TagAdded
+		}
+		entries[i] = entry
+	}
+	return entries
+}
+
+func clampDeltaLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultDeltaLimit
+	}
+	return min(limit, MaxDeltaLimit)
+}
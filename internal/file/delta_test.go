@@ -0,0 +1,62 @@
+package file
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := &cursor{GroupID: uuid.New(), Seq: 42, Listing: true, After: uuid.New()}
+	got, err := decodeCursor(c.encode())
+	if err != nil {
+		t.Fatalf("decodeCursor() error = %v", err)
+	}
+	if *got != *c {
+		t.Errorf("decodeCursor() = %+v, want %+v", got, c)
+	}
+
+	for _, bad := range []string{"", "not base64!", "e30", "eyJnIjoiMDAwMDAwMDAtMDAwMC0wMDAwLTAwMDAtMDAwMDAwMDAwMDAwIn0"} {
+		if _, err := decodeCursor(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) error = %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestCollapseChanges(t *testing.T) {
+	kept, renamed, removed, transient := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	changes := []*Change{
+		{Seq: 1, FileID: kept, Change: ChangeAdd, Name: "a.txt", SizeBytes: 3},
+		{Seq: 2, FileID: renamed, Change: ChangeModify, Name: "b.txt"},
+		{Seq: 3, FileID: transient, Change: ChangeAdd, Name: "tmp"},
+		{Seq: 4, FileID: kept, Change: ChangeModify, Name: "a2.txt", SizeBytes: 3},
+		{Seq: 5, FileID: removed, Change: ChangeDelete, Name: "c.txt", SizeBytes: 9},
+		{Seq: 6, FileID: transient, Change: ChangeDelete, Name: "tmp"},
+	}
+
+	want := []struct {
+		id   uuid.UUID
+		tag  string
+		name string
+	}{
+		{renamed, TagModified, "b.txt"},
+		{kept, TagAdded, "a2.txt"},
+		{removed, TagDeleted, "c.txt"},
+		{transient, TagDeleted, "tmp"},
+	}
+
+	entries := collapseChanges(changes)
+	if len(entries) != len(want) {
+		t.Fatalf("collapseChanges() returned %d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.File.ID != w.id || e.Tag != w.tag || e.File.Name != w.name {
+			t.Errorf("entry %d = {%s %s %s}, want {%s %s %s}", i, e.File.ID, e.Tag, e.File.Name, w.id, w.tag, w.name)
+		}
+	}
+	if entries[2].File.SizeBytes != 0 {
+		t.Errorf("tombstone carries size %d, want 0", entries[2].File.SizeBytes)
+	}
+}
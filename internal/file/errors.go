@@ -3,12 +3,28 @@ package file
 import "errors"
 
 var (
-	ErrFileNotFound       = errors.New("file not found")
-	ErrNameRequired       = errors.New("name is required")
-	ErrGroupIDRequired    = errors.New("group ID is required")
-	ErrUploadedByRequired = errors.New("uploaded by is required")
-	ErrFileTooLarge       = errors.New("file exceeds maximum size")
-	ErrInvalidContentType = errors.New("invalid content type")
-	ErrUploadFailed       = errors.New("failed to upload file")
-	ErrDownloadFailed     = errors.New("failed to download file")
+	ErrFileNotFound         = errors.New("file not found")
+	ErrNameRequired         = errors.New("name is required")
+	ErrNameTooLong          = errors.New("name must be at most 255 characters")
+	ErrGroupIDRequired      = errors.New("group ID is required")
+	ErrUploadedByRequired   = errors.New("uploaded by is required")
+	ErrFileTooLarge         = errors.New("file exceeds maximum size")
+	ErrInvalidContentType   = errors.New("invalid content type")
+	ErrUploadFailed         = errors.New("failed to upload file")
+	ErrDownloadFailed       = errors.New("failed to download file")
+	ErrInvalidRange         = errors.New("offset is outside the file")
+	ErrInvalidCursor        = errors.New("invalid cursor")
+	ErrCursorReset          = errors.New("cursor is no longer valid; restart with a full listing")
+	ErrInvalidSizeRange     = errors.New("minimum size exceeds maximum size")
+	ErrInvalidDateRange     = errors.New("date range ends before it starts")
+	ErrQueryRequired        = errors.New("search query is required")
+	ErrQueryTooLong         = errors.New("search query must be at most 200 characters")
+	ErrInvalidTag           = errors.New("tags must be 1 to 64 characters without commas or control characters")
+	ErrTooManyTags          = errors.New("a file may have at most 50 tags")
+	ErrInvalidMetadata      = errors.New("invalid metadata")
+	ErrMetadataRequired     = errors.New("required metadata is missing")
+	ErrInvalidSchema        = errors.New("invalid metadata schema")
+	ErrThumbnailNotFound    = errors.New("no thumbnail is available for this file")
+	ErrPreviewUnsupported   = errors.New("this file cannot be previewed")
+	ErrInvalidThumbnailSize = errors.New("size must be small, medium, large or a number of pixels from 1 to 4096")
 )
@@ -0,0 +1,278 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Document kinds the indexer extracts text from
+const (
+	kindNone = iota
+	kindText // Plain text, markdown, CSV and source code, indexed as is
+	kindJSON
+	kindHTML
+	kindDOCX
+	kindXLSX
+)
+
+// OOXML content types
+const (
+	contentTypeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	contentTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// extensionKinds maps file extensions to document kinds. Uploads often
+// arrive as application/octet-stream, so the extension is checked first.
+var extensionKinds = map[string]int{
+	".txt": kindText, ".text": kindText, ".log": kindText, ".md": kindText, ".markdown": kindText,
+	".rst": kindText, ".csv": kindText, ".tsv": kindText,
+	".go": kindText, ".py": kindText, ".js": kindText, ".mjs": kindText, ".ts": kindText, ".tsx": kindText,
+	".jsx": kindText, ".java": kindText, ".kt": kindText, ".scala": kindText, ".c": kindText, ".h": kindText,
+	".cc": kindText, ".cpp": kindText, ".hpp": kindText, ".cs": kindText, ".rb": kindText, ".rs": kindText,
+	".php": kindText, ".swift": kindText, ".lua": kindText, ".pl": kindText, ".r": kindText,
+	".sh": kindText, ".bash": kindText, ".zsh": kindText, ".ps1": kindText, ".sql": kindText,
+	".css": kindText, ".scss": kindText, ".proto": kindText, ".tf": kindText,
+	".yaml": kindText, ".yml": kindText, ".toml": kindText, ".ini": kindText, ".cfg": kindText,
+	".conf": kindText, ".env": kindText, ".xml": kindText,
+	".json": kindJSON,
+	".html": kindHTML, ".htm": kindHTML, ".xhtml": kindHTML,
+	".docx": kindDOCX,
+	".xlsx": kindXLSX,
+}
+
+// documentKind decides how to extract a file's text from its name and
+// content type
+func documentKind(name, contentType string) int {
+	if kind, ok := extensionKinds[strings.ToLower(path.Ext(name))]; ok {
+		return kind
+	}
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	switch {
+	case mediaType == "text/html", mediaType == "application/xhtml+xml":
+		return kindHTML
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return kindJSON
+	case mediaType == contentTypeDOCX:
+		return kindDOCX
+	case mediaType == contentTypeXLSX:
+		return kindXLSX
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/xml",
+		mediaType == "application/javascript", mediaType == "application/sql",
+		mediaType == "application/x-sh", mediaType == "application/yaml", mediaType == "application/toml":
+		return kindText
+	}
+	return kindNone
+}
+
+// textBuffer collects extracted text up to a size limit
+type textBuffer struct {
+	b   strings.Builder
+	max int
+}
+
+// write appends s as is. It reports false once the buffer is full, after
+// which further text is dropped.
+func (t *textBuffer) write(s string) bool {
+	room := t.max - t.b.Len()
+	if len(s) > room {
+		t.b.WriteString(truncateUTF8(s, room))
+		return false
+	}
+	t.b.WriteString(s)
+	return true
+}
+
+// add appends s as a separate piece of text
+func (t *textBuffer) add(s string) bool {
+	if s = strings.TrimSpace(s); s == "" {
+		return t.b.Len() < t.max
+	}
+	return t.write(s) && t.write(" ")
+}
+
+func (t *textBuffer) String() string {
+	return strings.TrimSpace(t.b.String())
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// extractText returns up to maxText bytes of a document's text. Formats
+// that must be parsed as a whole are read up to maxFile bytes; text is read
+// only as far as maxText. Binary content yields no text.
+func extractText(kind int, r io.Reader, size, maxFile int64, maxText int) (string, error) {
+	buf := &textBuffer{max: maxText}
+	switch kind {
+	case kindText:
+		data, err := io.ReadAll(io.LimitReader(r, int64(maxText)))
+		if err != nil {
+			return "", err
+		}
+		if isBinary(data) {
+			return "", nil
+		}
+		buf.add(strings.ToValidUTF8(string(data), ""))
+	case kindJSON:
+		extractJSON(io.LimitReader(r, maxFile), buf)
+	case kindHTML:
+		extractHTML(io.LimitReader(r, maxFile), buf)
+	case kindDOCX, kindXLSX:
+		if size > maxFile {
+			return "", nil
+		}
+		data, err := io.ReadAll(io.LimitReader(r, maxFile))
+		if err != nil {
+			return "", err
+		}
+		if err := extractOOXML(kind, data, maxFile, buf); err != nil {
+			return "", nil // A corrupt document has no text to index
+		}
+	}
+	return buf.String(), nil
+}
+
+// isBinary reports whether the start of data holds a NUL byte, which text
+// never does
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8<<10)], 0) >= 0
+}
+
+// extractJSON collects a JSON document's keys, strings and numbers. A
+// document cut off by the size limit keeps what was read before the cut.
+func extractJSON(r io.Reader, buf *textBuffer) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return
+		}
+		var s string
+		switch v := tok.(type) {
+		case string:
+			s = v
+		case json.Number:
+			s = v.String()
+		default:
+			continue
+		}
+		if !buf.add(s) {
+			return
+		}
+	}
+}
+
+// extractHTML collects an HTML document's text, leaving out scripts and
+// styles
+func extractHTML(r io.Reader, buf *textBuffer) {
+	z := html.NewTokenizer(r)
+	skip := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return
+		case html.StartTagToken:
+			if name, _ := z.TagName(); isHiddenElement(string(name)) {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); isHiddenElement(string(name)) && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip == 0 && !buf.add(html.UnescapeString(string(z.Text()))) {
+				return
+			}
+		}
+	}
+}
+
+func isHiddenElement(name string) bool {
+	switch name {
+	case "script", "style", "noscript", "template":
+		return true
+	}
+	return false
+}
+
+// extractOOXML collects the text of a Word document's body or a
+// spreadsheet's cells. Both keep text in <t> elements: Word in the main
+// document part, Excel in the shared strings table and in inline strings
+// on each sheet. No part is decompressed past maxFile bytes.
+func extractOOXML(kind int, data []byte, maxFile int64, buf *textBuffer) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		var wanted bool
+		switch kind {
+		case kindDOCX:
+			wanted = f.Name == "word/document.xml"
+		case kindXLSX:
+			wanted = f.Name == "xl/sharedStrings.xml" ||
+				strings.HasPrefix(f.Name, "xl/worksheets/") && strings.HasSuffix(f.Name, ".xml")
+		}
+		if !wanted {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		full := extractXMLText(io.LimitReader(rc, maxFile), buf)
+		_ = rc.Close()
+		if full {
+			return nil
+		}
+	}
+	return nil
+}
+
+// extractXMLText adds the character data of every <t> element to buf. Word
+// splits words across runs, so text is joined as is and separated only at
+// the end of paragraphs, strings, cells, tabs and breaks. It reports
+// whether buf filled up.
+func extractXMLText(r io.Reader, buf *textBuffer) bool {
+	dec := xml.NewDecoder(r)
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false // The end, or malformed or cut off; keep what was read
+		}
+		full := false
+		switch t := tok.(type) {
+		case xml.StartElement:
+			inText = t.Name.Local == "t"
+		case xml.EndElement:
+			inText = false
+			switch t.Name.Local {
+			case "p", "si", "c", "tab", "br":
+				full = !buf.write(" ")
+			}
+		case xml.CharData:
+			full = inText && !buf.write(string(t))
+		}
+		if full {
+			return true
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDocumentKind(t *testing.T) {
+	tests := []struct {
+		name, contentType string
+		want              int
+	}{
+		{"notes.md", "application/octet-stream", kindText},
+		{"main.go", "", kindText},
+		{"data.json", "text/plain", kindJSON},
+		{"page", "text/html; charset=utf-8", kindHTML},
+		{"report.DOCX", "", kindDOCX},
+		{"sheet", contentTypeXLSX, kindXLSX},
+		{"events", "application/ld+json", kindJSON},
+		{"photo.jpg", "image/jpeg", kindNone},
+	}
+	for _, tt := range tests {
+		if got := documentKind(tt.name, tt.contentType); got != tt.want {
+			t.Errorf("documentKind(%q, %q) = %d, want %d", tt.name, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func extract(t *testing.T, kind int, data []byte, maxText int) string {
+	t.Helper()
+	text, err := extractText(kind, bytes.NewReader(data), int64(len(data)), 1<<20, maxText)
+	if err != nil {
+		t.Fatalf("extractText() error = %v", err)
+	}
+	return text
+}
+
+func TestExtractText(t *testing.T) {
+	if got := extract(t, kindText, []byte("hello, world"), 1024); got != "hello, world" {
+		t.Errorf("text = %q", got)
+	}
+	if got := extract(t, kindText, []byte("GIF89a\x00\x01"), 1024); got != "" {
+		t.Errorf("binary = %q, want none", got)
+	}
+	if got := extract(t, kindText, []byte("héllo"), 2); got != "h" {
+		t.Errorf("truncated = %q, want %q", got, "h")
+	}
+
+	got := extract(t, kindJSON, []byte(`{"title":"Budget","year":2024,"tags":["q3",true]}`), 1024)
+	if got != "title Budget year 2024 tags q3" {
+		t.Errorf("JSON = %q", got)
+	}
+
+	page := `<html><head><title>Plan</title><style>p{}</style></head>
+		<body><p>Ship &amp; celebrate</p><script>var x = "secret"</script></body></html>`
+	if got := extract(t, kindHTML, []byte(page), 1024); got != "Plan Ship & celebrate" {
+		t.Errorf("HTML = %q", got)
+	}
+}
+
+func ooxml(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractOOXML(t *testing.T) {
+	docx := ooxml(t, map[string]string{
+		"word/document.xml": `<w:document xmlns:w="w"><w:body>` +
+			`<w:p><w:r><w:t>Quar</w:t></w:r><w:r><w:t>terly</w:t></w:r><w:r><w:tab/><w:t>review</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>Next steps</w:t></w:r></w:p></w:body></w:document>`,
+		"word/styles.xml": `<w:styles xmlns:w="w"><w:t>ignored</w:t></w:styles>`,
+	})
+	if got := strings.Join(strings.Fields(extract(t, kindDOCX, docx, 1024)), " "); got != "Quarterly review Next steps" {
+		t.Errorf("docx = %q", got)
+	}
+
+	xlsx := ooxml(t, map[string]string{
+		"xl/sharedStrings.xml":     `<sst><si><t>Revenue</t></si><si><t>Costs</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row><c t="inlineStr"><is><t>Margin</t></is></c><c><v>42</v></c></row></sheetData></worksheet>`,
+	})
+	got := extract(t, kindXLSX, xlsx, 1024)
+	for _, want := range []string{"Revenue", "Costs", "Margin"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("xlsx = %q, missing %q", got, want)
+		}
+	}
+
+	if got := extract(t, kindDOCX, []byte("not a zip"), 1024); got != "" {
+		t.Errorf("corrupt docx = %q, want none", got)
+	}
+}
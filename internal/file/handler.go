@@ -3,35 +3,114 @@ package file
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/testifysec/dropbox-clone/internal/auth"
 	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/pagination"
 )
 
 // Handler handles file-related HTTP requests
 type Handler struct {
-	service *Service
+	service     *Service
+	longpollMax time.Duration
 }
 
-// NewHandler creates a new file handler
-func NewHandler(service *Service) *Handler {
-	return &Handler{service: service}
+// NewHandler creates a new file handler. Long polls wait at most
+// longpollMax.
+func NewHandler(service *Service, longpollMax time.Duration) *Handler {
+	return &Handler{service: service, longpollMax: longpollMax}
 }
 
 // FileResponse represents a file in API responses
 type FileResponse struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	SizeBytes   int64    `json:"size_bytes"`
+	ContentType string   `json:"content_type"`
+	GroupID     string   `json:"group_id"`
+	UploadedBy  string   `json:"uploaded_by"` // Empty once the uploader's account is deleted
+	CreatedAt   string   `json:"created_at"`
+	Tags        []string `json:"tags"`
+	Metadata    Metadata `json:"metadata"`
+}
+
+// TagsRequest represents a request to replace a file's tags
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// SchemaResponse represents a group's metadata schema
+type SchemaResponse struct {
+	Fields []*MetadataField `json:"fields"`
+}
+
+// SearchResultResponse represents a search match. Highlight is the file's
+// name as HTML with the matched words in <mark> elements.
+type SearchResultResponse struct {
+	File           FileResponse `json:"file"`
+	Highlight      string       `json:"highlight"`
+	Rank           float64      `json:"rank"`
+	MatchedContent bool         `json:"matched_content"`
+}
+
+// SearchResponse represents a page of search results
+type SearchResponse struct {
+	Results []SearchResultResponse `json:"results"`
+	HasMore bool                   `json:"has_more"`
+}
+
+// ReindexResponse reports how many files were queued for indexing
+type ReindexResponse struct {
+	Queued int64 `json:"queued"`
+}
+
+// ShareResponse represents a temporary download link
+type ShareResponse struct {
+	URL string `json:"url"`
+}
+
+// DeltaEntryResponse represents a delta sync entry in API responses.
+// Deleted entries only carry the file's ID and last name.
+type DeltaEntryResponse struct {
+	Tag         string `json:"tag"`
 	ID          string `json:"id"`
 	Name        string `json:"name"`
-	SizeBytes   int64  `json:"size_bytes"`
-	ContentType string `json:"content_type"`
-	GroupID     string `json:"group_id"`
-	UploadedBy  string `json:"uploaded_by"`
-	CreatedAt   string `json:"created_at"`
+	SizeBytes   *int64 `json:"size_bytes,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	UploadedBy  string `json:"uploaded_by,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+}
+
+// DeltaResponse represents a page of delta sync results
+type DeltaResponse struct {
+	Entries []DeltaEntryResponse `json:"entries"`
+	Cursor  string               `json:"cursor"`
+	HasMore bool                 `json:"has_more"`
+}
+
+// CursorResponse represents a delta cursor
+type CursorResponse struct {
+	Cursor string `json:"cursor"`
+}
+
+// LongpollRequest represents a long poll request. Timeout is in seconds.
+type LongpollRequest struct {
+	Cursors []string `json:"cursors"`
+	Timeout int      `json:"timeout"`
+}
+
+// LongpollResponse reports which groups have changes after their cursors
+type LongpollResponse struct {
+	Changes bool     `json:"changes"`
+	Groups  []string `json:"groups"`
 }
 
 // ErrorResponse represents an error response
@@ -73,17 +152,42 @@ func (h *Handler) Upload(w http.ResponseWriter, r *http.Request) {
 		contentType = "application/octet-stream"
 	}
 
+	// An explicit name field may carry a path, which multipart strips from
+	// the part's filename
+	name := header.Filename
+	if n := r.FormValue("name"); n != "" {
+		name = n
+	}
+
+	// Tags may be repeated or comma-separated; metadata is a JSON object
+	var tags []string
+	for _, v := range r.MultipartForm.Value["tags"] {
+		tags = append(tags, splitTags(v)...)
+	}
+	var metadata Metadata
+	if v := r.FormValue("metadata"); v != "" {
+		if err := json.Unmarshal([]byte(v), &metadata); err != nil {
+			respondError(w, "Metadata must be a JSON object", http.StatusBadRequest)
+			return
+		}
+	}
+
 	input := &UploadFileInput{
-		Name:        header.Filename,
+		Name:        name,
 		ContentType: contentType,
 		SizeBytes:   header.Size,
 		GroupID:     groupID,
 		UploadedBy:  userID,
+		Tags:        tags,
+		Metadata:    metadata,
 	}
 
 	uploadedFile, err := h.service.Upload(r.Context(), input, file)
 	if err != nil {
 		switch {
+		case errors.Is(err, ErrNameTooLong), errors.Is(err, ErrInvalidTag), errors.Is(err, ErrTooManyTags),
+			errors.Is(err, ErrInvalidMetadata), errors.Is(err, ErrMetadataRequired):
+			respondError(w, err.Error(), http.StatusBadRequest)
 		case errors.Is(err, ErrFileTooLarge):
 			respondError(w, "File exceeds maximum size (1 GB)", http.StatusRequestEntityTooLarge)
 		case errors.Is(err, group.ErrNotMember):
@@ -94,18 +198,11 @@ func (h *Handler) Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, FileResponse{
-		ID:          uploadedFile.ID.String(),
-		Name:        uploadedFile.Name,
-		SizeBytes:   uploadedFile.SizeBytes,
-		ContentType: uploadedFile.ContentType,
-		GroupID:     uploadedFile.GroupID.String(),
-		UploadedBy:  uploadedFile.UploadedBy.String(),
-		CreatedAt:   uploadedFile.CreatedAt.Format("2006-01-02T15:04:05Z"),
-	})
+	respondJSON(w, http.StatusCreated, toFileResponse(uploadedFile))
 }
 
-// List handles listing files in a group
+// List handles listing files in a group, a page at a time. The token for
+// the next page is returned in the X-Next-Page-Token header.
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 	userID, ok := auth.GetUserID(r.Context())
 	if !ok {
@@ -120,28 +217,45 @@ func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	files, err := h.service.ListByGroupID(r.Context(), groupID, userID)
+	opts, message := parseListOptions(r)
+	if message != "" {
+		respondError(w, message, http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.service.ListByGroupID(r.Context(), groupID, userID, opts)
 	if err != nil {
 		switch {
 		case errors.Is(err, group.ErrNotMember):
 			respondError(w, "You are not a member of this group", http.StatusForbidden)
+		case errors.Is(err, pagination.ErrInvalidToken):
+			respondError(w, "Invalid page token", http.StatusBadRequest)
+		case errors.Is(err, pagination.ErrInvalidSort):
+			respondError(w, "Invalid sort", http.StatusBadRequest)
+		case errors.Is(err, pagination.ErrInvalidOrder):
+			respondError(w, "Invalid order", http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidSizeRange):
+			respondError(w, "min_size must not exceed max_size", http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidDateRange):
+			respondError(w, "created_before must be after created_after", http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidTag):
+			respondError(w, "Invalid tag", http.StatusBadRequest)
+		case errors.Is(err, ErrTooManyTags):
+			respondError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidMetadata):
+			respondError(w, "Invalid metadata key", http.StatusBadRequest)
 		default:
 			respondError(w, "Failed to list files", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	response := make([]FileResponse, len(files))
-	for i, f := range files {
-		response[i] = FileResponse{
-			ID:          f.ID.String(),
-			Name:        f.Name,
-			SizeBytes:   f.SizeBytes,
-			ContentType: f.ContentType,
-			GroupID:     f.GroupID.String(),
-			UploadedBy:  f.UploadedBy.String(),
-			CreatedAt:   f.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		}
+	if page.NextPageToken != "" {
+		w.Header().Set(pagination.NextPageHeader, page.NextPageToken)
+	}
+	response := make([]FileResponse, len(page.Files))
+	for i, f := range page.Files {
+		response[i] = toFileResponse(f)
 	}
 
 	respondJSON(w, http.StatusOK, response)
@@ -185,6 +299,296 @@ func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
 	_, _ = io.Copy(w, body)
 }
 
+// Thumbnail handles GET /files/{fileId}/thumbnail, serving a scaled copy of
+// an image. size is small, medium (the default), large or a number of
+// pixels; the closest size generated is served.
+func (h *Handler) Thumbnail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fileID, err := uuid.Parse(chi.URLParam(r, "fileId"))
+	if err != nil {
+		respondError(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	size, err := parseThumbnailSize(r.URL.Query().Get("size"))
+	if err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, thumbs, size, err := h.service.Thumbnail(r.Context(), fileID, userID, size)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrFileNotFound):
+			respondError(w, "File not found", http.StatusNotFound)
+		case errors.Is(err, ErrThumbnailNotFound):
+			respondError(w, "No thumbnail is available for this file", http.StatusNotFound)
+		case errors.Is(err, group.ErrNotMember):
+			respondError(w, "You are not a member of this group", http.StatusForbidden)
+		default:
+			respondError(w, "Failed to get thumbnail", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer func() { _ = body.Close() }()
+
+	// Files never change, so a thumbnail only changes if it is regenerated
+	etag := fmt.Sprintf(`"%s-%d-%d"`, fileID, size, thumbs.CreatedAt.Unix())
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", thumbs.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, _ = io.Copy(w, body)
+}
+
+// Preview handles GET /files/{fileId}/preview, rendering a text, markdown or
+// source file as a standalone HTML page. Its policy keeps the page from
+// running script or reaching the app's origin, so it can be shown in a
+// frame or opened directly.
+func (h *Handler) Preview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fileID, err := uuid.Parse(chi.URLParam(r, "fileId"))
+	if err != nil {
+		respondError(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	preview, err := h.service.Preview(r.Context(), fileID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrFileNotFound):
+			respondError(w, "File not found", http.StatusNotFound)
+		case errors.Is(err, ErrPreviewUnsupported):
+			respondError(w, "This file cannot be previewed", http.StatusUnsupportedMediaType)
+		case errors.Is(err, group.ErrNotMember):
+			respondError(w, "You are not a member of this group", http.StatusForbidden)
+		default:
+			respondError(w, "Failed to preview file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", PreviewPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("X-Preview-Truncated", strconv.FormatBool(preview.Truncated))
+	_, _ = w.Write(preview.HTML)
+}
+
+// Rename handles renaming a file
+func (h *Handler) Rename(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fileID, err := uuid.Parse(chi.URLParam(r, "fileId"))
+	if err != nil {
+		respondError(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var input RenameFileInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	f, err := h.service.Rename(r.Context(), fileID, userID, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNameRequired), errors.Is(err, ErrNameTooLong):
+			respondError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrFileNotFound):
+			respondError(w, "File not found", http.StatusNotFound)
+		case errors.Is(err, group.ErrNotMember):
+			respondError(w, "You are not a member of this group", http.StatusForbidden)
+		default:
+			respondError(w, "Failed to rename file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toFileResponse(f))
+}
+
+// UpdateTags handles PUT /files/{fileId}/tags, which replaces a file's tags
+func (h *Handler) UpdateTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fileID, err := uuid.Parse(chi.URLParam(r, "fileId"))
+	if err != nil {
+		respondError(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var req TagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	f, err := h.service.UpdateTags(r.Context(), fileID, userID, req.Tags)
+	if err != nil {
+		respondMetadataError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toFileResponse(f))
+}
+
+// UpdateMetadata handles PATCH /files/{fileId}/metadata. The body is a JSON
+// merge patch: null removes a key and other values set it.
+func (h *Handler) UpdateMetadata(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fileID, err := uuid.Parse(chi.URLParam(r, "fileId"))
+	if err != nil {
+		respondError(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var patch Metadata
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	f, err := h.service.UpdateMetadata(r.Context(), fileID, userID, patch)
+	if err != nil {
+		respondMetadataError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toFileResponse(f))
+}
+
+// GetMetadataSchema handles GET /groups/{groupId}/metadata-schema
+func (h *Handler) GetMetadataSchema(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupId"))
+	if err != nil {
+		respondError(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	fields, err := h.service.GetMetadataSchema(r.Context(), groupID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, group.ErrNotMember):
+			respondError(w, "You are not a member of this group", http.StatusForbidden)
+		default:
+			respondError(w, "Failed to get metadata schema", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, SchemaResponse{Fields: fields})
+}
+
+// SetMetadataSchema handles PUT /groups/{groupId}/metadata-schema, which
+// replaces the group's metadata fields
+func (h *Handler) SetMetadataSchema(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupId"))
+	if err != nil {
+		respondError(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	var input SetSchemaInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	fields, err := h.service.SetMetadataSchema(r.Context(), groupID, userID, &input)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidSchema):
+			respondError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, group.ErrNotMember):
+			respondError(w, "You are not a member of this group", http.StatusForbidden)
+		case errors.Is(err, group.ErrNotAdmin):
+			respondError(w, "Only admins can change the metadata schema", http.StatusForbidden)
+		default:
+			respondError(w, "Failed to set metadata schema", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if fields == nil {
+		fields = []*MetadataField{}
+	}
+	respondJSON(w, http.StatusOK, SchemaResponse{Fields: fields})
+}
+
+// Share handles creating a temporary download link for a file
+func (h *Handler) Share(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fileID, err := uuid.Parse(chi.URLParam(r, "fileId"))
+	if err != nil {
+		respondError(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	url, err := h.service.GetDownloadURL(r.Context(), fileID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrFileNotFound):
+			respondError(w, "File not found", http.StatusNotFound)
+		case errors.Is(err, group.ErrNotMember):
+			respondError(w, "You are not a member of this group", http.StatusForbidden)
+		default:
+			respondError(w, "Failed to share file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, ShareResponse{URL: url})
+}
+
 // Delete handles file deletion
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	userID, ok := auth.GetUserID(r.Context())
@@ -216,8 +620,414 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// Delta handles GET /groups/{groupId}/delta, which starts a delta sync with
+// a listing of the group's files
+func (h *Handler) Delta(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupId"))
+	if err != nil {
+		respondError(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	page, err := h.service.ListDelta(r.Context(), groupID, userID, limit)
+	if err != nil {
+		respondDeltaError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toDeltaResponse(page))
+}
+
+// DeltaContinue handles GET /groups/{groupId}/delta/continue, which returns
+// the changes after a cursor
+func (h *Handler) DeltaContinue(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupId"))
+	if err != nil {
+		respondError(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	if cursor == "" {
+		respondError(w, "Cursor is required", http.StatusBadRequest)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	page, err := h.service.ContinueDelta(r.Context(), groupID, userID, cursor, limit)
+	if err != nil {
+		respondDeltaError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toDeltaResponse(page))
+}
+
+// DeltaLatestCursor handles GET /groups/{groupId}/delta/latest_cursor, which
+// returns a cursor that only follows changes made from now on
+func (h *Handler) DeltaLatestCursor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupId"))
+	if err != nil {
+		respondError(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := h.service.LatestCursor(r.Context(), groupID, userID)
+	if err != nil {
+		respondDeltaError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, CursorResponse{Cursor: cursor})
+}
+
+// Longpoll handles POST /delta/longpoll. It blocks until any of the cursors'
+// groups has changes or the timeout passes; clients then call continue for
+// the groups reported.
+func (h *Handler) Longpoll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req LongpollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Cursors) == 0 || len(req.Cursors) > MaxLongpollCursors {
+		respondError(w, fmt.Sprintf("Between 1 and %d cursors are required", MaxLongpollCursors), http.StatusBadRequest)
+		return
+	}
+
+	timeout := min(DefaultLongpollTimeout, h.longpollMax)
+	if req.Timeout > 0 {
+		timeout = min(time.Duration(req.Timeout)*time.Second, h.longpollMax)
+	}
+
+	// The wait outlasts the server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 10*time.Second))
+
+	groups, err := h.service.Longpoll(r.Context(), userID, req.Cursors, timeout)
+	if err != nil {
+		respondDeltaError(w, err)
+		return
+	}
+
+	response := LongpollResponse{Changes: len(groups) > 0, Groups: make([]string, len(groups))}
+	for i, id := range groups {
+		response.Groups[i] = id.String()
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// Search handles GET /search, which finds files by name across the
+// caller's groups
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	opts, message := parseSearchOptions(r)
+	if message != "" {
+		respondError(w, message, http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.service.Search(r.Context(), userID, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrQueryRequired), errors.Is(err, ErrQueryTooLong):
+			respondError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidDateRange):
+			respondError(w, "created_before must be after created_after", http.StatusBadRequest)
+		default:
+			respondError(w, "Failed to search files", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := SearchResponse{Results: make([]SearchResultResponse, len(page.Results)), HasMore: page.HasMore}
+	for i, result := range page.Results {
+		response.Results[i] = SearchResultResponse{
+			File:           toFileResponse(result.File),
+			Highlight:      result.Highlight,
+			Rank:           result.Rank,
+			MatchedContent: result.MatchedContent,
+		}
+	}
+	respondJSON(w, http.StatusOK, response)
+}
+
+// Reindex handles POST /groups/{groupId}/reindex, which queues the group's
+// files for content indexing
+func (h *Handler) Reindex(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupId"))
+	if err != nil {
+		respondError(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	queued, err := h.service.ReindexGroup(r.Context(), groupID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, group.ErrNotMember):
+			respondError(w, "You are not a member of this group", http.StatusForbidden)
+		case errors.Is(err, group.ErrNotAdmin):
+			respondError(w, "Only admins can reindex a group", http.StatusForbidden)
+		default:
+			respondError(w, "Failed to reindex group", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, ReindexResponse{Queued: queued})
+}
+
 // Helper functions
 
+// parseSearchOptions reads a search's query, filters and paging from the
+// query string. It returns a message for the client if any are invalid.
+func parseSearchOptions(r *http.Request) (*SearchOptions, string) {
+	q := r.URL.Query()
+	opts := &SearchOptions{Query: q.Get("q"), ContentType: q.Get("content_type")}
+	for _, p := range []struct {
+		name string
+		dest *int
+	}{{"limit", &opts.Limit}, {"offset", &opts.Offset}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, "Invalid " + p.name
+			}
+			*p.dest = n
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dest *uuid.UUID
+	}{{"group_id", &opts.GroupID}, {"uploaded_by", &opts.UploadedBy}} {
+		if v := q.Get(p.name); v != "" {
+			id, err := uuid.Parse(v)
+			if err != nil {
+				return nil, "Invalid " + p.name
+			}
+			*p.dest = id
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dest *time.Time
+	}{{"created_after", &opts.CreatedAfter}, {"created_before", &opts.CreatedBefore}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, "Invalid " + p.name
+			}
+			*p.dest = t
+		}
+	}
+	return opts, ""
+}
+
+// parseListOptions reads a file listing's paging, sorting and filters from
+// the query string. It returns a message for the client if any are invalid.
+func parseListOptions(r *http.Request) (*ListOptions, string) {
+	q := r.URL.Query()
+	limit, err := pagination.Limit(q.Get("limit"))
+	if err != nil {
+		return nil, "Invalid limit"
+	}
+	opts := &ListOptions{
+		Limit:       limit,
+		PageToken:   q.Get("page_token"),
+		Sort:        q.Get("sort"),
+		Order:       q.Get("order"),
+		ContentType: q.Get("content_type"),
+	}
+	if v := q.Get("uploaded_by"); v != "" {
+		if opts.UploadedBy, err = uuid.Parse(v); err != nil {
+			return nil, "Invalid uploaded_by"
+		}
+	}
+	for _, v := range q["tag"] {
+		opts.Tags = append(opts.Tags, splitTags(v)...)
+	}
+	// Metadata filters are deep object parameters: metadata[key]=value
+	for name, values := range q {
+		key, ok := strings.CutPrefix(name, "metadata[")
+		if !ok {
+			continue
+		}
+		key, ok = strings.CutSuffix(key, "]")
+		if !ok || len(values) != 1 {
+			return nil, "Invalid " + name
+		}
+		if opts.Metadata == nil {
+			opts.Metadata = make(map[string]string)
+		}
+		opts.Metadata[key] = values[0]
+	}
+	for _, p := range []struct {
+		name string
+		dest **int64
+	}{{"min_size", &opts.MinSize}, {"max_size", &opts.MaxSize}} {
+		if v := q.Get(p.name); v != "" {
+			size, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || size < 0 {
+				return nil, "Invalid " + p.name
+			}
+			*p.dest = &size
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dest *time.Time
+	}{{"created_after", &opts.CreatedAfter}, {"created_before", &opts.CreatedBefore}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, "Invalid " + p.name
+			}
+			*p.dest = t
+		}
+	}
+	return opts, ""
+}
+
+// parseThumbnailSize parses a thumbnail size name or pixel count
+func parseThumbnailSize(s string) (int, error) {
+	switch s {
+	case "", "medium":
+		return ThumbnailMedium, nil
+	case "small":
+		return ThumbnailSmall, nil
+	case "large":
+		return ThumbnailLarge, nil
+	}
+	size, err := strconv.Atoi(s)
+	if err != nil || size < 1 || size > 4096 {
+		return 0, ErrInvalidThumbnailSize
+	}
+	return size, nil
+}
+
+// splitTags splits a comma-separated list of tags, dropping empty entries
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func respondMetadataError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidTag), errors.Is(err, ErrTooManyTags),
+		errors.Is(err, ErrInvalidMetadata), errors.Is(err, ErrMetadataRequired):
+		respondError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrFileNotFound):
+		respondError(w, "File not found", http.StatusNotFound)
+	case errors.Is(err, group.ErrNotMember):
+		respondError(w, "You are not a member of this group", http.StatusForbidden)
+	default:
+		respondError(w, "Failed to update file", http.StatusInternalServerError)
+	}
+}
+
+func respondDeltaError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, group.ErrNotMember):
+		respondError(w, "You are not a member of this group", http.StatusForbidden)
+	case errors.Is(err, ErrInvalidCursor):
+		respondError(w, "Invalid cursor", http.StatusBadRequest)
+	case errors.Is(err, ErrCursorReset):
+		respondError(w, err.Error(), http.StatusGone)
+	default:
+		respondError(w, "Failed to list changes", http.StatusInternalServerError)
+	}
+}
+
+func toDeltaResponse(page *DeltaPage) DeltaResponse {
+	response := DeltaResponse{
+		Entries: make([]DeltaEntryResponse, len(page.Entries)),
+		Cursor:  page.Cursor,
+		HasMore: page.HasMore,
+	}
+	for i, e := range page.Entries {
+		entry := DeltaEntryResponse{Tag: e.Tag, ID: e.File.ID.String(), Name: e.File.Name}
+		if e.Tag != TagDeleted {
+			entry.SizeBytes = &e.File.SizeBytes
+			entry.ContentType = e.File.ContentType
+			entry.UploadedBy = formatUserID(e.File.UploadedBy)
+			entry.CreatedAt = e.File.CreatedAt.Format("2006-01-02T15:04:05Z")
+		}
+		response.Entries[i] = entry
+	}
+	return response
+}
+
+func toFileResponse(f *File) FileResponse {
+	tags := f.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	metadata := f.Metadata
+	if metadata == nil {
+		metadata = Metadata{}
+	}
+	return FileResponse{
+		ID:          f.ID.String(),
+		Name:        f.Name,
+		SizeBytes:   f.SizeBytes,
+		ContentType: f.ContentType,
+		GroupID:     f.GroupID.String(),
+		UploadedBy:  formatUserID(f.UploadedBy),
+		CreatedAt:   f.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		Tags:        tags,
+		Metadata:    metadata,
+	}
+}
+
+// formatUserID renders a user reference that may have been nulled when the
+// user's account was deleted
+func formatUserID(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
+
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
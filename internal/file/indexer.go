@@ -0,0 +1,126 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/queue"
+)
+
+// IndexerConfig controls content indexing
+type IndexerConfig struct {
+	BatchSize    int           // Files claimed and indexed concurrently per poll
+	PollInterval time.Duration // Wait between polls when no files are due
+	MaxAttempts  int           // Attempts before a file is left unindexed
+	MaxFileSize  int64         // Documents parsed as a whole, such as docx, are skipped above this size
+	MaxTextSize  int           // Bytes of extracted text kept per file
+}
+
+// IndexJob is a file waiting to have its content indexed
+type IndexJob struct {
+	FileID   uuid.UUID
+	Attempts int // Including the current one
+}
+
+// Indexer extracts text from files' contents in the background so search
+// can match it. Any number of indexers, in one or many replicas, may drain
+// the same queue.
+type Indexer struct {
+	repo    Repository
+	storage Storage
+	cfg     IndexerConfig
+}
+
+// NewIndexer creates a new Indexer
+func NewIndexer(repo Repository, storage Storage, cfg IndexerConfig) *Indexer {
+	return &Indexer{repo: repo, storage: storage, cfg: cfg}
+}
+
+// Run indexes queued files until ctx is cancelled
+func (ix *Indexer) Run(ctx context.Context) {
+	runner := &queue.Runner[*IndexJob]{
+		Name:         "index jobs",
+		BatchSize:    ix.cfg.BatchSize,
+		PollInterval: ix.cfg.PollInterval,
+		Lease:        10 * time.Minute,
+		Claim:        ix.repo.ClaimIndexJobs,
+		Handle:       ix.index,
+	}
+	runner.Run(ctx)
+}
+
+// ReindexGroup queues every file in a group for content indexing (requires
+// admin permission) and returns how many were queued
+func (s *Service) ReindexGroup(ctx context.Context, groupID, userID uuid.UUID) (int64, error) {
+	membership, err := s.groupService.GetMembership(ctx, groupID, userID)
+	if err != nil {
+		return 0, err
+	}
+	if membership.Role != group.RoleAdmin {
+		return 0, group.ErrNotAdmin
+	}
+	return s.repo.ReindexGroup(ctx, groupID)
+}
+
+// index extracts and stores one file's text, scheduling a retry on failure
+func (ix *Indexer) index(ctx context.Context, job *IndexJob) {
+	text, err := ix.extract(ctx, job)
+	if errors.Is(err, ErrFileNotFound) {
+		return // Deleted along with its job
+	}
+	if err != nil && ctx.Err() != nil {
+		return // Shutting down; the lease expires and another indexer retries
+	}
+	if err != nil && job.Attempts < ix.cfg.MaxAttempts {
+		retryAt := time.Now().Add(retryBackoff(job.Attempts))
+		if err := ix.repo.RecordIndexFailure(context.WithoutCancel(ctx), job, err.Error(), retryAt); err != nil {
+			log.Printf("Failed to record index failure for file %s: %v", job.FileID, err)
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Giving up indexing file %s after %d attempts: %v", job.FileID, job.Attempts, err)
+	}
+
+	if err := ix.repo.SetContentIndex(context.WithoutCancel(ctx), job, text); err != nil {
+		log.Printf("Failed to store content index for file %s: %v", job.FileID, err)
+	}
+}
+
+// extract returns the file's text, which is empty for files that are not
+// documents
+func (ix *Indexer) extract(ctx context.Context, job *IndexJob) (string, error) {
+	file, err := ix.repo.GetByID(ctx, job.FileID)
+	if err != nil {
+		return "", err
+	}
+	kind := documentKind(file.Name, file.ContentType)
+	if kind == kindNone || file.SizeBytes == 0 {
+		return "", nil
+	}
+
+	body, err := ix.storage.Download(ctx, file.S3Key)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = body.Close() }()
+
+	text, err := extractText(kind, body, file.SizeBytes, ix.cfg.MaxFileSize, ix.cfg.MaxTextSize)
+	if err != nil {
+		return "", err
+	}
+	// Postgres text cannot hold NUL characters
+	return strings.ReplaceAll(text, "\x00", ""), nil
+}
+
+// retryBackoff returns the delay before retrying a background job on a
+// file, such as indexing or thumbnailing, after the given number of failed
+// attempts: a minute, doubling up to an hour
+func retryBackoff(attempts int) time.Duration {
+	return queue.Backoff(attempts, time.Minute, time.Hour)
+}
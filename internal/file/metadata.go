@@ -0,0 +1,337 @@
+package file
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/events"
+	"github.com/testifysec/dropbox-clone/internal/group"
+)
+
+// Tag and metadata limits
+const (
+	MaxTags                = 50
+	MaxTagLength           = 64   // Characters
+	MaxMetadataKeys        = 50   // Per file
+	MaxMetadataValueLength = 1024 // Characters in a string value
+	MaxSchemaFields        = 50
+	maxDescriptionLength   = 500
+)
+
+// Metadata field types
+const (
+	FieldString  = "string"
+	FieldNumber  = "number"
+	FieldBoolean = "boolean"
+	FieldDate    = "date" // A string in YYYY-MM-DD form
+)
+
+// metadataKeyPattern matches metadata keys, which are used as-is in query
+// parameters such as metadata[project]
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,63}$`)
+
+// Metadata is a file's custom key-value metadata. Values are strings,
+// numbers (float64) or booleans.
+type Metadata map[string]interface{}
+
+// Scan implements sql.Scanner for the JSONB metadata column
+func (m *Metadata) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*m = Metadata{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Metadata", src)
+	}
+	*m = Metadata{}
+	return json.Unmarshal(data, m)
+}
+
+// Value implements driver.Valuer, encoding the metadata as JSON text
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// MetadataField is a field in a group's metadata schema. Files may also
+// carry keys the schema does not define.
+type MetadataField struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required"`
+	Description string `json:"description,omitempty"`
+}
+
+// SetSchemaInput represents the input for replacing a group's metadata
+// schema
+type SetSchemaInput struct {
+	Fields []*MetadataField `json:"fields"`
+}
+
+// Validate validates the schema
+func (s *SetSchemaInput) Validate() error {
+	if len(s.Fields) > MaxSchemaFields {
+		return fmt.Errorf("%w: at most %d fields are allowed", ErrInvalidSchema, MaxSchemaFields)
+	}
+	seen := make(map[string]bool)
+	for _, f := range s.Fields {
+		if f == nil || !metadataKeyPattern.MatchString(f.Key) {
+			return fmt.Errorf("%w: keys must start with a letter and hold at most 64 letters, digits, '_', '-' or '.'", ErrInvalidSchema)
+		}
+		if seen[f.Key] {
+			return fmt.Errorf("%w: %q is defined twice", ErrInvalidSchema, f.Key)
+		}
+		seen[f.Key] = true
+		switch f.Type {
+		case FieldString, FieldNumber, FieldBoolean, FieldDate:
+		default:
+			return fmt.Errorf("%w: %q has unknown type %q", ErrInvalidSchema, f.Key, f.Type)
+		}
+		if utf8.RuneCountInString(f.Description) > maxDescriptionLength {
+			return fmt.Errorf("%w: descriptions must be at most %d characters", ErrInvalidSchema, maxDescriptionLength)
+		}
+	}
+	return nil
+}
+
+// UpdateTags replaces a file's tags (requires group membership)
+func (s *Service) UpdateTags(ctx context.Context, fileID, userID uuid.UUID, tags []string) (*File, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.GetByID(ctx, fileID, userID); err != nil {
+		return nil, err
+	}
+
+	file, err := s.repo.UpdateTags(ctx, fileID, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordMetadataChange(ctx, file, userID)
+	return file, nil
+}
+
+// UpdateMetadata applies a merge patch to a file's metadata (requires group
+// membership): keys set to nil are removed and the rest are set. Values are
+// checked against the group's schema, and required fields cannot be
+// removed. Files uploaded before a field became required keep working until
+// someone sets it.
+func (s *Service) UpdateMetadata(ctx context.Context, fileID, userID uuid.UUID, patch Metadata) (*File, error) {
+	file, err := s.GetByID(ctx, fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := s.repo.GetMetadataSchema(ctx, file.GroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := Metadata{}
+	var remove []string
+	for key, value := range patch {
+		if value == nil {
+			if f := findField(schema, key); f != nil && f.Required {
+				return nil, fmt.Errorf("%w: %q is required", ErrMetadataRequired, key)
+			}
+			remove = append(remove, key)
+			continue
+		}
+		set[key] = value
+	}
+	if err := checkMetadata(set, schema, false); err != nil {
+		return nil, err
+	}
+
+	// Bound the merged result; the merge itself happens in one statement
+	count := len(set)
+	for key := range file.Metadata {
+		if _, ok := patch[key]; !ok {
+			count++
+		}
+	}
+	if count > MaxMetadataKeys {
+		return nil, fmt.Errorf("%w: a file may have at most %d keys", ErrInvalidMetadata, MaxMetadataKeys)
+	}
+
+	file, err = s.repo.UpdateMetadata(ctx, fileID, set, remove)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordMetadataChange(ctx, file, userID)
+	return file, nil
+}
+
+// GetMetadataSchema returns a group's metadata schema (requires group
+// membership)
+func (s *Service) GetMetadataSchema(ctx context.Context, groupID, userID uuid.UUID) ([]*MetadataField, error) {
+	isMember, err := s.groupService.IsMember(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, group.ErrNotMember
+	}
+	return s.repo.GetMetadataSchema(ctx, groupID)
+}
+
+// SetMetadataSchema replaces a group's metadata schema (requires admin
+// permission). Existing files are not checked against it; new uploads and
+// metadata changes are.
+func (s *Service) SetMetadataSchema(ctx context.Context, groupID, userID uuid.UUID, input *SetSchemaInput) ([]*MetadataField, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	membership, err := s.groupService.GetMembership(ctx, groupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if membership.Role != group.RoleAdmin {
+		return nil, group.ErrNotAdmin
+	}
+
+	if err := s.repo.SetMetadataSchema(ctx, groupID, input.Fields); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, &audit.Event{
+		ActorID:    userID,
+		Action:     audit.ActionMetadataSchemaChanged,
+		GroupID:    groupID,
+		TargetType: audit.TargetGroup,
+		TargetID:   groupID.String(),
+		Metadata:   map[string]string{"fields": fmt.Sprint(len(input.Fields))},
+	})
+
+	return input.Fields, nil
+}
+
+// recordMetadataChange audits and announces a change to a file's tags or
+// metadata
+func (s *Service) recordMetadataChange(ctx context.Context, file *File, userID uuid.UUID) {
+	s.record(ctx, audit.ActionFileMetadataChanged, file, userID)
+	s.publish(ctx, events.TypeFileMetadataChanged, file, userID, nil)
+}
+
+// Helper functions
+
+// normalizeTags trims and lower-cases tags, drops duplicates and sorts them
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > MaxTagLength || strings.Contains(tag, ",") ||
+			strings.IndexFunc(tag, unicode.IsControl) >= 0 {
+			return nil, ErrInvalidTag
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > MaxTags {
+		return nil, ErrTooManyTags
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// checkMetadata validates metadata against a group's schema. Keys the
+// schema does not define may hold any string, number or boolean. With
+// requireAll, every required field must be present.
+func checkMetadata(m Metadata, schema []*MetadataField, requireAll bool) error {
+	if len(m) > MaxMetadataKeys {
+		return fmt.Errorf("%w: a file may have at most %d keys", ErrInvalidMetadata, MaxMetadataKeys)
+	}
+	for key, value := range m {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: keys must start with a letter and hold at most 64 letters, digits, '_', '-' or '.'", ErrInvalidMetadata)
+		}
+		kind := valueType(value)
+		if kind == "" {
+			return fmt.Errorf("%w: %q must be a string, number or boolean", ErrInvalidMetadata, key)
+		}
+		if s, ok := value.(string); ok && utf8.RuneCountInString(s) > MaxMetadataValueLength {
+			return fmt.Errorf("%w: %q must be at most %d characters", ErrInvalidMetadata, key, MaxMetadataValueLength)
+		}
+		f := findField(schema, key)
+		if f == nil {
+			continue
+		}
+		if f.Type == FieldDate {
+			if s, ok := value.(string); !ok || !isDate(s) {
+				return fmt.Errorf("%w: %q must be a date in YYYY-MM-DD form", ErrInvalidMetadata, key)
+			}
+		} else if kind != f.Type {
+			return fmt.Errorf("%w: %q must be a %s", ErrInvalidMetadata, key, f.Type)
+		}
+	}
+	if requireAll {
+		for _, f := range schema {
+			if _, ok := m[f.Key]; f.Required && !ok {
+				return fmt.Errorf("%w: %q is required", ErrMetadataRequired, f.Key)
+			}
+		}
+	}
+	return nil
+}
+
+// valueType returns the field type of a decoded JSON value, or "" if it
+// cannot be stored as metadata
+func valueType(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return FieldString
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return ""
+		}
+		return FieldNumber
+	case bool:
+		return FieldBoolean
+	}
+	return ""
+}
+
+func isDate(s string) bool {
+	_, err := time.Parse(time.DateOnly, s)
+	return err == nil
+}
+
+func findField(schema []*MetadataField, key string) *MetadataField {
+	for _, f := range schema {
+		if f.Key == key {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got, err := normalizeTags([]string{" Release ", "q3", "release", "Q3", "draft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"draft", "q3", "release"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeTags() = %q, want %q", got, want)
+	}
+	if got, _ := normalizeTags(nil); got == nil || len(got) != 0 {
+		t.Errorf("normalizeTags(nil) = %#v, want empty", got)
+	}
+
+	for _, tag := range []string{"", "  ", "a,b", "tab\there", strings.Repeat("x", MaxTagLength+1)} {
+		if _, err := normalizeTags([]string{tag}); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("normalizeTags(%q) error = %v, want ErrInvalidTag", tag, err)
+		}
+	}
+	many := make([]string, MaxTags+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("tag%d", i)
+	}
+	if _, err := normalizeTags(many); !errors.Is(err, ErrTooManyTags) {
+		t.Errorf("normalizeTags() error = %v, want ErrTooManyTags", err)
+	}
+}
+
+func TestCheckMetadata(t *testing.T) {
+	schema := []*MetadataField{
+		{Key: "project", Type: FieldString, Required: true},
+		{Key: "build", Type: FieldNumber},
+		{Key: "approved", Type: FieldBoolean},
+		{Key: "release_date", Type: FieldDate},
+	}
+	tests := []struct {
+		name       string
+		metadata   Metadata
+		requireAll bool
+		wantErr    error
+	}{
+		{"valid", Metadata{"project": "apollo", "build": 42.0, "approved": true, "release_date": "2026-03-01", "owner": "ops"}, true, nil},
+		{"missing required", Metadata{"build": 1.0}, true, ErrMetadataRequired},
+		{"missing required in patch", Metadata{"build": 1.0}, false, nil},
+		{"wrong type", Metadata{"project": "apollo", "build": "42"}, true, ErrInvalidMetadata},
+		{"bad date", Metadata{"project": "apollo", "release_date": "March 1st"}, true, ErrInvalidMetadata},
+		{"nested value", Metadata{"project": "apollo", "owner": map[string]interface{}{"team": "ops"}}, true, ErrInvalidMetadata},
+		{"invalid key", Metadata{"project": "apollo", "bad key": "x"}, true, ErrInvalidMetadata},
+		{"long value", Metadata{"project": strings.Repeat("x", MaxMetadataValueLength+1)}, true, ErrInvalidMetadata},
+	}
+	for _, tt := range tests {
+		err := checkMetadata(tt.metadata, schema, tt.requireAll)
+		if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: checkMetadata() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSetSchemaInputValidate(t *testing.T) {
+	valid := &SetSchemaInput{Fields: []*MetadataField{{Key: "project", Type: FieldString, Required: true}, {Key: "due", Type: FieldDate}}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	for name, input := range map[string]*SetSchemaInput{
+		"duplicate key": {Fields: []*MetadataField{{Key: "a", Type: FieldString}, {Key: "a", Type: FieldNumber}}},
+		"unknown type":  {Fields: []*MetadataField{{Key: "a", Type: "list"}}},
+		"invalid key":   {Fields: []*MetadataField{{Key: "1a", Type: FieldString}}},
+		"missing field": {Fields: []*MetadataField{nil}},
+	} {
+		if err := input.Validate(); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("%s: Validate() error = %v, want ErrInvalidSchema", name, err)
+		}
+	}
+}
+
+func TestMetadataScan(t *testing.T) {
+	var m Metadata
+	if err := m.Scan([]byte(`{"project": "apollo", "build": 7, "approved": false}`)); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Metadata{"project": "apollo", "build": 7.0, "approved": false}); !reflect.DeepEqual(m, want) {
+		t.Errorf("Scan() = %v, want %v", m, want)
+	}
+	if v, err := Metadata(nil).Value(); err != nil || v != "{}" {
+		t.Errorf("Value() = %v, %v, want {}", v, err)
+	}
+}
+
+func TestMetadataMatches(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"acme", []string{`{"client":"acme"}`}},
+		{"42", []string{`{"client":"42"}`, `{"client":42}`}},
+		{"-1.5e3", []string{`{"client":"-1.5e3"}`, `{"client":-1.5e3}`}},
+		{"true", []string{`{"client":"true"}`, `{"client":true}`}},
+		{"TRUE", []string{`{"client":"TRUE"}`}},
+		{"042", []string{`{"client":"042"}`}},
+		{" 42", []string{`{"client":" 42"}`}},
+		{"", []string{`{"client":""}`}},
+	}
+
+	for _, tt := range tests {
+		got := metadataMatches("client", tt.value)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("metadataMatches(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/pagination"
 )
 
 // File represents a file in the system
@@ -16,6 +18,8 @@ type File struct {
 	GroupID     uuid.UUID `json:"group_id" db:"group_id"`
 	UploadedBy  uuid.UUID `json:"uploaded_by" db:"uploaded_by"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	Tags        []string  `json:"tags" db:"tags"`
+	Metadata    Metadata  `json:"metadata" db:"metadata"`
 }
 
 // UploadFileInput represents the input for uploading a file
@@ -25,6 +29,8 @@ type UploadFileInput struct {
 	SizeBytes   int64
 	GroupID     uuid.UUID
 	UploadedBy  uuid.UUID
+	Tags        []string
+	Metadata    Metadata // Checked against the group's schema
 }
 
 // Validate validates the upload file input
@@ -32,6 +38,9 @@ func (u *UploadFileInput) Validate() error {
 	if u.Name == "" {
 		return ErrNameRequired
 	}
+	if len(u.Name) > 255 {
+		return ErrNameTooLong
+	}
 	if u.GroupID == uuid.Nil {
 		return ErrGroupIDRequired
 	}
@@ -40,3 +49,126 @@ func (u *UploadFileInput) Validate() error {
 	}
 	return nil
 }
+
+// Sort orders for file listings
+const (
+	SortName      = "name"
+	SortSize      = "size"
+	SortCreatedAt = "created_at"
+	SortUploader  = "uploader" // By the uploader's ID, which groups each uploader's files
+)
+
+// ListOptions selects a page of a group's files. The zero value selects
+// every file, newest first.
+type ListOptions struct {
+	Limit         int    // Files per page; 0 for no limit
+	PageToken     string // From the previous page
+	Sort          string // One of the Sort constants; SortCreatedAt if empty
+	Order         string // pagination.Asc or pagination.Desc; names ascend and sizes and dates descend if empty
+	ContentType   string // Exact type, or a prefix ending in "/" such as "image/"
+	UploadedBy    uuid.UUID
+	MinSize       *int64
+	MaxSize       *int64
+	CreatedAfter  time.Time         // Inclusive
+	CreatedBefore time.Time         // Exclusive
+	Tags          []string          // Files with every one of these tags
+	Metadata      map[string]string // Files whose metadata values read as these strings
+}
+
+// Validate validates the list options
+func (o *ListOptions) Validate() error {
+	switch o.Sort {
+	case "", SortName, SortSize, SortCreatedAt, SortUploader:
+	default:
+		return pagination.ErrInvalidSort
+	}
+	if _, err := pagination.Descending(o.Order, false); err != nil {
+		return err
+	}
+	if o.MinSize != nil && o.MaxSize != nil && *o.MinSize > *o.MaxSize {
+		return ErrInvalidSizeRange
+	}
+	if !o.CreatedAfter.IsZero() && !o.CreatedBefore.IsZero() && !o.CreatedBefore.After(o.CreatedAfter) {
+		return ErrInvalidDateRange
+	}
+	if len(o.Tags) > 0 {
+		tags, err := normalizeTags(o.Tags)
+		if err != nil {
+			return err
+		}
+		o.Tags = tags
+	}
+	for key := range o.Metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return ErrInvalidMetadata
+		}
+	}
+	return nil
+}
+
+// FilePage is a page of a group's files. NextPageToken is empty on the
+// last page.
+type FilePage struct {
+	Files         []*File
+	NextPageToken string
+}
+
+// RenameFileInput represents the input for renaming a file
+type RenameFileInput struct {
+	Name string `json:"name"`
+}
+
+// Validate validates the rename file input
+func (r *RenameFileInput) Validate() error {
+	if r.Name == "" {
+		return ErrNameRequired
+	}
+	if len(r.Name) > 255 {
+		return ErrNameTooLong
+	}
+	return nil
+}
+
+// Journal change kinds
+const (
+	ChangeAdd    = "add"
+	ChangeModify = "modify"
+	ChangeDelete = "delete"
+)
+
+// Change is an entry in a group's file change journal. It snapshots the
+// file's metadata as of the change; delete entries are tombstones.
+type Change struct {
+	GroupID     uuid.UUID `json:"group_id" db:"group_id"`
+	Seq         int64     `json:"seq" db:"seq"` // Increases by one per change in the group
+	FileID      uuid.UUID `json:"file_id" db:"file_id"`
+	Change      string    `json:"change" db:"change"`
+	Name        string    `json:"name" db:"name"`
+	SizeBytes   int64     `json:"size_bytes" db:"size_bytes"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	UploadedBy  uuid.UUID `json:"uploaded_by" db:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ChangedAt   time.Time `json:"changed_at" db:"changed_at"`
+}
+
+// Delta entry tags
+const (
+	TagAdded    = "added"
+	TagModified = "modified"
+	TagDeleted  = "deleted"
+)
+
+// DeltaEntry is a file's state in a delta page. Deleted entries only carry
+// the file's ID and last name.
+type DeltaEntry struct {
+	Tag  string
+	File *File
+}
+
+// DeltaPage is a page of delta sync results. Cursor resumes after the page;
+// HasMore reports that the next page is available immediately.
+type DeltaPage struct {
+	Entries []*DeltaEntry
+	Cursor  string
+	HasMore bool
+}
@@ -0,0 +1,237 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/google/uuid"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// MaxPreviewSize is how much of a file is rendered in a preview (512 KB);
+// the rest is cut off
+const MaxPreviewSize = 512 << 10
+
+// PreviewPolicy is the Content-Security-Policy previews are served with.
+// The sandbox directive gives the document an opaque origin of its own, so
+// even if markup got past sanitizing it could neither run script nor reach
+// the app's origin. Only inline styles load; images and other subresources
+// are blocked so opening a preview cannot be tracked.
+const PreviewPolicy = "default-src 'none'; style-src 'unsafe-inline'; sandbox; base-uri 'none'; form-action 'none'; frame-ancestors 'self'"
+
+// Preview is a file rendered as a standalone HTML document
+type Preview struct {
+	HTML      []byte
+	Truncated bool // Only the first MaxPreviewSize bytes were rendered
+}
+
+// Preview kinds
+const (
+	previewNone = iota
+	previewText
+	previewMarkdown
+	previewCode
+)
+
+// markdown converts GitHub-flavoured markdown. Raw HTML is left out rather
+// than passed through.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// markdownPolicy cleans rendered markdown again, in case the converter lets
+// anything active through
+var markdownPolicy = bluemonday.UGCPolicy().RequireNoReferrerOnLinks(true)
+
+// previewPage wraps a rendered preview. The body is trusted: it is either
+// sanitized markdown or escaped by the highlighter.
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="referrer" content="no-referrer">
+<title>{{.Name}}</title>
+<style>
+body { margin: 0; padding: 1rem 1.5rem; font: 14px/1.5 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1f2328; background: #fff; }
+pre { margin: 0; font: 13px/1.45 ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; white-space: pre-wrap; overflow-wrap: anywhere; }
+article pre { padding: .75rem; background: #f6f8fa; border-radius: 6px; }
+article img { max-width: 100%; }
+article table { border-collapse: collapse; }
+article th, article td { border: 1px solid #d0d7de; padding: .25rem .75rem; }
+.truncated { margin: 0 0 1rem; padding: .5rem .75rem; background: #fff8c5; border: 1px solid #d4a72c; border-radius: 6px; }
+</style>
+</head>
+<body>
+{{if .Truncated}}<p class="truncated">This preview shows the first {{.Shown}} of {{.Size}}. Download the file to see all of it.</p>
+{{end}}{{.Body}}
+</body>
+</html>
+`))
+
+// Preview renders a text, markdown or source file as HTML (requires group
+// membership). Other files yield ErrPreviewUnsupported, as do files that
+// turn out not to be text.
+func (s *Service) Preview(ctx context.Context, fileID, userID uuid.UUID) (*Preview, error) {
+	file, err := s.GetByID(ctx, fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	kind := previewKind(file.Name, file.ContentType)
+	if kind == previewNone {
+		return nil, ErrPreviewUnsupported
+	}
+
+	var data []byte
+	if file.SizeBytes > 0 {
+		body, err := s.storage.Download(ctx, file.S3Key)
+		if err != nil {
+			return nil, ErrDownloadFailed
+		}
+		data, err = io.ReadAll(io.LimitReader(body, MaxPreviewSize+1))
+		_ = body.Close()
+		if err != nil {
+			return nil, ErrDownloadFailed
+		}
+	}
+
+	text, truncated, ok := truncateText(data, MaxPreviewSize)
+	if !ok {
+		return nil, ErrPreviewUnsupported
+	}
+	page, err := renderPreview(file, kind, text, truncated)
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, audit.ActionFileDownloaded, file, userID)
+
+	return &Preview{HTML: page, Truncated: truncated}, nil
+}
+
+// renderPreview renders text as a preview page
+func renderPreview(file *File, kind int, text string, truncated bool) ([]byte, error) {
+	var body bytes.Buffer
+	switch kind {
+	case previewMarkdown:
+		var raw bytes.Buffer
+		if err := markdown.Convert([]byte(text), &raw); err != nil {
+			return nil, err
+		}
+		body.WriteString("<article>")
+		body.Write(markdownPolicy.SanitizeBytes(raw.Bytes()))
+		body.WriteString("</article>")
+	case previewCode:
+		if err := highlightCode(&body, file.Name, file.ContentType, text); err != nil {
+			return nil, err
+		}
+	default:
+		body.WriteString("<pre>")
+		template.HTMLEscape(&body, []byte(text))
+		body.WriteString("</pre>")
+	}
+
+	var page bytes.Buffer
+	err := previewPage.Execute(&page, map[string]interface{}{
+		"Name":      file.Name,
+		"Truncated": truncated,
+		"Shown":     formatSize(int64(len(text))),
+		"Size":      formatSize(file.SizeBytes),
+		"Body":      template.HTML(body.String()),
+	})
+	return page.Bytes(), err
+}
+
+// highlightCode writes source code as syntax-highlighted HTML. The formatter
+// escapes every token and styles them inline, so the page needs no
+// stylesheet.
+func highlightCode(w io.Writer, name, contentType, text string) error {
+	lexer := lexers.Match(name)
+	if lexer == nil {
+		mediaType, _, _ := strings.Cut(contentType, ";")
+		lexer = lexers.MatchMimeType(strings.TrimSpace(mediaType))
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	tokens, err := chroma.Coalesce(lexer).Tokenise(nil, text)
+	if err != nil {
+		return err
+	}
+	formatter := chromahtml.New(chromahtml.WithLineNumbers(true), chromahtml.TabWidth(4))
+	return formatter.Format(w, styles.Get("github"), tokens)
+}
+
+// previewKind returns how a file is previewed
+func previewKind(name, contentType string) int {
+	ext := strings.ToLower(path.Ext(name))
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	switch {
+	case ext == ".md", ext == ".markdown", mediaType == "text/markdown":
+		return previewMarkdown
+	case ext == ".txt", ext == ".text", ext == ".log", ext == ".csv", ext == ".tsv":
+		return previewText
+	}
+	// HTML is shown as source like any other code, never rendered
+	switch documentKind(name, contentType) {
+	case kindText, kindJSON, kindHTML:
+		if ext == "" && mediaType == "text/plain" {
+			return previewText
+		}
+		return previewCode
+	}
+	return previewNone
+}
+
+// truncateText returns the first limit bytes of data as text, cut at the
+// end of a line where there is one, and whether anything was cut. It
+// reports false for data that is not UTF-8 text.
+func truncateText(data []byte, limit int) (string, bool, bool) {
+	truncated := len(data) > limit
+	if truncated {
+		data = data[:limit]
+		if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+			data = data[:i+1]
+		} else if i := lastRuneStart(data); !utf8.FullRune(data[i:]) {
+			data = data[:i]
+		}
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // Byte order mark
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return "", false, false
+	}
+	return string(data), truncated, true
+}
+
+// lastRuneStart returns the index where the last, possibly incomplete,
+// rune in data starts
+func lastRuneStart(data []byte) int {
+	for i := len(data) - 1; i > 0 && i > len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			return i
+		}
+	}
+	return max(len(data)-utf8.UTFMax, 0)
+}
+
+// formatSize formats a byte count for people, such as "512 KB"
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,106 @@
+package file
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreviewKind(t *testing.T) {
+	tests := []struct {
+		name, contentType string
+		want              int
+	}{
+		{"README.md", "application/octet-stream", previewMarkdown},
+		{"notes", "text/markdown; charset=utf-8", previewMarkdown},
+		{"server.log", "", previewText},
+		{"notes", "text/plain", previewText},
+		{"main.go", "", previewCode},
+		{"config.yaml", "application/octet-stream", previewCode},
+		{"data.json", "", previewCode},
+		{"page.html", "text/html", previewCode},
+		{"photo.jpg", "image/jpeg", previewNone},
+		{"report.docx", "", previewNone},
+	}
+	for _, tt := range tests {
+		if got := previewKind(tt.name, tt.contentType); got != tt.want {
+			t.Errorf("previewKind(%q, %q) = %d, want %d", tt.name, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		limit         int
+		want          string
+		wantTruncated bool
+		wantOK        bool
+	}{
+		{"short", "one\ntwo\n", 100, "one\ntwo\n", false, true},
+		{"at a line", "one\ntwo\nthree\n", 10, "one\ntwo\n", true, true},
+		{"within a line", "abcdef", 4, "abcd", true, true},
+		{"within a rune", "aé", 2, "a", true, true},
+		{"byte order mark", "\xef\xbb\xbfhello", 100, "hello", false, true},
+		{"binary", "PK\x03\x04\x00\x00", 100, "", false, false},
+		{"not UTF-8", "caf\xe9", 100, "", false, false},
+	}
+	for _, tt := range tests {
+		got, truncated, ok := truncateText([]byte(tt.data), tt.limit)
+		if got != tt.want || truncated != tt.wantTruncated || ok != tt.wantOK {
+			t.Errorf("%s: truncateText() = %q, %v, %v, want %q, %v, %v", tt.name, got, truncated, ok, tt.want, tt.wantTruncated, tt.wantOK)
+		}
+	}
+}
+
+func TestRenderPreview(t *testing.T) {
+	render := func(name string, kind int, text string, truncated bool) string {
+		t.Helper()
+		page, err := renderPreview(&File{Name: name, SizeBytes: 2 << 20}, kind, text, truncated)
+		if err != nil {
+			t.Fatalf("renderPreview(%q) error = %v", name, err)
+		}
+		return string(page)
+	}
+
+	// Markdown is converted, and nothing active survives
+	page := render("README.md", previewMarkdown, "# Title\n\n"+
+		"<script>alert(1)</script>\n\n"+
+		"<img src=x onerror=alert(1)>\n\n"+
+		"[click](javascript:alert(1)) [site](https://example.com)\n\n"+
+		"| a | b |\n|---|---|\n| 1 | 2 |\n", false)
+	for _, want := range []string{"<h1", "Title</h1>", "<table>", `href="https://example.com"`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("markdown preview is missing %q:\n%s", want, page)
+		}
+	}
+	for _, unwanted := range []string{"<script>alert", "onerror", "javascript:"} {
+		if strings.Contains(page, unwanted) {
+			t.Errorf("markdown preview contains %q:\n%s", unwanted, page)
+		}
+	}
+
+	// Code is highlighted, with markup in it escaped
+	page = render("main.go", previewCode, "package main\n\n// </pre><script>alert(1)</script>\nfunc main() {}\n", false)
+	if strings.Contains(page, "<script>alert") || !strings.Contains(page, "&lt;script&gt;") {
+		t.Errorf("code preview does not escape markup:\n%s", page)
+	}
+	if !strings.Contains(page, `style="`) {
+		t.Errorf("code preview is not highlighted:\n%s", page)
+	}
+
+	// HTML files are shown as source
+	page = render("page.html", previewCode, `<p onclick="alert(1)">hi</p>`, false)
+	if strings.Contains(page, "<p onclick") {
+		t.Errorf("HTML preview renders the file:\n%s", page)
+	}
+
+	// Names are escaped, and cut-off previews say so
+	page = render("<b>notes</b>.txt", previewText, "hello\n", true)
+	if strings.Contains(page, "<b>notes") {
+		t.Errorf("text preview does not escape the name:\n%s", page)
+	}
+	if !strings.Contains(page, "first 6 bytes of 2.0 MB") {
+		t.Errorf("truncated preview has no notice:\n%s", page)
+	}
+}
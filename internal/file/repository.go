@@ -3,17 +3,80 @@ package file
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/testifysec/dropbox-clone/internal/pagination"
 )
 
 // Repository defines the interface for file metadata operations
 type Repository interface {
 	Create(ctx context.Context, file *File) error
 	GetByID(ctx context.Context, id uuid.UUID) (*File, error)
+	UpdateName(ctx context.Context, id uuid.UUID, name string) error
 	Delete(ctx context.Context, id uuid.UUID) error
-	ListByGroupID(ctx context.Context, groupID uuid.UUID) ([]*File, error)
+	// ListByGroupID returns a page of the group's files; nil options list
+	// them all, newest first
+	ListByGroupID(ctx context.Context, groupID uuid.UUID, opts *ListOptions) (*FilePage, error)
+	// Search returns up to opts.Limit+1 files the user can see that match
+	// the query, best match first
+	Search(ctx context.Context, userID uuid.UUID, opts *SearchOptions) ([]*SearchResult, error)
+
+	// CurrentChangeSeq returns the sequence number of the group's latest
+	// journal entry
+	CurrentChangeSeq(ctx context.Context, groupID uuid.UUID) (int64, error)
+	// ListPage returns up to limit of the group's files with IDs greater than
+	// afterID, ordered by ID
+	ListPage(ctx context.Context, groupID, afterID uuid.UUID, limit int) ([]*File, error)
+	// ListChanges returns up to limit journal entries after afterSeq in order
+	ListChanges(ctx context.Context, groupID uuid.UUID, afterSeq int64, limit int) ([]*Change, error)
+
+	// ClaimIndexJobs leases up to limit files that are due for content
+	// indexing, counting the attempt and pushing the next one out by lease
+	// so a crashed indexer's files are retried. Concurrent indexers skip
+	// each other's claims.
+	ClaimIndexJobs(ctx context.Context, limit int, lease time.Duration) ([]*IndexJob, error)
+	// RecordIndexFailure schedules the file's next indexing attempt, unless
+	// the job has been claimed or requeued since
+	RecordIndexFailure(ctx context.Context, job *IndexJob, message string, retryAt time.Time) error
+	// SetContentIndex stores the file's extracted text, or clears it when
+	// text is empty, and removes its job unless the job has been claimed or
+	// requeued since, so a reindex requested meanwhile still runs
+	SetContentIndex(ctx context.Context, job *IndexJob, text string) error
+	// ReindexGroup queues every file in the group for indexing and returns
+	// how many were queued
+	ReindexGroup(ctx context.Context, groupID uuid.UUID) (int64, error)
+
+	// UpdateTags replaces the file's tags
+	UpdateTags(ctx context.Context, id uuid.UUID, tags []string) (*File, error)
+	// UpdateMetadata sets and removes keys of the file's metadata in one
+	// step, leaving other keys alone
+	UpdateMetadata(ctx context.Context, id uuid.UUID, set Metadata, remove []string) (*File, error)
+	// GetMetadataSchema returns the group's metadata fields in order
+	GetMetadataSchema(ctx context.Context, groupID uuid.UUID) ([]*MetadataField, error)
+	// SetMetadataSchema replaces the group's metadata fields
+	SetMetadataSchema(ctx context.Context, groupID uuid.UUID, fields []*MetadataField) error
+
+	// ClaimThumbnailJobs leases up to limit images that are due for
+	// thumbnails, like ClaimIndexJobs
+	ClaimThumbnailJobs(ctx context.Context, limit int, lease time.Duration) ([]*ThumbnailJob, error)
+	// RecordThumbnailFailure schedules the image's next attempt, like
+	// RecordIndexFailure
+	RecordThumbnailFailure(ctx context.Context, job *ThumbnailJob, message string, retryAt time.Time) error
+	// SetThumbnails records the sizes stored for the file, if any, and
+	// removes its job like SetContentIndex. It fails with ErrFileNotFound
+	// once the file is gone.
+	SetThumbnails(ctx context.Context, job *ThumbnailJob, sizes []int, contentType string) error
+	// GetThumbnails returns the file's thumbnails or ErrThumbnailNotFound
+	GetThumbnails(ctx context.Context, fileID uuid.UUID) (*Thumbnails, error)
 }
 
 // PostgresRepository implements Repository using PostgreSQL
@@ -26,62 +89,487 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 	return &PostgresRepository{db: db}
 }
 
-// Create inserts a new file record into the database
+// Create inserts a new file record into the database and journals it
 func (r *PostgresRepository) Create(ctx context.Context, file *File) error {
-	query := `
-		INSERT INTO files (id, name, s3_key, size_bytes, content_type, group_id, uploaded_by, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`
-	_, err := r.db.ExecContext(ctx, query,
-		file.ID, file.Name, file.S3Key, file.SizeBytes, file.ContentType,
-		file.GroupID, file.UploadedBy, file.CreatedAt)
-	return err
+	return r.withChange(ctx, func(tx *sql.Tx) (*Change, error) {
+		query := `
+			INSERT INTO files (id, name, s3_key, size_bytes, content_type, group_id, uploaded_by, created_at, tags, metadata)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`
+		_, err := tx.ExecContext(ctx, query,
+			file.ID, file.Name, file.S3Key, file.SizeBytes, file.ContentType,
+			file.GroupID, file.UploadedBy, file.CreatedAt, tagArray(file.Tags), file.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		// Queue the content for indexing once the upload commits
+		if _, err := tx.ExecContext(ctx, `INSERT INTO file_index_jobs (file_id) VALUES ($1)`, file.ID); err != nil {
+			return nil, err
+		}
+		if isImage(file.Name, file.ContentType) {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO file_thumbnail_jobs (file_id) VALUES ($1)`, file.ID); err != nil {
+				return nil, err
+			}
+		}
+		return newChange(ChangeAdd, file), nil
+	})
 }
 
 // GetByID retrieves a file by ID
 func (r *PostgresRepository) GetByID(ctx context.Context, id uuid.UUID) (*File, error) {
+	query := `SELECT ` + fileColumns + ` FROM files WHERE id = $1`
+	return scanFile(r.db.QueryRowContext(ctx, query, id))
+}
+
+// UpdateName renames a file and journals the change. The storage key is
+// left unchanged.
+func (r *PostgresRepository) UpdateName(ctx context.Context, id uuid.UUID, name string) error {
+	return r.withChange(ctx, func(tx *sql.Tx) (*Change, error) {
+		query := `UPDATE files SET name = $1 WHERE id = $2 RETURNING ` + fileColumns
+		file, err := scanFile(tx.QueryRowContext(ctx, query, name, id))
+		if err != nil {
+			return nil, err
+		}
+		return newChange(ChangeModify, file), nil
+	})
+}
+
+// Delete removes a file record from the database and journals a tombstone
+func (r *PostgresRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return r.withChange(ctx, func(tx *sql.Tx) (*Change, error) {
+		query := `DELETE FROM files WHERE id = $1 RETURNING ` + fileColumns
+		file, err := scanFile(tx.QueryRowContext(ctx, query, id))
+		if err != nil {
+			return nil, err
+		}
+		return newChange(ChangeDelete, file), nil
+	})
+}
+
+// fileSortKeys maps sort orders to the expressions they sort by
+var fileSortKeys = map[string]string{
+	SortName:      "f.name",
+	SortSize:      "f.size_bytes",
+	SortCreatedAt: "f.created_at",
+	SortUploader:  "COALESCE(f.uploaded_by, '00000000-0000-0000-0000-000000000000'::uuid)",
+}
+
+// ListByGroupID retrieves a page of a group's files, filtered and sorted
+// as the options ask. One row beyond the limit is read to tell whether
+// another page follows.
+func (r *PostgresRepository) ListByGroupID(ctx context.Context, groupID uuid.UUID, opts *ListOptions) (*FilePage, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	sort := opts.Sort
+	if sort == "" {
+		sort = SortCreatedAt
+	}
+	keyExpr, ok := fileSortKeys[sort]
+	if !ok {
+		return nil, pagination.ErrInvalidSort
+	}
+	desc, err := pagination.Descending(opts.Order, sort == SortSize || sort == SortCreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{groupID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conds := []string{"f.group_id = $1"}
+	switch {
+	case strings.HasSuffix(opts.ContentType, "/"):
+		conds = append(conds, "f.content_type LIKE "+arg(pagination.EscapeLike(opts.ContentType)+"%"))
+	case opts.ContentType != "":
+		conds = append(conds, "f.content_type = "+arg(opts.ContentType))
+	}
+	if opts.UploadedBy != uuid.Nil {
+		conds = append(conds, "f.uploaded_by = "+arg(opts.UploadedBy))
+	}
+	if opts.MinSize != nil {
+		conds = append(conds, "f.size_bytes >= "+arg(*opts.MinSize))
+	}
+	if opts.MaxSize != nil {
+		conds = append(conds, "f.size_bytes <= "+arg(*opts.MaxSize))
+	}
+	if !opts.CreatedAfter.IsZero() {
+		conds = append(conds, "f.created_at >= "+arg(opts.CreatedAfter))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		conds = append(conds, "f.created_at < "+arg(opts.CreatedBefore))
+	}
+	if len(opts.Tags) > 0 {
+		conds = append(conds, "f.tags @> "+arg(tagArray(opts.Tags)))
+	}
+	for _, key := range slices.Sorted(maps.Keys(opts.Metadata)) {
+		// Containment, unlike ->>, can use the metadata GIN index
+		var matches []string
+		for _, doc := range metadataMatches(key, opts.Metadata[key]) {
+			matches = append(matches, "f.metadata @> "+arg(doc)+"::jsonb")
+		}
+		conds = append(conds, "("+strings.Join(matches, " OR ")+")")
+	}
+	if opts.PageToken != "" {
+		token, err := pagination.Decode(opts.PageToken, sort, desc)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, token.Key, token.ID)
+		conds = append(conds, pagination.After(keyExpr, "f.id", desc, len(args)-1))
+	}
+
+	query := `SELECT f.id, f.name, f.s3_key, f.size_bytes, f.content_type, f.group_id, f.uploaded_by, f.created_at,
+		f.tags, f.metadata, (` +
+		keyExpr + `)::text FROM files f WHERE ` + strings.Join(conds, " AND ") +
+		` ORDER BY ` + pagination.OrderBy(keyExpr, "f.id", desc)
+	if opts.Limit > 0 {
+		query += ` LIMIT ` + arg(opts.Limit+1)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var files []*File
+	var keys []string
+	for rows.Next() {
+		file := &File{}
+		var key string
+		if err := rows.Scan(
+			&file.ID, &file.Name, &file.S3Key, &file.SizeBytes, &file.ContentType,
+			&file.GroupID, &file.UploadedBy, &file.CreatedAt, pq.Array(&file.Tags), &file.Metadata, &key); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := &FilePage{Files: files}
+	if opts.Limit > 0 && len(files) > opts.Limit {
+		page.Files = files[:opts.Limit]
+		last := opts.Limit - 1
+		page.NextPageToken = (&pagination.Token{Sort: sort, Desc: desc, Key: keys[last], ID: files[last].ID}).Encode()
+	}
+	return page, nil
+}
+
+// Search finds files by name and content across the user's groups.
+// Membership is part of the query, so files in other groups are never read.
+// A name matches when it has a word starting with every term, when it is
+// similar to the query, or when it contains the query; indexed content
+// matches when it has a word starting with every term. Name matches rank
+// above content matches.
+func (r *PostgresRepository) Search(ctx context.Context, userID uuid.UUID, opts *SearchOptions) ([]*SearchResult, error) {
+	terms := searchTerms(opts.Query)
+	args := []interface{}{userID, prefixQuery(terms), strings.Join(terms, " "), "%" + pagination.EscapeLike(opts.Query) + "%"}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	conds := []string{"(f.name_tsv @@ to_tsquery('simple', $2) OR f.content_tsv @@ to_tsquery('simple', $2) OR $3 <% f.name OR f.name ILIKE $4)"}
+	if opts.GroupID != uuid.Nil {
+		conds = append(conds, "f.group_id = "+arg(opts.GroupID))
+	}
+	switch {
+	case strings.HasSuffix(opts.ContentType, "/"):
+		conds = append(conds, "f.content_type LIKE "+arg(pagination.EscapeLike(opts.ContentType)+"%"))
+	case opts.ContentType != "":
+		conds = append(conds, "f.content_type = "+arg(opts.ContentType))
+	}
+	if opts.UploadedBy != uuid.Nil {
+		conds = append(conds, "f.uploaded_by = "+arg(opts.UploadedBy))
+	}
+	if !opts.CreatedAfter.IsZero() {
+		conds = append(conds, "f.created_at >= "+arg(opts.CreatedAfter))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		conds = append(conds, "f.created_at < "+arg(opts.CreatedBefore))
+	}
+
 	query := `
-		SELECT id, name, s3_key, size_bytes, content_type, group_id, uploaded_by, created_at
-		FROM files
-		WHERE id = $1
+		SELECT f.id, f.name, f.s3_key, f.size_bytes, f.content_type, f.group_id, f.uploaded_by, f.created_at,
+			f.tags, f.metadata,
+			ts_rank(f.name_tsv, to_tsquery('simple', $2)) + word_similarity($3, f.name) +
+				COALESCE(ts_rank(f.content_tsv, to_tsquery('simple', $2)), 0) / 2 AS rank,
+			COALESCE(f.content_tsv @@ to_tsquery('simple', $2), false)
+		FROM files f
+		INNER JOIN user_groups ug ON ug.group_id = f.group_id AND ug.user_id = $1
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY rank DESC, f.created_at DESC, f.id
+		LIMIT ` + arg(opts.Limit+1) + ` OFFSET ` + arg(opts.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var results []*SearchResult
+	for rows.Next() {
+		result := &SearchResult{File: &File{}}
+		f := result.File
+		if err := rows.Scan(&f.ID, &f.Name, &f.S3Key, &f.SizeBytes, &f.ContentType,
+			&f.GroupID, &f.UploadedBy, &f.CreatedAt, pq.Array(&f.Tags), &f.Metadata, &result.Rank, &result.MatchedContent); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// CurrentChangeSeq retrieves the group's change counter
+func (r *PostgresRepository) CurrentChangeSeq(ctx context.Context, groupID uuid.UUID) (int64, error) {
+	var seq int64
+	err := r.db.QueryRowContext(ctx, `SELECT change_seq FROM groups WHERE id = $1`, groupID).Scan(&seq)
+	return seq, err
+}
+
+// ListPage retrieves a page of a group's files in ID order
+func (r *PostgresRepository) ListPage(ctx context.Context, groupID, afterID uuid.UUID, limit int) ([]*File, error) {
+	query := `SELECT ` + fileColumns + ` FROM files WHERE group_id = $1 AND id > $2 ORDER BY id LIMIT $3`
+	rows, err := r.db.QueryContext(ctx, query, groupID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var files []*File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// ListChanges retrieves journal entries after a sequence number
+func (r *PostgresRepository) ListChanges(ctx context.Context, groupID uuid.UUID, afterSeq int64, limit int) ([]*Change, error) {
+	query := `
+		SELECT seq, file_id, change, name, size_bytes, content_type, uploaded_by, created_at, changed_at
+		FROM file_changes
+		WHERE group_id = $1 AND seq > $2
+		ORDER BY seq
+		LIMIT $3
 	`
-	file := &File{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&file.ID, &file.Name, &file.S3Key, &file.SizeBytes, &file.ContentType,
-		&file.GroupID, &file.UploadedBy, &file.CreatedAt)
+	rows, err := r.db.QueryContext(ctx, query, groupID, afterSeq, limit)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrFileNotFound
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var changes []*Change
+	for rows.Next() {
+		c := &Change{GroupID: groupID}
+		var createdAt sql.NullTime
+		if err := rows.Scan(&c.Seq, &c.FileID, &c.Change, &c.Name, &c.SizeBytes, &c.ContentType, &c.UploadedBy,
+			&createdAt, &c.ChangedAt); err != nil {
+			return nil, err
 		}
+		c.CreatedAt = createdAt.Time
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// ClaimIndexJobs leases due index jobs using FOR UPDATE SKIP LOCKED
+func (r *PostgresRepository) ClaimIndexJobs(ctx context.Context, limit int, lease time.Duration) ([]*IndexJob, error) {
+	query := `
+		UPDATE file_index_jobs
+		SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE file_id IN (
+			SELECT file_id FROM file_index_jobs
+			WHERE next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING file_id, attempts
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
 		return nil, err
 	}
-	return file, nil
+	defer func() { _ = rows.Close() }()
+
+	var jobs []*IndexJob
+	for rows.Next() {
+		job := &IndexJob{}
+		if err := rows.Scan(&job.FileID, &job.Attempts); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
 }
 
-// Delete removes a file record from the database
-func (r *PostgresRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM files WHERE id = $1`
-	result, err := r.db.ExecContext(ctx, query, id)
+// RecordIndexFailure stores the error and when to try again. Claims count
+// attempts, so a changed count means the job was claimed or requeued since.
+func (r *PostgresRepository) RecordIndexFailure(ctx context.Context, job *IndexJob, message string, retryAt time.Time) error {
+	query := `UPDATE file_index_jobs SET last_error = $3, next_attempt_at = $4 WHERE file_id = $1 AND attempts = $2`
+	_, err := r.db.ExecContext(ctx, query, job.FileID, job.Attempts, message, retryAt)
+	return err
+}
+
+// SetContentIndex stores the text as a tsvector and finishes the file's job
+// if it still holds the claim
+func (r *PostgresRepository) SetContentIndex(ctx context.Context, job *IndexJob, text string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+	defer func() { _ = tx.Rollback() }()
+
+	query := `UPDATE files SET content_tsv = CASE WHEN $2 = '' THEN NULL ELSE to_tsvector('simple', $2) END WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, query, job.FileID, text); err != nil {
+		return err
+	}
+	query = `DELETE FROM file_index_jobs WHERE file_id = $1 AND attempts = $2`
+	if _, err := tx.ExecContext(ctx, query, job.FileID, job.Attempts); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReindexGroup queues the group's files, restarting any pending jobs
+func (r *PostgresRepository) ReindexGroup(ctx context.Context, groupID uuid.UUID) (int64, error) {
+	query := `
+		INSERT INTO file_index_jobs (file_id)
+		SELECT id FROM files WHERE group_id = $1
+		ON CONFLICT (file_id) DO UPDATE SET attempts = 0, next_attempt_at = NOW(), last_error = NULL
+	`
+	result, err := r.db.ExecContext(ctx, query, groupID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ClaimThumbnailJobs leases due thumbnail jobs using FOR UPDATE SKIP LOCKED
+func (r *PostgresRepository) ClaimThumbnailJobs(ctx context.Context, limit int, lease time.Duration) ([]*ThumbnailJob, error) {
+	query := `
+		UPDATE file_thumbnail_jobs
+		SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE file_id IN (
+			SELECT file_id FROM file_thumbnail_jobs
+			WHERE next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING file_id, attempts
+	`
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var jobs []*ThumbnailJob
+	for rows.Next() {
+		job := &ThumbnailJob{}
+		if err := rows.Scan(&job.FileID, &job.Attempts); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// RecordThumbnailFailure stores the error and when to try again, like
+// RecordIndexFailure
+func (r *PostgresRepository) RecordThumbnailFailure(ctx context.Context, job *ThumbnailJob, message string, retryAt time.Time) error {
+	query := `UPDATE file_thumbnail_jobs SET last_error = $3, next_attempt_at = $4 WHERE file_id = $1 AND attempts = $2`
+	_, err := r.db.ExecContext(ctx, query, job.FileID, job.Attempts, message, retryAt)
+	return err
+}
+
+// SetThumbnails stores the file's thumbnail sizes and finishes its job. The
+// file's row is locked first so a concurrent delete either happens before,
+// and is reported, or removes the thumbnails row with the file.
+func (r *PostgresRepository) SetThumbnails(ctx context.Context, job *ThumbnailJob, sizes []int, contentType string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
+	defer func() { _ = tx.Rollback() }()
+
+	var id uuid.UUID
+	err = tx.QueryRowContext(ctx, `SELECT id FROM files WHERE id = $1 FOR SHARE`, job.FileID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
 		return ErrFileNotFound
 	}
-	return nil
+	if err != nil {
+		return err
+	}
+	if len(sizes) > 0 {
+		query := `
+			INSERT INTO file_thumbnails (file_id, sizes, content_type, created_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (file_id) DO UPDATE SET sizes = EXCLUDED.sizes, content_type = EXCLUDED.content_type, created_at = EXCLUDED.created_at
+		`
+		if _, err := tx.ExecContext(ctx, query, job.FileID, pq.Array(sizes), contentType); err != nil {
+			return err
+		}
+	}
+	query := `DELETE FROM file_thumbnail_jobs WHERE file_id = $1 AND attempts = $2`
+	if _, err := tx.ExecContext(ctx, query, job.FileID, job.Attempts); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// ListByGroupID retrieves all files in a group
-func (r *PostgresRepository) ListByGroupID(ctx context.Context, groupID uuid.UUID) ([]*File, error) {
+// GetThumbnails retrieves the file's thumbnail sizes
+func (r *PostgresRepository) GetThumbnails(ctx context.Context, fileID uuid.UUID) (*Thumbnails, error) {
+	query := `SELECT file_id, sizes, content_type, created_at FROM file_thumbnails WHERE file_id = $1`
+	thumbs := &Thumbnails{}
+	var sizes pq.Int64Array
+	err := r.db.QueryRowContext(ctx, query, fileID).Scan(&thumbs.FileID, &sizes, &thumbs.ContentType, &thumbs.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrThumbnailNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, size := range sizes {
+		thumbs.Sizes = append(thumbs.Sizes, int(size))
+	}
+	if len(thumbs.Sizes) == 0 {
+		return nil, ErrThumbnailNotFound
+	}
+	return thumbs, nil
+}
+
+// UpdateTags stores the file's tags. Tags are not journaled, as delta
+// entries do not carry them.
+func (r *PostgresRepository) UpdateTags(ctx context.Context, id uuid.UUID, tags []string) (*File, error) {
+	query := `UPDATE files SET tags = $2 WHERE id = $1 RETURNING ` + fileColumns
+	return scanFile(r.db.QueryRowContext(ctx, query, id, tagArray(tags)))
+}
+
+// UpdateMetadata merges the keys to set into the file's metadata and drops
+// the keys to remove, so concurrent edits to different keys both apply
+func (r *PostgresRepository) UpdateMetadata(ctx context.Context, id uuid.UUID, set Metadata, remove []string) (*File, error) {
+	query := `UPDATE files SET metadata = (metadata || $2::jsonb) - $3::text[] WHERE id = $1 RETURNING ` + fileColumns
+	return scanFile(r.db.QueryRowContext(ctx, query, id, set, tagArray(remove)))
+}
+
+// GetMetadataSchema retrieves the group's metadata fields
+func (r *PostgresRepository) GetMetadataSchema(ctx context.Context, groupID uuid.UUID) ([]*MetadataField, error) {
 	query := `
-		SELECT id, name, s3_key, size_bytes, content_type, group_id, uploaded_by, created_at
-		FROM files
+		SELECT key, type, required, description
+		FROM group_metadata_fields
 		WHERE group_id = $1
-		ORDER BY created_at DESC
+		ORDER BY position
 	`
 	rows, err := r.db.QueryContext(ctx, query, groupID)
 	if err != nil {
@@ -89,15 +577,146 @@ func (r *PostgresRepository) ListByGroupID(ctx context.Context, groupID uuid.UUI
 	}
 	defer func() { _ = rows.Close() }()
 
-	var files []*File
+	fields := []*MetadataField{}
 	for rows.Next() {
-		file := &File{}
-		if err := rows.Scan(
-			&file.ID, &file.Name, &file.S3Key, &file.SizeBytes, &file.ContentType,
-			&file.GroupID, &file.UploadedBy, &file.CreatedAt); err != nil {
+		f := &MetadataField{}
+		if err := rows.Scan(&f.Key, &f.Type, &f.Required, &f.Description); err != nil {
 			return nil, err
 		}
-		files = append(files, file)
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+// SetMetadataSchema replaces the group's metadata fields in one transaction
+func (r *PostgresRepository) SetMetadataSchema(ctx context.Context, groupID uuid.UUID, fields []*MetadataField) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM group_metadata_fields WHERE group_id = $1`, groupID); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO group_metadata_fields (group_id, key, type, required, description, position)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	for i, f := range fields {
+		if _, err := tx.ExecContext(ctx, query, groupID, f.Key, f.Type, f.Required, f.Description, i); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Helper functions
+
+// tagArray converts tags to a Postgres array, which is empty rather than
+// NULL when there are none
+func tagArray(tags []string) pq.StringArray {
+	if tags == nil {
+		return pq.StringArray{}
+	}
+	return pq.StringArray(tags)
+}
+
+// metadataMatches lists the JSON objects, any of which a file's metadata
+// must contain for the value under key to read as value: the string itself
+// and, where value reads as one, the number or boolean
+func metadataMatches(key, value string) []string {
+	candidates := []interface{}{value}
+	switch {
+	case value == "true" || value == "false":
+		candidates = append(candidates, value == "true")
+	case value != "" && value == strings.TrimSpace(value):
+		candidates = append(candidates, json.Number(value))
+	}
+
+	var docs []string
+	for _, v := range candidates {
+		// json.Number fails to marshal unless it is a valid number
+		if doc, err := json.Marshal(map[string]interface{}{key: v}); err == nil {
+			docs = append(docs, string(doc))
+		}
+	}
+	return docs
+}
+
+const fileColumns = `id, name, s3_key, size_bytes, content_type, group_id, uploaded_by, created_at, tags, metadata`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFile(row scanner) (*File, error) {
+	file := &File{}
+	err := row.Scan(&file.ID, &file.Name, &file.S3Key, &file.SizeBytes, &file.ContentType,
+		&file.GroupID, &file.UploadedBy, &file.CreatedAt, pq.Array(&file.Tags), &file.Metadata)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// withChange runs a file mutation and appends the change it returns to the
+// group's journal in the same transaction. Bumping the group's counter locks
+// the group row until commit, so entries become visible in sequence order.
+func (r *PostgresRepository) withChange(ctx context.Context, mutate func(tx *sql.Tx) (*Change, error)) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	change, err := mutate(tx)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE groups SET change_seq = change_seq + 1 WHERE id = $1 RETURNING change_seq`
+	if err := tx.QueryRowContext(ctx, query, change.GroupID).Scan(&change.Seq); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO file_changes (group_id, seq, file_id, change, name, size_bytes, content_type, uploaded_by,
+			created_at, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	var uploadedBy interface{}
+	if change.UploadedBy != uuid.Nil {
+		uploadedBy = change.UploadedBy
+	}
+	_, err = tx.ExecContext(ctx, query, change.GroupID, change.Seq, change.FileID, change.Change, change.Name,
+		change.SizeBytes, change.ContentType, uploadedBy, change.CreatedAt, change.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	// Delivered to long-polling clients on every replica once committed
+	_, err = tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`,
+		ChangeNotifyChannel, formatChangeNotification(change.GroupID, change.Seq))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func newChange(kind string, file *File) *Change {
+	return &Change{
+		GroupID:     file.GroupID,
+		FileID:      file.ID,
+		Change:      kind,
+		Name:        file.Name,
+		SizeBytes:   file.SizeBytes,
+		ContentType: file.ContentType,
+		UploadedBy:  file.UploadedBy,
+		CreatedAt:   file.CreatedAt,
+		ChangedAt:   time.Now(),
 	}
-	return files, rows.Err()
 }
@@ -0,0 +1,158 @@
+package file
+
+import (
+	"context"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Search limits
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+	MaxSearchLength    = 200 // Characters in a query
+	maxSearchTerms     = 16
+)
+
+// SearchOptions describes a search across the groups a user belongs to
+type SearchOptions struct {
+	Query         string
+	GroupID       uuid.UUID // Only this group
+	ContentType   string    // Exact type, or a prefix ending in "/" such as "image/"
+	UploadedBy    uuid.UUID
+	CreatedAfter  time.Time // Inclusive
+	CreatedBefore time.Time // Exclusive
+	Limit         int
+	Offset        int
+}
+
+// Validate validates the search options
+func (o *SearchOptions) Validate() error {
+	o.Query = strings.TrimSpace(o.Query)
+	if len(searchTerms(o.Query)) == 0 {
+		return ErrQueryRequired
+	}
+	if len([]rune(o.Query)) > MaxSearchLength {
+		return ErrQueryTooLong
+	}
+	if !o.CreatedAfter.IsZero() && !o.CreatedBefore.IsZero() && !o.CreatedBefore.After(o.CreatedAfter) {
+		return ErrInvalidDateRange
+	}
+	return nil
+}
+
+// SearchResult is a file matching a search. Highlight is the file's name as
+// HTML, with the matched words wrapped in <mark>.
+type SearchResult struct {
+	File           *File
+	Rank           float64
+	Highlight      string
+	MatchedContent bool // The file's indexed content matched
+}
+
+// SearchPage is a page of search results, best match first
+type SearchPage struct {
+	Results []*SearchResult
+	HasMore bool
+}
+
+// Search finds files by name and content in the groups the user belongs
+// to. Words in the query match words in the name or content by prefix, and
+// names that are close to the query match too, so typos are forgiven.
+func (s *Service) Search(ctx context.Context, userID uuid.UUID, opts *SearchOptions) (*SearchPage, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Limit <= 0 || opts.Limit > MaxSearchLimit {
+		opts.Limit = DefaultSearchLimit
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+
+	results, err := s.repo.Search(ctx, userID, opts)
+	if err != nil {
+		return nil, err
+	}
+	page := &SearchPage{Results: results}
+	if len(results) > opts.Limit {
+		page.Results, page.HasMore = results[:opts.Limit], true
+	}
+	terms := searchTerms(opts.Query)
+	for _, r := range page.Results {
+		r.Highlight = highlight(r.File.Name, terms)
+	}
+	return page, nil
+}
+
+// searchTerms splits a query into lower-case words of letters and digits,
+// the same way names are split when they are indexed
+func searchTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), isSeparator) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// prefixQuery builds a tsquery matching names containing a word starting
+// with each term. Terms only hold letters and digits, so they need no
+// quoting.
+func prefixQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = t + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// highlight escapes name as HTML and marks where the terms occur in it
+func highlight(name string, terms []string) string {
+	runes := []rune(name)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	marked := make([]bool, len(runes))
+	for _, term := range terms {
+		t := []rune(term)
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) == term {
+				for j := i; j < i+len(t); j++ {
+					marked[j] = true
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		j := i
+		for j < len(runes) && marked[j] == marked[i] {
+			j++
+		}
+		text := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			text = "<mark>" + text + "</mark>"
+		}
+		b.WriteString(text)
+		i = j
+	}
+	return b.String()
+}
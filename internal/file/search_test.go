@@ -0,0 +1,52 @@
+package file
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	got := searchTerms("  Q3-Report_final.PDF report  ")
+	want := []string{"q3", "report", "final", "pdf"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("searchTerms() = %q, want %q", got, want)
+	}
+	if q := prefixQuery(want); q != "q3:* & report:* & final:* & pdf:*" {
+		t.Errorf("prefixQuery() = %q", q)
+	}
+
+	// Punctuation alone is not a query, and tsquery syntax cannot get through
+	if terms := searchTerms("&|!():*'"); len(terms) != 0 {
+		t.Errorf("searchTerms() = %q, want none", terms)
+	}
+	opts := &SearchOptions{Query: " *** "}
+	if err := opts.Validate(); !errors.Is(err, ErrQueryRequired) {
+		t.Errorf("Validate() error = %v, want ErrQueryRequired", err)
+	}
+	opts = &SearchOptions{Query: strings.Repeat("a", MaxSearchLength+1)}
+	if err := opts.Validate(); !errors.Is(err, ErrQueryTooLong) {
+		t.Errorf("Validate() error = %v, want ErrQueryTooLong", err)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		terms []string
+		want  string
+	}{
+		{"Quarterly Report.pdf", []string{"report"}, "Quarterly <mark>Report</mark>.pdf"},
+		{"report-reporting.txt", []string{"report"}, "<mark>report</mark>-<mark>report</mark>ing.txt"},
+		{"budget.xlsx", []string{"bud", "get"}, "<mark>budget</mark>.xlsx"},
+		{"<script>.html", []string{"script"}, "&lt;<mark>script</mark>&gt;.html"},
+		{"Ärger.txt", []string{"är"}, "<mark>Är</mark>ger.txt"},
+		{"notes.md", []string{"x"}, "notes.md"},
+	}
+	for _, tt := range tests {
+		if got := highlight(tt.name, tt.terms); got != tt.want {
+			t.Errorf("highlight(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
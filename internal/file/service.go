@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/events"
 	"github.com/testifysec/dropbox-clone/internal/group"
 )
 
@@ -18,14 +21,20 @@ type Service struct {
 	repo         Repository
 	storage      Storage
 	groupService *group.Service
+	audit        audit.Recorder
+	events       events.Publisher
+	watcher      *Watcher
 }
 
 // NewService creates a new file service
-func NewService(repo Repository, storage Storage, groupService *group.Service) *Service {
+func NewService(repo Repository, storage Storage, groupService *group.Service, recorder audit.Recorder, publisher events.Publisher, watcher *Watcher) *Service {
 	return &Service{
 		repo:         repo,
 		storage:      storage,
 		groupService: groupService,
+		audit:        recorder,
+		events:       publisher,
+		watcher:      watcher,
 	}
 }
 
@@ -49,6 +58,23 @@ func (s *Service) Upload(ctx context.Context, input *UploadFileInput, body io.Re
 		return nil, group.ErrNotMember
 	}
 
+	// Check tags and metadata before storing anything
+	tags, err := normalizeTags(input.Tags)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := s.repo.GetMetadataSchema(ctx, input.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	metadata := input.Metadata
+	if metadata == nil {
+		metadata = Metadata{}
+	}
+	if err := checkMetadata(metadata, schema, true); err != nil {
+		return nil, err
+	}
+
 	// Generate S3 key: groups/{group_id}/{file_id}/{filename}
 	fileID := uuid.New()
 	s3Key := fmt.Sprintf("groups/%s/%s/%s", input.GroupID, fileID, input.Name)
@@ -69,6 +95,8 @@ func (s *Service) Upload(ctx context.Context, input *UploadFileInput, body io.Re
 		GroupID:     input.GroupID,
 		UploadedBy:  input.UploadedBy,
 		CreatedAt:   now,
+		Tags:        tags,
+		Metadata:    metadata,
 	}
 
 	if err := s.repo.Create(ctx, file); err != nil {
@@ -77,11 +105,20 @@ func (s *Service) Upload(ctx context.Context, input *UploadFileInput, body io.Re
 		return nil, err
 	}
 
+	s.record(ctx, audit.ActionFileUploaded, file, input.UploadedBy)
+	s.publish(ctx, events.TypeFileCreated, file, input.UploadedBy, nil)
+
 	return file, nil
 }
 
 // Download returns a file's content
 func (s *Service) Download(ctx context.Context, fileID, userID uuid.UUID) (io.ReadCloser, *File, error) {
+	return s.DownloadFrom(ctx, fileID, userID, 0)
+}
+
+// DownloadFrom returns a file's content after the first offset bytes, for
+// serving ranges
+func (s *Service) DownloadFrom(ctx context.Context, fileID, userID uuid.UUID, offset int64) (io.ReadCloser, *File, error) {
 	// Get file metadata
 	file, err := s.repo.GetByID(ctx, fileID)
 	if err != nil {
@@ -97,12 +134,19 @@ func (s *Service) Download(ctx context.Context, fileID, userID uuid.UUID) (io.Re
 		return nil, nil, group.ErrNotMember
 	}
 
+	// Only an empty file may be read from its end
+	if offset < 0 || (offset > 0 && offset >= file.SizeBytes) {
+		return nil, nil, ErrInvalidRange
+	}
+
 	// Download from S3
-	body, err := s.storage.Download(ctx, file.S3Key)
+	body, err := s.storage.DownloadFrom(ctx, file.S3Key, offset)
 	if err != nil {
 		return nil, nil, ErrDownloadFailed
 	}
 
+	s.record(ctx, audit.ActionFileDownloaded, file, userID)
+
 	return body, file, nil
 }
 
@@ -125,8 +169,15 @@ func (s *Service) GetByID(ctx context.Context, fileID, userID uuid.UUID) (*File,
 	return file, nil
 }
 
-// ListByGroupID retrieves all files in a group
-func (s *Service) ListByGroupID(ctx context.Context, groupID, userID uuid.UUID) ([]*File, error) {
+// ListByGroupID retrieves a page of a group's files. Nil options list
+// every file, newest first.
+func (s *Service) ListByGroupID(ctx context.Context, groupID, userID uuid.UUID, opts *ListOptions) (*FilePage, error) {
+	if opts != nil {
+		if err := opts.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Check if user is a member of the group
 	isMember, err := s.groupService.IsMember(ctx, groupID, userID)
 	if err != nil {
@@ -136,7 +187,7 @@ func (s *Service) ListByGroupID(ctx context.Context, groupID, userID uuid.UUID)
 		return nil, group.ErrNotMember
 	}
 
-	return s.repo.ListByGroupID(ctx, groupID)
+	return s.repo.ListByGroupID(ctx, groupID, opts)
 }
 
 // Delete removes a file from storage and database
@@ -163,10 +214,69 @@ func (s *Service) Delete(ctx context.Context, fileID, userID uuid.UUID) error {
 
 	// Delete from S3 (best effort)
 	_ = s.storage.Delete(ctx, file.S3Key)
+	s.deleteThumbnails(ctx, file)
+
+	s.record(ctx, audit.ActionFileDeleted, file, userID)
+	s.publish(ctx, events.TypeFileDeleted, file, userID, nil)
 
 	return nil
 }
 
+// Rename changes a file's display name (requires group membership)
+func (s *Service) Rename(ctx context.Context, fileID, userID uuid.UUID, input *RenameFileInput) (*File, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	file, err := s.GetByID(ctx, fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if file.Name == input.Name {
+		return file, nil
+	}
+
+	if err := s.repo.UpdateName(ctx, fileID, input.Name); err != nil {
+		return nil, err
+	}
+	oldName := file.Name
+	file.Name = input.Name
+
+	s.record(ctx, audit.ActionFileRenamed, file, userID)
+	s.publish(ctx, events.TypeFileRenamed, file, userID, map[string]interface{}{"old_name": oldName})
+
+	return file, nil
+}
+
+// DeleteGroupFiles removes the stored objects and metadata of every file in a
+// group. It does not check permissions; it is used when a group is deleted.
+func (s *Service) DeleteGroupFiles(ctx context.Context, groupID uuid.UUID) error {
+	page, err := s.repo.ListByGroupID(ctx, groupID, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range page.Files {
+		if err := s.repo.Delete(ctx, file.ID); err != nil && err != ErrFileNotFound {
+			return err
+		}
+		// Delete from S3 (best effort)
+		_ = s.storage.Delete(ctx, file.S3Key)
+		s.deleteThumbnails(ctx, file)
+	}
+
+	return nil
+}
+
+// RemoveStored deletes the stored content and thumbnails of files whose
+// records are already gone (best effort)
+func (s *Service) RemoveStored(ctx context.Context, files []*File) {
+	for _, file := range files {
+		_ = s.storage.Delete(ctx, file.S3Key)
+		s.deleteThumbnails(ctx, file)
+	}
+}
+
 // GetDownloadURL returns a presigned URL for downloading a file
 func (s *Service) GetDownloadURL(ctx context.Context, fileID, userID uuid.UUID) (string, error) {
 	file, err := s.GetByID(ctx, fileID, userID)
@@ -174,5 +284,51 @@ func (s *Service) GetDownloadURL(ctx context.Context, fileID, userID uuid.UUID)
 		return "", err
 	}
 
-	return s.storage.GetURL(ctx, file.S3Key)
+	url, err := s.storage.GetURL(ctx, file.S3Key)
+	if err != nil {
+		return "", err
+	}
+
+	s.record(ctx, audit.ActionFileShared, file, userID)
+
+	return url, nil
+}
+
+// publish announces a change to a file, with extra data merged into the
+// file's details
+func (s *Service) publish(ctx context.Context, eventType string, file *File, actorID uuid.UUID, extra map[string]interface{}) {
+	data := map[string]interface{}{
+		"file_id":      file.ID.String(),
+		"name":         file.Name,
+		"size_bytes":   file.SizeBytes,
+		"content_type": file.ContentType,
+		"uploaded_by":  formatUserID(file.UploadedBy),
+		"created_at":   file.CreatedAt.UTC().Format(time.RFC3339),
+		"tags":         file.Tags,
+		"metadata":     file.Metadata,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	s.events.Publish(ctx, &events.Event{
+		Type:    eventType,
+		GroupID: file.GroupID,
+		ActorID: actorID,
+		Data:    data,
+	})
+}
+
+// record writes an audit event for an action on a file
+func (s *Service) record(ctx context.Context, action string, file *File, actorID uuid.UUID) {
+	s.audit.Record(ctx, &audit.Event{
+		ActorID:    actorID,
+		Action:     action,
+		GroupID:    file.GroupID,
+		TargetType: audit.TargetFile,
+		TargetID:   file.ID.String(),
+		Metadata: map[string]string{
+			"name":       file.Name,
+			"size_bytes": strconv.FormatInt(file.SizeBytes, 10),
+		},
+	})
 }
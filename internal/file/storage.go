@@ -16,6 +16,8 @@ import (
 type Storage interface {
 	Upload(ctx context.Context, key string, body io.Reader, contentType string, size int64) error
 	Download(ctx context.Context, key string) (io.ReadCloser, error)
+	// DownloadFrom returns the content after the first offset bytes
+	DownloadFrom(ctx context.Context, key string, offset int64) (io.ReadCloser, error)
 	Delete(ctx context.Context, key string) error
 	GetURL(ctx context.Context, key string) (string, error)
 }
@@ -123,6 +125,23 @@ func (s *S3Storage) Download(ctx context.Context, key string) (io.ReadCloser, er
 	return output.Body, nil
 }
 
+// DownloadFrom downloads the rest of a file from S3, starting at offset
+func (s *S3Storage) DownloadFrom(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	if offset == 0 {
+		// A range starting at 0 is unsatisfiable for empty objects
+		return s.Download(ctx, key)
+	}
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-", offset)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from S3: %w", err)
+	}
+	return output.Body, nil
+}
+
 // Delete deletes a file from S3
 func (s *S3Storage) Delete(ctx context.Context, key string) error {
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
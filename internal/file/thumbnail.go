@@ -0,0 +1,423 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Registers GIF decoding; the first frame is used
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Registers WebP decoding
+
+	"github.com/testifysec/dropbox-clone/internal/queue"
+)
+
+// Thumbnail sizes, in pixels along the longer edge
+const (
+	ThumbnailSmall  = 128
+	ThumbnailMedium = 256
+	ThumbnailLarge  = 1024
+)
+
+// ThumbnailSizes lists the sizes generated for each image, smallest first
+var ThumbnailSizes = []int{ThumbnailSmall, ThumbnailMedium, ThumbnailLarge}
+
+const thumbnailQuality = 80 // JPEG quality of opaque thumbnails
+
+// errNotThumbnailable marks images that will never get thumbnails, so they
+// are not retried
+var errNotThumbnailable = errors.New("image cannot be thumbnailed")
+
+// ThumbnailerConfig controls thumbnail generation
+type ThumbnailerConfig struct {
+	BatchSize    int           // Images claimed and rendered concurrently per poll
+	PollInterval time.Duration // Wait between polls when no images are due
+	MaxAttempts  int           // Attempts before an image is left without thumbnails
+	MaxFileSize  int64         // Larger images get no thumbnails
+	MaxPixels    int64         // Images with more pixels get no thumbnails
+}
+
+// ThumbnailJob is an image waiting to have its thumbnails generated
+type ThumbnailJob struct {
+	FileID   uuid.UUID
+	Attempts int // Including the current one
+}
+
+// Thumbnails describes the thumbnails stored for a file. Every size shares
+// one content type: JPEG for opaque images, PNG otherwise.
+type Thumbnails struct {
+	FileID      uuid.UUID
+	Sizes       []int // Smallest first
+	ContentType string
+	CreatedAt   time.Time
+}
+
+// Thumbnailer renders thumbnails of uploaded images in the background and
+// stores them alongside the originals. Like indexers, any number of
+// thumbnailers may drain the same queue.
+type Thumbnailer struct {
+	repo    Repository
+	storage Storage
+	cfg     ThumbnailerConfig
+}
+
+// NewThumbnailer creates a new Thumbnailer
+func NewThumbnailer(repo Repository, storage Storage, cfg ThumbnailerConfig) *Thumbnailer {
+	return &Thumbnailer{repo: repo, storage: storage, cfg: cfg}
+}
+
+// Run generates thumbnails for queued images until ctx is cancelled
+func (t *Thumbnailer) Run(ctx context.Context) {
+	runner := &queue.Runner[*ThumbnailJob]{
+		Name:         "thumbnail jobs",
+		BatchSize:    t.cfg.BatchSize,
+		PollInterval: t.cfg.PollInterval,
+		Lease:        10 * time.Minute,
+		Claim:        t.repo.ClaimThumbnailJobs,
+		Handle:       t.generate,
+	}
+	runner.Run(ctx)
+}
+
+// Thumbnail returns the thumbnail closest to size, in pixels, for a file
+// (requires group membership): the smallest one at least that large, or
+// the largest there is. Files without thumbnails yield
+// ErrThumbnailNotFound.
+func (s *Service) Thumbnail(ctx context.Context, fileID, userID uuid.UUID, size int) (io.ReadCloser, *Thumbnails, int, error) {
+	file, err := s.GetByID(ctx, fileID, userID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	thumbs, err := s.repo.GetThumbnails(ctx, file.ID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	size = pickThumbnailSize(thumbs.Sizes, size)
+
+	body, err := s.storage.Download(ctx, thumbnailKey(file, size))
+	if err != nil {
+		return nil, nil, 0, ErrDownloadFailed
+	}
+	return body, thumbs, size, nil
+}
+
+// deleteThumbnails removes a deleted image's thumbnails from storage (best
+// effort). Their rows go with the file's.
+func (s *Service) deleteThumbnails(ctx context.Context, file *File) {
+	if !isImage(file.Name, file.ContentType) {
+		return
+	}
+	for _, size := range ThumbnailSizes {
+		_ = s.storage.Delete(ctx, thumbnailKey(file, size))
+	}
+}
+
+// generate renders and stores one image's thumbnails, scheduling a retry
+// on failure
+func (t *Thumbnailer) generate(ctx context.Context, job *ThumbnailJob) {
+	file, sizes, contentType, err := t.render(ctx, job)
+	if errors.Is(err, ErrFileNotFound) {
+		return // Deleted along with its job
+	}
+	if err != nil && ctx.Err() != nil {
+		return // Shutting down; the lease expires and another thumbnailer retries
+	}
+	if err != nil && !errors.Is(err, errNotThumbnailable) && job.Attempts < t.cfg.MaxAttempts {
+		retryAt := time.Now().Add(retryBackoff(job.Attempts))
+		if err := t.repo.RecordThumbnailFailure(context.WithoutCancel(ctx), job, err.Error(), retryAt); err != nil {
+			log.Printf("Failed to record thumbnail failure for file %s: %v", job.FileID, err)
+		}
+		return
+	}
+	if err != nil && !errors.Is(err, errNotThumbnailable) {
+		log.Printf("Giving up on thumbnails for file %s after %d attempts: %v", job.FileID, job.Attempts, err)
+	}
+
+	err = t.repo.SetThumbnails(context.WithoutCancel(ctx), job, sizes, contentType)
+	if errors.Is(err, ErrFileNotFound) && file != nil {
+		// Deleted while rendering, after its thumbnails were cleaned up
+		for _, size := range sizes {
+			_ = t.storage.Delete(context.WithoutCancel(ctx), thumbnailKey(file, size))
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to store thumbnails for file %s: %v", job.FileID, err)
+	}
+}
+
+// render generates and uploads a file's thumbnails, returning the sizes
+// stored and their content type. Files that are not supported images
+// yield errNotThumbnailable.
+func (t *Thumbnailer) render(ctx context.Context, job *ThumbnailJob) (*File, []int, string, error) {
+	file, err := t.repo.GetByID(ctx, job.FileID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if !isImage(file.Name, file.ContentType) || file.SizeBytes == 0 || file.SizeBytes > t.cfg.MaxFileSize {
+		return file, nil, "", errNotThumbnailable
+	}
+
+	body, err := t.storage.Download(ctx, file.S3Key)
+	if err != nil {
+		return file, nil, "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(body, t.cfg.MaxFileSize+1))
+	_ = body.Close()
+	if err != nil {
+		return file, nil, "", err
+	}
+	if int64(len(data)) > t.cfg.MaxFileSize {
+		return file, nil, "", errNotThumbnailable
+	}
+
+	thumbs, err := makeThumbnails(data, t.cfg.MaxPixels)
+	if err != nil {
+		return file, nil, "", err
+	}
+
+	contentType := "image/jpeg"
+	if !thumbs[0].Opaque() {
+		contentType = "image/png"
+	}
+	var sizes []int
+	for i, thumb := range thumbs {
+		var buf bytes.Buffer
+		if contentType == "image/jpeg" {
+			err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailQuality})
+		} else {
+			err = png.Encode(&buf, thumb)
+		}
+		if err != nil {
+			return file, nil, "", err
+		}
+		size := ThumbnailSizes[i]
+		if err := t.storage.Upload(ctx, thumbnailKey(file, size), &buf, contentType, int64(buf.Len())); err != nil {
+			return file, nil, "", err
+		}
+		sizes = append(sizes, size)
+	}
+	return file, sizes, contentType, nil
+}
+
+// makeThumbnails decodes an image and scales it to each of ThumbnailSizes
+// in turn, upright per its EXIF orientation. Images are never enlarged:
+// the list stops at the first size the image fits within, which holds the
+// image at its own size.
+func makeThumbnails(data []byte, maxPixels int64) ([]*image.RGBA, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotThumbnailable, err)
+	}
+	if cfg.Width < 1 || cfg.Height < 1 || int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", errNotThumbnailable, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotThumbnailable, err)
+	}
+	orientation := exifOrientation(data)
+
+	// Scale the largest first and each smaller size from the one before,
+	// which is much cheaper than scaling the original every time
+	var sizes []int
+	for _, size := range ThumbnailSizes {
+		sizes = append(sizes, size)
+		if size >= max(cfg.Width, cfg.Height) {
+			break
+		}
+	}
+	thumbs := make([]*image.RGBA, len(sizes))
+	src := img
+	for i := len(sizes) - 1; i >= 0; i-- {
+		w, h := fitWithin(src.Bounds().Dx(), src.Bounds().Dy(), sizes[i])
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+		thumbs[i] = dst
+		src = dst
+	}
+	// Rotating a thumbnail is cheaper than rotating the original, and fitting
+	// the longer edge does not depend on which way up the image is
+	for i, thumb := range thumbs {
+		thumbs[i] = orient(thumb, orientation)
+	}
+	return thumbs, nil
+}
+
+// fitWithin scales w by h down to fit a size by size square, keeping the
+// aspect ratio and at least one pixel on each side
+func fitWithin(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		return size, max(1, int(int64(h)*int64(size)/int64(w)))
+	}
+	return max(1, int(int64(w)*int64(size)/int64(h))), size
+}
+
+// pickThumbnailSize returns the smallest of sizes at least want, or the
+// largest when none is
+func pickThumbnailSize(sizes []int, want int) int {
+	for _, size := range sizes {
+		if size >= want {
+			return size
+		}
+	}
+	return sizes[len(sizes)-1]
+}
+
+// orient turns an image upright according to an EXIF orientation (1 to 8)
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w // Rotated a quarter turn
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Flip horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotate a half turn
+				sx, sy = w-1-x, h-1-y
+			case 4: // Flip vertically
+				sx, sy = x, h-1-y
+			case 5: // Transpose
+				sx, sy = y, x
+			case 6: // Rotate a quarter turn clockwise
+				sx, sy = y, h-1-x
+			case 7: // Transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // Rotate a quarter turn counterclockwise
+				sx, sy = w-1-y, x
+			}
+			i, j := img.PixOffset(sx, sy), dst.PixOffset(x, y)
+			copy(dst.Pix[j:j+4], img.Pix[i:i+4])
+		}
+	}
+	return dst
+}
+
+// exifOrientation returns the EXIF orientation of a JPEG, PNG or WebP
+// image, or 1 when it has none
+func exifOrientation(data []byte) int {
+	tiff := findEXIF(data)
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int64(order.Uint32(tiff[4:8]))
+	if ifd+2 > int64(len(tiff)) {
+		return 1
+	}
+	count := int64(order.Uint16(tiff[ifd:]))
+	for i := int64(0); i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > int64(len(tiff)) {
+			break
+		}
+		const tagOrientation, typeShort = 0x0112, 3
+		if order.Uint16(tiff[entry:]) == tagOrientation && order.Uint16(tiff[entry+2:]) == typeShort {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// findEXIF returns the TIFF-structured EXIF data embedded in a JPEG (APP1
+// segment), PNG (eXIf chunk) or WebP (EXIF chunk) image, or nil
+func findEXIF(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+			marker := data[i+1]
+			if marker == 0xDA || marker == 0xD9 { // Image data follows
+				return nil
+			}
+			end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+			if end > len(data) {
+				return nil
+			}
+			if segment := data[i+4 : end]; marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+				return segment[6:]
+			}
+			i = end
+		}
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		for i := 8; i+8 <= len(data); {
+			n := int64(binary.BigEndian.Uint32(data[i:]))
+			kind := string(data[i+4 : i+8])
+			end := int64(i) + 8 + n
+			if kind == "IDAT" || end > int64(len(data)) {
+				return nil
+			}
+			if kind == "eXIf" {
+				return data[i+8 : end]
+			}
+			i = int(end) + 4 // CRC
+		}
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		for i := 12; i+8 <= len(data); {
+			n := int64(binary.LittleEndian.Uint32(data[i+4:]))
+			kind := string(data[i : i+4])
+			end := int64(i) + 8 + n
+			if end > int64(len(data)) {
+				return nil
+			}
+			if kind == "EXIF" {
+				return bytes.TrimPrefix(data[i+8:end], []byte("Exif\x00\x00"))
+			}
+			i = int(end + n%2) // Chunks are padded to an even length
+		}
+	}
+	return nil
+}
+
+// isImage reports whether a file is an image thumbnails can be made of
+func isImage(name, contentType string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+		return true
+	}
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	switch strings.TrimSpace(mediaType) {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// thumbnailKey returns the storage key of a file's thumbnail:
+// thumbnails/{group_id}/{file_id}/{size}
+func thumbnailKey(file *File, size int) string {
+	return fmt.Sprintf("thumbnails/%s/%s/%d", file.GroupID, file.ID, size)
+}
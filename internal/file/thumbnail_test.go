@@ -0,0 +1,223 @@
+package file
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+// exifTIFF returns big-endian TIFF data with only an orientation tag
+func exifTIFF(orientation uint16) []byte {
+	var b bytes.Buffer
+	b.WriteString("MM\x00\x2a\x00\x00\x00\x08")            // Header, IFD0 at 8
+	_ = binary.Write(&b, binary.BigEndian, uint16(1))      // One entry
+	_ = binary.Write(&b, binary.BigEndian, uint16(0x0112)) // Orientation
+	_ = binary.Write(&b, binary.BigEndian, uint16(3))      // SHORT
+	_ = binary.Write(&b, binary.BigEndian, uint32(1))      // Count
+	_ = binary.Write(&b, binary.BigEndian, orientation)    // Value, left-justified
+	_ = binary.Write(&b, binary.BigEndian, uint16(0))      // Padding
+	_ = binary.Write(&b, binary.BigEndian, uint32(0))      // No IFD1
+	return b.Bytes()
+}
+
+// withJPEGExif inserts an APP1 EXIF segment after a JPEG's SOI marker
+func withJPEGExif(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var enc bytes.Buffer
+	if err := jpeg.Encode(&enc, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	payload := append([]byte("Exif\x00\x00"), exifTIFF(orientation)...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	data := append([]byte{}, enc.Bytes()[:2]...)
+	data = append(data, segment...)
+	data = append(data, payload...)
+	return append(data, enc.Bytes()[2:]...)
+}
+
+// withPNGExif inserts an eXIf chunk after a PNG's IHDR chunk
+func withPNGExif(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var enc bytes.Buffer
+	if err := png.Encode(&enc, img); err != nil {
+		t.Fatal(err)
+	}
+	tiff := exifTIFF(orientation)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(tiff)))
+	chunk = append(chunk, "eXIf"...)
+	chunk = append(chunk, tiff...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	ihdrEnd := 8 + 8 + 13 + 4
+	data := append([]byte{}, enc.Bytes()[:ihdrEnd]...)
+	data = append(data, chunk...)
+	return append(data, enc.Bytes()[ihdrEnd:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+
+	if got := exifOrientation(withJPEGExif(t, img, 6)); got != 6 {
+		t.Errorf("JPEG orientation = %d, want 6", got)
+	}
+	if got := exifOrientation(withPNGExif(t, img, 3)); got != 3 {
+		t.Errorf("PNG orientation = %d, want 3", got)
+	}
+
+	// WebP EXIF chunks may or may not keep the JPEG-style prefix
+	payload := append([]byte("Exif\x00\x00"), exifTIFF(8)...)
+	webp := []byte("RIFF\x00\x00\x00\x00WEBPVP8X")
+	webp = binary.LittleEndian.AppendUint32(webp, 10)
+	webp = append(webp, make([]byte, 10)...)
+	webp = append(webp, "EXIF"...)
+	webp = binary.LittleEndian.AppendUint32(webp, uint32(len(payload)))
+	webp = append(webp, payload...)
+	if got := exifOrientation(webp); got != 8 {
+		t.Errorf("WebP orientation = %d, want 8", got)
+	}
+
+	// Missing, out of range and truncated data read as upright
+	var plain bytes.Buffer
+	_ = png.Encode(&plain, img)
+	for name, data := range map[string][]byte{
+		"none":      plain.Bytes(),
+		"invalid":   withJPEGExif(t, img, 9),
+		"truncated": withJPEGExif(t, img, 6)[:30],
+		"empty":     nil,
+	} {
+		if got := exifOrientation(data); got != 1 {
+			t.Errorf("%s: orientation = %d, want 1", name, got)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image whose pixels are numbered in reading order:
+	//   0 1 2
+	//   3 4 5
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		img.Set(i%3, i/3, color.RGBA{R: uint8(i), A: 255})
+	}
+	tests := []struct {
+		orientation int
+		want        [][]uint8 // Rows of the upright image
+	}{
+		{1, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{2, [][]uint8{{2, 1, 0}, {5, 4, 3}}},
+		{3, [][]uint8{{5, 4, 3}, {2, 1, 0}}},
+		{4, [][]uint8{{3, 4, 5}, {0, 1, 2}}},
+		{5, [][]uint8{{0, 3}, {1, 4}, {2, 5}}},
+		{6, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{7, [][]uint8{{5, 2}, {4, 1}, {3, 0}}},
+		{8, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+	}
+	for _, tt := range tests {
+		got := orient(img, tt.orientation)
+		if got.Bounds().Dx() != len(tt.want[0]) || got.Bounds().Dy() != len(tt.want) {
+			t.Errorf("orient(%d) size = %v", tt.orientation, got.Bounds().Size())
+			continue
+		}
+		for y, row := range tt.want {
+			for x, want := range row {
+				if r := got.RGBAAt(x, y).R; r != want {
+					t.Errorf("orient(%d) pixel (%d, %d) = %d, want %d", tt.orientation, x, y, r, want)
+				}
+			}
+		}
+	}
+}
+
+func TestMakeThumbnails(t *testing.T) {
+	encode := func(w, h int) []byte {
+		var b bytes.Buffer
+		_ = png.Encode(&b, image.NewGray(image.Rect(0, 0, w, h)))
+		return b.Bytes()
+	}
+	sizes := func(thumbs []*image.RGBA) []image.Point {
+		var got []image.Point
+		for _, thumb := range thumbs {
+			got = append(got, thumb.Bounds().Size())
+		}
+		return got
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want []image.Point
+	}{
+		{"large", encode(2000, 1000), []image.Point{{128, 64}, {256, 128}, {1024, 512}}},
+		// Not enlarged: the last size holds the image as it is
+		{"medium", encode(200, 300), []image.Point{{85, 128}, {170, 256}, {200, 300}}},
+		{"small", encode(40, 30), []image.Point{{40, 30}}},
+		// Sideways photos come out upright
+		{"rotated", withJPEGExif(t, image.NewGray(image.Rect(0, 0, 300, 100)), 6), []image.Point{{42, 128}, {85, 256}, {100, 300}}},
+	}
+	for _, tt := range tests {
+		thumbs, err := makeThumbnails(tt.data, 10_000_000)
+		if err != nil {
+			t.Errorf("%s: makeThumbnails() error = %v", tt.name, err)
+			continue
+		}
+		if got := sizes(thumbs); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: thumbnail sizes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := makeThumbnails(encode(2000, 1000), 1_000_000); !errors.Is(err, errNotThumbnailable) {
+		t.Errorf("makeThumbnails() over the pixel limit error = %v, want errNotThumbnailable", err)
+	}
+	if _, err := makeThumbnails([]byte("not an image"), 1_000_000); !errors.Is(err, errNotThumbnailable) {
+		t.Errorf("makeThumbnails() of text error = %v, want errNotThumbnailable", err)
+	}
+}
+
+func TestPickThumbnailSize(t *testing.T) {
+	sizes := []int{128, 256, 1024}
+	for want, expected := range map[int]int{1: 128, 128: 128, 129: 256, 256: 256, 500: 1024, 4096: 1024} {
+		if got := pickThumbnailSize(sizes, want); got != expected {
+			t.Errorf("pickThumbnailSize(%d) = %d, want %d", want, got, expected)
+		}
+	}
+	if got := pickThumbnailSize([]int{128}, 1024); got != 128 {
+		t.Errorf("pickThumbnailSize() of a small image = %d, want 128", got)
+	}
+
+	for s, want := range map[string]int{"": ThumbnailMedium, "small": ThumbnailSmall, "large": ThumbnailLarge, "300": 300} {
+		if got, err := parseThumbnailSize(s); err != nil || got != want {
+			t.Errorf("parseThumbnailSize(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"huge", "0", "-5", "5000"} {
+		if _, err := parseThumbnailSize(s); !errors.Is(err, ErrInvalidThumbnailSize) {
+			t.Errorf("parseThumbnailSize(%q) error = %v, want ErrInvalidThumbnailSize", s, err)
+		}
+	}
+}
+
+func TestIsImage(t *testing.T) {
+	tests := []struct {
+		name, contentType string
+		want              bool
+	}{
+		{"photo.JPG", "application/octet-stream", true},
+		{"scan", "image/png; charset=binary", true},
+		{"anim.gif", "", true},
+		{"pic.webp", "", true},
+		{"drawing.svg", "image/svg+xml", false},
+		{"photo.heic", "image/heic", false},
+		{"notes.txt", "text/plain", false},
+	}
+	for _, tt := range tests {
+		if got := isImage(tt.name, tt.contentType); got != tt.want {
+			t.Errorf("isImage(%q, %q) = %v, want %v", tt.name, tt.contentType, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package file
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ChangeNotifyChannel is the Postgres channel on which journal appends are
+// announced as "<group ID>:<seq>"
+const ChangeNotifyChannel = "file_changes"
+
+// Watcher wakes long-polling clients when a group's journal advances. It
+// learns about changes committed on any replica through LISTEN/NOTIFY, so
+// waiting clients hold no database connection of their own.
+type Watcher struct {
+	databaseURL string
+
+	mu    sync.Mutex
+	watch map[*Watch]struct{}
+}
+
+// Watch is a registration for changes to a set of groups. C receives a value
+// when any watched group may have advanced past its position.
+type Watch struct {
+	C         <-chan struct{}
+	ch        chan struct{}
+	positions map[uuid.UUID]int64
+	watcher   *Watcher
+}
+
+// NewWatcher creates a new Watcher that listens on the database at
+// databaseURL
+func NewWatcher(databaseURL string) *Watcher {
+	return &Watcher{databaseURL: databaseURL, watch: make(map[*Watch]struct{})}
+}
+
+// Watch registers interest in changes after the given journal positions
+func (w *Watcher) Watch(positions map[uuid.UUID]int64) *Watch {
+	ch := make(chan struct{}, 1)
+	watch := &Watch{C: ch, ch: ch, positions: positions, watcher: w}
+
+	w.mu.Lock()
+	w.watch[watch] = struct{}{}
+	w.mu.Unlock()
+	return watch
+}
+
+// Close unregisters the watch
+func (w *Watch) Close() {
+	w.watcher.mu.Lock()
+	delete(w.watcher.watch, w)
+	w.watcher.mu.Unlock()
+}
+
+func (w *Watch) signal() {
+	select {
+	case w.ch <- struct{}{}:
+	default:
+	}
+}
+
+// Run listens for journal notifications until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	listener := pq.NewListener(w.databaseURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Change listener: %v", err)
+		}
+	})
+	defer func() { _ = listener.Close() }()
+	if err := listener.Listen(ChangeNotifyChannel); err != nil {
+		log.Printf("Failed to listen for file changes: %v", err)
+	}
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			if n == nil {
+				// Reconnected; notifications may have been lost, so every
+				// waiter rechecks
+				w.signalAll()
+				continue
+			}
+			groupID, seq, ok := parseChangeNotification(n.Extra)
+			if !ok {
+				continue
+			}
+			w.signalGroup(groupID, seq)
+		case <-ticker.C:
+			go func() { _ = listener.Ping() }()
+		}
+	}
+}
+
+func (w *Watcher) signalGroup(groupID uuid.UUID, seq int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for watch := range w.watch {
+		if pos, ok := watch.positions[groupID]; ok && seq > pos {
+			watch.signal()
+		}
+	}
+}
+
+func (w *Watcher) signalAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for watch := range w.watch {
+		watch.signal()
+	}
+}
+
+func formatChangeNotification(groupID uuid.UUID, seq int64) string {
+	return groupID.String() + ":" + strconv.FormatInt(seq, 10)
+}
+
+func parseChangeNotification(s string) (uuid.UUID, int64, bool) {
+	id, seqStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return uuid.Nil, 0, false
+	}
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, 0, false
+	}
+	seq, err := strconv.ParseInt(seqStr, 10, 64)
+	if err != nil {
+		return uuid.Nil, 0, false
+	}
+	return groupID, seq, true
+}
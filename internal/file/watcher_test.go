@@ -0,0 +1,49 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestChangeNotificationRoundTrip(t *testing.T) {
+	groupID := uuid.New()
+	gotGroup, gotSeq, ok := parseChangeNotification(formatChangeNotification(groupID, 17))
+	if !ok || gotGroup != groupID || gotSeq != 17 {
+		t.Errorf("parseChangeNotification() = %s, %d, %v", gotGroup, gotSeq, ok)
+	}
+
+	for _, bad := range []string{"", "17", "not-a-uuid:1", groupID.String() + ":x"} {
+		if _, _, ok := parseChangeNotification(bad); ok {
+			t.Errorf("parseChangeNotification(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestWatcherSignalsOnlyAdvancedGroups(t *testing.T) {
+	w := NewWatcher("")
+	watched, other := uuid.New(), uuid.New()
+	watch := w.Watch(map[uuid.UUID]int64{watched: 5})
+	defer watch.Close()
+
+	w.signalGroup(other, 100)
+	w.signalGroup(watched, 5)
+	select {
+	case <-watch.C:
+		t.Fatal("watch signalled for a change it already has")
+	default:
+	}
+
+	w.signalGroup(watched, 6)
+	w.signalGroup(watched, 7) // Coalesced with the pending signal
+	select {
+	case <-watch.C:
+	default:
+		t.Fatal("watch not signalled for a newer change")
+	}
+	select {
+	case <-watch.C:
+		t.Fatal("watch signalled twice")
+	default:
+	}
+}
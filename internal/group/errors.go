@@ -11,4 +11,5 @@ var (
 	ErrAlreadyMember    = errors.New("user is already a member of this group")
 	ErrCannotRemoveSelf = errors.New("cannot remove yourself from the group")
 	ErrNotAdmin         = errors.New("user is not an admin of this group")
+	ErrExternalIDExists = errors.New("external ID already exists")
 )
@@ -8,6 +8,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/pagination"
 )
 
 // Handler handles group-related HTTP requests
@@ -35,7 +36,7 @@ type AddMemberRequest struct {
 type GroupResponse struct {
 	ID        string `json:"id"`
 	Name      string `json:"name"`
-	CreatedBy string `json:"created_by"`
+	CreatedBy string `json:"created_by"` // Empty once the creator's account is deleted
 	CreatedAt string `json:"created_at"`
 }
 
@@ -45,6 +46,7 @@ type MembershipResponse struct {
 	GroupID  string `json:"group_id"`
 	Role     string `json:"role"`
 	JoinedAt string `json:"joined_at"`
+	Email    string `json:"email,omitempty"` // Only set when listing members
 }
 
 // ErrorResponse represents an error response
@@ -81,12 +83,13 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusCreated, GroupResponse{
 		ID:        group.ID.String(),
 		Name:      group.Name,
-		CreatedBy: group.CreatedBy.String(),
+		CreatedBy: formatUserID(group.CreatedBy),
 		CreatedAt: group.CreatedAt.Format("2006-01-02T15:04:05Z"),
 	})
 }
 
-// List handles listing user's groups
+// List handles listing user's groups, a page at a time. The token for the
+// next page is returned in the X-Next-Page-Token header.
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 	userID, ok := auth.GetUserID(r.Context())
 	if !ok {
@@ -94,18 +97,38 @@ func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	groups, err := h.service.ListByUserID(r.Context(), userID)
+	query := r.URL.Query()
+	limit, err := pagination.Limit(query.Get("limit"))
 	if err != nil {
+		respondError(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	opts := &UserGroupsOptions{
+		Limit:     limit,
+		PageToken: query.Get("page_token"),
+		Sort:      query.Get("sort"),
+		Order:     query.Get("order"),
+	}
+
+	page, err := h.service.ListByUserID(r.Context(), userID, opts)
+	if err != nil {
+		if message, ok := pageErrorMessage(err); ok {
+			respondError(w, message, http.StatusBadRequest)
+			return
+		}
 		respondError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	response := make([]GroupResponse, len(groups))
-	for i, group := range groups {
+	if page.NextPageToken != "" {
+		w.Header().Set(pagination.NextPageHeader, page.NextPageToken)
+	}
+	response := make([]GroupResponse, len(page.Groups))
+	for i, group := range page.Groups {
 		response[i] = GroupResponse{
 			ID:        group.ID.String(),
 			Name:      group.Name,
-			CreatedBy: group.CreatedBy.String(),
+			CreatedBy: formatUserID(group.CreatedBy),
 			CreatedAt: group.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		}
 	}
@@ -170,6 +193,69 @@ func (h *Handler) AddMember(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// ListMembers handles listing a group's members, a page at a time. The
+// token for the next page is returned in the X-Next-Page-Token header.
+func (h *Handler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupId"))
+	if err != nil {
+		respondError(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := pagination.Limit(query.Get("limit"))
+	if err != nil {
+		respondError(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	opts := &MembersOptions{
+		Limit:     limit,
+		PageToken: query.Get("page_token"),
+		Sort:      query.Get("sort"),
+		Order:     query.Get("order"),
+		Role:      query.Get("role"),
+	}
+
+	page, err := h.service.ListMembers(r.Context(), groupID, userID, opts)
+	if err != nil {
+		if message, ok := pageErrorMessage(err); ok {
+			respondError(w, message, http.StatusBadRequest)
+			return
+		}
+		switch {
+		case errors.Is(err, ErrNotMember):
+			respondError(w, "You are not a member of this group", http.StatusForbidden)
+		case errors.Is(err, ErrInvalidRole):
+			respondError(w, "Invalid role", http.StatusBadRequest)
+		default:
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if page.NextPageToken != "" {
+		w.Header().Set(pagination.NextPageHeader, page.NextPageToken)
+	}
+	response := make([]MembershipResponse, len(page.Members))
+	for i, m := range page.Members {
+		response[i] = MembershipResponse{
+			UserID:   m.UserID.String(),
+			GroupID:  m.GroupID.String(),
+			Role:     m.Role,
+			JoinedAt: m.JoinedAt.Format("2006-01-02T15:04:05Z"),
+			Email:    m.Email,
+		}
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
 // RemoveMember handles removing a member from a group
 func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 	requestingUserID, ok := auth.GetUserID(r.Context())
@@ -212,6 +298,28 @@ func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 
 // Helper functions
 
+// pageErrorMessage describes invalid paging options to the client
+func pageErrorMessage(err error) (string, bool) {
+	switch {
+	case errors.Is(err, pagination.ErrInvalidToken):
+		return "Invalid page token", true
+	case errors.Is(err, pagination.ErrInvalidSort):
+		return "Invalid sort", true
+	case errors.Is(err, pagination.ErrInvalidOrder):
+		return "Invalid order", true
+	}
+	return "", false
+}
+
+// formatUserID renders a user reference that may have been nulled when the
+// user's account was deleted
+func formatUserID(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
+
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
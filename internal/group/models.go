@@ -4,14 +4,90 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/pagination"
 )
 
 // Group represents a group in the system
 type Group struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	CreatedBy uuid.UUID `json:"created_by" db:"created_by"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID         uuid.UUID `json:"id" db:"id"`
+	Name       string    `json:"name" db:"name"`
+	ExternalID string    `json:"external_id,omitempty" db:"external_id"` // Set by SCIM provisioning
+	CreatedBy  uuid.UUID `json:"created_by" db:"created_by"`             // uuid.Nil for provisioned groups
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// ListOptions controls listing all groups
+type ListOptions struct {
+	Name       string // Exact name match
+	ExternalID string // Exact external ID match
+	Limit      int
+	Offset     int
+}
+
+// Sort orders for group and member listings
+const (
+	SortName      = "name"
+	SortCreatedAt = "created_at"
+	SortJoinedAt  = "joined_at"
+	SortEmail     = "email"
+)
+
+// UserGroupsOptions selects a page of the groups a user belongs to. The
+// zero value selects them all, newest first.
+type UserGroupsOptions struct {
+	Limit     int    // Groups per page; 0 for no limit
+	PageToken string // From the previous page
+	Sort      string // SortName or SortCreatedAt; SortCreatedAt if empty
+	Order     string // pagination.Asc or pagination.Desc; names ascend and dates descend if empty
+}
+
+// Validate validates the list options
+func (o *UserGroupsOptions) Validate() error {
+	switch o.Sort {
+	case "", SortName, SortCreatedAt:
+	default:
+		return pagination.ErrInvalidSort
+	}
+	_, err := pagination.Descending(o.Order, false)
+	return err
+}
+
+// GroupPage is a page of groups. NextPageToken is empty on the last page.
+type GroupPage struct {
+	Groups        []*Group
+	NextPageToken string
+}
+
+// MembersOptions selects a page of a group's members. The zero value
+// selects them all in the order they joined.
+type MembersOptions struct {
+	Limit     int    // Members per page; 0 for no limit
+	PageToken string // From the previous page
+	Sort      string // SortJoinedAt or SortEmail; SortJoinedAt if empty
+	Order     string // pagination.Asc or pagination.Desc; ascending if empty
+	Role      string // Only members with this role
+}
+
+// Validate validates the list options
+func (o *MembersOptions) Validate() error {
+	switch o.Sort {
+	case "", SortJoinedAt, SortEmail:
+	default:
+		return pagination.ErrInvalidSort
+	}
+	if o.Role != "" && o.Role != RoleAdmin && o.Role != RoleMember {
+		return ErrInvalidRole
+	}
+	_, err := pagination.Descending(o.Order, false)
+	return err
+}
+
+// MemberPage is a page of a group's members. NextPageToken is empty on the
+// last page.
+type MemberPage struct {
+	Members       []*Membership
+	NextPageToken string
 }
 
 // Membership represents a user's membership in a group
@@ -20,6 +96,26 @@ type Membership struct {
 	GroupID  uuid.UUID `json:"group_id" db:"group_id"`
 	Role     string    `json:"role" db:"role"`
 	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
+	Email    string    `json:"email,omitempty" db:"email"` // Only set when listing members
+}
+
+// UserMembership represents a group together with a user's role in it
+type UserMembership struct {
+	Group    *Group    `json:"group"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// UserDeletion describes how a user's group memberships are resolved when
+// their account is deleted
+type UserDeletion struct {
+	UserID uuid.UUID
+	// Orphaned lists the groups the user is the only member of, which are
+	// deleted along with their files
+	Orphaned []uuid.UUID
+	// Successors maps each group the user is the only admin of to the
+	// longest-standing remaining member, who becomes its admin
+	Successors map[uuid.UUID]uuid.UUID
 }
 
 // Role constants
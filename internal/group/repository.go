@@ -4,23 +4,35 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/pagination"
 )
 
 // Repository defines the interface for group data operations
 type Repository interface {
 	Create(ctx context.Context, group *Group) error
 	GetByID(ctx context.Context, id uuid.UUID) (*Group, error)
+	Update(ctx context.Context, group *Group) error
 	Delete(ctx context.Context, id uuid.UUID) error
-	ListByUserID(ctx context.Context, userID uuid.UUID) ([]*Group, error)
+	List(ctx context.Context, opts *ListOptions) ([]*Group, int, error)
+	// ListByUserID returns a page of the user's groups; nil options list
+	// them all, newest first
+	ListByUserID(ctx context.Context, userID uuid.UUID, opts *UserGroupsOptions) (*GroupPage, error)
 
 	// Membership operations
 	AddMember(ctx context.Context, membership *Membership) error
 	RemoveMember(ctx context.Context, groupID, userID uuid.UUID) error
 	GetMembership(ctx context.Context, groupID, userID uuid.UUID) (*Membership, error)
-	ListMembers(ctx context.Context, groupID uuid.UUID) ([]*Membership, error)
+	// ListMembers returns a page of the group's members; nil options list
+	// them all in the order they joined
+	ListMembers(ctx context.Context, groupID uuid.UUID, opts *MembersOptions) (*MemberPage, error)
 	GetUserGroupIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	ListUserMemberships(ctx context.Context, userID uuid.UUID) ([]*UserMembership, error)
+	UpdateRole(ctx context.Context, groupID, userID uuid.UUID, role string) error
 }
 
 // PostgresRepository implements Repository using PostgreSQL
@@ -36,24 +48,27 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 // Create inserts a new group into the database
 func (r *PostgresRepository) Create(ctx context.Context, group *Group) error {
 	query := `
-		INSERT INTO groups (id, name, created_by, created_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO groups (id, name, external_id, created_by, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5)
 	`
 	_, err := r.db.ExecContext(ctx, query,
-		group.ID, group.Name, group.CreatedBy, group.CreatedAt)
+		group.ID, group.Name, group.ExternalID, nullUUID(group.CreatedBy), group.CreatedAt)
+	if err != nil && isUniqueViolation(err) {
+		return ErrExternalIDExists
+	}
 	return err
 }
 
 // GetByID retrieves a group by ID
 func (r *PostgresRepository) GetByID(ctx context.Context, id uuid.UUID) (*Group, error) {
 	query := `
-		SELECT id, name, created_by, created_at
+		SELECT id, name, COALESCE(external_id, ''), created_by, created_at
 		FROM groups
 		WHERE id = $1
 	`
 	group := &Group{}
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&group.ID, &group.Name, &group.CreatedBy, &group.CreatedAt)
+		&group.ID, &group.Name, &group.ExternalID, &group.CreatedBy, &group.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrGroupNotFound
@@ -63,6 +78,54 @@ func (r *PostgresRepository) GetByID(ctx context.Context, id uuid.UUID) (*Group,
 	return group, nil
 }
 
+// Update updates a group's name and external ID
+func (r *PostgresRepository) Update(ctx context.Context, group *Group) error {
+	query := `UPDATE groups SET name = $1, external_id = NULLIF($2, '') WHERE id = $3`
+	result, err := r.db.ExecContext(ctx, query, group.Name, group.ExternalID, group.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrExternalIDExists
+		}
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// List retrieves all groups matching the options, oldest first, along with
+// the total number of matches
+func (r *PostgresRepository) List(ctx context.Context, opts *ListOptions) ([]*Group, int, error) {
+	query := `
+		SELECT id, name, COALESCE(external_id, ''), created_by, created_at, COUNT(*) OVER()
+		FROM groups
+		WHERE ($1 = '' OR name = $1) AND ($2 = '' OR external_id = $2)
+		ORDER BY created_at ASC, id
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := r.db.QueryContext(ctx, query, opts.Name, opts.ExternalID, opts.Limit, opts.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var groups []*Group
+	total := 0
+	for rows.Next() {
+		group := &Group{}
+		if err := rows.Scan(&group.ID, &group.Name, &group.ExternalID, &group.CreatedBy, &group.CreatedAt, &total); err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, total, rows.Err()
+}
+
 // Delete removes a group from the database
 func (r *PostgresRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	query := `DELETE FROM groups WHERE id = $1`
@@ -80,30 +143,79 @@ func (r *PostgresRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-// ListByUserID retrieves all groups that a user is a member of
-func (r *PostgresRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*Group, error) {
+// groupSortKeys maps sort orders to the expressions they sort by
+var groupSortKeys = map[string]string{
+	SortName:      "g.name",
+	SortCreatedAt: "g.created_at",
+}
+
+// ListByUserID retrieves a page of the groups a user is a member of
+func (r *PostgresRepository) ListByUserID(ctx context.Context, userID uuid.UUID, opts *UserGroupsOptions) (*GroupPage, error) {
+	if opts == nil {
+		opts = &UserGroupsOptions{}
+	}
+	sort := opts.Sort
+	if sort == "" {
+		sort = SortCreatedAt
+	}
+	keyExpr, ok := groupSortKeys[sort]
+	if !ok {
+		return nil, pagination.ErrInvalidSort
+	}
+	desc, err := pagination.Descending(opts.Order, sort == SortCreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{userID}
+	conds := []string{"ug.user_id = $1"}
+	if opts.PageToken != "" {
+		token, err := pagination.Decode(opts.PageToken, sort, desc)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, token.Key, token.ID)
+		conds = append(conds, pagination.After(keyExpr, "g.id", desc, len(args)-1))
+	}
 	query := `
-		SELECT g.id, g.name, g.created_by, g.created_at
+		SELECT g.id, g.name, COALESCE(g.external_id, ''), g.created_by, g.created_at, (` + keyExpr + `)::text
 		FROM groups g
 		INNER JOIN user_groups ug ON g.id = ug.group_id
-		WHERE ug.user_id = $1
-		ORDER BY g.created_at DESC
-	`
-	rows, err := r.db.QueryContext(ctx, query, userID)
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY ` + pagination.OrderBy(keyExpr, "g.id", desc)
+	if opts.Limit > 0 {
+		args = append(args, opts.Limit+1)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = rows.Close() }()
 
 	var groups []*Group
+	var keys []string
 	for rows.Next() {
 		group := &Group{}
-		if err := rows.Scan(&group.ID, &group.Name, &group.CreatedBy, &group.CreatedAt); err != nil {
+		var key string
+		if err := rows.Scan(&group.ID, &group.Name, &group.ExternalID, &group.CreatedBy, &group.CreatedAt, &key); err != nil {
 			return nil, err
 		}
 		groups = append(groups, group)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	return groups, rows.Err()
+
+	page := &GroupPage{Groups: groups}
+	if opts.Limit > 0 && len(groups) > opts.Limit {
+		page.Groups = groups[:opts.Limit]
+		last := opts.Limit - 1
+		page.NextPageToken = (&pagination.Token{Sort: sort, Desc: desc, Key: keys[last], ID: groups[last].ID}).Encode()
+	}
+	return page, nil
 }
 
 // AddMember adds a user to a group
@@ -160,29 +272,84 @@ func (r *PostgresRepository) GetMembership(ctx context.Context, groupID, userID
 	return membership, nil
 }
 
-// ListMembers retrieves all members of a group
-func (r *PostgresRepository) ListMembers(ctx context.Context, groupID uuid.UUID) ([]*Membership, error) {
+// memberSortKeys maps sort orders to the expressions they sort by
+var memberSortKeys = map[string]string{
+	SortJoinedAt: "ug.joined_at",
+	SortEmail:    "u.email",
+}
+
+// ListMembers retrieves a page of a group's members with their emails
+func (r *PostgresRepository) ListMembers(ctx context.Context, groupID uuid.UUID, opts *MembersOptions) (*MemberPage, error) {
+	if opts == nil {
+		opts = &MembersOptions{}
+	}
+	sort := opts.Sort
+	if sort == "" {
+		sort = SortJoinedAt
+	}
+	keyExpr, ok := memberSortKeys[sort]
+	if !ok {
+		return nil, pagination.ErrInvalidSort
+	}
+	desc, err := pagination.Descending(opts.Order, false)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{groupID}
+	conds := []string{"ug.group_id = $1"}
+	if opts.Role != "" {
+		args = append(args, opts.Role)
+		conds = append(conds, fmt.Sprintf("ug.role = $%d", len(args)))
+	}
+	if opts.PageToken != "" {
+		token, err := pagination.Decode(opts.PageToken, sort, desc)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, token.Key, token.ID)
+		conds = append(conds, pagination.After(keyExpr, "ug.user_id", desc, len(args)-1))
+	}
 	query := `
-		SELECT user_id, group_id, role, joined_at
-		FROM user_groups
-		WHERE group_id = $1
-		ORDER BY joined_at ASC
-	`
-	rows, err := r.db.QueryContext(ctx, query, groupID)
+		SELECT ug.user_id, ug.group_id, ug.role, ug.joined_at, u.email, (` + keyExpr + `)::text
+		FROM user_groups ug
+		INNER JOIN users u ON u.id = ug.user_id
+		WHERE ` + strings.Join(conds, " AND ") + `
+		ORDER BY ` + pagination.OrderBy(keyExpr, "ug.user_id", desc)
+	if opts.Limit > 0 {
+		args = append(args, opts.Limit+1)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = rows.Close() }()
 
 	var members []*Membership
+	var keys []string
 	for rows.Next() {
 		membership := &Membership{}
-		if err := rows.Scan(&membership.UserID, &membership.GroupID, &membership.Role, &membership.JoinedAt); err != nil {
+		var key string
+		if err := rows.Scan(&membership.UserID, &membership.GroupID, &membership.Role, &membership.JoinedAt,
+			&membership.Email, &key); err != nil {
 			return nil, err
 		}
 		members = append(members, membership)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := &MemberPage{Members: members}
+	if opts.Limit > 0 && len(members) > opts.Limit {
+		page.Members = members[:opts.Limit]
+		last := opts.Limit - 1
+		page.NextPageToken = (&pagination.Token{Sort: sort, Desc: desc, Key: keys[last], ID: members[last].UserID}).Encode()
 	}
-	return members, rows.Err()
+	return page, nil
 }
 
 // GetUserGroupIDs retrieves all group IDs that a user is a member of
@@ -205,6 +372,58 @@ func (r *PostgresRepository) GetUserGroupIDs(ctx context.Context, userID uuid.UU
 	return groupIDs, rows.Err()
 }
 
+// ListUserMemberships retrieves every group a user belongs to with their role
+func (r *PostgresRepository) ListUserMemberships(ctx context.Context, userID uuid.UUID) ([]*UserMembership, error) {
+	query := `
+		SELECT g.id, g.name, COALESCE(g.external_id, ''), g.created_by, g.created_at, ug.role, ug.joined_at
+		FROM groups g
+		INNER JOIN user_groups ug ON g.id = ug.group_id
+		WHERE ug.user_id = $1
+		ORDER BY ug.joined_at ASC
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var memberships []*UserMembership
+	for rows.Next() {
+		m := &UserMembership{Group: &Group{}}
+		if err := rows.Scan(&m.Group.ID, &m.Group.Name, &m.Group.ExternalID, &m.Group.CreatedBy, &m.Group.CreatedAt,
+			&m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
+// UpdateRole changes a member's role in a group
+func (r *PostgresRepository) UpdateRole(ctx context.Context, groupID, userID uuid.UUID, role string) error {
+	query := `UPDATE user_groups SET role = $1 WHERE group_id = $2 AND user_id = $3`
+	result, err := r.db.ExecContext(ctx, query, role, groupID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// nullUUID maps uuid.Nil to SQL NULL for nullable foreign keys
+func nullUUID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
 // isUniqueViolation checks if the error is a unique constraint violation
 func isUniqueViolation(err error) bool {
 	return err != nil && (contains(err.Error(), "23505") || contains(err.Error(), "unique"))
@@ -5,16 +5,20 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/events"
 )
 
 // Service provides group-related business logic
 type Service struct {
-	repo Repository
+	repo   Repository
+	audit  audit.Recorder
+	events events.Publisher
 }
 
 // NewService creates a new group service
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo Repository, recorder audit.Recorder, publisher events.Publisher) *Service {
+	return &Service{repo: repo, audit: recorder, events: publisher}
 }
 
 // Create creates a new group and adds the creator as admin
@@ -49,6 +53,22 @@ func (s *Service) Create(ctx context.Context, input *CreateGroupInput, creatorID
 		return nil, err
 	}
 
+	s.audit.Record(ctx, &audit.Event{
+		ActorID:    creatorID,
+		Action:     audit.ActionGroupCreated,
+		GroupID:    group.ID,
+		TargetType: audit.TargetGroup,
+		TargetID:   group.ID.String(),
+		Metadata:   map[string]string{"name": group.Name},
+	})
+	// Lets the creator's open event streams pick up the new group
+	s.events.Publish(ctx, &events.Event{
+		Type:    events.TypeMemberAdded,
+		GroupID: group.ID,
+		ActorID: creatorID,
+		Data:    map[string]interface{}{"user_id": creatorID.String(), "role": RoleAdmin},
+	})
+
 	return group, nil
 }
 
@@ -57,9 +77,15 @@ func (s *Service) GetByID(ctx context.Context, id uuid.UUID) (*Group, error) {
 	return s.repo.GetByID(ctx, id)
 }
 
-// ListByUserID retrieves all groups that a user is a member of
-func (s *Service) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*Group, error) {
-	return s.repo.ListByUserID(ctx, userID)
+// ListByUserID retrieves a page of the groups a user is a member of. Nil
+// options list them all, newest first.
+func (s *Service) ListByUserID(ctx context.Context, userID uuid.UUID, opts *UserGroupsOptions) (*GroupPage, error) {
+	if opts != nil {
+		if err := opts.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return s.repo.ListByUserID(ctx, userID, opts)
 }
 
 // AddMember adds a user to a group (requires admin permission)
@@ -95,6 +121,21 @@ func (s *Service) AddMember(ctx context.Context, groupID uuid.UUID, input *AddMe
 		return nil, err
 	}
 
+	s.audit.Record(ctx, &audit.Event{
+		ActorID:    requestingUserID,
+		Action:     audit.ActionMemberAdded,
+		GroupID:    groupID,
+		TargetType: audit.TargetUser,
+		TargetID:   input.UserID.String(),
+		Metadata:   map[string]string{"role": role},
+	})
+	s.events.Publish(ctx, &events.Event{
+		Type:    events.TypeMemberAdded,
+		GroupID: groupID,
+		ActorID: requestingUserID,
+		Data:    map[string]interface{}{"user_id": input.UserID.String(), "role": role},
+	})
+
 	return newMembership, nil
 }
 
@@ -114,7 +155,25 @@ func (s *Service) RemoveMember(ctx context.Context, groupID, userID, requestingU
 		return ErrCannotRemoveSelf
 	}
 
-	return s.repo.RemoveMember(ctx, groupID, userID)
+	if err := s.repo.RemoveMember(ctx, groupID, userID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, &audit.Event{
+		ActorID:    requestingUserID,
+		Action:     audit.ActionMemberRemoved,
+		GroupID:    groupID,
+		TargetType: audit.TargetUser,
+		TargetID:   userID.String(),
+	})
+	s.events.Publish(ctx, &events.Event{
+		Type:    events.TypeMemberRemoved,
+		GroupID: groupID,
+		ActorID: requestingUserID,
+		Data:    map[string]interface{}{"user_id": userID.String()},
+	})
+
+	return nil
 }
 
 // IsMember checks if a user is a member of a group
@@ -134,9 +193,18 @@ func (s *Service) GetMembership(ctx context.Context, groupID, userID uuid.UUID)
 	return s.repo.GetMembership(ctx, groupID, userID)
 }
 
-// ListMembers retrieves all members of a group
-func (s *Service) ListMembers(ctx context.Context, groupID uuid.UUID) ([]*Membership, error) {
-	return s.repo.ListMembers(ctx, groupID)
+// ListMembers retrieves a page of a group's members (requires membership).
+// Nil options list them all in the order they joined.
+func (s *Service) ListMembers(ctx context.Context, groupID, requestingUserID uuid.UUID, opts *MembersOptions) (*MemberPage, error) {
+	if opts != nil {
+		if err := opts.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.repo.GetMembership(ctx, groupID, requestingUserID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListMembers(ctx, groupID, opts)
 }
 
 // GetUserGroupIDs retrieves all group IDs that a user is a member of
@@ -155,5 +223,107 @@ func (s *Service) Delete(ctx context.Context, groupID, requestingUserID uuid.UUI
 		return ErrNotAdmin
 	}
 
-	return s.repo.Delete(ctx, groupID)
+	return s.delete(ctx, groupID, requestingUserID)
+}
+
+// ListUserMemberships retrieves every group a user belongs to with their role
+func (s *Service) ListUserMemberships(ctx context.Context, userID uuid.UUID) ([]*UserMembership, error) {
+	return s.repo.ListUserMemberships(ctx, userID)
+}
+
+// PlanUserDeletion works out what happens to the user's groups when their
+// account is deleted, without changing anything:
+//
+//   - In groups where the user is the only admin but other members remain,
+//     the longest-standing remaining member is to be promoted to admin.
+//   - Groups where the user is the only member are to be deleted together
+//     with their files.
+//
+// The caller applies the plan in a single transaction and then reports it
+// with RecordUserDeletion. Memberships themselves are removed by the
+// database when the user is deleted.
+func (s *Service) PlanUserDeletion(ctx context.Context, userID uuid.UUID) (*UserDeletion, error) {
+	memberships, err := s.repo.ListUserMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &UserDeletion{UserID: userID, Successors: make(map[uuid.UUID]uuid.UUID)}
+	for _, m := range memberships {
+		page, err := s.repo.ListMembers(ctx, m.Group.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		members := page.Members
+
+		var successor *Membership
+		hasOtherAdmin := false
+		for _, member := range members {
+			if member.UserID == userID {
+				continue
+			}
+			if member.Role == RoleAdmin {
+				hasOtherAdmin = true
+			}
+			// Members are ordered by join date, so the first is the oldest
+			if successor == nil {
+				successor = member
+			}
+		}
+
+		switch {
+		case successor == nil:
+			plan.Orphaned = append(plan.Orphaned, m.Group.ID)
+		case m.Role == RoleAdmin && !hasOtherAdmin:
+			plan.Successors[m.Group.ID] = successor.UserID
+		}
+	}
+
+	return plan, nil
+}
+
+// RecordUserDeletion audits the promotions and group deletions of an
+// applied account deletion plan
+func (s *Service) RecordUserDeletion(ctx context.Context, plan *UserDeletion) {
+	for groupID, successorID := range plan.Successors {
+		s.audit.Record(ctx, &audit.Event{
+			ActorID:    plan.UserID,
+			Action:     audit.ActionRoleChanged,
+			GroupID:    groupID,
+			TargetType: audit.TargetUser,
+			TargetID:   successorID.String(),
+			Metadata:   map[string]string{"role": RoleAdmin, "reason": "previous admin deleted their account"},
+		})
+	}
+	for _, groupID := range plan.Orphaned {
+		s.audit.Record(ctx, &audit.Event{
+			ActorID:    plan.UserID,
+			Action:     audit.ActionGroupDeleted,
+			GroupID:    groupID,
+			TargetType: audit.TargetGroup,
+			TargetID:   groupID.String(),
+		})
+	}
+}
+
+// ForceDelete deletes a group without a permission check. Callers must
+// authorize the operation and remove the group's stored files first.
+func (s *Service) ForceDelete(ctx context.Context, groupID, actorID uuid.UUID) error {
+	return s.delete(ctx, groupID, actorID)
+}
+
+func (s *Service) delete(ctx context.Context, groupID, actorID uuid.UUID) error {
+	if err := s.repo.Delete(ctx, groupID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, &audit.Event{
+		ActorID:    actorID,
+		Action:     audit.ActionGroupDeleted,
+		GroupID:    groupID,
+		TargetType: audit.TargetGroup,
+		TargetID:   groupID.String(),
+	})
+
+	return nil
 }
@@ -0,0 +1,107 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/lockout"
+	"github.com/testifysec/dropbox-clone/internal/user"
+	dropboxv1 "github.com/testifysec/dropbox-clone/pkg/api/dropbox/v1"
+)
+
+// authServer implements AuthService with the same sign-in service as the
+// REST auth handler
+type authServer struct {
+	dropboxv1.UnimplementedAuthServiceServer
+	auth *auth.Service
+}
+
+func (s *authServer) Register(ctx context.Context, req *dropboxv1.RegisterRequest) (*dropboxv1.AuthResponse, error) {
+	session, err := s.auth.Register(ctx, req.GetEmail(), req.GetPassword())
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrEmailExists):
+			return nil, status.Error(codes.AlreadyExists, "Email already exists")
+		case errors.Is(err, user.ErrEmailRequired):
+			return nil, status.Error(codes.InvalidArgument, "Email is required")
+		case errors.Is(err, user.ErrPasswordRequired):
+			return nil, status.Error(codes.InvalidArgument, "Password is required")
+		case errors.Is(err, user.ErrPasswordTooShort):
+			return nil, status.Error(codes.InvalidArgument, "Password must be at least 8 characters")
+		default:
+			return nil, status.Error(codes.Internal, "Internal server error")
+		}
+	}
+	return toAuthResponse(session), nil
+}
+
+func (s *authServer) Login(ctx context.Context, req *dropboxv1.LoginRequest) (*dropboxv1.AuthResponse, error) {
+	session, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), clientIP(ctx))
+	if err != nil {
+		var blocked *lockout.BlockedError
+		switch {
+		case errors.As(err, &blocked):
+			return nil, blockedError(blocked)
+		case errors.Is(err, auth.ErrCredentialsRequired):
+			return nil, status.Error(codes.InvalidArgument, "Email and password are required")
+		case errors.Is(err, user.ErrAccountDisabled):
+			return nil, status.Error(codes.PermissionDenied, "Account is disabled")
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			return nil, status.Error(codes.Unauthenticated, "Invalid email or password")
+		default:
+			return nil, status.Error(codes.Internal, "Internal server error")
+		}
+	}
+	return toAuthResponse(session), nil
+}
+
+func (s *authServer) Refresh(ctx context.Context, req *dropboxv1.RefreshRequest) (*dropboxv1.AuthResponse, error) {
+	session, err := s.auth.Refresh(ctx, req.GetRefreshToken(), clientIP(ctx))
+	if err != nil {
+		var blocked *lockout.BlockedError
+		switch {
+		case errors.As(err, &blocked):
+			return nil, blockedError(blocked)
+		case errors.Is(err, auth.ErrRefreshTokenRequired):
+			return nil, status.Error(codes.InvalidArgument, "Refresh token is required")
+		case errors.Is(err, auth.ErrExpiredToken):
+			return nil, status.Error(codes.Unauthenticated, "Refresh token has expired")
+		case errors.Is(err, auth.ErrInvalidToken):
+			return nil, status.Error(codes.Unauthenticated, "Invalid refresh token")
+		case errors.Is(err, user.ErrUserNotFound):
+			return nil, status.Error(codes.Unauthenticated, "User not found")
+		case errors.Is(err, user.ErrAccountDisabled):
+			return nil, status.Error(codes.PermissionDenied, "Account is disabled")
+		case errors.Is(err, auth.ErrRevokedToken):
+			return nil, status.Error(codes.Unauthenticated, "Refresh token has been revoked")
+		default:
+			return nil, status.Error(codes.Internal, "Internal server error")
+		}
+	}
+	return toAuthResponse(session), nil
+}
+
+// toAuthResponse describes a session's user and tokens
+func toAuthResponse(session *auth.Session) *dropboxv1.AuthResponse {
+	return &dropboxv1.AuthResponse{
+		User:         toUser(session.User),
+		AccessToken:  session.Tokens.AccessToken,
+		RefreshToken: session.Tokens.RefreshToken,
+		ExpiresAt:    timestamppb.New(session.Tokens.ExpiresAt),
+	}
+}
+
+// blockedError reports a lockout. Unlike HTTP there is no Retry-After
+// header, so the wait is given in the message.
+func blockedError(blocked *lockout.BlockedError) error {
+	seconds := int(blocked.RetryAfter.Seconds()) + 1
+	if blocked.Locked {
+		return status.Errorf(codes.ResourceExhausted, "Account is temporarily locked due to too many failed attempts, retry after %d seconds", seconds)
+	}
+	return status.Errorf(codes.ResourceExhausted, "Too many failed attempts, try again after %d seconds", seconds)
+}
@@ -0,0 +1,310 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/pagination"
+	"github.com/testifysec/dropbox-clone/internal/user"
+	dropboxv1 "github.com/testifysec/dropbox-clone/pkg/api/dropbox/v1"
+)
+
+// chunkSize is how much content each Download message carries
+const chunkSize = 64 << 10
+
+var errSizeMismatch = errors.New("content does not match the declared size")
+
+// fileServer implements FileService
+type fileServer struct {
+	dropboxv1.UnimplementedFileServiceServer
+	users *user.Service
+	files *file.Service
+}
+
+func (s *fileServer) Upload(stream grpc.ClientStreamingServer[dropboxv1.UploadRequest, dropboxv1.File]) error {
+	ctx := stream.Context()
+	userID, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+	if err := requireVerifiedEmail(ctx, s.users, userID); err != nil {
+		return err
+	}
+
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	meta := req.GetMetadata()
+	if meta == nil {
+		return status.Error(codes.InvalidArgument, "The first message must carry the file's metadata")
+	}
+	groupID, err := uuid.Parse(meta.GetGroupId())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Invalid group ID")
+	}
+	if meta.GetSizeBytes() < 0 {
+		return status.Error(codes.InvalidArgument, "Size must not be negative")
+	}
+	contentType := meta.GetContentType()
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	body := &uploadReader{stream: stream, remaining: meta.GetSizeBytes()}
+	uploaded, err := s.files.Upload(ctx, &file.UploadFileInput{
+		Name:        meta.GetName(),
+		ContentType: contentType,
+		SizeBytes:   meta.GetSizeBytes(),
+		GroupID:     groupID,
+		UploadedBy:  userID,
+	}, body)
+	if err == nil {
+		// Storage may stop reading at the declared size; the client must
+		// not have sent more
+		if err = body.finish(); err != nil {
+			if deleteErr := s.files.Delete(ctx, uploaded.ID, userID); deleteErr != nil {
+				log.Printf("Failed to delete rejected gRPC upload %s: %v", uploaded.ID, deleteErr)
+			}
+		}
+	}
+	if err != nil {
+		// The stream's own failure explains a failed upload better
+		if body.err != nil {
+			err = body.err
+		}
+		switch {
+		case status.Code(err) != codes.Unknown:
+			return err
+		case errors.Is(err, errSizeMismatch):
+			return status.Error(codes.InvalidArgument, "Content does not match the declared size")
+		case errors.Is(err, file.ErrNameRequired), errors.Is(err, file.ErrNameTooLong):
+			return status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, file.ErrFileTooLarge):
+			return status.Error(codes.InvalidArgument, "File exceeds maximum size (1 GB)")
+		case errors.Is(err, file.ErrMetadataRequired):
+			return status.Error(codes.FailedPrecondition, err.Error())
+		case errors.Is(err, group.ErrNotMember):
+			return status.Error(codes.PermissionDenied, "You are not a member of this group")
+		default:
+			return status.Error(codes.Internal, "Failed to upload file")
+		}
+	}
+
+	return stream.SendAndClose(toFile(uploaded))
+}
+
+// uploadReader reads an upload's content from the chunks that follow its
+// metadata, failing if they add up to more or less than the declared size
+type uploadReader struct {
+	stream    grpc.ClientStreamingServer[dropboxv1.UploadRequest, dropboxv1.File]
+	chunk     []byte
+	remaining int64 // Declared bytes not yet read
+	err       error // Set once the stream fails or breaks the size
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for len(r.chunk) == 0 {
+		req, err := r.stream.Recv()
+		if err == io.EOF {
+			if r.remaining != 0 {
+				r.err = errSizeMismatch
+				return 0, r.err
+			}
+			return 0, io.EOF
+		}
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		if req.GetMetadata() != nil {
+			r.err = status.Error(codes.InvalidArgument, "Only the first message may carry metadata")
+			return 0, r.err
+		}
+		r.chunk = req.GetChunk()
+	}
+
+	if int64(len(r.chunk)) > r.remaining {
+		r.err = errSizeMismatch
+		return 0, r.err
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+// finish reads to the end of the stream, checking that the content was
+// exactly the declared size
+func (r *uploadReader) finish() error {
+	n, err := r.Read(make([]byte, 1))
+	if n > 0 || r.remaining != 0 {
+		return errSizeMismatch
+	}
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func (s *fileServer) Download(req *dropboxv1.DownloadRequest, stream grpc.ServerStreamingServer[dropboxv1.DownloadResponse]) error {
+	ctx := stream.Context()
+	userID, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+	fileID, err := uuid.Parse(req.GetFileId())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "Invalid file ID")
+	}
+
+	body, f, err := s.files.DownloadFrom(ctx, fileID, userID, req.GetOffset())
+	if err != nil {
+		switch {
+		case errors.Is(err, file.ErrFileNotFound):
+			return status.Error(codes.NotFound, "File not found")
+		case errors.Is(err, group.ErrNotMember):
+			return status.Error(codes.PermissionDenied, "You are not a member of this group")
+		case errors.Is(err, file.ErrInvalidRange):
+			return status.Error(codes.OutOfRange, "Offset is outside the file")
+		default:
+			return status.Error(codes.Internal, "Failed to download file")
+		}
+	}
+	defer func() { _ = body.Close() }()
+
+	if err := stream.Send(&dropboxv1.DownloadResponse{Data: &dropboxv1.DownloadResponse_File{File: toFile(f)}}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(body, buf)
+		if n > 0 {
+			chunk := &dropboxv1.DownloadResponse{Data: &dropboxv1.DownloadResponse_Chunk{Chunk: buf[:n]}}
+			if err := stream.Send(chunk); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Failed to stream file %s: %v", f.ID, err)
+			return status.Error(codes.Internal, "Failed to download file")
+		}
+	}
+}
+
+func (s *fileServer) ListFiles(ctx context.Context, req *dropboxv1.ListFilesRequest) (*dropboxv1.ListFilesResponse, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groupID, err := uuid.Parse(req.GetGroupId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid group ID")
+	}
+
+	limit, err := pageSize(req.GetPageSize())
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.files.ListByGroupID(ctx, groupID, userID, &file.ListOptions{Limit: limit, PageToken: req.GetPageToken()})
+	if err != nil {
+		switch {
+		case errors.Is(err, group.ErrNotMember):
+			return nil, status.Error(codes.PermissionDenied, "You are not a member of this group")
+		case errors.Is(err, pagination.ErrInvalidToken):
+			return nil, status.Error(codes.InvalidArgument, "Invalid page token")
+		default:
+			return nil, status.Error(codes.Internal, "Failed to list files")
+		}
+	}
+	response := &dropboxv1.ListFilesResponse{
+		Files:         make([]*dropboxv1.File, len(page.Files)),
+		NextPageToken: page.NextPageToken,
+	}
+	for i, f := range page.Files {
+		response.Files[i] = toFile(f)
+	}
+	return response, nil
+}
+
+func (s *fileServer) GetFile(ctx context.Context, req *dropboxv1.GetFileRequest) (*dropboxv1.File, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fileID, err := uuid.Parse(req.GetFileId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid file ID")
+	}
+
+	f, err := s.files.GetByID(ctx, fileID, userID)
+	if err != nil {
+		return nil, fileError(err, "Failed to get file")
+	}
+	return toFile(f), nil
+}
+
+func (s *fileServer) RenameFile(ctx context.Context, req *dropboxv1.RenameFileRequest) (*dropboxv1.File, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fileID, err := uuid.Parse(req.GetFileId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid file ID")
+	}
+
+	f, err := s.files.Rename(ctx, fileID, userID, &file.RenameFileInput{Name: req.GetName()})
+	if err != nil {
+		if errors.Is(err, file.ErrNameRequired) || errors.Is(err, file.ErrNameTooLong) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, fileError(err, "Failed to rename file")
+	}
+	return toFile(f), nil
+}
+
+func (s *fileServer) DeleteFile(ctx context.Context, req *dropboxv1.DeleteFileRequest) (*dropboxv1.DeleteFileResponse, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fileID, err := uuid.Parse(req.GetFileId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid file ID")
+	}
+
+	if err := s.files.Delete(ctx, fileID, userID); err != nil {
+		return nil, fileError(err, "Failed to delete file")
+	}
+	return &dropboxv1.DeleteFileResponse{}, nil
+}
+
+// fileError maps the errors common to operations on a single file
+func fileError(err error, message string) error {
+	switch {
+	case errors.Is(err, file.ErrFileNotFound):
+		return status.Error(codes.NotFound, "File not found")
+	case errors.Is(err, group.ErrNotMember):
+		return status.Error(codes.PermissionDenied, "You are not a member of this group")
+	default:
+		return status.Error(codes.Internal, message)
+	}
+}
@@ -0,0 +1,93 @@
+package grpcapi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/testifysec/dropbox-clone/internal/pagination"
+	dropboxv1 "github.com/testifysec/dropbox-clone/pkg/api/dropbox/v1"
+)
+
+// chunkStream replays upload messages
+type chunkStream struct {
+	grpc.ClientStreamingServer[dropboxv1.UploadRequest, dropboxv1.File]
+	requests []*dropboxv1.UploadRequest
+}
+
+func (s *chunkStream) Recv() (*dropboxv1.UploadRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func chunks(parts ...string) *chunkStream {
+	s := &chunkStream{}
+	for _, p := range parts {
+		s.requests = append(s.requests, &dropboxv1.UploadRequest{Data: &dropboxv1.UploadRequest_Chunk{Chunk: []byte(p)}})
+	}
+	return s
+}
+
+func TestUploadReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  *chunkStream
+		size    int64
+		wantErr bool
+	}{
+		{"exact size", chunks("hello ", "", "world"), 11, false},
+		{"empty file", chunks(), 0, false},
+		{"short content", chunks("hello"), 11, true},
+		{"long content", chunks("hello ", "world!"), 11, true},
+		{"content after the declared size", chunks("hello world", "!"), 11, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &uploadReader{stream: tt.stream, remaining: tt.size}
+			got, err := io.ReadAll(r)
+			if err == nil {
+				err = r.finish()
+			}
+			if tt.wantErr {
+				if !errors.Is(err, errSizeMismatch) {
+					t.Errorf("err = %v, want size mismatch", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, []byte("hello world")[:tt.size]) {
+				t.Errorf("read %q", got)
+			}
+		})
+	}
+
+	// Metadata is only allowed first
+	stream := chunks("hello")
+	stream.requests = append(stream.requests, &dropboxv1.UploadRequest{Data: &dropboxv1.UploadRequest_Metadata{Metadata: &dropboxv1.UploadMetadata{}}})
+	r := &uploadReader{stream: stream, remaining: 10}
+	if _, err := io.ReadAll(r); err == nil || errors.Is(err, errSizeMismatch) {
+		t.Errorf("second metadata message: err = %v", err)
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	for in, want := range map[int32]int{0: pagination.DefaultLimit, 1: 1, 250: 250, 5000: pagination.MaxLimit} {
+		if got, err := pageSize(in); err != nil || got != want {
+			t.Errorf("pageSize(%d) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	if _, err := pageSize(-1); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("pageSize(-1) error = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,137 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/pagination"
+	"github.com/testifysec/dropbox-clone/internal/user"
+	dropboxv1 "github.com/testifysec/dropbox-clone/pkg/api/dropbox/v1"
+)
+
+// groupServer implements GroupService
+type groupServer struct {
+	dropboxv1.UnimplementedGroupServiceServer
+	users  *user.Service
+	groups *group.Service
+}
+
+func (s *groupServer) CreateGroup(ctx context.Context, req *dropboxv1.CreateGroupRequest) (*dropboxv1.Group, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := s.groups.Create(ctx, &group.CreateGroupInput{Name: req.GetName()}, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, group.ErrNameRequired):
+			return nil, status.Error(codes.InvalidArgument, "Name is required")
+		default:
+			return nil, status.Error(codes.Internal, "Internal server error")
+		}
+	}
+	return toGroup(g), nil
+}
+
+func (s *groupServer) ListGroups(ctx context.Context, req *dropboxv1.ListGroupsRequest) (*dropboxv1.ListGroupsResponse, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, err := pageSize(req.GetPageSize())
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.groups.ListByUserID(ctx, userID, &group.UserGroupsOptions{Limit: limit, PageToken: req.GetPageToken()})
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidToken) {
+			return nil, status.Error(codes.InvalidArgument, "Invalid page token")
+		}
+		return nil, status.Error(codes.Internal, "Internal server error")
+	}
+	response := &dropboxv1.ListGroupsResponse{
+		Groups:        make([]*dropboxv1.Group, len(page.Groups)),
+		NextPageToken: page.NextPageToken,
+	}
+	for i, g := range page.Groups {
+		response.Groups[i] = toGroup(g)
+	}
+	return response, nil
+}
+
+func (s *groupServer) AddMember(ctx context.Context, req *dropboxv1.AddMemberRequest) (*dropboxv1.Membership, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireVerifiedEmail(ctx, s.users, userID); err != nil {
+		return nil, err
+	}
+
+	groupID, err := uuid.Parse(req.GetGroupId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid group ID")
+	}
+	memberUserID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid user ID")
+	}
+
+	membership, err := s.groups.AddMember(ctx, groupID, &group.AddMemberInput{
+		UserID: memberUserID,
+		Role:   req.GetRole(),
+	}, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, group.ErrNotMember):
+			return nil, status.Error(codes.PermissionDenied, "You are not a member of this group")
+		case errors.Is(err, group.ErrNotAdmin):
+			return nil, status.Error(codes.PermissionDenied, "Only admins can add members")
+		case errors.Is(err, group.ErrAlreadyMember):
+			return nil, status.Error(codes.AlreadyExists, "User is already a member")
+		case errors.Is(err, group.ErrInvalidRole):
+			return nil, status.Error(codes.InvalidArgument, "Invalid role")
+		default:
+			return nil, status.Error(codes.Internal, "Internal server error")
+		}
+	}
+	return toMembership(membership), nil
+}
+
+func (s *groupServer) RemoveMember(ctx context.Context, req *dropboxv1.RemoveMemberRequest) (*dropboxv1.RemoveMemberResponse, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groupID, err := uuid.Parse(req.GetGroupId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid group ID")
+	}
+	memberUserID, err := uuid.Parse(req.GetUserId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid user ID")
+	}
+
+	if err := s.groups.RemoveMember(ctx, groupID, memberUserID, userID); err != nil {
+		switch {
+		case errors.Is(err, group.ErrNotMember):
+			return nil, status.Error(codes.NotFound, "User is not a member of this group")
+		case errors.Is(err, group.ErrNotAdmin):
+			return nil, status.Error(codes.PermissionDenied, "Only admins can remove members")
+		case errors.Is(err, group.ErrCannotRemoveSelf):
+			return nil, status.Error(codes.InvalidArgument, "Cannot remove yourself from the group")
+		default:
+			return nil, status.Error(codes.Internal, "Internal server error")
+		}
+	}
+	return &dropboxv1.RemoveMemberResponse{}, nil
+}
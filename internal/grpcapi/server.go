@@ -0,0 +1,198 @@
+// Package grpcapi serves the gRPC API defined in proto/dropbox/v1, for
+// internal services that prefer gRPC to REST. It covers authentication,
+// groups and files, with files transferred over streaming RPCs, and goes
+// through the same services and checks as the REST API.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/pagination"
+	"github.com/testifysec/dropbox-clone/internal/user"
+	dropboxv1 "github.com/testifysec/dropbox-clone/pkg/api/dropbox/v1"
+)
+
+// publicMethods are served without an access token
+var publicMethods = []string{
+	"/" + dropboxv1.AuthService_ServiceDesc.ServiceName + "/",
+	"/" + healthpb.Health_ServiceDesc.ServiceName + "/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+// NewServer creates a gRPC server with the API, health and reflection
+// services registered
+func NewServer(userService *user.Service, groupService *group.Service, fileService *file.Service,
+	jwtService *auth.JWTService, authService *auth.Service) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			unaryRequestInfo,
+			auth.UnaryInterceptor(jwtService, userService, publicMethods...),
+		),
+		grpc.ChainStreamInterceptor(
+			streamRequestInfo,
+			auth.StreamInterceptor(jwtService, userService, publicMethods...),
+		),
+	)
+
+	dropboxv1.RegisterAuthServiceServer(s, &authServer{auth: authService})
+	dropboxv1.RegisterGroupServiceServer(s, &groupServer{users: userService, groups: groupService})
+	dropboxv1.RegisterFileServiceServer(s, &fileServer{users: userService, files: fileService})
+
+	healthServer := health.NewServer()
+	for name := range s.GetServiceInfo() {
+		healthServer.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(s, healthServer)
+	reflection.Register(s)
+
+	return s
+}
+
+// unaryRequestInfo adds the caller's details to the context for audit
+// events, as audit.Middleware does for HTTP requests
+func unaryRequestInfo(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withRequestInfo(ctx), req)
+}
+
+func streamRequestInfo(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: withRequestInfo(ss.Context())})
+}
+
+func withRequestInfo(ctx context.Context) context.Context {
+	info := audit.RequestInfo{IP: clientIP(ctx)}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			info.UserAgent = values[0]
+		}
+		if values := md.Get("x-request-id"); len(values) > 0 {
+			info.RequestID = values[0]
+		}
+	}
+	return audit.WithRequestInfo(ctx, info)
+}
+
+// contextStream is a server stream with a replaced context
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// clientIP returns the caller's address without the port
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	ip := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return ip
+}
+
+// callerID returns the signed-in user, which the auth interceptors have
+// added to the context
+func callerID(ctx context.Context) (uuid.UUID, error) {
+	userID, ok := auth.GetUserID(ctx)
+	if !ok {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	return userID, nil
+}
+
+// requireVerifiedEmail applies the email verification policy, as
+// auth.RequireVerifiedEmail does for HTTP routes
+func requireVerifiedEmail(ctx context.Context, userService *user.Service, userID uuid.UUID) error {
+	if err := userService.RequireVerifiedEmail(ctx, userID); err != nil {
+		switch {
+		case errors.Is(err, user.ErrEmailNotVerified):
+			return status.Error(codes.PermissionDenied, "Email address must be verified")
+		case errors.Is(err, user.ErrUserNotFound):
+			return status.Error(codes.Unauthenticated, "Unauthorized")
+		default:
+			return status.Error(codes.Internal, "Internal server error")
+		}
+	}
+	return nil
+}
+
+// pageSize resolves a requested page size, which defaults to
+// pagination.DefaultLimit and is capped at pagination.MaxLimit
+func pageSize(n int32) (int, error) {
+	switch {
+	case n < 0:
+		return 0, status.Error(codes.InvalidArgument, "Invalid page size")
+	case n == 0:
+		return pagination.DefaultLimit, nil
+	}
+	return min(int(n), pagination.MaxLimit), nil
+}
+
+func toUser(u *user.User) *dropboxv1.User {
+	return &dropboxv1.User{
+		Id:            u.ID.String(),
+		Email:         u.Email,
+		EmailVerified: u.IsEmailVerified(),
+		CreatedAt:     timestamppb.New(u.CreatedAt),
+	}
+}
+
+func toGroup(g *group.Group) *dropboxv1.Group {
+	return &dropboxv1.Group{
+		Id:        g.ID.String(),
+		Name:      g.Name,
+		CreatedBy: formatUserID(g.CreatedBy),
+		CreatedAt: timestamppb.New(g.CreatedAt),
+	}
+}
+
+func toMembership(m *group.Membership) *dropboxv1.Membership {
+	return &dropboxv1.Membership{
+		UserId:   m.UserID.String(),
+		GroupId:  m.GroupID.String(),
+		Role:     m.Role,
+		JoinedAt: timestamppb.New(m.JoinedAt),
+	}
+}
+
+func toFile(f *file.File) *dropboxv1.File {
+	return &dropboxv1.File{
+		Id:          f.ID.String(),
+		Name:        f.Name,
+		SizeBytes:   f.SizeBytes,
+		ContentType: f.ContentType,
+		GroupId:     f.GroupID.String(),
+		UploadedBy:  formatUserID(f.UploadedBy),
+		CreatedAt:   timestamppb.New(f.CreatedAt),
+	}
+}
+
+// formatUserID returns the ID, or an empty string for uuid.Nil
+func formatUserID(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,29 @@
+package lockout
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrBlocked = errors.New("too many failed attempts")
+)
+
+// BlockedError is returned when a key is in backoff or locked out
+type BlockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *BlockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account locked, retry after %s", e.RetryAfter)
+	}
+	return fmt.Sprintf("too many failed attempts, retry after %s", e.RetryAfter)
+}
+
+// Is allows errors.Is(err, ErrBlocked)
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
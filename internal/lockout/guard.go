@@ -0,0 +1,178 @@
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Policy controls how failures for one kind of key are throttled
+type Policy struct {
+	FreeAttempts    int           // Failures allowed before backoff starts
+	BaseDelay       time.Duration // Delay after the first throttled failure
+	MaxDelay        time.Duration // Upper bound for the exponential backoff
+	LockAfter       int           // Failures after which the key is locked out
+	LockoutDuration time.Duration // How long a lockout lasts
+}
+
+// delay returns how long to block after the given number of failures, and
+// whether the block is a lockout rather than backoff
+func (p Policy) delay(failures int) (time.Duration, bool) {
+	if p.LockAfter > 0 && failures >= p.LockAfter {
+		return p.LockoutDuration, true
+	}
+	if failures <= p.FreeAttempts {
+		return 0, false
+	}
+
+	d := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		d *= 2
+		if d >= p.MaxDelay {
+			return p.MaxDelay, false
+		}
+	}
+	return min(d, p.MaxDelay), false
+}
+
+// schedule returns the delay in seconds after each failure count, starting
+// at one failure. Counts past the end of the schedule use its last entry.
+func (p Policy) schedule() []float64 {
+	var delays []float64
+	for failures := 1; ; failures++ {
+		d, _ := p.delay(failures)
+		delays = append(delays, d.Seconds())
+		if p.LockAfter > 0 {
+			if failures >= p.LockAfter {
+				return delays
+			}
+			continue
+		}
+		if failures > p.FreeAttempts+1 && delays[len(delays)-2] == d.Seconds() || failures > p.FreeAttempts+64 {
+			return delays
+		}
+	}
+}
+
+// Config holds the guard configuration
+type Config struct {
+	Account Policy
+	IP      Policy
+	Window  time.Duration // Failures older than this are forgotten
+}
+
+// Guard tracks failed authentication attempts per account and per client IP
+// and rejects attempts while a key is in backoff or locked out
+type Guard struct {
+	store  Store
+	config Config
+	now    func() time.Time
+}
+
+// NewGuard creates a new Guard
+func NewGuard(store Store, config Config) *Guard {
+	return &Guard{store: store, config: config, now: time.Now}
+}
+
+// Attempt counts an authentication attempt for the account and the IP
+// before the credentials are checked, and returns a *BlockedError if either
+// key is in backoff or locked out. Counting and comparing against the
+// policy happen in one store operation, so parallel guesses cannot all slip
+// in before the first block is written. Attempts are counted as failures
+// until Clear or Release says otherwise. An empty email or IP is not tracked.
+func (g *Guard) Attempt(ctx context.Context, email, ip string) error {
+	var counted []string
+	var blocked *BlockedError
+	for _, key := range g.keys(email, ip) {
+		policy := g.policy(key)
+		record, allowed, err := g.store.RecordAttempt(ctx, key, policy, g.config.Window)
+		if err != nil {
+			return err
+		}
+		if allowed {
+			counted = append(counted, key)
+			continue
+		}
+		wait := record.BlockedUntil.Sub(g.now())
+		_, locked := policy.delay(record.Failures)
+		if blocked == nil || wait > blocked.RetryAfter {
+			blocked = &BlockedError{RetryAfter: wait, Locked: locked}
+		}
+	}
+	if blocked == nil {
+		return nil
+	}
+
+	// A rejected attempt never reaches the credentials, so it does not count
+	// against the keys that let it through
+	for _, key := range counted {
+		if err := g.store.Release(ctx, key, g.policy(key)); err != nil {
+			return err
+		}
+	}
+	return blocked
+}
+
+// Clear forgives an attempt that turned out to be legitimate: failures,
+// backoff and lockout on the account are cleared, and the IP gets its
+// attempt back. The IP counter is not reset, so one valid login cannot mask
+// spraying. Administrators unlock an account by clearing it without an IP.
+func (g *Guard) Clear(ctx context.Context, email, ip string) error {
+	if email != "" {
+		if err := g.store.Reset(ctx, accountKey(email)); err != nil {
+			return err
+		}
+	}
+	if ip != "" {
+		return g.store.Release(ctx, ipKey(ip), g.config.IP)
+	}
+	return nil
+}
+
+// Release gives back an attempt whose credentials could not be checked,
+// such as one cut short by a database error, to both the account and the
+// IP, along with any backoff or lockout it started
+func (g *Guard) Release(ctx context.Context, email, ip string) error {
+	for _, key := range g.keys(email, ip) {
+		if err := g.store.Release(ctx, key, g.policy(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune removes state for keys that have not failed within the window
+func (g *Guard) Prune(ctx context.Context) error {
+	return g.store.Prune(ctx, g.now().Add(-g.config.Window))
+}
+
+func (g *Guard) keys(email, ip string) []string {
+	var keys []string
+	if email != "" {
+		keys = append(keys, accountKey(email))
+	}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	return keys
+}
+
+func (g *Guard) policy(key string) Policy {
+	if strings.HasPrefix(key, ipPrefix) {
+		return g.config.IP
+	}
+	return g.config.Account
+}
+
+const (
+	accountPrefix = "account:"
+	ipPrefix      = "ip:"
+)
+
+func accountKey(email string) string {
+	return accountPrefix + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return ipPrefix + ip
+}
@@ -0,0 +1,238 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestGuard(now *time.Time) *Guard {
+	store := NewMemoryStore()
+	store.now = func() time.Time { return *now }
+	g := NewGuard(store, Config{
+		Account: Policy{
+			FreeAttempts:    2,
+			BaseDelay:       time.Second,
+			MaxDelay:        8 * time.Second,
+			LockAfter:       6,
+			LockoutDuration: 15 * time.Minute,
+		},
+		IP: Policy{
+			FreeAttempts: 100,
+			BaseDelay:    time.Second,
+			MaxDelay:     time.Minute,
+		},
+		Window: time.Hour,
+	})
+	g.now = func() time.Time { return *now }
+	return g
+}
+
+func TestPolicyDelay(t *testing.T) {
+	p := Policy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 8 * time.Second, LockAfter: 10, LockoutDuration: time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+		locked   bool
+	}{
+		{1, 0, false},
+		{2, 0, false},
+		{3, time.Second, false},
+		{4, 2 * time.Second, false},
+		{5, 4 * time.Second, false},
+		{6, 8 * time.Second, false},
+		{9, 8 * time.Second, false},
+		{10, time.Hour, true},
+	}
+	for _, tt := range tests {
+		got, locked := p.delay(tt.failures)
+		if got != tt.want || locked != tt.locked {
+			t.Errorf("delay(%d) = %v, %v; want %v, %v", tt.failures, got, locked, tt.want, tt.locked)
+		}
+	}
+}
+
+func TestPolicySchedule(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		want   []float64
+	}{
+		{Policy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 4 * time.Second}, []float64{0, 0, 1, 2, 4, 4}},
+		{Policy{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: 2 * time.Second, LockAfter: 5, LockoutDuration: time.Minute}, []float64{0, 1, 2, 2, 60}},
+		{Policy{FreeAttempts: 1}, []float64{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.schedule(); !slices.Equal(got, tt.want) {
+			t.Errorf("schedule(%+v) = %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestGuard_BackoffAndLockout(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	g := newTestGuard(&now)
+
+	// Free attempts are not throttled
+	for i := 0; i < 2; i++ {
+		if err := g.Attempt(ctx, "User@Example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i, err)
+		}
+	}
+
+	// The third failure triggers backoff
+	if err := g.Attempt(ctx, "user@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("attempt 3: unexpected error: %v", err)
+	}
+	err := g.Attempt(ctx, "user@example.com", "10.0.0.2")
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("expected BlockedError, got %v", err)
+	}
+	if blocked.Locked {
+		t.Error("expected backoff, not lockout")
+	}
+	if !errors.Is(err, ErrBlocked) {
+		t.Error("expected errors.Is(err, ErrBlocked)")
+	}
+
+	// Other accounts are unaffected
+	if err := g.Attempt(ctx, "other@example.com", "10.0.0.2"); err != nil {
+		t.Errorf("unexpected error for other account: %v", err)
+	}
+
+	// Keep failing until the account locks
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Minute)
+		if err := g.Attempt(ctx, "user@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i+4, err)
+		}
+	}
+	err = g.Attempt(ctx, "user@example.com", "")
+	if !errors.As(err, &blocked) || !blocked.Locked {
+		t.Fatalf("expected lockout, got %v", err)
+	}
+
+	// Clearing the account lifts the lockout
+	if err := g.Clear(ctx, "user@example.com", ""); err != nil {
+		t.Fatalf("failed to clear: %v", err)
+	}
+	if err := g.Attempt(ctx, "user@example.com", ""); err != nil {
+		t.Errorf("expected account to be unlocked, got %v", err)
+	}
+}
+
+func TestGuard_ParallelAttempts(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	g := newTestGuard(&now)
+
+	// However the attempts interleave, only the free attempts and the one
+	// that starts the backoff get through
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := g.Attempt(ctx, "user@example.com", "10.0.0.1"); err == nil {
+				allowed.Add(1)
+			} else if !errors.Is(err, ErrBlocked) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := allowed.Load(); got != 3 {
+		t.Errorf("%d parallel attempts were allowed, want 3", got)
+	}
+}
+
+func TestGuard_ClearReleasesAttempt(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	g := newTestGuard(&now)
+
+	for i := 0; i < 2; i++ {
+		if err := g.Attempt(ctx, "user@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i, err)
+		}
+	}
+	// The second attempt succeeded, so it is not held against the account
+	if err := g.Clear(ctx, "user@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("failed to clear: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := g.Attempt(ctx, "user@example.com", "10.0.0.1"); err != nil {
+			t.Errorf("attempt %d after success: unexpected error: %v", i, err)
+		}
+	}
+
+	// A rejected attempt is not counted against the IP
+	store := g.store.(*MemoryStore)
+	before := store.records[ipKey("10.0.0.1")].Failures
+	if err := g.Attempt(ctx, "user@example.com", "10.0.0.1"); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected backoff, got %v", err)
+	}
+	if after := store.records[ipKey("10.0.0.1")].Failures; after != before {
+		t.Errorf("IP failures = %d after a rejected attempt, want %d", after, before)
+	}
+}
+
+func TestGuard_ReleaseLiftsBlock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	g := newTestGuard(&now)
+
+	for i := 0; i < 3; i++ {
+		if err := g.Attempt(ctx, "user@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i, err)
+		}
+	}
+	// The third attempt started backoff, but its credentials were never
+	// checked, so it is given back along with the block
+	if err := g.Release(ctx, "user@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("failed to release: %v", err)
+	}
+	store := g.store.(*MemoryStore)
+	if got := store.records[accountKey("user@example.com")].Failures; got != 2 {
+		t.Errorf("account failures = %d after release, want 2", got)
+	}
+	if got := store.records[ipKey("10.0.0.1")].Failures; got != 2 {
+		t.Errorf("IP failures = %d after release, want 2", got)
+	}
+
+	// The next failure starts backoff again
+	if err := g.Attempt(ctx, "user@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("attempt after release: unexpected error: %v", err)
+	}
+	if err := g.Attempt(ctx, "user@example.com", "10.0.0.1"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("expected backoff, got %v", err)
+	}
+}
+
+func TestGuard_WindowExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	g := newTestGuard(&now)
+
+	for i := 0; i < 2; i++ {
+		if err := g.Attempt(ctx, "user@example.com", ""); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i, err)
+		}
+	}
+
+	// After the window passes the count starts over, so these are free
+	// attempts
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 2; i++ {
+		if err := g.Attempt(ctx, "user@example.com", ""); err != nil {
+			t.Errorf("expected no block after window expiry, got %v", err)
+		}
+	}
+}
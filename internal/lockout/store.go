@@ -0,0 +1,215 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Record is the failure state tracked for a single key
+type Record struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	BlockedUntil  time.Time
+}
+
+// Store defines the interface for shared failure counters. Implementations
+// must be safe for concurrent use; the Postgres store is shared by all
+// replicas.
+type Store interface {
+	// RecordAttempt counts an attempt for key unless the key is blocked, and
+	// blocks it for as long as policy requires after the new count. It
+	// reports whether the attempt was allowed; either way the returned
+	// record is current. Failures older than window are forgotten before
+	// counting.
+	RecordAttempt(ctx context.Context, key string, policy Policy, window time.Duration) (*Record, bool, error)
+	// Release takes back one counted attempt for key and shortens its block
+	// to what policy requires for the failures left, counted from the last
+	// failure
+	Release(ctx context.Context, key string, policy Policy) error
+	// Reset clears all state for key
+	Reset(ctx context.Context, key string) error
+	// Prune removes records with no failures since olderThan that are not blocked
+	Prune(ctx context.Context, olderThan time.Time) error
+}
+
+// PostgresStore implements Store using PostgreSQL
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a new PostgresStore
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Get retrieves the record for a key
+func (s *PostgresStore) Get(ctx context.Context, key string) (*Record, error) {
+	query := `
+		SELECT key, failures, last_failure_at, blocked_until
+		FROM login_attempts
+		WHERE key = $1
+	`
+	record := &Record{}
+	var blockedUntil sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, key).Scan(
+		&record.Key, &record.Failures, &record.LastFailureAt, &blockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &Record{Key: key}, nil
+		}
+		return nil, err
+	}
+	record.BlockedUntil = blockedUntil.Time
+	return record, nil
+}
+
+// RecordAttempt atomically counts an attempt and applies the policy. A
+// blocked key is left as it is, which the upsert reports by returning no
+// row.
+func (s *PostgresStore) RecordAttempt(ctx context.Context, key string, policy Policy, window time.Duration) (*Record, bool, error) {
+	query := `
+		INSERT INTO login_attempts AS a (key, failures, last_failure_at, blocked_until)
+		VALUES ($1, 1, NOW(), NOW() + make_interval(secs => ($3::float8[])[1]))
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN a.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+				ELSE a.failures + 1
+			END,
+			last_failure_at = NOW(),
+			blocked_until = NOW() + make_interval(secs => ($3::float8[])[LEAST(
+				CASE
+					WHEN a.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+					ELSE a.failures + 1
+				END,
+				cardinality($3::float8[]))])
+		WHERE a.blocked_until IS NULL OR a.blocked_until <= NOW()
+		RETURNING key, failures, last_failure_at, blocked_until
+	`
+	record := &Record{}
+	var blockedUntil sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, key, window.Seconds(), pq.Array(policy.schedule())).Scan(
+		&record.Key, &record.Failures, &record.LastFailureAt, &blockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		record, err := s.Get(ctx, key)
+		return record, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	record.BlockedUntil = blockedUntil.Time
+	return record, true, nil
+}
+
+// Release takes back one counted attempt for a key and recomputes its block
+func (s *PostgresStore) Release(ctx context.Context, key string, policy Policy) error {
+	query := `
+		UPDATE login_attempts SET
+			failures = GREATEST(failures - 1, 0),
+			blocked_until = CASE
+				WHEN failures > 1 THEN last_failure_at + make_interval(secs => ($2::float8[])[LEAST(failures - 1, cardinality($2::float8[]))])
+				ELSE NULL
+			END
+		WHERE key = $1
+	`
+	_, err := s.db.ExecContext(ctx, query, key, pq.Array(policy.schedule()))
+	return err
+}
+
+// Reset removes the record for a key
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	query := `DELETE FROM login_attempts WHERE key = $1`
+	_, err := s.db.ExecContext(ctx, query, key)
+	return err
+}
+
+// Prune removes stale records
+func (s *PostgresStore) Prune(ctx context.Context, olderThan time.Time) error {
+	query := `
+		DELETE FROM login_attempts
+		WHERE last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until < NOW())
+	`
+	_, err := s.db.ExecContext(ctx, query, olderThan)
+	return err
+}
+
+// MemoryStore implements Store in process memory. It is only suitable for
+// single-replica deployments and tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*Record
+	now     func() time.Time
+}
+
+// NewMemoryStore creates a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record), now: time.Now}
+}
+
+// RecordAttempt counts an attempt and applies the policy
+func (s *MemoryStore) RecordAttempt(ctx context.Context, key string, policy Policy, window time.Duration) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	record, ok := s.records[key]
+	if !ok {
+		record = &Record{Key: key}
+		s.records[key] = record
+	}
+	if record.BlockedUntil.After(now) {
+		copied := *record
+		return &copied, false, nil
+	}
+	if record.LastFailureAt.Before(now.Add(-window)) {
+		record.Failures = 0
+	}
+	record.Failures++
+	record.LastFailureAt = now
+	delay, _ := policy.delay(record.Failures)
+	record.BlockedUntil = now.Add(delay)
+
+	copied := *record
+	return &copied, true, nil
+}
+
+// Release takes back one counted attempt for a key and recomputes its block
+func (s *MemoryStore) Release(ctx context.Context, key string, policy Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[key]; ok && record.Failures > 0 {
+		record.Failures--
+		delay, _ := policy.delay(record.Failures)
+		record.BlockedUntil = record.LastFailureAt.Add(delay)
+	}
+	return nil
+}
+
+// Reset removes the record for a key
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// Prune removes stale records
+func (s *MemoryStore) Prune(ctx context.Context, olderThan time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, record := range s.records {
+		if record.LastFailureAt.Before(olderThan) && record.BlockedUntil.Before(now) {
+			delete(s.records, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"context"
+	"log"
+)
+
+// Message represents an outgoing email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender defines the interface for delivering email
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// LogSender implements Sender by writing messages to the application log.
+// It is used in development when no SMTP server is configured.
+type LogSender struct{}
+
+// NewLogSender creates a new LogSender
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+// Send logs the message instead of delivering it
+func (s *LogSender) Send(ctx context.Context, msg *Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
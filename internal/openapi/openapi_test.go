@@ -0,0 +1,198 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/lockout"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+func newValidator(t *testing.T, validateResponses bool) *Validator {
+	t.Helper()
+	doc, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewValidator(doc, validateResponses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func serve(h http.Handler, method, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func errorMessage(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	return resp.Error
+}
+
+func TestSpec(t *testing.T) {
+	doc, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, item := range doc.Paths.Map() {
+		for method, op := range item.Operations() {
+			if op.OperationID == "" {
+				t.Errorf("%s %s has no operationId", method, path)
+			}
+		}
+	}
+
+	h, err := NewHandler(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.Spec(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	var served struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&served); err != nil || served.OpenAPI != "3.1.0" {
+		t.Errorf("served document: version %q, %v", served.OpenAPI, err)
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	v := newValidator(t, false)
+	var reached bool
+	h := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	groupFiles := "/api/v1/groups/" + uuid.NewString() + "/files"
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantError   string
+	}{
+		{"valid body", http.MethodPost, "/api/v1/auth/login", "application/json", `{"email":"a@example.com","password":"secret"}`, http.StatusNoContent, ""},
+		{"missing property", http.MethodPost, "/api/v1/auth/login", "application/json", `{"email":"a@example.com"}`, http.StatusBadRequest, "Invalid request body: password is required"},
+		{"wrong type", http.MethodPut, "/api/v1/admin/users/" + uuid.NewString() + "/admin", "application/json", `{"is_admin":"yes"}`, http.StatusBadRequest, "Invalid request body: is_admin: value must be a boolean"},
+		{"missing body", http.MethodPost, "/api/v1/groups", "application/json", ``, http.StatusBadRequest, "Request body is required"},
+		{"invalid enum", http.MethodPost, "/api/v1/groups/" + uuid.NewString() + "/members", "application/json", `{"user_id":"x","role":"owner"}`, http.StatusBadRequest, "Invalid request body: role: value is not one of the allowed values [\"admin\",\"member\"]"},
+		{"invalid query", http.MethodGet, "/api/v1/admin/users?limit=ten", "", "", http.StatusBadRequest, `Invalid query parameter "limit": an invalid integer`},
+		{"missing query", http.MethodGet, "/api/v1/auth/verify-email", "", "", http.StatusBadRequest, `Invalid query parameter "token": value is required`},
+		{"multipart upload", http.MethodPost, groupFiles, "multipart/form-data; boundary=x", "--x--", http.StatusNoContent, ""},
+		{"metadata filter", http.MethodGet, groupFiles + "?tag=a&tag=b&metadata[project]=apollo", "", "", http.StatusNoContent, ""},
+		{"metadata patch", http.MethodPatch, groupFiles + "/" + uuid.NewString() + "/metadata", "application/json", `{"project":"apollo","build":42,"draft":null}`, http.StatusNoContent, ""},
+		{"nested metadata", http.MethodPatch, groupFiles + "/" + uuid.NewString() + "/metadata", "application/json", `{"project":{"name":"apollo"}}`, http.StatusBadRequest, "Invalid request body: project: value must be one of string, number, boolean"},
+		{"thumbnail size", http.MethodGet, groupFiles + "/" + uuid.NewString() + "/thumbnail?size=large", "", "", http.StatusNoContent, ""},
+		{"undocumented path", http.MethodGet, "/api/v1/unknown", "", "", http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			rec := serve(h, tt.method, tt.path, tt.contentType, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantError == "" {
+				if !reached {
+					t.Error("handler was not reached")
+				}
+				return
+			}
+			if reached {
+				t.Error("handler was reached")
+			}
+			if msg := errorMessage(t, rec); msg != tt.wantError {
+				t.Errorf("error = %q, want %q", msg, tt.wantError)
+			}
+		})
+	}
+}
+
+// userRepo serves users by ID from a map
+type userRepo struct {
+	user.Repository
+	users map[uuid.UUID]*user.User
+}
+
+func (r *userRepo) GetByID(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func TestResponseValidation(t *testing.T) {
+	v := newValidator(t, true)
+	var mismatches []error
+	v.report = func(r *http.Request, err error) { mismatches = append(mismatches, err) }
+
+	// The auth handler's responses match the document
+	jwtService := auth.NewJWTService("test-secret-key-that-is-long-enough", 15*time.Minute, time.Hour, "test-issuer")
+	u := &user.User{ID: uuid.New(), Email: "alice@example.com", CreatedAt: time.Now()}
+	userService := user.NewService(&userRepo{users: map[uuid.UUID]*user.User{u.ID: u}}, nil, user.VerificationPolicyOff)
+	guard := lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{
+		Account: lockout.Policy{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, LockAfter: 10, LockoutDuration: time.Minute},
+		IP:      lockout.Policy{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, LockAfter: 10, LockoutDuration: time.Minute},
+		Window:  time.Hour,
+	})
+	authHandler := auth.NewHandler(auth.NewService(userService, jwtService, nil, guard, audit.Nop{}), userService, nil, guard, audit.Nop{})
+	refresh := v.Middleware(http.HandlerFunc(authHandler.Refresh))
+
+	pair, err := jwtService.GenerateUserTokenPair(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(refresh, http.MethodPost, "/api/v1/auth/refresh", "application/json", `{"refresh_token":"`+pair.RefreshToken+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("refresh: status = %d: %s", rec.Code, rec.Body)
+	}
+	rec = serve(refresh, http.MethodPost, "/api/v1/auth/refresh", "application/json", `{"refresh_token":"invalid"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("invalid refresh: status = %d: %s", rec.Code, rec.Body)
+	}
+	if len(mismatches) > 0 {
+		t.Fatalf("auth handler responses do not match: %v", errors.Join(mismatches...))
+	}
+
+	// A handler that drifts from the document is caught
+	drifted := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"` + uuid.NewString() + `","title":"Team"}`))
+	}))
+	rec = serve(drifted, http.MethodPost, "/api/v1/groups", "application/json", `{"name":"Team"}`)
+	if rec.Code != http.StatusInternalServerError || len(mismatches) != 1 {
+		t.Errorf("drifted response: status = %d, %d mismatches reported", rec.Code, len(mismatches))
+	}
+
+	// Every route must be documented
+	rec = serve(drifted, http.MethodGet, "/api/v1/unknown", "", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("undocumented route: status = %d", rec.Code)
+	}
+}
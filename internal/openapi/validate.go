@@ -0,0 +1,230 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// maxBodySize bounds the JSON request bodies read for validation. Uploads
+// are multipart and are not read.
+const maxBodySize = 1 << 20
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Validator checks requests against the document. In test mode it also
+// checks responses, replacing JSON responses that do not match with an
+// error.
+type Validator struct {
+	router    routers.Router
+	responses bool
+	report    func(r *http.Request, err error) // Called for responses that do not match
+}
+
+// NewValidator creates a validator for doc. validateResponses enables
+// test mode, which buffers JSON responses to check them.
+func NewValidator(doc *openapi3.T, validateResponses bool) (*Validator, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI router: %w", err)
+	}
+	return &Validator{router: router, responses: validateResponses, report: logMismatch}, nil
+}
+
+func logMismatch(r *http.Request, err error) {
+	log.Printf("Response to %s %s does not match the OpenAPI document: %v", r.Method, r.URL.Path, err)
+}
+
+// Middleware rejects requests whose parameters or JSON body do not match
+// the document. Requests for paths the document does not describe are
+// passed on, except in test mode, where every route must be documented.
+// Authentication is left to the handlers' own middleware.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			if v.responses && errors.Is(err, routers.ErrPathNotFound) {
+				v.report(r, err)
+				respondError(w, "Route is not documented", http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		jsonBody := isJSON(r.Header.Get("Content-Type"))
+		if jsonBody && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				ExcludeRequestBody: !jsonBody,
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respondError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			respondError(w, requestErrorMessage(err), http.StatusBadRequest)
+			return
+		}
+
+		if !v.responses {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		v.checkResponse(rec, input)
+	})
+}
+
+// checkResponse validates a recorded response. Buffered JSON responses are
+// then sent, or replaced with an error when they do not match; other
+// responses have already been sent, so only their status is checked and a
+// mismatch is reported.
+func (v *Validator) checkResponse(rec *responseRecorder, input *openapi3filter.RequestValidationInput) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	err := openapi3filter.ValidateResponse(input.Request.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 rec.status,
+		Header:                 rec.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(rec.body.Bytes())),
+		Options: &openapi3filter.Options{
+			ExcludeResponseBody:   !rec.buffering,
+			IncludeResponseStatus: true,
+		},
+	})
+	if err != nil {
+		v.report(input.Request, err)
+	}
+	if !rec.buffering {
+		return
+	}
+	if err != nil {
+		rec.Header().Del("Content-Length")
+		respondError(rec.ResponseWriter, "Response does not match the API document", http.StatusInternalServerError)
+		return
+	}
+	rec.ResponseWriter.WriteHeader(rec.status)
+	_, _ = rec.ResponseWriter.Write(rec.body.Bytes())
+}
+
+// responseRecorder holds back JSON responses until they are checked.
+// Other responses, such as downloads and event streams, pass straight
+// through.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buffering   bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status, rec.wroteHeader = status, true
+	rec.buffering = isJSON(rec.Header().Get("Content-Type"))
+	if !rec.buffering {
+		rec.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.buffering {
+		return rec.body.Write(p)
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher for streamed responses
+func (rec *responseRecorder) Flush() {
+	if rec.buffering {
+		return
+	}
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// requestErrorMessage describes a validation failure to the client
+func requestErrorMessage(err error) string {
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		return "Invalid request"
+	}
+	var schemaErr *openapi3.SchemaError
+	var parseErr *openapi3filter.ParseError
+	switch {
+	case reqErr.Parameter != nil:
+		msg := fmt.Sprintf("Invalid %s parameter %q", reqErr.Parameter.In, reqErr.Parameter.Name)
+		switch {
+		case errors.Is(err, openapi3filter.ErrInvalidRequired):
+			return msg + ": value is required"
+		case errors.As(err, &schemaErr):
+			return msg + ": " + schemaErr.Reason
+		case errors.As(err, &parseErr) && parseErr.Reason != "":
+			return msg + ": " + parseErr.Reason
+		}
+		return msg
+	case reqErr.RequestBody != nil:
+		switch {
+		case errors.Is(err, openapi3filter.ErrInvalidRequired):
+			return "Request body is required"
+		case errors.As(err, &schemaErr):
+			field := strings.Join(schemaErr.JSONPointer(), ".")
+			if schemaErr.SchemaField == "required" {
+				return fmt.Sprintf("Invalid request body: %s is required", field)
+			}
+			if field != "" {
+				return fmt.Sprintf("Invalid request body: %s: %s", field, schemaErr.Reason)
+			}
+			return "Invalid request body: " + schemaErr.Reason
+		}
+		return "Invalid request body"
+	}
+	return "Invalid request"
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+func respondError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+}
@@ -0,0 +1,12 @@
+package pagination
+
+import "strings"
+
+// likeEscaper escapes LIKE wildcards and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// EscapeLike escapes LIKE wildcards so user input used in a listing's
+// filter matches literally
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,113 @@
+// Package pagination implements keyset pagination for listings. A page
+// token records the sort key and ID of the last row returned, and the next
+// page starts after that row, so pages stay consistent while rows are added
+// or removed and deep pages cost no more than the first.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// Page sizes for API listings
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// NextPageHeader is the response header carrying the token for a listing's
+// next page. It is absent on the last page.
+const NextPageHeader = "X-Next-Page-Token"
+
+// Sort orders
+const (
+	Asc  = "asc"
+	Desc = "desc"
+)
+
+var (
+	ErrInvalidLimit = errors.New("invalid limit")
+	ErrInvalidToken = errors.New("invalid page token")
+	ErrInvalidSort  = errors.New("invalid sort")
+	ErrInvalidOrder = errors.New("invalid sort order")
+)
+
+// Token is the decoded form of a page token. It is only valid for the sort
+// it was issued for.
+type Token struct {
+	Sort string    `json:"s"`
+	Desc bool      `json:"d,omitempty"`
+	Key  string    `json:"k"` // The last row's sort key, as text
+	ID   uuid.UUID `json:"i"` // The last row's ID, which breaks ties
+}
+
+// Encode returns the token's opaque form
+func (t *Token) Encode() string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode parses a page token issued for the given sort and direction
+func Decode(s, sort string, desc bool) (*Token, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	t := &Token{}
+	if err := json.Unmarshal(b, t); err != nil || t.ID == uuid.Nil || t.Sort != sort || t.Desc != desc {
+		return nil, ErrInvalidToken
+	}
+	return t, nil
+}
+
+// Limit parses a limit query parameter. It defaults to DefaultLimit and is
+// capped at MaxLimit.
+func Limit(s string) (int, error) {
+	if s == "" {
+		return DefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 {
+		return 0, ErrInvalidLimit
+	}
+	return min(limit, MaxLimit), nil
+}
+
+// Descending resolves a requested order, which may be empty for the
+// sort's default
+func Descending(order string, defaultDesc bool) (bool, error) {
+	switch order {
+	case "":
+		return defaultDesc, nil
+	case Asc:
+		return false, nil
+	case Desc:
+		return true, nil
+	}
+	return false, ErrInvalidOrder
+}
+
+// After returns the condition selecting rows that sort after the token's
+// row when ordering by keyExpr then idExpr. The token's key and ID are
+// bound as parameters $n and $n+1.
+func After(keyExpr, idExpr string, desc bool, n int) string {
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	return fmt.Sprintf("(%s, %s) %s ($%d, $%d)", keyExpr, idExpr, op, n, n+1)
+}
+
+// OrderBy returns the ORDER BY list for sorting by keyExpr then idExpr
+func OrderBy(keyExpr, idExpr string, desc bool) string {
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("%s %s, %s %s", keyExpr, dir, idExpr, dir)
+}
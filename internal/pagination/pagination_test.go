@@ -0,0 +1,70 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	token := &Token{Sort: "name", Desc: true, Key: "report.pdf", ID: uuid.New()}
+	encoded := token.Encode()
+
+	decoded, err := Decode(encoded, "name", true)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if *decoded != *token {
+		t.Errorf("decoded = %+v, want %+v", decoded, token)
+	}
+
+	// A token only continues the listing it was issued for
+	if _, err := Decode(encoded, "size", true); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("other sort: err = %v", err)
+	}
+	if _, err := Decode(encoded, "name", false); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("other order: err = %v", err)
+	}
+	for _, s := range []string{"", "not base64!", "e30"} {
+		if _, err := Decode(s, "name", true); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Decode(%q): err = %v", s, err)
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"", DefaultLimit, false},
+		{"25", 25, false},
+		{"5000", MaxLimit, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"ten", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Limit(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Limit(%q) = %d, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestAfter(t *testing.T) {
+	if got := After("f.name", "f.id", false, 3); got != "(f.name, f.id) > ($3, $4)" {
+		t.Errorf("ascending: %s", got)
+	}
+	if got := After("f.size_bytes", "f.id", true, 2); got != "(f.size_bytes, f.id) < ($2, $3)" {
+		t.Errorf("descending: %s", got)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := EscapeLike(`50%_off\now`); got != `50\%\_off\\now` {
+		t.Errorf("EscapeLike() = %q", got)
+	}
+}
@@ -0,0 +1,69 @@
+// Package queue runs the background workers that drain database-backed job
+// queues, such as webhook deliveries and file indexing. Jobs are claimed in
+// batches with a lease, so any number of workers, in one or many replicas,
+// may drain the same queue, and a crashed worker's jobs are retried once
+// their lease runs out.
+package queue
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Runner claims due jobs and handles each batch concurrently
+type Runner[J any] struct {
+	Name         string        // What is claimed, for log messages, such as "index jobs"
+	BatchSize    int           // Jobs claimed and handled concurrently per poll
+	PollInterval time.Duration // Wait between polls when no jobs are due
+	Lease        time.Duration // How long a claimed job is held before it is due again
+
+	// Claim leases up to limit due jobs
+	Claim func(ctx context.Context, limit int, lease time.Duration) ([]J, error)
+	// Handle processes one job, recording its outcome
+	Handle func(ctx context.Context, job J)
+}
+
+// Run handles queued jobs until ctx is cancelled
+func (r *Runner[J]) Run(ctx context.Context) {
+	for {
+		jobs, err := r.Claim(ctx, r.BatchSize, r.Lease)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to claim %s: %v", r.Name, err)
+		}
+
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.Handle(ctx, job)
+			}()
+		}
+		wg.Wait()
+
+		// Keep draining while the queue is busy
+		if len(jobs) == r.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
+
+// Backoff returns the delay before retrying after the given number of
+// failed attempts: base, 2*base, 4*base, ... capped at max
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return min(delay, max)
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunner_DrainsQueue(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		pending = []int{1, 2, 3, 4, 5, 6, 7}
+		handled atomic.Int32
+		claims  atomic.Int32
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := &Runner[int]{
+		Name:         "test jobs",
+		BatchSize:    3,
+		PollInterval: time.Hour,
+		Lease:        time.Minute,
+		Claim: func(ctx context.Context, limit int, lease time.Duration) ([]int, error) {
+			claims.Add(1)
+			if lease != time.Minute {
+				t.Errorf("lease = %v, want 1m", lease)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			n := min(limit, len(pending))
+			jobs := pending[:n]
+			pending = pending[n:]
+			return jobs, nil
+		},
+		Handle: func(ctx context.Context, job int) {
+			if handled.Add(1) == 7 {
+				cancel()
+			}
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runner did not stop after its context was cancelled")
+	}
+
+	if handled.Load() != 7 {
+		t.Errorf("handled %d jobs, want 7", handled.Load())
+	}
+	// Full batches are followed by another claim without waiting for the
+	// poll interval
+	if claims.Load() != 3 {
+		t.Errorf("claimed %d times, want 3", claims.Load())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 30*time.Second, 10*time.Minute
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{6, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts, base, max); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	proxies, err := ParseProxies([]string{"10.0.0.0/8", "192.168.1.5", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "", "203.0.113.7:5000"},
+		{"spoofed from outside", "203.0.113.7:5000", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.7:5000"},
+		{"through a proxy", "10.1.2.3:443", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"spoofed through a proxy", "10.1.2.3:443", []string{"1.2.3.4, 198.51.100.1"}, "", "198.51.100.1"},
+		{"proxy chain", "192.168.1.5:443", []string{"198.51.100.1, 10.9.9.9"}, "", "198.51.100.1"},
+		{"split headers", "10.1.2.3:443", []string{"1.2.3.4", "198.51.100.1, 10.0.0.2"}, "", "198.51.100.1"},
+		{"only proxies", "10.1.2.3:443", []string{"10.0.0.9, 10.0.0.2"}, "", "10.0.0.9"},
+		{"malformed hop", "10.1.2.3:443", []string{"198.51.100.1, nonsense"}, "", "10.1.2.3:443"},
+		{"real IP header", "10.1.2.3:443", nil, "198.51.100.1", "198.51.100.1"},
+		{"IPv6 proxy", "[fd00::1]:443", []string{"2001:db8::1"}, "", "2001:db8::1"},
+		{"untrusted IPv6", "[2001:db8::2]:443", []string{"198.51.100.1"}, "", "[2001:db8::2]:443"},
+	}
+	for _, tt := range tests {
+		var got string
+		handler := Middleware(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.RemoteAddr
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if got != tt.want {
+			t.Errorf("%s: RemoteAddr = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	if _, err := ParseProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected an error for an invalid range")
+	}
+	if _, err := ParseProxies([]string{"proxy.internal"}); err == nil {
+		t.Error("expected an error for a host name")
+	}
+	if proxies, err := ParseProxies(nil); err != nil || len(proxies) != 0 {
+		t.Errorf("ParseProxies(nil) = %v, %v", proxies, err)
+	}
+}
@@ -0,0 +1,107 @@
+package s3gw
+
+import (
+	"context"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/pagination"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// backend is what the gateway needs from the services. Every call acts on
+// behalf of userID and fails with group.ErrNotMember outside the user's
+// groups.
+type backend interface {
+	ListGroups(ctx context.Context, userID uuid.UUID) ([]*group.Group, error)
+	// CheckMember reports whether the user may read the group
+	CheckMember(ctx context.Context, groupID, userID uuid.UUID) error
+	// CheckUpload reports whether the user may upload to the group
+	CheckUpload(ctx context.Context, groupID, userID uuid.UUID) error
+	ListFiles(ctx context.Context, groupID, userID uuid.UUID) ([]*file.File, error)
+	// Open returns a file's content after the first offset bytes
+	Open(ctx context.Context, fileID, userID uuid.UUID, offset int64) (io.ReadCloser, error)
+	Upload(ctx context.Context, input *file.UploadFileInput, body io.Reader) (*file.File, error)
+	Delete(ctx context.Context, fileID, userID uuid.UUID) error
+}
+
+// keyResolver resolves access keys to their owner and secret
+type keyResolver interface {
+	Resolve(ctx context.Context, accessKeyID string) (uuid.UUID, string, error)
+}
+
+// services implements backend with the API's services, so S3 requests get
+// the same permission checks, audit events and change notifications
+type services struct {
+	users  *user.Service
+	groups *group.Service
+	files  *file.Service
+}
+
+// ListGroups reads the user's groups a page at a time, so no single query
+// returns an unbounded number of rows
+func (s *services) ListGroups(ctx context.Context, userID uuid.UUID) ([]*group.Group, error) {
+	var groups []*group.Group
+	opts := &group.UserGroupsOptions{Limit: pagination.MaxLimit}
+	for {
+		page, err := s.groups.ListByUserID(ctx, userID, opts)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, page.Groups...)
+		if page.NextPageToken == "" {
+			return groups, nil
+		}
+		opts.PageToken = page.NextPageToken
+	}
+}
+
+func (s *services) CheckMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	isMember, err := s.groups.IsMember(ctx, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return group.ErrNotMember
+	}
+	return nil
+}
+
+func (s *services) CheckUpload(ctx context.Context, groupID, userID uuid.UUID) error {
+	if err := s.users.RequireVerifiedEmail(ctx, userID); err != nil {
+		return err
+	}
+	return s.CheckMember(ctx, groupID, userID)
+}
+
+// ListFiles reads the group's files a page at a time, like ListGroups
+func (s *services) ListFiles(ctx context.Context, groupID, userID uuid.UUID) ([]*file.File, error) {
+	var files []*file.File
+	opts := &file.ListOptions{Limit: pagination.MaxLimit}
+	for {
+		page, err := s.files.ListByGroupID(ctx, groupID, userID, opts)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, page.Files...)
+		if page.NextPageToken == "" {
+			return files, nil
+		}
+		opts.PageToken = page.NextPageToken
+	}
+}
+
+func (s *services) Open(ctx context.Context, fileID, userID uuid.UUID, offset int64) (io.ReadCloser, error) {
+	body, _, err := s.files.DownloadFrom(ctx, fileID, userID, offset)
+	return body, err
+}
+
+func (s *services) Upload(ctx context.Context, input *file.UploadFileInput, body io.Reader) (*file.File, error) {
+	return s.files.Upload(ctx, input, body)
+}
+
+func (s *services) Delete(ctx context.Context, fileID, userID uuid.UUID) error {
+	return s.files.Delete(ctx, fileID, userID)
+}
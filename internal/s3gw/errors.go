@@ -0,0 +1,88 @@
+package s3gw
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// apiError is an error in the form S3 clients expect, with an S3 error code
+type apiError struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+func (e *apiError) Error() string { return e.Message }
+
+// ErrUploadNotFound is returned by repositories for unknown multipart uploads
+var ErrUploadNotFound = errors.New("multipart upload not found")
+
+var (
+	errAnonymous              = &apiError{"AccessDenied", "Anonymous access is not allowed; sign requests with an access key", http.StatusForbidden}
+	errAccessDenied           = &apiError{"AccessDenied", "Access denied", http.StatusForbidden}
+	errAccountDisabled        = &apiError{"AccessDenied", "Account is disabled", http.StatusForbidden}
+	errEmailNotVerified       = &apiError{"AccessDenied", "Verify your email address to upload files", http.StatusForbidden}
+	errUnsupportedSignature   = &apiError{"InvalidRequest", "Only AWS Signature Version 4 (AWS4-HMAC-SHA256) is supported", http.StatusBadRequest}
+	errMalformedAuthorization = &apiError{"AuthorizationHeaderMalformed", "The authorization header or query parameters are malformed", http.StatusBadRequest}
+	errMissingContentSHA256   = &apiError{"InvalidRequest", "Missing required header x-amz-content-sha256", http.StatusBadRequest}
+	errInvalidAccessKeyID     = &apiError{"InvalidAccessKeyId", "The access key ID does not exist", http.StatusForbidden}
+	errSignatureMismatch      = &apiError{"SignatureDoesNotMatch", "The request signature does not match the signature calculated with your key", http.StatusForbidden}
+	errRequestTimeTooSkewed   = &apiError{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large", http.StatusForbidden}
+	errExpiredRequest         = &apiError{"AccessDenied", "Request has expired", http.StatusForbidden}
+	errContentSHA256Mismatch  = &apiError{"XAmzContentSHA256Mismatch", "The provided x-amz-content-sha256 does not match the content", http.StatusBadRequest}
+	errBadDigest              = &apiError{"BadDigest", "The content does not match the checksum you specified", http.StatusBadRequest}
+	errIncompleteBody         = &apiError{"IncompleteBody", "The request body does not match its declared length or encoding", http.StatusBadRequest}
+	errMissingContentLength   = &apiError{"MissingContentLength", "You must provide the Content-Length HTTP header", http.StatusLengthRequired}
+	errNoSuchBucket           = &apiError{"NoSuchBucket", "The specified bucket does not exist", http.StatusNotFound}
+	errNoSuchKey              = &apiError{"NoSuchKey", "The specified key does not exist", http.StatusNotFound}
+	errNoSuchUpload           = &apiError{"NoSuchUpload", "The specified multipart upload does not exist", http.StatusNotFound}
+	errInvalidPart            = &apiError{"InvalidPart", "One or more of the specified parts could not be found or its ETag does not match", http.StatusBadRequest}
+	errInvalidPartOrder       = &apiError{"InvalidPartOrder", "The list of parts was not in ascending order", http.StatusBadRequest}
+	errEntityTooSmall         = &apiError{"EntityTooSmall", "Every part but the last must be at least 5 MiB", http.StatusBadRequest}
+	errEntityTooLarge         = &apiError{"EntityTooLarge", "The object exceeds the maximum file size", http.StatusBadRequest}
+	errKeyTooLong             = &apiError{"KeyTooLongError", "Keys must be at most 255 bytes", http.StatusBadRequest}
+	errInvalidRange           = &apiError{"InvalidRange", "The requested range is not satisfiable", http.StatusRequestedRangeNotSatisfiable}
+	errPreconditionFailed     = &apiError{"PreconditionFailed", "At least one of the preconditions you specified did not hold", http.StatusPreconditionFailed}
+	errMalformedXML           = &apiError{"MalformedXML", "The XML you provided was not well-formed or did not validate", http.StatusBadRequest}
+	errInvalidArgument        = &apiError{"InvalidArgument", "Invalid argument", http.StatusBadRequest}
+	errMetadataRequired       = &apiError{"InvalidArgument", "The group requires metadata; upload the file through the API instead", http.StatusBadRequest}
+	errMethodNotAllowed       = &apiError{"MethodNotAllowed", "The specified method is not allowed against this resource", http.StatusMethodNotAllowed}
+	errNotImplemented         = &apiError{"NotImplemented", "This operation is not supported by the gateway", http.StatusNotImplemented}
+	errInternal               = &apiError{"InternalError", "We encountered an internal error; please try again", http.StatusInternalServerError}
+)
+
+// toAPIError maps an error from the services to an S3 error. Unexpected
+// errors map to errInternal and are reported as unexpected.
+func toAPIError(err error) (*apiError, bool) {
+	var apiErr *apiError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr, true
+	case errors.Is(err, group.ErrNotMember):
+		return errAccessDenied, true
+	case errors.Is(err, group.ErrGroupNotFound):
+		return errNoSuchBucket, true
+	case errors.Is(err, user.ErrAccountDisabled):
+		return errAccountDisabled, true
+	case errors.Is(err, user.ErrEmailNotVerified):
+		return errEmailNotVerified, true
+	case errors.Is(err, file.ErrFileNotFound):
+		return errNoSuchKey, true
+	case errors.Is(err, file.ErrFileTooLarge):
+		return errEntityTooLarge, true
+	case errors.Is(err, file.ErrNameTooLong):
+		return errKeyTooLong, true
+	case errors.Is(err, file.ErrMetadataRequired):
+		return errMetadataRequired, true
+	case errors.Is(err, file.ErrInvalidRange):
+		return errInvalidRange, true
+	case errors.Is(err, ErrUploadNotFound):
+		return errNoSuchUpload, true
+	default:
+		return errInternal, false
+	}
+}
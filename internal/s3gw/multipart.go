@@ -0,0 +1,364 @@
+package s3gw
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/file"
+)
+
+// Multipart upload limits, as in S3
+const (
+	maxPartNumber = 10000
+	minPartSize   = 5 << 20 // Every part but the last
+)
+
+// createMultipartUpload handles CreateMultipartUpload: POST /bucket/key?uploads
+func (s *Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, req *request) error {
+	if err := s.backend.CheckUpload(r.Context(), req.group.ID, req.userID); err != nil {
+		return err
+	}
+
+	u := &Upload{
+		ID:          uuid.New(),
+		GroupID:     req.group.ID,
+		UserID:      req.userID,
+		Key:         req.key,
+		ContentType: contentType(r, req.key),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repo.CreateUpload(r.Context(), u); err != nil {
+		return err
+	}
+
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   req.bucket,
+		Key:      req.key,
+		UploadID: u.ID.String(),
+	})
+	return nil
+}
+
+// upload returns the caller's multipart upload to the request's object
+func (s *Server) upload(ctx context.Context, req *request, uploadID string) (*Upload, error) {
+	id, err := uuid.Parse(uploadID)
+	if err != nil {
+		return nil, errNoSuchUpload
+	}
+	u, err := s.repo.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.GroupID != req.group.ID || u.Key != req.key || u.UserID != req.userID {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+// uploadPart handles UploadPart: PUT /bucket/key?partNumber=N&uploadId=ID.
+// The part is staged in storage; its ETag is the MD5 of its content.
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, req *request, uploadID string) error {
+	ctx := r.Context()
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		return errInvalidArgument
+	}
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		return errNotImplemented
+	}
+
+	u, err := s.upload(ctx, req, uploadID)
+	if err != nil {
+		return err
+	}
+	if err := s.backend.CheckUpload(ctx, req.group.ID, req.userID); err != nil {
+		return err
+	}
+
+	body, size, err := s.payload(r, req)
+	if err != nil {
+		return err
+	}
+	if size > file.MaxFileSize {
+		return errEntityTooLarge
+	}
+
+	sum := md5.New()
+	key := fmt.Sprintf("s3-multipart/%s/%d-%s", u.ID, partNumber, uuid.New())
+	if err := s.storage.Upload(ctx, key, io.TeeReader(body, sum), "application/octet-stream", size); err != nil {
+		if body.err != nil {
+			return body.err
+		}
+		return err
+	}
+
+	part := &Part{
+		UploadID:   u.ID,
+		PartNumber: partNumber,
+		SizeBytes:  size,
+		ETag:       hex.EncodeToString(sum.Sum(nil)),
+		StorageKey: key,
+		CreatedAt:  time.Now(),
+	}
+	replaced, err := s.repo.PutPart(ctx, part)
+	if err != nil {
+		s.deleteStaged(ctx, key)
+		return err
+	}
+	if replaced != "" {
+		s.deleteStaged(ctx, replaced)
+	}
+
+	w.Header().Set("ETag", `"`+part.ETag+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// completeMultipartUpload handles CompleteMultipartUpload:
+// POST /bucket/key?uploadId=ID. The listed parts are uploaded as one file,
+// which replaces any files with the same name.
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, req *request, uploadID string) error {
+	ctx := r.Context()
+	u, err := s.upload(ctx, req, uploadID)
+	if err != nil {
+		return err
+	}
+
+	body, _, err := s.payload(r, req)
+	if err != nil {
+		return err
+	}
+	var input completeMultipartUpload
+	if err := xml.NewDecoder(io.LimitReader(body, 2<<20)).Decode(&input); err != nil {
+		if body.err != nil {
+			return body.err
+		}
+		return errMalformedXML
+	}
+	if len(input.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	staged, err := s.repo.ListParts(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	byNumber := make(map[int]*Part, len(staged))
+	for _, p := range staged {
+		byNumber[p.PartNumber] = p
+	}
+
+	parts := make([]*Part, len(input.Parts))
+	var size int64
+	for i, in := range input.Parts {
+		if i > 0 && in.PartNumber <= input.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+		p := byNumber[in.PartNumber]
+		if p == nil || !strings.EqualFold(strings.Trim(in.ETag, `"`), p.ETag) {
+			return errInvalidPart
+		}
+		if i < len(input.Parts)-1 && p.SizeBytes < minPartSize {
+			return errEntityTooSmall
+		}
+		parts[i] = p
+		size += p.SizeBytes
+	}
+	if size > file.MaxFileSize {
+		return errEntityTooLarge
+	}
+
+	byKey, err := s.objects(ctx, req)
+	if err != nil {
+		return err
+	}
+	replaced := byKey[req.key]
+
+	content := &partsReader{ctx: ctx, storage: s.storage, parts: parts}
+	defer content.Close()
+	f, err := s.backend.Upload(ctx, inherit(&file.UploadFileInput{
+		Name:        u.Key,
+		ContentType: u.ContentType,
+		SizeBytes:   size,
+		GroupID:     u.GroupID,
+		UploadedBy:  req.userID,
+	}, replaced), content)
+	if err != nil {
+		return err
+	}
+
+	s.discard(ctx, u, staged)
+	s.deleteFiles(ctx, req, replaced)
+
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: "/" + req.bucket + "/" + req.key,
+		Bucket:   req.bucket,
+		Key:      req.key,
+		ETag:     etag(f),
+	})
+	return nil
+}
+
+// abortMultipartUpload handles AbortMultipartUpload:
+// DELETE /bucket/key?uploadId=ID
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *http.Request, req *request, uploadID string) error {
+	u, err := s.upload(r.Context(), req, uploadID)
+	if err != nil {
+		return err
+	}
+	parts, err := s.repo.ListParts(r.Context(), u.ID)
+	if err != nil {
+		return err
+	}
+	s.discard(r.Context(), u, parts)
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// listParts handles ListParts: GET /bucket/key?uploadId=ID
+func (s *Server) listParts(w http.ResponseWriter, r *http.Request, req *request, uploadID string) error {
+	query := r.URL.Query()
+	maxParts := maxListKeys
+	if v := query.Get("max-parts"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return errInvalidArgument
+		}
+		maxParts = min(n, maxListKeys)
+	}
+	marker := 0
+	if v := query.Get("part-number-marker"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return errInvalidArgument
+		}
+		marker = n
+	}
+
+	u, err := s.upload(r.Context(), req, uploadID)
+	if err != nil {
+		return err
+	}
+	parts, err := s.repo.ListParts(r.Context(), u.ID)
+	if err != nil {
+		return err
+	}
+
+	result := &listPartsResult{
+		Xmlns:            s3Namespace,
+		Bucket:           req.bucket,
+		Key:              req.key,
+		UploadID:         u.ID.String(),
+		PartNumberMarker: marker,
+		MaxParts:         maxParts,
+	}
+	for _, p := range parts {
+		if p.PartNumber <= marker {
+			continue
+		}
+		if len(result.Parts) == maxParts {
+			result.IsTruncated = true
+			break
+		}
+		result.Parts = append(result.Parts, partInfo{
+			PartNumber:   p.PartNumber,
+			LastModified: p.CreatedAt.UTC().Format(s3TimeFormat),
+			ETag:         `"` + p.ETag + `"`,
+			Size:         p.SizeBytes,
+		})
+		result.NextPartNumberMarker = p.PartNumber
+	}
+
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+// PruneUploads discards multipart uploads started before a time, which
+// clients abandoned without completing or aborting them. It returns how
+// many were discarded.
+func (s *Server) PruneUploads(ctx context.Context, before time.Time) (int, error) {
+	uploads, err := s.repo.ListUploadsBefore(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	for _, u := range uploads {
+		parts, err := s.repo.ListParts(ctx, u.ID)
+		if err != nil {
+			return 0, err
+		}
+		s.discard(ctx, u, parts)
+	}
+	return len(uploads), nil
+}
+
+// discard deletes an upload's record and its staged parts
+func (s *Server) discard(ctx context.Context, u *Upload, parts []*Part) {
+	if err := s.repo.DeleteUpload(ctx, u.ID); err != nil && !errors.Is(err, ErrUploadNotFound) {
+		log.Printf("Failed to delete multipart upload %s: %v", u.ID, err)
+		return
+	}
+	for _, p := range parts {
+		s.deleteStaged(ctx, p.StorageKey)
+	}
+}
+
+func (s *Server) deleteStaged(ctx context.Context, key string) {
+	if err := s.storage.Delete(ctx, key); err != nil {
+		log.Printf("Failed to delete staged part %s: %v", key, err)
+	}
+}
+
+// partsReader reads staged parts one after another, opening each as it
+// is reached
+type partsReader struct {
+	ctx     context.Context
+	storage file.Storage
+	parts   []*Part
+	current io.ReadCloser
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.current == nil {
+			if len(p.parts) == 0 {
+				return 0, io.EOF
+			}
+			body, err := p.storage.Download(p.ctx, p.parts[0].StorageKey)
+			if err != nil {
+				return 0, err
+			}
+			p.current, p.parts = body, p.parts[1:]
+		}
+		n, err := p.current.Read(b)
+		if err == io.EOF {
+			_ = p.current.Close()
+			p.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() {
+	if p.current != nil {
+		_ = p.current.Close()
+	}
+}
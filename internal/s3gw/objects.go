@@ -0,0 +1,597 @@
+package s3gw
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/testifysec/dropbox-clone/internal/file"
+)
+
+// s3TimeFormat is how S3 formats times in XML documents
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+// maxListKeys bounds the entries in one listing page, as S3 does
+const maxListKeys = 1000
+
+// listBuckets handles ListBuckets: GET /
+func (s *Server) listBuckets(w http.ResponseWriter, r *http.Request, req *request) error {
+	groups, err := s.backend.ListGroups(r.Context(), req.userID)
+	if err != nil {
+		return err
+	}
+
+	result := &listAllMyBucketsResult{
+		Xmlns:   s3Namespace,
+		Owner:   owner{ID: req.userID.String()},
+		Buckets: make([]bucket, len(groups)),
+	}
+	for i, g := range groups {
+		result.Buckets[i] = bucket{Name: bucketName(g), CreationDate: g.CreatedAt.UTC().Format(s3TimeFormat)}
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool { return result.Buckets[i].Name < result.Buckets[j].Name })
+
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+// objects returns a group's files by key. When several files share a name
+// the newest is the object; older ones are shadowed until it is deleted.
+func (s *Server) objects(ctx context.Context, req *request) (map[string][]*file.File, error) {
+	files, err := s.backend.ListFiles(ctx, req.group.ID, req.userID)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string][]*file.File)
+	for _, f := range files {
+		byKey[f.Name] = append(byKey[f.Name], f)
+	}
+	for _, versions := range byKey {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].CreatedAt.After(versions[j].CreatedAt) })
+	}
+	return byKey, nil
+}
+
+// listObjects handles ListObjects and ListObjectsV2: GET /bucket
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, req *request, v2 bool) error {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	maxKeys := maxListKeys
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return errInvalidArgument
+		}
+		maxKeys = min(n, maxListKeys)
+	}
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		return errInvalidArgument
+	}
+
+	// Listing resumes after the marker, a key or common prefix already sent
+	var marker string
+	if v2 {
+		marker = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				return errInvalidArgument
+			}
+			marker = string(decoded)
+		}
+	} else {
+		marker = query.Get("marker")
+	}
+
+	byKey, err := s.objects(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(byKey))
+	for key := range byKey {
+		if strings.HasPrefix(key, prefix) && key > marker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	encode := func(s string) string { return s }
+	if encodingType == "url" {
+		encode = url.QueryEscape
+	}
+	result := &listBucketResult{
+		Xmlns:        s3Namespace,
+		Name:         req.bucket,
+		Prefix:       encode(prefix),
+		Delimiter:    encode(delimiter),
+		EncodingType: encodingType,
+		MaxKeys:      maxKeys,
+	}
+
+	var last string // The last key or common prefix in the page
+	count := 0
+	for _, key := range keys {
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common := key[:len(prefix)+i+len(delimiter)]
+				if common <= marker || common == last {
+					continue
+				}
+				if count == maxKeys {
+					result.IsTruncated = true
+					break
+				}
+				result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: encode(common)})
+				last = common
+				count++
+				continue
+			}
+		}
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		f := byKey[key][0]
+		obj := object{
+			Key:          encode(key),
+			LastModified: f.CreatedAt.UTC().Format(s3TimeFormat),
+			ETag:         etag(f),
+			Size:         f.SizeBytes,
+			StorageClass: "STANDARD",
+		}
+		if !v2 || query.Get("fetch-owner") == "true" {
+			obj.Owner = &owner{ID: f.UploadedBy.String()}
+		}
+		result.Contents = append(result.Contents, obj)
+		last = key
+		count++
+	}
+
+	if v2 {
+		result.KeyCount = &count
+		result.StartAfter = encode(query.Get("start-after"))
+		result.ContinuationToken = query.Get("continuation-token")
+		if result.IsTruncated {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+		}
+	} else {
+		m := encode(marker)
+		result.Marker = &m
+		if result.IsTruncated && delimiter != "" {
+			result.NextMarker = encode(last)
+		}
+	}
+
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+// getObject handles GetObject and HeadObject: GET and HEAD /bucket/key
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, req *request, head bool) error {
+	byKey, err := s.objects(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	versions := byKey[req.key]
+	if len(versions) == 0 {
+		return errNoSuchKey
+	}
+	f := versions[0]
+
+	if status := checkPreconditions(r, f); status != 0 {
+		if status == http.StatusNotModified {
+			setObjectHeaders(w, f)
+			w.WriteHeader(status)
+			return nil
+		}
+		return errPreconditionFailed
+	}
+
+	start, length := int64(0), f.SizeBytes
+	partial := false
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && f.SizeBytes > 0 {
+		var ok bool
+		start, length, ok, err = parseRange(rangeHeader, f.SizeBytes)
+		if err != nil {
+			return err
+		}
+		partial = ok
+		if !ok {
+			start, length = 0, f.SizeBytes
+		}
+	}
+
+	var body io.ReadCloser
+	if !head {
+		body, err = s.backend.Open(r.Context(), f.ID, req.userID, start)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = body.Close() }()
+	}
+
+	setObjectHeaders(w, f)
+	// Presigned URLs may override response headers
+	query := r.URL.Query()
+	for param, header := range responseOverrides {
+		if v := query.Get(param); v != "" {
+			w.Header().Set(header, v)
+		}
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	status := http.StatusOK
+	if partial {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, f.SizeBytes))
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+
+	if !head {
+		if _, err := io.CopyN(w, body, length); err != nil {
+			log.Printf("S3 GetObject %s: copy failed: %v", f.ID, err)
+		}
+	}
+	return nil
+}
+
+// responseOverrides maps the query parameters that override response
+// headers to the headers
+var responseOverrides = map[string]string{
+	"response-content-type":        "Content-Type",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-encoding":    "Content-Encoding",
+	"response-content-language":    "Content-Language",
+	"response-cache-control":       "Cache-Control",
+	"response-expires":             "Expires",
+}
+
+func setObjectHeaders(w http.ResponseWriter, f *file.File) {
+	h := w.Header()
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	h.Set("ETag", etag(f))
+	h.Set("Last-Modified", f.CreatedAt.UTC().Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	// Uploaded content must never be rendered as an active document
+	h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	h.Set("X-Content-Type-Options", "nosniff")
+}
+
+// checkPreconditions evaluates conditional request headers, returning the
+// status that ends the request, or 0 to serve it
+func checkPreconditions(r *http.Request, f *file.File) int {
+	tag := etag(f)
+	modified := f.CreatedAt.UTC().Truncate(time.Second)
+
+	if v := r.Header.Get("If-Match"); v != "" && !etagMatches(v, tag) {
+		return http.StatusPreconditionFailed
+	}
+	if v := r.Header.Get("If-Unmodified-Since"); v != "" && r.Header.Get("If-Match") == "" {
+		if t, err := http.ParseTime(v); err == nil && modified.After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		if etagMatches(v, tag) {
+			return http.StatusNotModified
+		}
+	} else if v := r.Header.Get("If-Modified-Since"); v != "" {
+		if t, err := http.ParseTime(v); err == nil && !modified.After(t) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// etagMatches reports whether a list of ETags from a conditional header
+// includes tag
+func etagMatches(list, tag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange parses a single byte range against an object's size. It
+// returns ok false for ranges S3 ignores, such as multiple ranges.
+func parseRange(header string, size int64) (start, length int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	if first == "" {
+		// The last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 {
+			return 0, 0, false, errInvalidRange
+		}
+		n = min(n, size)
+		return size - n, n, true, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, false, errInvalidRange
+	}
+	return start, end - start + 1, true, nil
+}
+
+// putObject handles PutObject: PUT /bucket/key. The new file replaces any
+// files with the same name.
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, req *request) error {
+	ctx := r.Context()
+	if err := s.backend.CheckUpload(ctx, req.group.ID, req.userID); err != nil {
+		return err
+	}
+
+	body, size, err := s.payload(r, req)
+	if err != nil {
+		return err
+	}
+	if size > file.MaxFileSize {
+		return errEntityTooLarge
+	}
+
+	byKey, err := s.objects(ctx, req)
+	if err != nil {
+		return err
+	}
+	replaced := byKey[req.key]
+
+	f, err := s.backend.Upload(ctx, inherit(&file.UploadFileInput{
+		Name:        req.key,
+		ContentType: contentType(r, req.key),
+		SizeBytes:   size,
+		GroupID:     req.group.ID,
+		UploadedBy:  req.userID,
+	}, replaced), body)
+	if err != nil {
+		if body.err != nil {
+			return body.err
+		}
+		return err
+	}
+
+	s.deleteFiles(ctx, req, replaced)
+
+	w.Header().Set("ETag", etag(f))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// deleteObject handles DeleteObject: DELETE /bucket/key. Deleting a key
+// that does not exist succeeds, as in S3.
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, req *request) error {
+	byKey, err := s.objects(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	for _, f := range byKey[req.key] {
+		if err := s.backend.Delete(r.Context(), f.ID, req.userID); err != nil && !errors.Is(err, file.ErrFileNotFound) {
+			return err
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// deleteObjects handles DeleteObjects: POST /bucket?delete
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request, req *request) error {
+	body, _, err := s.payload(r, req)
+	if err != nil {
+		return err
+	}
+	var input deleteRequest
+	if err := xml.NewDecoder(io.LimitReader(body, 2<<20)).Decode(&input); err != nil {
+		if body.err != nil {
+			return body.err
+		}
+		return errMalformedXML
+	}
+	if len(input.Objects) == 0 || len(input.Objects) > maxListKeys {
+		return errMalformedXML
+	}
+
+	byKey, err := s.objects(r.Context(), req)
+	if err != nil {
+		return err
+	}
+
+	result := &deleteResult{Xmlns: s3Namespace}
+	for _, obj := range input.Objects {
+		var failed error
+		for _, f := range byKey[obj.Key] {
+			if err := s.backend.Delete(r.Context(), f.ID, req.userID); err != nil && !errors.Is(err, file.ErrFileNotFound) {
+				failed = err
+				break
+			}
+		}
+		if failed != nil {
+			apiErr, ok := toAPIError(failed)
+			if !ok {
+				log.Printf("S3 DeleteObjects %s: %v", obj.Key, failed)
+			}
+			result.Errors = append(result.Errors, deleteError{Key: obj.Key, Code: apiErr.Code, Message: apiErr.Message})
+			continue
+		}
+		delete(byKey, obj.Key)
+		if !input.Quiet {
+			result.Deleted = append(result.Deleted, deletedObject{Key: obj.Key})
+		}
+	}
+
+	writeXML(w, http.StatusOK, result)
+	return nil
+}
+
+// deleteFiles deletes files an upload replaced. Failures leave the old
+// files shadowed by the new one, so they are only logged.
+func (s *Server) deleteFiles(ctx context.Context, req *request, files []*file.File) {
+	for _, f := range files {
+		if err := s.backend.Delete(ctx, f.ID, req.userID); err != nil && !errors.Is(err, file.ErrFileNotFound) {
+			log.Printf("Failed to delete file %s replaced over S3: %v", f.ID, err)
+		}
+	}
+}
+
+// inherit gives an upload the tags and metadata of the newest version it
+// replaces, as the gateway does not map S3 object metadata to them
+func inherit(input *file.UploadFileInput, replaced []*file.File) *file.UploadFileInput {
+	if len(replaced) > 0 {
+		input.Tags, input.Metadata = replaced[0].Tags, replaced[0].Metadata
+	}
+	return input
+}
+
+// etag is an object's ETag. Files do not record an MD5 of their content,
+// so the ETag is derived from the file's ID, which changes whenever the
+// object is written. The "-1" suffix marks it as a multipart-style ETag,
+// so clients do not mistake it for an MD5 and fail their integrity checks.
+func etag(f *file.File) string {
+	return fmt.Sprintf(`"%x-1"`, f.ID[:])
+}
+
+// contentType is the content type for an uploaded object: as sent, or else
+// guessed from the key's extension. SDKs send a generic type when the
+// caller gives none, which counts as none.
+func contentType(r *http.Request, key string) string {
+	if v := r.Header.Get("Content-Type"); v != "" && v != "application/octet-stream" && v != "binary/octet-stream" {
+		return v
+	}
+	if v := mime.TypeByExtension(path.Ext(key)); v != "" {
+		return v
+	}
+	return "application/octet-stream"
+}
+
+// payload is a request body being decoded and verified. Verification
+// errors surface at the end of the body, and are kept in err because the
+// file service reports any failed upload as file.ErrUploadFailed.
+type payload struct {
+	r   io.Reader
+	err error
+}
+
+func (p *payload) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if err != nil && err != io.EOF && p.err == nil {
+		p.err = err
+	}
+	return n, err
+}
+
+// payload returns the request body, decoded from aws-chunked encoding if
+// need be and checked against the hashes and checksums the request
+// declares as it is read, along with its length
+func (s *Server) payload(r *http.Request, req *request) (*payload, int64, error) {
+	var body io.Reader = r.Body
+	size := r.ContentLength
+	var chunked *chunkedReader
+
+	switch hash := req.sig.payloadHash; hash {
+	case unsignedPayload:
+	case streamingPayload, streamingPayloadTrailer, streamingUnsignedTrailer:
+		decoded, err := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if err != nil || decoded < 0 {
+			return nil, 0, errMissingContentLength
+		}
+		sig := req.sig
+		if hash == streamingUnsignedTrailer {
+			sig = nil
+		}
+		chunked = newChunkedReader(r.Body, sig, req.secret, hash != streamingPayload, decoded)
+		body, size = chunked, decoded
+	default:
+		if len(hash) != sha256.Size*2 {
+			return nil, 0, errContentSHA256Mismatch
+		}
+		body = &hashReader{r: body, hash: sha256.New(), expected: strings.ToLower(hash)}
+	}
+	if size < 0 {
+		return nil, 0, errMissingContentLength
+	}
+
+	if v := r.Header.Get("Content-MD5"); v != "" {
+		body = &checksumReader{r: body, hash: md5.New(), expected: func() string { return v }}
+	}
+	for name, newHash := range checksumAlgorithms {
+		header := "x-amz-checksum-" + name
+		if v := r.Header.Get(header); v != "" {
+			body = &checksumReader{r: body, hash: newHash(), expected: func() string { return v }}
+		} else if chunked != nil && strings.EqualFold(r.Header.Get("X-Amz-Trailer"), header) {
+			body = &checksumReader{r: body, hash: newHash(), expected: func() string { return chunked.trailers.Get(header) }}
+		}
+	}
+
+	return &payload{r: body}, size, nil
+}
+
+// checksumAlgorithms are the x-amz-checksum-* algorithms that are checked.
+// Checksums with other algorithms are accepted unchecked.
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"crc32c": func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// checksumReader checks that the content it reads has the base64 checksum
+// expected, which for trailing checksums is only known at the end
+type checksumReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected func() string
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	if err == io.EOF && base64.StdEncoding.EncodeToString(c.hash.Sum(nil)) != c.expected() {
+		return n, errBadDigest
+	}
+	return n, err
+}
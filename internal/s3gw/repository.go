@@ -0,0 +1,158 @@
+package s3gw
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Repository defines the interface for multipart upload storage
+type Repository interface {
+	CreateUpload(ctx context.Context, u *Upload) error
+	GetUpload(ctx context.Context, id uuid.UUID) (*Upload, error)
+	// DeleteUpload removes an upload and its parts' records
+	DeleteUpload(ctx context.Context, id uuid.UUID) error
+	// ListUploadsBefore lists uploads started before a time, for expiry
+	ListUploadsBefore(ctx context.Context, before time.Time) ([]*Upload, error)
+	// PutPart records a part, returning the storage key of the part it
+	// replaces, if any
+	PutPart(ctx context.Context, p *Part) (string, error)
+	// ListParts lists an upload's parts by part number
+	ListParts(ctx context.Context, uploadID uuid.UUID) ([]*Part, error)
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const uploadColumns = `id, group_id, user_id, object_key, content_type, created_at`
+
+// CreateUpload inserts a new multipart upload
+func (r *PostgresRepository) CreateUpload(ctx context.Context, u *Upload) error {
+	query := `
+		INSERT INTO s3_multipart_uploads (id, group_id, user_id, object_key, content_type, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.ExecContext(ctx, query, u.ID, u.GroupID, u.UserID, u.Key, u.ContentType, u.CreatedAt)
+	return err
+}
+
+// GetUpload retrieves a multipart upload by ID
+func (r *PostgresRepository) GetUpload(ctx context.Context, id uuid.UUID) (*Upload, error) {
+	query := `SELECT ` + uploadColumns + ` FROM s3_multipart_uploads WHERE id = $1`
+	u, err := scanUpload(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	return u, nil
+}
+
+// DeleteUpload removes a multipart upload; its parts cascade
+func (r *PostgresRepository) DeleteUpload(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM s3_multipart_uploads WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUploadNotFound
+	}
+	return nil
+}
+
+// ListUploadsBefore lists multipart uploads started before a time
+func (r *PostgresRepository) ListUploadsBefore(ctx context.Context, before time.Time) ([]*Upload, error) {
+	query := `SELECT ` + uploadColumns + ` FROM s3_multipart_uploads WHERE created_at < $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var uploads []*Upload
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
+
+// PutPart inserts or replaces a part
+func (r *PostgresRepository) PutPart(ctx context.Context, p *Part) (string, error) {
+	query := `
+		WITH previous AS (
+			SELECT storage_key FROM s3_multipart_parts WHERE upload_id = $1 AND part_number = $2
+		)
+		INSERT INTO s3_multipart_parts (upload_id, part_number, size_bytes, etag, storage_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (upload_id, part_number) DO UPDATE
+		SET size_bytes = EXCLUDED.size_bytes, etag = EXCLUDED.etag,
+			storage_key = EXCLUDED.storage_key, created_at = EXCLUDED.created_at
+		RETURNING (SELECT storage_key FROM previous)
+	`
+	var replaced sql.NullString
+	err := r.db.QueryRowContext(ctx, query, p.UploadID, p.PartNumber, p.SizeBytes, p.ETag, p.StorageKey, p.CreatedAt).Scan(&replaced)
+	if err != nil {
+		// The upload was completed or aborted meanwhile
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return "", ErrUploadNotFound
+		}
+		return "", err
+	}
+	return replaced.String, nil
+}
+
+// ListParts lists a multipart upload's parts in part number order
+func (r *PostgresRepository) ListParts(ctx context.Context, uploadID uuid.UUID) ([]*Part, error) {
+	query := `
+		SELECT upload_id, part_number, size_bytes, etag, storage_key, created_at
+		FROM s3_multipart_parts WHERE upload_id = $1 ORDER BY part_number
+	`
+	rows, err := r.db.QueryContext(ctx, query, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var parts []*Part
+	for rows.Next() {
+		p := &Part{}
+		if err := rows.Scan(&p.UploadID, &p.PartNumber, &p.SizeBytes, &p.ETag, &p.StorageKey, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+	return parts, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUpload(row scanner) (*Upload, error) {
+	u := &Upload{}
+	if err := row.Scan(&u.ID, &u.GroupID, &u.UserID, &u.Key, &u.ContentType, &u.CreatedAt); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,710 @@
+package s3gw
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/accesskey"
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+)
+
+const (
+	testKeyID  = "DBXTESTKEY000000000"
+	testSecret = "test-secret-access-key"
+)
+
+// memBackend is an in-memory backend with one user in some groups
+type memBackend struct {
+	mu     sync.Mutex
+	userID uuid.UUID
+	groups []*group.Group
+	files  []*file.File
+	blobs  map[uuid.UUID][]byte
+}
+
+func newMemBackend(groupNames ...string) *memBackend {
+	b := &memBackend{userID: uuid.New(), blobs: make(map[uuid.UUID][]byte)}
+	for _, name := range groupNames {
+		b.groups = append(b.groups, &group.Group{ID: uuid.New(), Name: name, CreatedAt: time.Now()})
+	}
+	return b
+}
+
+func (b *memBackend) ListGroups(ctx context.Context, userID uuid.UUID) ([]*group.Group, error) {
+	if userID != b.userID {
+		return nil, nil
+	}
+	return b.groups, nil
+}
+
+func (b *memBackend) CheckMember(ctx context.Context, groupID, userID uuid.UUID) error {
+	for _, g := range b.groups {
+		if g.ID == groupID && userID == b.userID {
+			return nil
+		}
+	}
+	return group.ErrNotMember
+}
+
+func (b *memBackend) CheckUpload(ctx context.Context, groupID, userID uuid.UUID) error {
+	return b.CheckMember(ctx, groupID, userID)
+}
+
+func (b *memBackend) ListFiles(ctx context.Context, groupID, userID uuid.UUID) ([]*file.File, error) {
+	if err := b.CheckMember(ctx, groupID, userID); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var files []*file.File
+	for _, f := range b.files {
+		if f.GroupID == groupID {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (b *memBackend) Open(ctx context.Context, fileID, userID uuid.UUID, offset int64) (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.blobs[fileID]
+	if !ok {
+		return nil, file.ErrFileNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data[offset:])), nil
+}
+
+func (b *memBackend) Upload(ctx context.Context, input *file.UploadFileInput, body io.Reader) (*file.File, error) {
+	if err := b.CheckMember(ctx, input.GroupID, input.UploadedBy); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(body)
+	if err != nil || int64(len(data)) != input.SizeBytes {
+		return nil, file.ErrUploadFailed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f := &file.File{
+		ID:          uuid.New(),
+		Name:        input.Name,
+		SizeBytes:   input.SizeBytes,
+		ContentType: input.ContentType,
+		GroupID:     input.GroupID,
+		UploadedBy:  input.UploadedBy,
+		CreatedAt:   time.Now(),
+	}
+	b.files = append(b.files, f)
+	b.blobs[f.ID] = data
+	return f, nil
+}
+
+func (b *memBackend) Delete(ctx context.Context, fileID, userID uuid.UUID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, f := range b.files {
+		if f.ID == fileID {
+			b.files = append(b.files[:i], b.files[i+1:]...)
+			delete(b.blobs, fileID)
+			return nil
+		}
+	}
+	return file.ErrFileNotFound
+}
+
+// memStorage is an in-memory file.Storage for staged parts
+type memStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *memStorage) Upload(ctx context.Context, key string, body io.Reader, contentType string, size int64) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return errors.New("size mismatch")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.DownloadFrom(ctx, key, 0)
+}
+
+func (s *memStorage) DownloadFrom(ctx context.Context, key string, offset int64) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, errors.New("no such object")
+	}
+	return io.NopCloser(bytes.NewReader(data[offset:])), nil
+}
+
+func (s *memStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memStorage) GetURL(ctx context.Context, key string) (string, error) {
+	return "", errors.New("not supported")
+}
+
+// memRepo is an in-memory Repository
+type memRepo struct {
+	mu      sync.Mutex
+	uploads map[uuid.UUID]*Upload
+	parts   map[uuid.UUID]map[int]*Part
+}
+
+func (r *memRepo) CreateUpload(ctx context.Context, u *Upload) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uploads[u.ID] = u
+	r.parts[u.ID] = make(map[int]*Part)
+	return nil
+}
+
+func (r *memRepo) GetUpload(ctx context.Context, id uuid.UUID) (*Upload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.uploads[id]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+	return u, nil
+}
+
+func (r *memRepo) DeleteUpload(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.uploads[id]; !ok {
+		return ErrUploadNotFound
+	}
+	delete(r.uploads, id)
+	delete(r.parts, id)
+	return nil
+}
+
+func (r *memRepo) ListUploadsBefore(ctx context.Context, before time.Time) ([]*Upload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var uploads []*Upload
+	for _, u := range r.uploads {
+		if u.CreatedAt.Before(before) {
+			uploads = append(uploads, u)
+		}
+	}
+	return uploads, nil
+}
+
+func (r *memRepo) PutPart(ctx context.Context, p *Part) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parts, ok := r.parts[p.UploadID]
+	if !ok {
+		return "", ErrUploadNotFound
+	}
+	var replaced string
+	if old := parts[p.PartNumber]; old != nil {
+		replaced = old.StorageKey
+	}
+	parts[p.PartNumber] = p
+	return replaced, nil
+}
+
+func (r *memRepo) ListParts(ctx context.Context, uploadID uuid.UUID) ([]*Part, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var parts []*Part
+	for _, p := range r.parts[uploadID] {
+		parts = append(parts, p)
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// staticCredentials resolves the one test access key
+type staticCredentials struct {
+	userID uuid.UUID
+}
+
+func (c *staticCredentials) Resolve(ctx context.Context, accessKeyID string) (uuid.UUID, string, error) {
+	if accessKeyID != testKeyID {
+		return uuid.Nil, "", accesskey.ErrInvalidAccessKey
+	}
+	return c.userID, testSecret, nil
+}
+
+type testGateway struct {
+	backend *memBackend
+	storage *memStorage
+	repo    *memRepo
+	server  *Server
+	url     string
+}
+
+func newTestGateway(t *testing.T, groupNames ...string) *testGateway {
+	t.Helper()
+	b := newMemBackend(groupNames...)
+	gw := &testGateway{
+		backend: b,
+		storage: &memStorage{objects: make(map[string][]byte)},
+		repo:    &memRepo{uploads: make(map[uuid.UUID]*Upload), parts: make(map[uuid.UUID]map[int]*Part)},
+	}
+	gw.server = newServer("us-east-1", b, &staticCredentials{userID: b.userID}, gw.storage, gw.repo)
+	ts := httptest.NewServer(gw.server)
+	t.Cleanup(ts.Close)
+	gw.url = ts.URL
+	return gw
+}
+
+func (gw *testGateway) client(keyID, secret string) *s3.Client {
+	return s3.New(s3.Options{
+		BaseEndpoint: aws.String(gw.url),
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider(keyID, secret, ""),
+		UsePathStyle: true,
+	})
+}
+
+func (gw *testGateway) bucket(i int) string {
+	return bucketName(gw.backend.groups[i])
+}
+
+func apiCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func put(t *testing.T, c *s3.Client, bucket, key, content string) *s3.PutObjectOutput {
+	t.Helper()
+	out, err := c.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader(content),
+	})
+	if err != nil {
+		t.Fatalf("PutObject %s: %v", key, err)
+	}
+	return out
+}
+
+func get(t *testing.T, c *s3.Client, bucket, key string) string {
+	t.Helper()
+	out, err := c.GetObject(context.Background(), &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		t.Fatalf("GetObject %s: %v", key, err)
+	}
+	defer func() { _ = out.Body.Close() }()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return string(data)
+}
+
+func TestAuthentication(t *testing.T) {
+	gw := newTestGateway(t, "Team")
+	ctx := context.Background()
+
+	if _, err := gw.client(testKeyID, "wrong").ListBuckets(ctx, &s3.ListBucketsInput{}); apiCode(err) != "SignatureDoesNotMatch" {
+		t.Errorf("wrong secret: got %v, want SignatureDoesNotMatch", err)
+	}
+	if _, err := gw.client("DBXUNKNOWN000000000", testSecret).ListBuckets(ctx, &s3.ListBucketsInput{}); apiCode(err) != "InvalidAccessKeyId" {
+		t.Errorf("unknown key: got %v, want InvalidAccessKeyId", err)
+	}
+
+	resp, err := http.Get(gw.url + "/" + gw.bucket(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("anonymous request: got %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	gw := newTestGateway(t, "Team Photos!", "Finance")
+	c := gw.client(testKeyID, testSecret)
+	ctx := context.Background()
+
+	out, err := c.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		t.Fatalf("ListBuckets: %v", err)
+	}
+	var names []string
+	for _, b := range out.Buckets {
+		names = append(names, aws.ToString(b.Name))
+	}
+	want := []string{gw.bucket(1), gw.bucket(0)}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("buckets = %v, want %v", names, want)
+	}
+	if !strings.HasPrefix(gw.bucket(0), "team-photos-") {
+		t.Errorf("bucket name %q does not reflect the group name", gw.bucket(0))
+	}
+
+	// Buckets can also be named by group ID
+	put(t, c, gw.backend.groups[0].ID.String(), "a.txt", "by id")
+	if got := get(t, c, gw.bucket(0), "a.txt"); got != "by id" {
+		t.Errorf("content = %q", got)
+	}
+
+	if _, err := c.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(gw.bucket(1))}); err != nil {
+		t.Errorf("HeadBucket: %v", err)
+	}
+	_, err = c.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String("other-0123abcd")})
+	if apiCode(err) != "NoSuchBucket" {
+		t.Errorf("unknown bucket: got %v, want NoSuchBucket", err)
+	}
+}
+
+func TestPutGetHead(t *testing.T) {
+	gw := newTestGateway(t, "Team")
+	c := gw.client(testKeyID, testSecret)
+	ctx := context.Background()
+	bucket := gw.bucket(0)
+
+	first := put(t, c, bucket, "docs/readme.txt", "hello, world")
+	if got := get(t, c, bucket, "docs/readme.txt"); got != "hello, world" {
+		t.Errorf("content = %q", got)
+	}
+
+	out, err := c.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String("docs/readme.txt"),
+		Range:  aws.String("bytes=7-"),
+	})
+	if err != nil {
+		t.Fatalf("ranged GetObject: %v", err)
+	}
+	data, _ := io.ReadAll(out.Body)
+	_ = out.Body.Close()
+	if string(data) != "world" || aws.ToString(out.ContentRange) != "bytes 7-11/12" {
+		t.Errorf("range = %q (%s)", data, aws.ToString(out.ContentRange))
+	}
+
+	_, err = c.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String("docs/readme.txt"),
+		Range:  aws.String("bytes=20-"),
+	})
+	if apiCode(err) != "InvalidRange" {
+		t.Errorf("unsatisfiable range: got %v, want InvalidRange", err)
+	}
+
+	head, err := c.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String("docs/readme.txt")})
+	if err != nil {
+		t.Fatalf("HeadObject: %v", err)
+	}
+	if aws.ToInt64(head.ContentLength) != 12 || aws.ToString(head.ContentType) != "text/plain; charset=utf-8" {
+		t.Errorf("head = %d %s", aws.ToInt64(head.ContentLength), aws.ToString(head.ContentType))
+	}
+	if aws.ToString(head.ETag) != aws.ToString(first.ETag) {
+		t.Errorf("ETag = %s, want %s", aws.ToString(head.ETag), aws.ToString(first.ETag))
+	}
+
+	// Writing a key replaces the file
+	second := put(t, c, bucket, "docs/readme.txt", "replaced")
+	if aws.ToString(second.ETag) == aws.ToString(first.ETag) {
+		t.Error("ETag did not change")
+	}
+	if got := get(t, c, bucket, "docs/readme.txt"); got != "replaced" {
+		t.Errorf("content = %q", got)
+	}
+	if n := len(gw.backend.files); n != 1 {
+		t.Errorf("%d files, want 1", n)
+	}
+
+	_, err = c.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String("missing")})
+	var notFound *types.NotFound
+	if !errors.As(err, &notFound) {
+		t.Errorf("missing key: got %v, want NotFound", err)
+	}
+}
+
+func TestListObjectsV2(t *testing.T) {
+	gw := newTestGateway(t, "Team")
+	c := gw.client(testKeyID, testSecret)
+	ctx := context.Background()
+	bucket := gw.bucket(0)
+
+	for _, key := range []string{"a.txt", "dir/b.txt", "dir/c.txt", "dir/sub/d.txt", "e f.txt"} {
+		put(t, c, bucket, key, key)
+	}
+
+	out, err := c.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Delimiter: aws.String("/")})
+	if err != nil {
+		t.Fatalf("ListObjectsV2: %v", err)
+	}
+	var keys, prefixes []string
+	for _, o := range out.Contents {
+		keys = append(keys, aws.ToString(o.Key))
+	}
+	for _, p := range out.CommonPrefixes {
+		prefixes = append(prefixes, aws.ToString(p.Prefix))
+	}
+	if strings.Join(keys, ",") != "a.txt,e f.txt" || strings.Join(prefixes, ",") != "dir/" {
+		t.Errorf("keys = %v, prefixes = %v", keys, prefixes)
+	}
+
+	// Page through a prefix two entries at a time
+	paginator := s3.NewListObjectsV2Paginator(c, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String("dir/"),
+		MaxKeys: aws.Int32(2),
+	})
+	keys = nil
+	pages := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			t.Fatalf("page: %v", err)
+		}
+		pages++
+		for _, o := range page.Contents {
+			keys = append(keys, aws.ToString(o.Key))
+		}
+	}
+	if pages != 2 || strings.Join(keys, ",") != "dir/b.txt,dir/c.txt,dir/sub/d.txt" {
+		t.Errorf("%d pages of %v", pages, keys)
+	}
+}
+
+func TestDeleteObjects(t *testing.T) {
+	gw := newTestGateway(t, "Team")
+	c := gw.client(testKeyID, testSecret)
+	ctx := context.Background()
+	bucket := gw.bucket(0)
+
+	for _, key := range []string{"a", "b", "c"} {
+		put(t, c, bucket, key, key)
+	}
+
+	if _, err := c.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String("a")}); err != nil {
+		t.Fatalf("DeleteObject: %v", err)
+	}
+	if _, err := c.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String("a")}); err != nil {
+		t.Errorf("deleting a missing key: %v", err)
+	}
+
+	out, err := c.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &types.Delete{Objects: []types.ObjectIdentifier{{Key: aws.String("b")}, {Key: aws.String("c")}}},
+	})
+	if err != nil {
+		t.Fatalf("DeleteObjects: %v", err)
+	}
+	if len(out.Deleted) != 2 || len(out.Errors) != 0 {
+		t.Errorf("deleted %d, errors %d", len(out.Deleted), len(out.Errors))
+	}
+	if n := len(gw.backend.files); n != 0 {
+		t.Errorf("%d files remain", n)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	gw := newTestGateway(t, "Team")
+	c := gw.client(testKeyID, testSecret)
+	ctx := context.Background()
+	bucket := gw.bucket(0)
+
+	content := make([]byte, 11<<20)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	uploader := manager.NewUploader(c, func(u *manager.Uploader) { u.PartSize = minPartSize })
+	_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String("big.bin"),
+		Body:   io.NopCloser(bytes.NewReader(content)), // Not seekable, so streamed in parts
+	})
+	if err != nil {
+		t.Fatalf("multipart upload: %v", err)
+	}
+	if got := get(t, c, bucket, "big.bin"); got != string(content) {
+		t.Error("content differs")
+	}
+	if len(gw.repo.uploads) != 0 || len(gw.storage.objects) != 0 {
+		t.Errorf("%d uploads and %d parts left staged", len(gw.repo.uploads), len(gw.storage.objects))
+	}
+
+	// Parts other than the last must be at least 5 MiB
+	created, err := c.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String(bucket), Key: aws.String("small")})
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	var completed []types.CompletedPart
+	for i := int32(1); i <= 2; i++ {
+		part, err := c.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(bucket),
+			Key:        aws.String("small"),
+			UploadId:   created.UploadId,
+			PartNumber: aws.Int32(i),
+			Body:       strings.NewReader("tiny"),
+		})
+		if err != nil {
+			t.Fatalf("UploadPart: %v", err)
+		}
+		completed = append(completed, types.CompletedPart{PartNumber: aws.Int32(i), ETag: part.ETag})
+	}
+	_, err = c.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String("small"),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if apiCode(err) != "EntityTooSmall" {
+		t.Errorf("small parts: got %v, want EntityTooSmall", err)
+	}
+
+	parts, err := c.ListParts(ctx, &s3.ListPartsInput{Bucket: aws.String(bucket), Key: aws.String("small"), UploadId: created.UploadId})
+	if err != nil || len(parts.Parts) != 2 {
+		t.Fatalf("ListParts: %v", err)
+	}
+
+	_, err = c.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: aws.String(bucket), Key: aws.String("small"), UploadId: created.UploadId})
+	if err != nil {
+		t.Fatalf("AbortMultipartUpload: %v", err)
+	}
+	if len(gw.repo.uploads) != 0 || len(gw.storage.objects) != 0 {
+		t.Errorf("%d uploads and %d parts left after abort", len(gw.repo.uploads), len(gw.storage.objects))
+	}
+}
+
+func TestPresignedGet(t *testing.T) {
+	gw := newTestGateway(t, "Team")
+	c := gw.client(testKeyID, testSecret)
+	bucket := gw.bucket(0)
+	put(t, c, bucket, "shared.txt", "presigned")
+
+	presigned, err := s3.NewPresignClient(c).PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String("shared.txt"),
+	}, s3.WithPresignExpires(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(presigned.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(data) != "presigned" {
+		t.Errorf("got %d %q", resp.StatusCode, data)
+	}
+
+	resp, err = http.Get(strings.Replace(presigned.URL, "shared.txt", "other.txt", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("tampered URL: got %d, want 403", resp.StatusCode)
+	}
+}
+
+// TestChunkedSignatures checks aws-chunked decoding against the example in
+// the S3 documentation for STREAMING-AWS4-HMAC-SHA256-PAYLOAD
+func TestChunkedSignatures(t *testing.T) {
+	const secret = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+	sig := &signature{
+		scope:     "20130524/us-east-1/s3/aws4_request",
+		date:      "20130524",
+		region:    "us-east-1",
+		time:      time.Date(2013, 5, 24, 0, 0, 0, 0, time.UTC),
+		signature: "4f232c4386841ef735655705268965c44a0e4690baa4adea153f7db9fa80a0a9",
+	}
+	chunks := []struct {
+		size int
+		sig  string
+	}{
+		{65536, "ad80c730a21e5b8d04586a2213dd63b9a0e99e0e2307b0ade35a65485a288648"},
+		{1024, "0055627c9e194cb4542bae2aa5492e3c1575bbb81b612b7d234b86a503ef5497"},
+		{0, "b6c6ea8a5354eaf15b3cb7646744f4275b71ea724fed81ceb9323e279d449df9"},
+	}
+	var body bytes.Buffer
+	for _, c := range chunks {
+		fmt.Fprintf(&body, "%x;chunk-signature=%s\r\n%s\r\n", c.size, c.sig, strings.Repeat("a", c.size))
+	}
+	encoded := body.Bytes()
+
+	data, err := io.ReadAll(newChunkedReader(bytes.NewReader(encoded), sig, secret, false, 66560))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if string(data) != strings.Repeat("a", 66560) {
+		t.Errorf("decoded %d bytes", len(data))
+	}
+
+	tampered := bytes.Replace(encoded, []byte("aaaa\r\n0;"), []byte("aaab\r\n0;"), 1)
+	if _, err := io.ReadAll(newChunkedReader(bytes.NewReader(tampered), sig, secret, false, 66560)); err != errSignatureMismatch {
+		t.Errorf("tampered chunk: got %v, want %v", err, errSignatureMismatch)
+	}
+	if _, err := io.ReadAll(newChunkedReader(bytes.NewReader(encoded), sig, secret, false, 66000)); err != errIncompleteBody {
+		t.Errorf("wrong decoded length: got %v, want %v", err, errIncompleteBody)
+	}
+}
+
+// TestStreamingChecksums uploads over TLS, where SDKs stream content
+// unsigned in aws-chunked encoding with a trailing checksum
+func TestStreamingChecksums(t *testing.T) {
+	gw := newTestGateway(t, "Team")
+	ts := httptest.NewTLSServer(gw.server)
+	t.Cleanup(ts.Close)
+	c := s3.New(s3.Options{
+		BaseEndpoint: aws.String(ts.URL),
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider(testKeyID, testSecret, ""),
+		UsePathStyle: true,
+		HTTPClient:   ts.Client(),
+	})
+	bucket := gw.bucket(0)
+
+	_, err := c.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String("stream.txt"),
+		Body:              io.NopCloser(strings.NewReader("streamed content")),
+		ContentLength:     aws.Int64(16),
+		ChecksumAlgorithm: types.ChecksumAlgorithmCrc32c,
+	})
+	if err != nil {
+		t.Fatalf("PutObject: %v", err)
+	}
+	if got := get(t, c, bucket, "stream.txt"); got != "streamed content" {
+		t.Errorf("content = %q", got)
+	}
+}
@@ -0,0 +1,312 @@
+// Package s3gw serves users' groups through an S3-compatible API, for data
+// tools that only speak S3. Each group the caller belongs to is a bucket,
+// and each file an object keyed by its name. Requests are signed with AWS
+// Signature Version 4 using per-user access keys, and every read and write
+// goes through the file service.
+package s3gw
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+
+	"github.com/testifysec/dropbox-clone/internal/accesskey"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/group"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// Server serves the S3 API
+type Server struct {
+	region  string
+	backend backend
+	keys    keyResolver
+	storage file.Storage // Stages multipart upload parts
+	repo    Repository
+	now     func() time.Time
+}
+
+// NewServer creates an S3 gateway. Multipart upload parts are staged in
+// storage until the upload completes.
+func NewServer(region string, userService *user.Service, groupService *group.Service, fileService *file.Service,
+	accessKeys *accesskey.Service, storage file.Storage, repo Repository) *Server {
+	b := &services{users: userService, groups: groupService, files: fileService}
+	return newServer(region, b, accessKeys, storage, repo)
+}
+
+func newServer(region string, b backend, keys keyResolver, storage file.Storage, repo Repository) *Server {
+	return &Server{
+		region:  region,
+		backend: b,
+		keys:    keys,
+		storage: storage,
+		repo:    repo,
+		now:     time.Now,
+	}
+}
+
+// request is an authenticated request and what it addresses
+type request struct {
+	id     string
+	userID uuid.UUID
+	sig    *signature
+	secret string
+	bucket string       // As named by the client
+	group  *group.Group // The bucket's group; nil for service requests
+	key    string
+}
+
+// ServeHTTP authenticates and serves an S3 request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &request{id: middleware.GetReqID(r.Context())}
+	if req.id == "" {
+		req.id = uuid.NewString()
+	}
+	w.Header().Set("X-Amz-Request-Id", req.id)
+
+	if err := s.serve(w, r, req); err != nil {
+		s.writeError(w, r, req, err)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, req *request) error {
+	if err := s.authenticate(r, req); err != nil {
+		return err
+	}
+	ctx := context.WithValue(r.Context(), auth.UserIDKey, req.userID)
+	r = r.WithContext(ctx)
+
+	req.bucket, req.key = s.route(r)
+	if req.bucket == "" {
+		if r.Method != http.MethodGet {
+			return errMethodNotAllowed
+		}
+		return s.listBuckets(w, r, req)
+	}
+
+	g, err := s.resolveBucket(ctx, req.userID, req.bucket)
+	if err != nil {
+		return err
+	}
+	req.group = g
+
+	if req.key == "" {
+		return s.serveBucket(w, r, req)
+	}
+	if len(req.key) > 255 {
+		return errKeyTooLong
+	}
+	return s.serveObject(w, r, req)
+}
+
+// authenticate verifies the request's signature and identifies its signer
+func (s *Server) authenticate(r *http.Request, req *request) error {
+	sig, err := parseSignature(r, s.now())
+	if err != nil {
+		return err
+	}
+
+	userID, secret, err := s.keys.Resolve(r.Context(), sig.accessKeyID)
+	if err != nil {
+		if errors.Is(err, accesskey.ErrInvalidAccessKey) {
+			return errInvalidAccessKeyID
+		}
+		return err
+	}
+	if err := sig.verify(r, secret); err != nil {
+		return err
+	}
+
+	req.userID, req.sig, req.secret = userID, sig, secret
+	return nil
+}
+
+// bucketHost matches the first label of a virtual-hosted-style request's
+// host, which names the bucket
+var bucketHost = regexp.MustCompile(`^([a-z0-9-]*-[0-9a-f]{8}|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// route splits a request into bucket and key, for both path-style
+// (host/bucket/key) and virtual-hosted-style (bucket.host/key) requests
+func (s *Server) route(r *http.Request) (string, string) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if label, _, ok := strings.Cut(host, "."); ok && bucketHost.MatchString(label) {
+		return label, path
+	}
+
+	bucket, key, _ := strings.Cut(path, "/")
+	return bucket, key
+}
+
+// resolveBucket finds the caller's group a bucket name refers to. Buckets
+// are named by bucketName, or by group ID, which survives renames.
+func (s *Server) resolveBucket(ctx context.Context, userID uuid.UUID, name string) (*group.Group, error) {
+	groups, err := s.backend.ListGroups(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if name == bucketName(g) || name == g.ID.String() {
+			return g, nil
+		}
+	}
+	return nil, errNoSuchBucket
+}
+
+var nonBucketChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// bucketName names a group's bucket: its name reduced to the characters
+// bucket names allow, followed by the start of its ID to keep it unique
+func bucketName(g *group.Group) string {
+	name := strings.Trim(nonBucketChars.ReplaceAllString(strings.ToLower(g.Name), "-"), "-")
+	if len(name) > 54 {
+		name = strings.TrimRight(name[:54], "-")
+	}
+	if name == "" {
+		name = "group"
+	}
+	return name + "-" + g.ID.String()[:8]
+}
+
+// serveBucket dispatches requests on a bucket
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, req *request) error {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodHead:
+		w.Header().Set("X-Amz-Bucket-Region", s.region)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case http.MethodGet:
+		switch {
+		case query.Has("location"):
+			writeXML(w, http.StatusOK, &locationConstraint{Xmlns: s3Namespace, Region: s.locationConstraint()})
+			return nil
+		case query.Has("list-type"):
+			if query.Get("list-type") != "2" {
+				return errInvalidArgument
+			}
+			return s.listObjects(w, r, req, true)
+		case hasSubresource(query):
+			return errNotImplemented
+		default:
+			return s.listObjects(w, r, req, false)
+		}
+	case http.MethodPost:
+		if query.Has("delete") {
+			return s.deleteObjects(w, r, req)
+		}
+		return errNotImplemented
+	default:
+		// Buckets are groups, which are created and deleted through the API
+		return errNotImplemented
+	}
+}
+
+// serveObject dispatches requests on an object
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, req *request) error {
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if uploadID != "" && r.Method == http.MethodGet {
+			return s.listParts(w, r, req, uploadID)
+		}
+		if hasSubresource(query) {
+			return errNotImplemented
+		}
+		return s.getObject(w, r, req, r.Method == http.MethodHead)
+	case http.MethodPut:
+		if uploadID != "" {
+			return s.uploadPart(w, r, req, uploadID)
+		}
+		if hasSubresource(query) || r.Header.Get("X-Amz-Copy-Source") != "" {
+			return errNotImplemented
+		}
+		return s.putObject(w, r, req)
+	case http.MethodPost:
+		switch {
+		case query.Has("uploads"):
+			return s.createMultipartUpload(w, r, req)
+		case uploadID != "":
+			return s.completeMultipartUpload(w, r, req, uploadID)
+		default:
+			return errNotImplemented
+		}
+	case http.MethodDelete:
+		if uploadID != "" {
+			return s.abortMultipartUpload(w, r, req, uploadID)
+		}
+		if hasSubresource(query) {
+			return errNotImplemented
+		}
+		return s.deleteObject(w, r, req)
+	default:
+		return errMethodNotAllowed
+	}
+}
+
+// hasSubresource reports whether a query addresses a subresource, such as
+// ?acl or ?tagging, rather than only passing parameters
+func hasSubresource(query map[string][]string) bool {
+	for name := range query {
+		switch {
+		case strings.HasPrefix(name, "X-Amz-"), strings.HasPrefix(name, "x-amz-"),
+			strings.HasPrefix(name, "response-"), name == "x-id":
+		case name == "prefix", name == "delimiter", name == "max-keys", name == "marker",
+			name == "encoding-type", name == "continuation-token", name == "start-after",
+			name == "fetch-owner", name == "list-type":
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// locationConstraint is the bucket location S3 reports for the region,
+// which is empty for us-east-1
+func (s *Server) locationConstraint() string {
+	if s.region == "us-east-1" {
+		return ""
+	}
+	return s.region
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+// writeError responds with an S3 error document. Errors that are not S3
+// errors are logged and reported as internal errors.
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, req *request, err error) {
+	apiErr, ok := toAPIError(err)
+	if !ok {
+		log.Printf("S3 %s %s: %v", r.Method, r.URL.Path, err)
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(apiErr.Status)
+		return
+	}
+	writeXML(w, apiErr.Status, &errorResponse{
+		Code:      apiErr.Code,
+		Message:   apiErr.Message,
+		Resource:  r.URL.Path,
+		RequestID: req.id,
+	})
+}
@@ -0,0 +1,524 @@
+package s3gw
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4 constants
+const (
+	sigAlgorithm   = "AWS4-HMAC-SHA256"
+	sigTimeFormat  = "20060102T150405Z"
+	sigDateFormat  = "20060102"
+	sigService     = "s3"
+	sigTerminator  = "aws4_request"
+	maxClockSkew   = 15 * time.Minute
+	maxPresignTime = 7 * 24 * time.Hour
+
+	// Values of x-amz-content-sha256 other than the payload's hash
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingPayloadTrailer  = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// signature is the SigV4 signature of a request, from its Authorization
+// header or, for presigned URLs, its query string
+type signature struct {
+	accessKeyID   string
+	scope         string // date/region/s3/aws4_request
+	date          string
+	region        string
+	time          time.Time
+	signedHeaders []string
+	signature     string
+	payloadHash   string // As declared by the client
+	presigned     bool
+}
+
+// parseSignature reads the signature of a request and checks that it is
+// current. It does not verify the signature, which needs the secret.
+func parseSignature(r *http.Request, now time.Time) (*signature, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "" {
+		return parsePresigned(query, now)
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, errAnonymous
+	}
+	algorithm, params, ok := strings.Cut(header, " ")
+	if !ok || algorithm != sigAlgorithm {
+		return nil, errUnsupportedSignature
+	}
+
+	sig := &signature{}
+	var credential, signedHeaders string
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case "Credential":
+			credential = value
+		case "SignedHeaders":
+			signedHeaders = value
+		case "Signature":
+			sig.signature = value
+		}
+	}
+	if credential == "" || signedHeaders == "" || sig.signature == "" {
+		return nil, errMalformedAuthorization
+	}
+	if err := sig.parseCredential(credential); err != nil {
+		return nil, err
+	}
+	sig.signedHeaders = strings.Split(signedHeaders, ";")
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if amzDate == "" {
+		amzDate = r.Header.Get("Date")
+	}
+	t, err := time.Parse(sigTimeFormat, amzDate)
+	if err != nil {
+		return nil, errMalformedAuthorization
+	}
+	sig.time = t
+	if t.Format(sigDateFormat) != sig.date {
+		return nil, errMalformedAuthorization
+	}
+	if now.Sub(t) > maxClockSkew || t.Sub(now) > maxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+
+	sig.payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+	if sig.payloadHash == "" {
+		return nil, errMissingContentSHA256
+	}
+	return sig, nil
+}
+
+// parsePresigned reads a signature from a presigned URL's query string
+func parsePresigned(query url.Values, now time.Time) (*signature, error) {
+	if query.Get("X-Amz-Algorithm") != sigAlgorithm {
+		return nil, errUnsupportedSignature
+	}
+	sig := &signature{
+		signature:   query.Get("X-Amz-Signature"),
+		payloadHash: unsignedPayload,
+		presigned:   true,
+	}
+	if sig.signature == "" || query.Get("X-Amz-SignedHeaders") == "" {
+		return nil, errMalformedAuthorization
+	}
+	if err := sig.parseCredential(query.Get("X-Amz-Credential")); err != nil {
+		return nil, err
+	}
+	sig.signedHeaders = strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+
+	t, err := time.Parse(sigTimeFormat, query.Get("X-Amz-Date"))
+	if err != nil || t.Format(sigDateFormat) != sig.date {
+		return nil, errMalformedAuthorization
+	}
+	sig.time = t
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 1 || time.Duration(expires)*time.Second > maxPresignTime {
+		return nil, errMalformedAuthorization
+	}
+	if t.Sub(now) > maxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+	if now.After(t.Add(time.Duration(expires) * time.Second)) {
+		return nil, errExpiredRequest
+	}
+	return sig, nil
+}
+
+// parseCredential reads an access key ID and scope from
+// "AKID/20060102/region/s3/aws4_request"
+func (s *signature) parseCredential(credential string) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[3] != sigService || parts[4] != sigTerminator {
+		return errMalformedAuthorization
+	}
+	s.accessKeyID, s.date, s.region = parts[0], parts[1], parts[2]
+	s.scope = strings.Join(parts[1:], "/")
+	return nil
+}
+
+// verify checks the signature against the request, signed with secret.
+// The request's body is not read; its hash is checked as it is read.
+func (s *signature) verify(r *http.Request, secret string) error {
+	key := signingKey(secret, s.date, s.region)
+
+	headers, err := s.canonicalHeaders(r)
+	if err != nil {
+		return err
+	}
+	query := canonicalQuery(r.URL.Query(), s.presigned)
+
+	// S3 signs the path as sent, without normalizing it. Accept the strict
+	// RFC 3986 encoding too, for clients that send a looser one.
+	paths := []string{r.URL.EscapedPath()}
+	if strict := uriEncode(r.URL.Path, false); strict != paths[0] {
+		paths = append(paths, strict)
+	}
+	for _, path := range paths {
+		canonical := strings.Join([]string{
+			r.Method,
+			path,
+			query,
+			headers,
+			strings.Join(s.signedHeaders, ";"),
+			s.payloadHash,
+		}, "\n")
+		if hmac.Equal([]byte(s.sign(key, canonical)), []byte(s.signature)) {
+			return nil
+		}
+	}
+	return errSignatureMismatch
+}
+
+// sign computes the signature of a canonical request
+func (s *signature) sign(key []byte, canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := sigAlgorithm + "\n" + s.time.Format(sigTimeFormat) + "\n" + s.scope + "\n" + hex.EncodeToString(sum[:])
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func (s *signature) canonicalHeaders(r *http.Request) (string, error) {
+	var b strings.Builder
+	hasHost := false
+	for _, name := range s.signedHeaders {
+		var values []string
+		switch name {
+		case "host":
+			hasHost = true
+			values = []string{r.Host}
+		case "content-length":
+			values = r.Header.Values("Content-Length")
+			if len(values) == 0 && r.ContentLength >= 0 {
+				values = []string{strconv.FormatInt(r.ContentLength, 10)}
+			}
+		case "transfer-encoding":
+			values = r.TransferEncoding
+		default:
+			values = r.Header.Values(name)
+		}
+		b.WriteString(name)
+		b.WriteByte(':')
+		for i, v := range values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strings.Join(strings.Fields(v), " "))
+		}
+		b.WriteByte('\n')
+	}
+	if !hasHost {
+		return "", errMalformedAuthorization
+	}
+	return b.String(), nil
+}
+
+// canonicalQuery encodes query parameters sorted by name, then value
+func canonicalQuery(query url.Values, presigned bool) string {
+	var params [][2]string
+	for name, values := range query {
+		if presigned && name == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range values {
+			params = append(params, [2]string{uriEncode(name, true), uriEncode(v, true)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	encoded := make([]string, len(params))
+	for i, p := range params {
+		encoded[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+// uriEncode percent-encodes everything but RFC 3986 unreserved characters,
+// as SigV4 requires, optionally leaving slashes as they are
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func signingKey(secret, date, region string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, sigService)
+	return hmacSHA256(key, sigTerminator)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// hashReader checks that the content it reads has the SHA-256 the request
+// declared, failing the final read otherwise
+type hashReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func (h *hashReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(h.hash.Sum(nil)) != h.expected {
+		return n, errContentSHA256Mismatch
+	}
+	return n, err
+}
+
+// chunkedReader decodes an aws-chunked body, in which each chunk may carry
+// a signature chained from the request's, and trailing headers may follow
+// the last chunk.
+type chunkedReader struct {
+	r         *bufio.Reader
+	sig       *signature // nil for unsigned chunks
+	key       []byte
+	prevSig   string
+	trailer   bool // Trailing headers follow the last chunk
+	trailers  http.Header
+	inChunk   bool  // A chunk's data has been started
+	remaining int64 // Unread bytes in the current chunk
+	chunkSig  string
+	chunkHash hash.Hash
+	total     int64
+	expected  int64 // The decoded length the request declared
+	err       error
+}
+
+// maxChunkHeader bounds a chunk header line, which is at most a size, a
+// 64-character signature and some punctuation
+const maxChunkHeader = 4096
+
+func newChunkedReader(body io.Reader, sig *signature, secret string, trailer bool, decodedLength int64) *chunkedReader {
+	c := &chunkedReader{
+		r:        bufio.NewReader(body),
+		trailer:  trailer,
+		trailers: http.Header{},
+		expected: decodedLength,
+	}
+	if sig != nil {
+		c.sig = sig
+		c.key = signingKey(secret, sig.date, sig.region)
+		c.prevSig = sig.signature
+		c.chunkHash = sha256.New()
+	}
+	return c
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.remaining == 0 {
+		if err := c.nextChunk(); err != nil {
+			c.err = err
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	c.total += int64(n)
+	if c.chunkHash != nil {
+		c.chunkHash.Write(p[:n])
+	}
+	if err == io.EOF {
+		err = errIncompleteBody
+	}
+	if err != nil {
+		c.err = err
+	} else if c.total > c.expected {
+		c.err = errIncompleteBody
+		err = c.err
+	}
+	return n, err
+}
+
+// nextChunk finishes the current chunk, if any, and starts the next. At the
+// last chunk it reads the trailers and returns io.EOF.
+func (c *chunkedReader) nextChunk() error {
+	if c.inChunk {
+		if err := c.finishChunk(); err != nil {
+			return err
+		}
+		c.inChunk = false
+	}
+
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	sizeHex, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeHex), 16, 64)
+	if err != nil || size < 0 {
+		return errIncompleteBody
+	}
+	if c.sig != nil {
+		sig, ok := strings.CutPrefix(ext, "chunk-signature=")
+		if !ok {
+			return errSignatureMismatch
+		}
+		c.chunkSig = sig
+		c.chunkHash.Reset()
+	}
+	c.remaining = size
+
+	if size > 0 {
+		c.inChunk = true
+		return nil
+	}
+
+	// The last chunk is empty
+	if err := c.checkChunkSignature(); err != nil {
+		return err
+	}
+	if c.trailer {
+		if err := c.readTrailers(); err != nil {
+			return err
+		}
+	} else if line, err := c.readLine(); err != nil || line != "" {
+		return errIncompleteBody
+	}
+	if c.total != c.expected {
+		return errIncompleteBody
+	}
+	return io.EOF
+}
+
+// finishChunk reads the line end after a chunk's data and checks the
+// chunk's signature
+func (c *chunkedReader) finishChunk() error {
+	if line, err := c.readLine(); err != nil || line != "" {
+		return errIncompleteBody
+	}
+	return c.checkChunkSignature()
+}
+
+func (c *chunkedReader) checkChunkSignature() error {
+	if c.sig == nil {
+		return nil
+	}
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256-PAYLOAD",
+		c.sig.time.Format(sigTimeFormat),
+		c.sig.scope,
+		c.prevSig,
+		emptySHA256,
+		hex.EncodeToString(c.chunkHash.Sum(nil)),
+	}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(c.key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(c.chunkSig)) {
+		return errSignatureMismatch
+	}
+	c.prevSig = c.chunkSig
+	return nil
+}
+
+// readTrailers reads the headers after the last chunk, and checks their
+// signature when chunks are signed
+func (c *chunkedReader) readTrailers() error {
+	var canonical bytes.Buffer
+	var trailerSig string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return errIncompleteBody
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "x-amz-trailer-signature" {
+			trailerSig = value
+			continue
+		}
+		c.trailers.Add(name, value)
+		canonical.WriteString(name + ":" + value + "\n")
+	}
+
+	if c.sig == nil {
+		return nil
+	}
+	sum := sha256.Sum256(canonical.Bytes())
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256-TRAILER",
+		c.sig.time.Format(sigTimeFormat),
+		c.sig.scope,
+		c.prevSig,
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(c.key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(trailerSig)) {
+		return errSignatureMismatch
+	}
+	return nil
+}
+
+// readLine reads a CRLF-terminated line, without the line end
+func (c *chunkedReader) readLine() (string, error) {
+	var line []byte
+	for {
+		fragment, isPrefix, err := c.r.ReadLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", errIncompleteBody
+			}
+			return "", err
+		}
+		line = append(line, fragment...)
+		if len(line) > maxChunkHeader {
+			return "", errIncompleteBody
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
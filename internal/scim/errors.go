@@ -0,0 +1,15 @@
+package scim
+
+import "errors"
+
+var (
+	ErrNotFound        = errors.New("resource not found")
+	ErrUniqueness      = errors.New("resource already exists")
+	ErrInvalidFilter   = errors.New("invalid filter")
+	ErrInvalidPath     = errors.New("invalid path")
+	ErrInvalidValue    = errors.New("invalid value")
+	ErrInvalidSyntax   = errors.New("invalid request syntax")
+	ErrNoTarget        = errors.New("no target for path")
+	ErrMutability      = errors.New("attribute is read-only")
+	ErrUnauthenticated = errors.New("invalid SCIM bearer token")
+)
@@ -0,0 +1,489 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter is a parsed SCIM filter expression (RFC 7644 section 3.4.2.2).
+//
+// Logical nodes ("and", "or", "not") use Left and Right. Comparison nodes
+// use Attr and Value; "pr" has no value. Value paths such as
+// emails[type eq "work"] set Attr to the multi-valued attribute and Sub to
+// the filter applied to each of its entries.
+type Filter struct {
+	Op    string
+	Attr  string
+	Value interface{} // string, bool, float64 or nil
+	Left  *Filter
+	Right *Filter
+	Sub   *Filter
+}
+
+// Path is a parsed PATCH operation path such as members[value eq "id"] or
+// name.formatted
+type Path struct {
+	Attr   string  // Top-level attribute, lower-cased
+	Filter *Filter // Optional value filter on a multi-valued attribute
+	Sub    string  // Optional sub-attribute, lower-cased
+}
+
+var comparisonOps = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// ParseFilter parses a filter expression
+func ParseFilter(s string) (*Filter, error) {
+	p, err := newParser(s)
+	if err != nil {
+		return nil, err
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.peek().text)
+	}
+	return f, nil
+}
+
+// ParsePath parses a PATCH operation path
+func ParsePath(s string) (*Path, error) {
+	p, err := newParser(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPath, s)
+	}
+	tok := p.next()
+	if tok.kind != tokenWord {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPath, s)
+	}
+	path := &Path{}
+	path.Attr, path.Sub = splitAttr(tok.text)
+
+	if p.peek().kind == tokenLBracket {
+		if path.Sub != "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPath, s)
+		}
+		p.next()
+		if path.Filter, err = p.parseOr(); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPath, s)
+		}
+		if p.next().kind != tokenRBracket {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPath, s)
+		}
+		// A sub-attribute may follow the closing bracket, e.g. emails[type eq "work"].value
+		if tok := p.peek(); tok.kind == tokenWord && strings.HasPrefix(tok.text, ".") {
+			p.next()
+			path.Sub = strings.ToLower(tok.text[1:])
+		}
+	}
+	if !p.done() || path.Attr == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPath, s)
+	}
+	return path, nil
+}
+
+// Equality reports whether the filter is a single case-insensitive equality
+// test on a string attribute, which callers can push down to the database
+func (f *Filter) Equality() (attr, value string, ok bool) {
+	if f == nil || f.Op != "eq" || f.Sub != nil {
+		return "", "", false
+	}
+	value, ok = f.Value.(string)
+	return f.Attr, value, ok
+}
+
+// Matches evaluates the filter against a resource. The resource is matched
+// through its JSON representation, so attribute names follow the SCIM
+// schema and are compared case-insensitively.
+func (f *Filter) Matches(resource interface{}) bool {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return false
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	return f.eval(doc)
+}
+
+func (f *Filter) eval(doc map[string]interface{}) bool {
+	switch f.Op {
+	case "and":
+		return f.Left.eval(doc) && f.Right.eval(doc)
+	case "or":
+		return f.Left.eval(doc) || f.Right.eval(doc)
+	case "not":
+		return !f.Left.eval(doc)
+	}
+
+	if f.Sub != nil {
+		for _, v := range resolve(doc, f.Attr) {
+			if entry, ok := v.(map[string]interface{}); ok && f.Sub.eval(entry) {
+				return true
+			}
+		}
+		return false
+	}
+
+	values := lookup(doc, f.Attr)
+	switch f.Op {
+	case "pr":
+		for _, v := range values {
+			if v != nil && v != "" {
+				return true
+			}
+		}
+		return false
+	case "ne":
+		for _, v := range values {
+			if compare("eq", v, f.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if compare(f.Op, v, f.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the values of an attribute for comparison. An unqualified
+// path against a multi-valued complex attribute matches its "value"
+// sub-attribute, so emails eq "x" works like emails.value eq "x".
+func lookup(doc map[string]interface{}, attr string) []interface{} {
+	current := resolve(doc, attr)
+	values := make([]interface{}, 0, len(current))
+	for _, v := range current {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = m["value"]
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// resolve walks a dotted attribute path, flattening multi-valued attributes
+func resolve(doc map[string]interface{}, attr string) []interface{} {
+	current := []interface{}{doc}
+	for _, part := range strings.Split(attr, ".") {
+		var next []interface{}
+		for _, c := range current {
+			m, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for k, v := range m {
+				if !strings.EqualFold(k, part) {
+					continue
+				}
+				if list, ok := v.([]interface{}); ok {
+					next = append(next, list...)
+				} else {
+					next = append(next, v)
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+func compare(op string, actual, expected interface{}) bool {
+	switch want := expected.(type) {
+	case nil:
+		return op == "eq" && actual == nil
+	case bool:
+		got, ok := actual.(bool)
+		return ok && op == "eq" && got == want
+	case float64:
+		got, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return got == want
+		case "gt":
+			return got > want
+		case "ge":
+			return got >= want
+		case "lt":
+			return got < want
+		case "le":
+			return got <= want
+		}
+		return false
+	case string:
+		got, ok := actual.(string)
+		if !ok {
+			return false
+		}
+		got, want = strings.ToLower(got), strings.ToLower(want)
+		switch op {
+		case "eq":
+			return got == want
+		case "co":
+			return strings.Contains(got, want)
+		case "sw":
+			return strings.HasPrefix(got, want)
+		case "ew":
+			return strings.HasSuffix(got, want)
+		case "gt":
+			return got > want
+		case "ge":
+			return got >= want
+		case "lt":
+			return got < want
+		case "le":
+			return got <= want
+		}
+	}
+	return false
+}
+
+// splitAttr normalizes an attribute path, dropping any schema URN prefix,
+// and splits off a sub-attribute
+func splitAttr(s string) (attr, sub string) {
+	if strings.HasPrefix(strings.ToLower(s), "urn:") {
+		if i := strings.LastIndex(s, ":"); i >= 0 {
+			s = s[i+1:]
+		}
+	}
+	s = strings.ToLower(s)
+	if i := strings.Index(s, "."); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// Parser
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func newParser(s string) (*parser, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{tokens: tokens}, nil
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenLBracket, text: "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenRBracket, text: "]"})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			var text string
+			if err := json.Unmarshal([]byte(s[i:end+1]), &text); err != nil {
+				return nil, fmt.Errorf("%w: invalid string %s", ErrInvalidFilter, s[i:end+1])
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text})
+			i = end + 1
+		default:
+			end := i
+			for end < len(s) && !strings.ContainsRune(" \t\n\r()[]\"", rune(s[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: s[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{kind: tokenEOF}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.peek()
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) keyword(word string) bool {
+	tok := p.peek()
+	if tok.kind == tokenWord && strings.EqualFold(tok.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// parseOr parses: and ("or" and)*
+func (p *parser) parseOr() (*Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses: primary ("and" primary)*
+func (p *parser) parseAnd() (*Filter, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parsePrimary parses a parenthesized or negated filter, a value path or an
+// attribute expression
+func (p *parser) parsePrimary() (*Filter, error) {
+	if p.keyword("not") {
+		if p.peek().kind != tokenLParen {
+			return nil, fmt.Errorf("%w: expected \"(\" after not", ErrInvalidFilter)
+		}
+		inner, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Op: "not", Left: inner}, nil
+	}
+
+	if p.peek().kind == tokenLParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenRParen {
+			return nil, fmt.Errorf("%w: expected \")\"", ErrInvalidFilter)
+		}
+		return inner, nil
+	}
+
+	tok := p.next()
+	if tok.kind != tokenWord {
+		return nil, fmt.Errorf("%w: expected attribute, got %q", ErrInvalidFilter, tok.text)
+	}
+	attr, sub := splitAttr(tok.text)
+	if sub != "" {
+		attr += "." + sub
+	}
+
+	if p.peek().kind == tokenLBracket {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenRBracket {
+			return nil, fmt.Errorf("%w: expected \"]\"", ErrInvalidFilter)
+		}
+		return &Filter{Op: "eq", Attr: attr, Sub: inner}, nil
+	}
+
+	opTok := p.next()
+	op := strings.ToLower(opTok.text)
+	if opTok.kind != tokenWord || (op != "pr" && !comparisonOps[op]) {
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, opTok.text)
+	}
+	if op == "pr" {
+		return &Filter{Op: op, Attr: attr}, nil
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{Op: op, Attr: attr, Value: value}, nil
+}
+
+func (p *parser) parseValue() (interface{}, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenString:
+		return tok.text, nil
+	case tokenWord:
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		if n, err := strconv.ParseFloat(tok.text, 64); err == nil {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid value %q", ErrInvalidFilter, tok.text)
+}
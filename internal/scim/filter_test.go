@@ -0,0 +1,134 @@
+package scim
+
+import (
+	"errors"
+	"testing"
+)
+
+func testUser() *User {
+	active := true
+	return &User{
+		Schemas:     []string{SchemaUser},
+		ID:          "2819c223-7f76-453a-919d-413861904646",
+		ExternalID:  "00u1abcd",
+		UserName:    "Bjensen@Example.com",
+		DisplayName: "Barbara Jensen",
+		Name:        &Name{Formatted: "Barbara Jensen"},
+		Emails:      []MultiValue{{Value: "bjensen@example.com", Type: "work", Primary: true}},
+		Active:      &active,
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "bjensen@example.com"`, true},
+		{`USERNAME Eq "BJENSEN@EXAMPLE.COM"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "bjensen@example.com"`, true},
+		{`userName ne "bjensen@example.com"`, false},
+		{`userName sw "bjensen"`, true},
+		{`userName ew "@example.com"`, true},
+		{`displayName co "jens"`, true},
+		{`name.formatted eq "Barbara Jensen"`, true},
+		{`externalId pr`, true},
+		{`title pr`, false},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`emails eq "bjensen@example.com"`, true},
+		{`emails.value eq "bjensen@example.com"`, true},
+		{`emails[type eq "work" and value co "@example.com"]`, true},
+		{`emails[type eq "home"]`, false},
+		{`userName eq "nobody" or externalId eq "00u1abcd"`, true},
+		{`userName eq "nobody" or externalId eq "x" and active eq true`, false},
+		{`(userName eq "nobody" or externalId eq "00u1abcd") and active eq true`, true},
+		{`not (active eq true)`, false},
+		{`userName eq "a\"b"`, false},
+	}
+
+	u := testUser()
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.filter)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) error = %v", tt.filter, err)
+			continue
+		}
+		if got := f.Matches(u); got != tt.want {
+			t.Errorf("ParseFilter(%q).Matches() = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	tests := []string{
+		``,
+		`userName`,
+		`userName xx "a"`,
+		`userName eq`,
+		`userName eq "unterminated`,
+		`userName eq bare`,
+		`(userName eq "a"`,
+		`userName eq "a" and`,
+		`not userName eq "a"`,
+		`emails[type eq "work"`,
+	}
+
+	for _, filter := range tests {
+		if _, err := ParseFilter(filter); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("ParseFilter(%q) error = %v, want ErrInvalidFilter", filter, err)
+		}
+	}
+}
+
+func TestFilterEquality(t *testing.T) {
+	f, err := ParseFilter(`userName eq "bjensen@example.com"`)
+	if err != nil {
+		t.Fatalf("ParseFilter() error = %v", err)
+	}
+	attr, value, ok := f.Equality()
+	if !ok || attr != "username" || value != "bjensen@example.com" {
+		t.Errorf("Equality() = %q, %q, %v", attr, value, ok)
+	}
+
+	for _, filter := range []string{`userName co "x"`, `active eq true`, `userName eq "a" or userName eq "b"`} {
+		f, err := ParseFilter(filter)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q) error = %v", filter, err)
+		}
+		if _, _, ok := f.Equality(); ok {
+			t.Errorf("ParseFilter(%q).Equality() ok = true, want false", filter)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path      string
+		attr, sub string
+		filter    bool
+	}{
+		{"active", "active", "", false},
+		{"name.formatted", "name", "formatted", false},
+		{"urn:ietf:params:scim:schemas:core:2.0:User:displayName", "displayname", "", false},
+		{`members[value eq "2819c223-7f76-453a-919d-413861904646"]`, "members", "", true},
+		{`emails[type eq "work"].value`, "emails", "value", true},
+	}
+
+	for _, tt := range tests {
+		p, err := ParsePath(tt.path)
+		if err != nil {
+			t.Errorf("ParsePath(%q) error = %v", tt.path, err)
+			continue
+		}
+		if p.Attr != tt.attr || p.Sub != tt.sub || (p.Filter != nil) != tt.filter {
+			t.Errorf("ParsePath(%q) = %+v", tt.path, p)
+		}
+	}
+
+	for _, path := range []string{"", `members[value eq "x"`, `members[value eq "x"] extra`, "name.formatted[value pr]"} {
+		if _, err := ParsePath(path); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("ParsePath(%q) error = %v, want ErrInvalidPath", path, err)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package scim
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Handler handles SCIM 2.0 provisioning requests (RFC 7644)
+type Handler struct {
+	service *Service
+	baseURL string
+}
+
+// NewHandler creates a new SCIM handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service, baseURL: service.baseURL}
+}
+
+// RequireToken returns a middleware that authenticates the identity provider
+// by a static bearer token
+func RequireToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" ||
+				subtle.ConstantTimeCompare([]byte(parts[1]), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+				respondError(w, ErrUnauthenticated)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Users
+
+// ListUsers handles GET /Users
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	users, total, err := h.service.ListUsers(r.Context(), q)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newListResponse(users, len(users), total, q.StartIndex))
+}
+
+// CreateUser handles POST /Users
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var in User
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respondError(w, fmt.Errorf("%w: %v", ErrInvalidSyntax, err))
+		return
+	}
+
+	u, err := h.service.CreateUser(r.Context(), &in)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", u.Meta.Location)
+	respondJSON(w, http.StatusCreated, u)
+}
+
+// GetUser handles GET /Users/{id}
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	u, err := h.service.GetUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, u)
+}
+
+// ReplaceUser handles PUT /Users/{id}
+func (h *Handler) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	var in User
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respondError(w, fmt.Errorf("%w: %v", ErrInvalidSyntax, err))
+		return
+	}
+
+	u, err := h.service.ReplaceUser(r.Context(), chi.URLParam(r, "id"), &in)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, u)
+}
+
+// PatchUser handles PATCH /Users/{id}
+func (h *Handler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	var req PatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, fmt.Errorf("%w: %v", ErrInvalidSyntax, err))
+		return
+	}
+
+	u, err := h.service.PatchUser(r.Context(), chi.URLParam(r, "id"), req.Operations)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, u)
+}
+
+// DeleteUser handles DELETE /Users/{id} by disabling the account
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteUser(r.Context(), chi.URLParam(r, "id")); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Groups
+
+// ListGroups handles GET /Groups
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	groups, total, err := h.service.ListGroups(r.Context(), q, excludeMembers(r))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, newListResponse(groups, len(groups), total, q.StartIndex))
+}
+
+// CreateGroup handles POST /Groups
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var in Group
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respondError(w, fmt.Errorf("%w: %v", ErrInvalidSyntax, err))
+		return
+	}
+
+	g, err := h.service.CreateGroup(r.Context(), &in)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", g.Meta.Location)
+	respondJSON(w, http.StatusCreated, g)
+}
+
+// GetGroup handles GET /Groups/{id}
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request) {
+	g, err := h.service.GetGroup(r.Context(), chi.URLParam(r, "id"), excludeMembers(r))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, g)
+}
+
+// ReplaceGroup handles PUT /Groups/{id}
+func (h *Handler) ReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	var in Group
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respondError(w, fmt.Errorf("%w: %v", ErrInvalidSyntax, err))
+		return
+	}
+
+	g, err := h.service.ReplaceGroup(r.Context(), chi.URLParam(r, "id"), &in)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, g)
+}
+
+// PatchGroup handles PATCH /Groups/{id}
+func (h *Handler) PatchGroup(w http.ResponseWriter, r *http.Request) {
+	var req PatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, fmt.Errorf("%w: %v", ErrInvalidSyntax, err))
+		return
+	}
+
+	g, err := h.service.PatchGroup(r.Context(), chi.URLParam(r, "id"), req.Operations)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, g)
+}
+
+// DeleteGroup handles DELETE /Groups/{id}
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteGroup(r.Context(), chi.URLParam(r, "id")); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Discovery
+
+// ServiceProviderConfig handles GET /ServiceProviderConfig
+func (h *Handler) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	supported := func(ok bool) map[string]bool { return map[string]bool{"supported": ok} }
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"schemas":          []string{SchemaServiceProviderConfig},
+		"documentationUri": "https://datatracker.ietf.org/doc/html/rfc7644",
+		"patch":            supported(true),
+		"bulk":             map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]interface{}{"supported": true, "maxResults": maxCount},
+		"changePassword":   supported(true),
+		"sort":             supported(false),
+		"etag":             supported(false),
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with the configured SCIM bearer token",
+			"primary":     true,
+		}},
+		"meta": map[string]string{
+			"resourceType": "ServiceProviderConfig",
+			"location":     h.baseURL + "/scim/v2/ServiceProviderConfig",
+		},
+	})
+}
+
+// ResourceTypes handles GET /ResourceTypes
+func (h *Handler) ResourceTypes(w http.ResponseWriter, r *http.Request) {
+	resourceType := func(name, endpoint, schema string) map[string]interface{} {
+		return map[string]interface{}{
+			"schemas":  []string{SchemaResourceType},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta": map[string]string{
+				"resourceType": "ResourceType",
+				"location":     h.baseURL + "/scim/v2/ResourceTypes/" + name,
+			},
+		}
+	}
+	types := []map[string]interface{}{
+		resourceType("User", "/Users", SchemaUser),
+		resourceType("Group", "/Groups", SchemaGroup),
+	}
+
+	respondJSON(w, http.StatusOK, newListResponse(types, len(types), len(types), 1))
+}
+
+// Helper functions
+
+func parseListQuery(r *http.Request) (*ListQuery, error) {
+	params := r.URL.Query()
+	q := &ListQuery{StartIndex: 1, Count: defaultCount}
+
+	if s := params.Get("startIndex"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: startIndex must be an integer", ErrInvalidValue)
+		}
+		// Values below 1 are interpreted as 1 (RFC 7644 section 3.4.2.4)
+		q.StartIndex = max(n, 1)
+	}
+	if s := params.Get("count"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: count must be an integer", ErrInvalidValue)
+		}
+		q.Count = min(max(n, 0), maxCount)
+	}
+	if s := params.Get("filter"); s != "" {
+		f, err := ParseFilter(s)
+		if err != nil {
+			return nil, err
+		}
+		q.Filter = f
+	}
+	return q, nil
+}
+
+// excludeMembers reports whether the request asked to omit group members,
+// which identity providers do to avoid fetching large groups
+func excludeMembers(r *http.Request) bool {
+	for _, attr := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+func newListResponse(resources interface{}, itemsPerPage, total, startIndex int) *ListResponse {
+	return &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	}
+}
+
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func respondError(w http.ResponseWriter, err error) {
+	status, scimType := http.StatusBadRequest, ""
+	switch {
+	case errors.Is(err, ErrUnauthenticated):
+		status = http.StatusUnauthorized
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrUniqueness):
+		status, scimType = http.StatusConflict, "uniqueness"
+	case errors.Is(err, ErrInvalidFilter):
+		scimType = "invalidFilter"
+	case errors.Is(err, ErrInvalidPath):
+		scimType = "invalidPath"
+	case errors.Is(err, ErrInvalidValue):
+		scimType = "invalidValue"
+	case errors.Is(err, ErrInvalidSyntax):
+		scimType = "invalidSyntax"
+	case errors.Is(err, ErrNoTarget):
+		scimType = "noTarget"
+	case errors.Is(err, ErrMutability):
+		scimType = "mutability"
+	default:
+		log.Printf("SCIM request failed: %v", err)
+		status = http.StatusInternalServerError
+		err = errors.New("internal server error")
+	}
+
+	respondJSON(w, status, ErrorResponse{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   err.Error(),
+	})
+}
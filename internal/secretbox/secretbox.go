@@ -0,0 +1,58 @@
+// Package secretbox encrypts secrets the server must read back, such as
+// access key and webhook signing secrets, so they are not stored in the
+// clear. Each use derives its own AES-256-GCM key from the server secret,
+// so changing the server secret invalidates everything sealed with it.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// Box seals and opens secrets for one purpose
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a Box whose key is derived from serverSecret and purpose,
+// such as "access key secrets"
+func New(serverSecret, purpose string) (*Box, error) {
+	mac := hmac.New(sha256.New, []byte(serverSecret))
+	mac.Write([]byte(purpose))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts a secret, bound to the ID of the row that stores it so
+// ciphertexts cannot be swapped between rows. The nonce is prepended.
+func (b *Box) Seal(id, secret string) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(secret)+b.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, []byte(secret), []byte(id)), nil
+}
+
+// Open decrypts a secret sealed for the row with the given ID
+func (b *Box) Open(id string, ciphertext []byte) (string, error) {
+	n := b.aead.NonceSize()
+	if len(ciphertext) < n {
+		return "", errors.New("ciphertext too short")
+	}
+	secret, err := b.aead.Open(nil, ciphertext[:n], ciphertext[n:], []byte(id))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
@@ -0,0 +1,40 @@
+package secretbox
+
+import "testing"
+
+func TestSealOpen(t *testing.T) {
+	box, err := New("server-secret", "test secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := box.Seal("row-1", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := box.Open("row-1", sealed); err != nil || got != "hunter2" {
+		t.Fatalf("Open = %q, %v", got, err)
+	}
+
+	if _, err := box.Open("row-2", sealed); err == nil {
+		t.Error("expected a ciphertext moved to another row to fail")
+	}
+	if _, err := box.Open("row-1", sealed[:4]); err == nil {
+		t.Error("expected a truncated ciphertext to fail")
+	}
+
+	other, err := New("server-secret", "other secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Open("row-1", sealed); err == nil {
+		t.Error("expected a box for another purpose to fail")
+	}
+	rotated, err := New("new-server-secret", "test secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotated.Open("row-1", sealed); err == nil {
+		t.Error("expected a box with another server secret to fail")
+	}
+}
@@ -0,0 +1,123 @@
+package sftpd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/testifysec/dropbox-clone/internal/apppassword"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/sshkey"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+var errInvalidCredentials = errors.New("invalid email or credentials")
+
+// authenticator checks the credentials clients sign in with. The SSH user
+// name is the account email.
+type authenticator interface {
+	// password checks an account password or app password
+	password(ctx context.Context, email, password, ip string) (uuid.UUID, error)
+	// publicKey checks a key the client has proven it holds
+	publicKey(ctx context.Context, email string, key ssh.PublicKey) (uuid.UUID, error)
+	// active checks that a signed-in user may keep their connection: the
+	// account must still be active and, for key sign-ins, the key still
+	// registered to it
+	active(ctx context.Context, email string, userID uuid.UUID, key ssh.PublicKey) error
+}
+
+// credentials implements authenticator with the API's services
+type credentials struct {
+	logins       *auth.Service
+	users        *user.Service
+	appPasswords *apppassword.Service
+	sshKeys      *sshkey.Service
+}
+
+// password accepts app passwords, and account passwords, which go through
+// the same sign-in service as API logins for brute-force protection and
+// audit events
+func (c *credentials) password(ctx context.Context, email, password, ip string) (uuid.UUID, error) {
+	if strings.HasPrefix(password, apppassword.Prefix) {
+		u, err := c.appPasswords.Authenticate(ctx, email, password)
+		if err != nil {
+			if errors.Is(err, apppassword.ErrInvalidCredentials) {
+				return uuid.Nil, errInvalidCredentials
+			}
+			return uuid.Nil, err
+		}
+		return u.ID, nil
+	}
+
+	u, err := c.logins.Authenticate(ctx, email, password, ip)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, auth.ErrCredentialsRequired) {
+			return uuid.Nil, errInvalidCredentials
+		}
+		return uuid.Nil, err
+	}
+	return u.ID, nil
+}
+
+func (c *credentials) publicKey(ctx context.Context, email string, key ssh.PublicKey) (uuid.UUID, error) {
+	u, err := c.sshKeys.Authenticate(ctx, email, key)
+	if err != nil {
+		if errors.Is(err, sshkey.ErrInvalidCredentials) {
+			return uuid.Nil, errInvalidCredentials
+		}
+		return uuid.Nil, err
+	}
+	return u.ID, nil
+}
+
+func (c *credentials) active(ctx context.Context, email string, userID uuid.UUID, key ssh.PublicKey) error {
+	if key == nil {
+		return c.users.CheckActive(ctx, userID)
+	}
+	keyUserID, err := c.publicKey(ctx, email, key)
+	if err != nil {
+		return err
+	}
+	if keyUserID != userID {
+		return errInvalidCredentials
+	}
+	return nil
+}
+
+// LoadHostKeys reads the server's host keys from PEM files. With no files,
+// it generates an Ed25519 key that lasts until the process exits, which
+// clients will see change on every restart.
+func LoadHostKeys(paths []string) ([]ssh.Signer, error) {
+	if len(paths) == 0 {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.Signer{signer}, nil
+	}
+
+	signers := make([]ssh.Signer, 0, len(paths))
+	for _, path := range paths {
+		pemBytes, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("host key %s: %w", path, err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
@@ -0,0 +1,294 @@
+package sftpd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"golang.org/x/net/webdav"
+
+	"github.com/testifysec/dropbox-clone/internal/file"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+var (
+	errIsDirectory       = errors.New("is a directory")
+	errNotDirectory      = errors.New("not a directory")
+	errDirectoryNotEmpty = errors.New("directory not empty")
+)
+
+// handlers serves one session's SFTP requests from the user's groups. Each
+// request gets a fresh view of the groups, so changes made elsewhere show
+// up straight away.
+type handlers struct {
+	ctx         context.Context
+	userID      uuid.UUID
+	fileSystems fileSystems
+}
+
+func (h *handlers) fs() webdav.FileSystem {
+	return h.fileSystems.ForUser(h.userID)
+}
+
+// Fileread implements sftp.FileReader
+func (h *handlers) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	f, err := h.fs().OpenFile(h.ctx, r.Filepath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	info, err := f.Stat()
+	if err == nil && info.IsDir() {
+		err = errIsDirectory
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, statusError(err)
+	}
+	return &readerAt{file: f}, nil
+}
+
+// Filewrite implements sftp.FileWriter. Writing always replaces the file's
+// content, which is uploaded when the client closes the file; appending
+// is not supported, since files cannot change once uploaded.
+func (h *handlers) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if r.Pflags().Append {
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+	f, err := h.fs().OpenFile(h.ctx, r.Filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	w, ok := f.(io.WriterAt)
+	if !ok {
+		_ = f.Close()
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+	return &writerAt{WriterAt: w, file: f}, nil
+}
+
+// Filecmd implements sftp.FileCmder
+func (h *handlers) Filecmd(r *sftp.Request) error {
+	fs := h.fs()
+	switch r.Method {
+	case "Setstat":
+		// Files keep their upload time and have no permissions to set
+		return nil
+	case "Rename":
+		if _, err := fs.Stat(h.ctx, r.Target); err == nil {
+			return statusError(os.ErrExist)
+		}
+		return statusError(fs.Rename(h.ctx, r.Filepath, r.Target))
+	case "Mkdir":
+		return statusError(fs.Mkdir(h.ctx, r.Filepath, 0o755))
+	case "Remove":
+		info, err := fs.Stat(h.ctx, r.Filepath)
+		if err == nil && info.IsDir() {
+			err = errIsDirectory
+		}
+		if err != nil {
+			return statusError(err)
+		}
+		return statusError(fs.RemoveAll(h.ctx, r.Filepath))
+	case "Rmdir":
+		if err := h.checkEmptyDir(fs, r.Filepath); err != nil {
+			return statusError(err)
+		}
+		return statusError(fs.RemoveAll(h.ctx, r.Filepath))
+	default:
+		return sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// PosixRename implements sftp.PosixRenameFileCmder, replacing any file at
+// the target
+func (h *handlers) PosixRename(r *sftp.Request) error {
+	fs := h.fs()
+	info, err := fs.Stat(h.ctx, r.Target)
+	switch {
+	case err == nil && info.IsDir():
+		return statusError(errIsDirectory)
+	case err == nil:
+		if err := fs.RemoveAll(h.ctx, r.Target); err != nil {
+			return statusError(err)
+		}
+		fs = h.fs()
+	case !os.IsNotExist(err):
+		return statusError(err)
+	}
+	return statusError(fs.Rename(h.ctx, r.Filepath, r.Target))
+}
+
+func (h *handlers) checkEmptyDir(fs webdav.FileSystem, name string) error {
+	f, err := fs.OpenFile(h.ctx, name, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errNotDirectory
+	}
+	entries, err := f.Readdir(1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if len(entries) > 0 {
+		return errDirectoryNotEmpty
+	}
+	return nil
+}
+
+// Filelist implements sftp.FileLister
+func (h *handlers) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	fs := h.fs()
+	switch r.Method {
+	case "List":
+		f, err := fs.OpenFile(h.ctx, r.Filepath, os.O_RDONLY, 0)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		defer func() { _ = f.Close() }()
+		info, err := f.Stat()
+		if err == nil && !info.IsDir() {
+			err = errNotDirectory
+		}
+		if err != nil {
+			return nil, statusError(err)
+		}
+		entries, err := f.Readdir(-1)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		return listerAt(entries), nil
+	case "Stat":
+		info, err := fs.Stat(h.ctx, r.Filepath)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		return listerAt{info}, nil
+	default:
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// statusError maps an error to what the client is told. Errors the user
+// can act on keep their message; unexpected ones are logged and reported
+// as a plain failure.
+func statusError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case os.IsNotExist(err):
+		return sftp.ErrSSHFxNoSuchFile
+	case errors.Is(err, os.ErrPermission):
+		return sftp.ErrSSHFxPermissionDenied
+	case errors.Is(err, os.ErrExist), errors.Is(err, os.ErrInvalid),
+		errors.Is(err, errIsDirectory), errors.Is(err, errNotDirectory), errors.Is(err, errDirectoryNotEmpty),
+		errors.Is(err, file.ErrFileTooLarge), errors.Is(err, file.ErrNameTooLong), errors.Is(err, file.ErrMetadataRequired),
+		errors.Is(err, user.ErrEmailNotVerified):
+		return err
+	default:
+		log.Printf("SFTP operation failed: %v", err)
+		return sftp.ErrSSHFxFailure
+	}
+}
+
+// listerAt lists directory entries, or a single file's info for Stat
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(entries []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(entries, l[offset:])
+	if offset+int64(n) == int64(len(l)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readWindow is how much recently read content readerAt keeps, and how far
+// ahead it reads through rather than reopening the stream
+const readWindow = 1 << 20
+
+// readerAt serves reads at offsets from a file streamed from storage.
+// Clients pipeline reads and the server handles them concurrently, so they
+// arrive slightly out of order; reads just behind the stream are served
+// from recent content and short skips ahead are read through, so the
+// stream is only reopened when the client really seeks.
+type readerAt struct {
+	mu     sync.Mutex
+	file   webdav.File
+	pos    int64  // Offset the file is read from next
+	recent []byte // Content just before pos
+}
+
+func (r *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	if start := r.pos - int64(len(r.recent)); off >= start && off < r.pos {
+		n = copy(p, r.recent[off-start:])
+		off += int64(n)
+		if n == len(p) {
+			return n, nil
+		}
+	}
+
+	switch {
+	case off < r.pos || off-r.pos > readWindow:
+		if _, err := r.file.Seek(off, io.SeekStart); err != nil {
+			return n, err
+		}
+		r.pos, r.recent = off, r.recent[:0]
+	case off > r.pos:
+		if _, err := r.read(make([]byte, off-r.pos)); err != nil {
+			return n, eof(err)
+		}
+	}
+
+	m, err := r.read(p[n:])
+	return n + m, eof(err)
+}
+
+// read reads from the stream, keeping what it read as recent content
+func (r *readerAt) read(p []byte) (int, error) {
+	n, err := io.ReadFull(r.file, p)
+	r.recent = append(r.recent, p[:n]...)
+	if len(r.recent) > 2*readWindow {
+		r.recent = r.recent[:copy(r.recent, r.recent[len(r.recent)-readWindow:])]
+	}
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *readerAt) Close() error {
+	return r.file.Close()
+}
+
+// eof reports a short read as io.ReaderAt does
+func eof(err error) error {
+	if err == io.ErrUnexpectedEOF {
+		return io.EOF
+	}
+	return err
+}
+
+// writerAt is a file open for writing, which is uploaded when closed
+type writerAt struct {
+	io.WriterAt
+	file webdav.File
+}
+
+func (w *writerAt) Close() error {
+	return statusError(w.file.Close())
+}
@@ -0,0 +1,316 @@
+// Package sftpd serves users' groups over SFTP, for partners whose tools
+// only deliver files that way. Clients sign in with the account email as
+// the user name and an SSH key the user uploaded, an app password or the
+// account password. Each group the user belongs to is a top-level
+// directory, laid out as over WebDAV, and every operation goes through the
+// file service with the same membership checks.
+package sftpd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/webdav"
+
+	"github.com/testifysec/dropbox-clone/internal/apppassword"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/dav"
+	"github.com/testifysec/dropbox-clone/internal/lockout"
+	"github.com/testifysec/dropbox-clone/internal/sshkey"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// ErrServerClosed is returned by Serve after Shutdown
+var ErrServerClosed = errors.New("sftpd: server closed")
+
+// handshakeTimeout bounds how long a client may take to sign in
+const handshakeTimeout = 30 * time.Second
+
+// activeCheckInterval is how often an open connection checks that its
+// account is still active and its SSH key still registered
+const activeCheckInterval = 30 * time.Second
+
+// userIDExtension carries the signed-in user from authentication to the
+// connection, and publicKeyExtension the key for key sign-ins
+const (
+	userIDExtension    = "user-id"
+	publicKeyExtension = "public-key"
+)
+
+// fileSystems provides users' views of their groups
+type fileSystems interface {
+	ForUser(userID uuid.UUID) webdav.FileSystem
+}
+
+// Server serves SFTP sessions
+type Server struct {
+	config      *ssh.ServerConfig
+	fileSystems fileSystems
+	auth        authenticator
+	activeCheck time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer creates an SFTP server that identifies itself with hostKeys
+func NewServer(hostKeys []ssh.Signer, fileSystems *dav.FileSystems, authService *auth.Service,
+	userService *user.Service, appPasswords *apppassword.Service, sshKeys *sshkey.Service) *Server {
+	c := &credentials{logins: authService, users: userService, appPasswords: appPasswords, sshKeys: sshKeys}
+	return newServer(hostKeys, fileSystems, c)
+}
+
+func newServer(hostKeys []ssh.Signer, fs fileSystems, a authenticator) *Server {
+	s := &Server{fileSystems: fs, auth: a, activeCheck: activeCheckInterval, conns: make(map[net.Conn]struct{})}
+	s.config = &ssh.ServerConfig{
+		MaxAuthTries:      6,
+		PasswordCallback:  s.passwordCallback,
+		PublicKeyCallback: s.publicKeyCallback,
+		ServerVersion:     "SSH-2.0-dropbox-clone",
+	}
+	for _, key := range hostKeys {
+		s.config.AddHostKey(key)
+	}
+	return s
+}
+
+func (s *Server) passwordCallback(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	userID, err := s.auth.password(connContext(meta), meta.User(), string(password), remoteIP(meta.RemoteAddr()))
+	return permissions(userID, nil, err)
+}
+
+func (s *Server) publicKeyCallback(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	userID, err := s.auth.publicKey(connContext(meta), meta.User(), key)
+	return permissions(userID, key, err)
+}
+
+// connContext carries the client's address and version into audit events
+func connContext(meta ssh.ConnMetadata) context.Context {
+	return audit.WithRequestInfo(context.Background(), audit.RequestInfo{
+		IP:        remoteIP(meta.RemoteAddr()),
+		UserAgent: string(meta.ClientVersion()),
+	})
+}
+
+// permissions records the signed-in user, and the key for key sign-ins,
+// for the connection. Failures other than wrong credentials, such as
+// disabled accounts and lockouts, are logged, since SSH gives clients no
+// reason for them.
+func permissions(userID uuid.UUID, key ssh.PublicKey, err error) (*ssh.Permissions, error) {
+	if err != nil {
+		if !errors.Is(err, errInvalidCredentials) && !errors.Is(err, lockout.ErrBlocked) {
+			log.Printf("SFTP authentication failed: %v", err)
+		}
+		return nil, err
+	}
+	extensions := map[string]string{userIDExtension: userID.String()}
+	if key != nil {
+		extensions[publicKeyExtension] = string(key.Marshal())
+	}
+	return &ssh.Permissions{Extensions: extensions}, nil
+}
+
+// Serve accepts connections on l until Shutdown is called
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(conn) {
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown stops accepting connections and waits for open sessions to
+// end. When ctx is done first, the remaining connections are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// serveConn signs a client in and serves its sessions
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.untrack(conn)
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	defer func() { _ = sshConn.Close() }()
+	go ssh.DiscardRequests(requests)
+
+	userID, err := uuid.Parse(sshConn.Permissions.Extensions[userIDExtension])
+	if err != nil {
+		return
+	}
+	var key ssh.PublicKey
+	if wire, ok := sshConn.Permissions.Extensions[publicKeyExtension]; ok {
+		if key, err = ssh.ParsePublicKey([]byte(wire)); err != nil {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = context.WithValue(ctx, auth.UserIDKey, userID)
+	ctx = context.WithValue(ctx, auth.EmailKey, sshConn.User())
+	ctx = audit.WithRequestInfo(ctx, audit.RequestInfo{
+		IP:        remoteIP(sshConn.RemoteAddr()),
+		UserAgent: string(sshConn.ClientVersion()),
+	})
+	go s.watch(ctx, sshConn, userID, key)
+
+	var sessions sync.WaitGroup
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			s.serveSession(ctx, userID, channel, requests)
+		}()
+	}
+	sessions.Wait()
+}
+
+// watch closes conn once its account is disabled or deleted, or the key it
+// signed in with is removed, so revoking access ends open sessions too
+func (s *Server) watch(ctx context.Context, conn *ssh.ServerConn, userID uuid.UUID, key ssh.PublicKey) {
+	ticker := time.NewTicker(s.activeCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.auth.active(ctx, conn.User(), userID, key)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, user.ErrAccountDisabled) && !errors.Is(err, user.ErrUserNotFound) && !errors.Is(err, errInvalidCredentials) {
+				log.Printf("Failed to check account %s for SFTP connection: %v", userID, err)
+			}
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+// serveSession serves the sftp subsystem on a session channel. Shells and
+// commands are refused.
+func (s *Server) serveSession(ctx context.Context, userID uuid.UUID, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer func() { _ = channel.Close() }()
+
+	for req := range requests {
+		if req.Type != "subsystem" || string(req.Payload[min(4, len(req.Payload)):]) != "sftp" {
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+			continue
+		}
+		if req.WantReply {
+			_ = req.Reply(true, nil)
+		}
+		go ssh.DiscardRequests(requests)
+
+		h := &handlers{ctx: ctx, userID: userID, fileSystems: s.fileSystems}
+		server := sftp.NewRequestServer(channel, sftp.Handlers{
+			FileGet:  h,
+			FilePut:  h,
+			FileCmd:  h,
+			FileList: h,
+		})
+		if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+			log.Printf("SFTP session for %s ended: %v", userID, err)
+		}
+		_ = server.Close()
+		return
+	}
+}
+
+func remoteIP(addr net.Addr) string {
+	ip := addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return ip
+}
@@ -0,0 +1,477 @@
+package sftpd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/webdav"
+
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/lockout"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// memFileSystems serves every user the same in-memory tree
+type memFileSystems struct {
+	fs webdav.FileSystem
+}
+
+func (m *memFileSystems) ForUser(userID uuid.UUID) webdav.FileSystem { return m }
+
+func (m *memFileSystems) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return m.fs.Mkdir(ctx, name, perm)
+}
+
+func (m *memFileSystems) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	f, err := m.fs.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{File: f}, nil
+}
+
+func (m *memFileSystems) RemoveAll(ctx context.Context, name string) error {
+	return m.fs.RemoveAll(ctx, name)
+}
+
+func (m *memFileSystems) Rename(ctx context.Context, oldName, newName string) error {
+	return m.fs.Rename(ctx, oldName, newName)
+}
+
+func (m *memFileSystems) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return m.fs.Stat(ctx, name)
+}
+
+// memFile adds WriteAt to webdav's in-memory files, as the real files have
+type memFile struct {
+	webdav.File
+	mu sync.Mutex
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return f.Write(p)
+}
+
+// staticAuth accepts one password and one key until access is revoked
+type staticAuth struct {
+	userID uuid.UUID
+	email  string
+	secret string
+	key    ssh.PublicKey
+
+	mu      sync.Mutex
+	revoked error // Returned by active once set
+}
+
+func (a *staticAuth) password(ctx context.Context, email, password, ip string) (uuid.UUID, error) {
+	if email != a.email || password != a.secret {
+		return uuid.Nil, errInvalidCredentials
+	}
+	return a.userID, nil
+}
+
+func (a *staticAuth) publicKey(ctx context.Context, email string, key ssh.PublicKey) (uuid.UUID, error) {
+	if email != a.email || !bytes.Equal(key.Marshal(), a.key.Marshal()) {
+		return uuid.Nil, errInvalidCredentials
+	}
+	return a.userID, nil
+}
+
+func (a *staticAuth) active(ctx context.Context, email string, userID uuid.UUID, key ssh.PublicKey) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.revoked
+}
+
+func (a *staticAuth) revoke(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.revoked = err
+}
+
+type sftpTest struct {
+	t       *testing.T
+	addr    string
+	auth    *staticAuth
+	signer  ssh.Signer
+	hostKey ssh.PublicKey
+}
+
+func newSFTPTest(t *testing.T) *sftpTest {
+	t.Helper()
+	hostKeys, err := LoadHostKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := webdav.NewMemFS()
+	if err := fs.Mkdir(context.Background(), "/Team", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	a := &staticAuth{userID: uuid.New(), email: "alice@example.com", secret: "correct horse", key: signer.PublicKey()}
+	s := newServer(hostKeys, &memFileSystems{fs: fs}, a)
+	s.activeCheck = 10 * time.Millisecond
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown: %v", err)
+		}
+	})
+
+	return &sftpTest{t: t, addr: l.Addr().String(), auth: a, signer: signer, hostKey: hostKeys[0].PublicKey()}
+}
+
+func (st *sftpTest) dial(methods ...ssh.AuthMethod) (*ssh.Client, error) {
+	return ssh.Dial("tcp", st.addr, &ssh.ClientConfig{
+		User:            st.auth.email,
+		Auth:            methods,
+		HostKeyCallback: ssh.FixedHostKey(st.hostKey),
+		Timeout:         5 * time.Second,
+	})
+}
+
+func (st *sftpTest) client() *sftp.Client {
+	st.t.Helper()
+	conn, err := st.dial(ssh.PublicKeys(st.signer))
+	if err != nil {
+		st.t.Fatal(err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		st.t.Fatal(err)
+	}
+	st.t.Cleanup(func() {
+		_ = client.Close()
+		_ = conn.Close()
+	})
+	return client
+}
+
+func TestAuthentication(t *testing.T) {
+	st := newSFTPTest(t)
+
+	conn, err := st.dial(ssh.Password(st.auth.secret))
+	if err != nil {
+		t.Fatalf("password: %v", err)
+	}
+	_ = conn.Close()
+
+	if _, err := st.dial(ssh.Password("wrong")); err == nil {
+		t.Error("wrong password was accepted")
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherKey)
+	if _, err := st.dial(ssh.PublicKeys(otherSigner)); err == nil {
+		t.Error("unregistered key was accepted")
+	}
+
+	conn, err = st.dial(ssh.PublicKeys(st.signer))
+	if err != nil {
+		t.Fatalf("public key: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	session, err := conn.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = session.Close() }()
+	if err := session.Run("ls"); err == nil {
+		t.Error("command was run")
+	}
+}
+
+func TestRevokedAccessClosesConnection(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"account disabled", user.ErrAccountDisabled},
+		{"key removed", errInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newSFTPTest(t)
+			conn, err := st.dial(ssh.PublicKeys(st.signer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = conn.Close() }()
+			client, err := sftp.NewClient(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = client.Close() }()
+			if _, err := client.ReadDir("/"); err != nil {
+				t.Fatalf("ReadDir before revoking: %v", err)
+			}
+
+			st.auth.revoke(tt.err)
+			closed := make(chan struct{})
+			go func() {
+				_ = conn.Wait()
+				close(closed)
+			}()
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("connection stayed open after access was revoked")
+			}
+		})
+	}
+}
+
+// userRepo is an in-memory user.Repository
+type userRepo struct {
+	user.Repository
+	mu    sync.Mutex
+	users map[uuid.UUID]*user.User
+}
+
+func (r *userRepo) GetByID(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[id]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (r *userRepo) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range r.users {
+		if u.Email == email {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, user.ErrUserNotFound
+}
+
+// auditLog records the actions of audit events
+type auditLog struct {
+	mu      sync.Mutex
+	actions []string
+}
+
+func (l *auditLog) Record(ctx context.Context, event *audit.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.actions = append(l.actions, event.Action)
+}
+
+func (l *auditLog) last() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.actions) == 0 {
+		return ""
+	}
+	return l.actions[len(l.actions)-1]
+}
+
+func TestAccountPasswordSignIn(t *testing.T) {
+	ctx := context.Background()
+	hasher := user.NewPasswordHasher(user.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	hash, err := hasher.Hash("password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &user.User{ID: uuid.New(), Email: "alice@example.com", PasswordHash: hash}
+	repo := &userRepo{users: map[uuid.UUID]*user.User{u.ID: u}}
+	users := user.NewService(repo, hasher, user.VerificationPolicyOff)
+	policy := lockout.Policy{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute}
+	guard := lockout.NewGuard(lockout.NewMemoryStore(), lockout.Config{Account: policy, IP: policy, Window: time.Hour})
+	log := &auditLog{}
+	c := &credentials{logins: auth.NewService(users, nil, nil, guard, log), users: users}
+
+	if _, err := c.password(ctx, u.Email, "wrong", "192.0.2.1"); !errors.Is(err, errInvalidCredentials) {
+		t.Fatalf("wrong password error = %v, want errInvalidCredentials", err)
+	}
+	if got := log.last(); got != audit.ActionLoginFailed {
+		t.Errorf("wrong password audited as %q, want %q", got, audit.ActionLoginFailed)
+	}
+
+	userID, err := c.password(ctx, u.Email, "password123", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("password: %v", err)
+	}
+	if userID != u.ID {
+		t.Errorf("user ID = %s, want %s", userID, u.ID)
+	}
+	if got := log.last(); got != audit.ActionLoginSucceeded {
+		t.Errorf("sign-in audited as %q, want %q", got, audit.ActionLoginSucceeded)
+	}
+
+	if err := c.active(ctx, u.Email, u.ID, nil); err != nil {
+		t.Fatalf("active: %v", err)
+	}
+	now := time.Now()
+	repo.mu.Lock()
+	u.DisabledAt = &now
+	repo.mu.Unlock()
+	if err := c.active(ctx, u.Email, u.ID, nil); !errors.Is(err, user.ErrAccountDisabled) {
+		t.Errorf("active after disabling error = %v, want ErrAccountDisabled", err)
+	}
+}
+
+func TestFileOperations(t *testing.T) {
+	st := newSFTPTest(t)
+	client := st.client()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64<<10) // 1 MiB
+	f, err := client.Create("/Team/report.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadFrom(bytes.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = client.Open("/Team/report.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if _, err := f.WriteTo(&got); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if !bytes.Equal(got.Bytes(), content) {
+		t.Fatalf("read %d bytes that differ from the %d written", got.Len(), len(content))
+	}
+
+	if err := client.Mkdir("/Team/archive"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Rename("/Team/report.bin", "/Team/archive/report.bin"); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := client.ReadDir("/Team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != "archive" || !infos[0].IsDir() {
+		t.Errorf("listing after rename = %v", infos)
+	}
+	info, err := client.Stat("/Team/archive/report.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(content)) {
+		t.Errorf("size = %d, want %d", info.Size(), len(content))
+	}
+
+	if err := client.RemoveDirectory("/Team/archive"); err == nil {
+		t.Error("non-empty directory was removed")
+	}
+	if err := client.Remove("/Team/archive/report.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveDirectory("/Team/archive"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Stat("/Team/archive"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat removed directory: %v", err)
+	}
+
+	if _, err := client.OpenFile("/Team/log.txt", os.O_WRONLY|os.O_CREATE|os.O_APPEND); err == nil {
+		t.Error("file was opened for appending")
+	}
+}
+
+// seekCounter is a webdav.File that counts how often it is repositioned
+type seekCounter struct {
+	*bytes.Reader
+	seeks int
+}
+
+func (s *seekCounter) Seek(offset int64, whence int) (int64, error) {
+	s.seeks++
+	return s.Reader.Seek(offset, whence)
+}
+
+func (s *seekCounter) Close() error                             { return nil }
+func (s *seekCounter) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (s *seekCounter) Stat() (os.FileInfo, error)               { return nil, os.ErrInvalid }
+func (s *seekCounter) Write(p []byte) (int, error)              { return 0, os.ErrPermission }
+
+func TestReaderAtToleratesReordering(t *testing.T) {
+	content := make([]byte, 4<<20)
+	_, _ = rand.Read(content)
+	f := &seekCounter{Reader: bytes.NewReader(content)}
+	r := &readerAt{file: f}
+
+	// Pipelined reads of 32 KiB blocks, each pair arriving swapped
+	const block = 32 << 10
+	var offsets []int64
+	for off := int64(0); off < int64(len(content)); off += 2 * block {
+		offsets = append(offsets, off+block, off)
+	}
+	for _, off := range offsets {
+		p := make([]byte, block)
+		n, err := r.ReadAt(p, off)
+		if err != nil && err != io.EOF {
+			t.Fatalf("ReadAt(%d): %v", off, err)
+		}
+		if !bytes.Equal(p[:n], content[off:off+int64(n)]) {
+			t.Fatalf("ReadAt(%d) returned the wrong content", off)
+		}
+	}
+	if f.seeks != 0 {
+		t.Errorf("stream repositioned %d times for reordered reads", f.seeks)
+	}
+
+	// A real seek back to the start reopens the stream
+	p := make([]byte, 16)
+	if _, err := r.ReadAt(p, 0); err != nil {
+		t.Fatal(err)
+	}
+	if f.seeks != 1 || !bytes.Equal(p, content[:16]) {
+		t.Errorf("after seeking back: %d seeks, content match %v", f.seeks, bytes.Equal(p, content[:16]))
+	}
+
+	// Reads past the end report io.EOF
+	if n, err := r.ReadAt(p, int64(len(content))-8); n != 8 || err != io.EOF {
+		t.Errorf("read at end = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,13 @@
+package sshkey
+
+import "errors"
+
+var (
+	ErrSSHKeyNotFound     = errors.New("SSH key not found")
+	ErrSSHKeyExists       = errors.New("SSH key is already in use")
+	ErrNameRequired       = errors.New("name is required")
+	ErrNameTooLong        = errors.New("name must be at most 255 characters")
+	ErrInvalidPublicKey   = errors.New("public key must be a single line in authorized_keys format")
+	ErrWeakPublicKey      = errors.New("RSA keys must be at least 2048 bits")
+	ErrInvalidCredentials = errors.New("invalid email or SSH key")
+)
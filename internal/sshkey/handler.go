@@ -0,0 +1,144 @@
+package sshkey
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+)
+
+// Handler handles SSH key requests under /me/ssh-keys
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new SSH key handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// SSHKeyResponse represents an SSH key in API responses
+type SSHKeyResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	PublicKey   string `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+	CreatedAt   string `json:"created_at"`
+	LastUsedAt  string `json:"last_used_at,omitempty"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Add handles POST /me/ssh-keys
+func (h *Handler) Add(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input AddSSHKeyInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	k, err := h.service.Add(r.Context(), userID, &input)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, toSSHKeyResponse(k))
+}
+
+// List handles GET /me/ssh-keys
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	response := make([]SSHKeyResponse, len(keys))
+	for i, k := range keys {
+		response[i] = toSSHKeyResponse(k)
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// Delete handles DELETE /me/ssh-keys/{sshKeyId}
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "sshKeyId"))
+	if err != nil {
+		respondError(w, "Invalid SSH key ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), userID, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Helper functions
+
+func handleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrSSHKeyNotFound):
+		respondError(w, "SSH key not found", http.StatusNotFound)
+	case errors.Is(err, ErrSSHKeyExists):
+		respondError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrNameRequired), errors.Is(err, ErrNameTooLong),
+		errors.Is(err, ErrInvalidPublicKey), errors.Is(err, ErrWeakPublicKey):
+		respondError(w, err.Error(), http.StatusBadRequest)
+	default:
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func toSSHKeyResponse(k *SSHKey) SSHKeyResponse {
+	response := SSHKeyResponse{
+		ID:          k.ID.String(),
+		Name:        k.Name,
+		PublicKey:   k.PublicKey,
+		Fingerprint: k.Fingerprint,
+		CreatedAt:   k.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if k.LastUsedAt != nil {
+		response.LastUsedAt = k.LastUsedAt.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func respondError(w http.ResponseWriter, message string, status int) {
+	respondJSON(w, status, ErrorResponse{Error: message})
+}
@@ -0,0 +1,36 @@
+package sshkey
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SSHKey is a public key a user signs in to the SFTP listener with
+type SSHKey struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	PublicKey   string     `json:"public_key" db:"public_key"`   // authorized_keys format, without a comment
+	Fingerprint string     `json:"fingerprint" db:"fingerprint"` // e.g. "SHA256:..."
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+}
+
+// AddSSHKeyInput represents the input for adding an SSH key
+type AddSSHKeyInput struct {
+	Name      string `json:"name"`       // Defaults to the key's comment
+	PublicKey string `json:"public_key"` // A line from an authorized_keys or .pub file
+}
+
+// Validate validates the add SSH key input. The key itself is checked when
+// it is parsed.
+func (a *AddSSHKeyInput) Validate() error {
+	if a.Name == "" {
+		return ErrNameRequired
+	}
+	if len(a.Name) > 255 {
+		return ErrNameTooLong
+	}
+	return nil
+}
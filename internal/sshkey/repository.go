@@ -0,0 +1,119 @@
+package sshkey
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Repository defines the interface for SSH key storage
+type Repository interface {
+	// Create inserts a key, or returns ErrSSHKeyExists if any account has it
+	Create(ctx context.Context, k *SSHKey) error
+	GetByFingerprint(ctx context.Context, fingerprint string) (*SSHKey, error)
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]*SSHKey, error)
+	// Delete removes one of the user's SSH keys
+	Delete(ctx context.Context, id, userID uuid.UUID) error
+	TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// PostgresRepository implements Repository using PostgreSQL
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository creates a new PostgresRepository
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+const sshKeyColumns = `id, user_id, name, public_key, fingerprint, created_at, last_used_at`
+
+// Create inserts a new SSH key
+func (r *PostgresRepository) Create(ctx context.Context, k *SSHKey) error {
+	query := `
+		INSERT INTO ssh_keys (id, user_id, name, public_key, fingerprint, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := r.db.ExecContext(ctx, query, k.ID, k.UserID, k.Name, k.PublicKey, k.Fingerprint, k.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrSSHKeyExists
+	}
+	return err
+}
+
+// GetByFingerprint retrieves an SSH key by its fingerprint
+func (r *PostgresRepository) GetByFingerprint(ctx context.Context, fingerprint string) (*SSHKey, error) {
+	query := `SELECT ` + sshKeyColumns + ` FROM ssh_keys WHERE fingerprint = $1`
+	k, err := scanSSHKey(r.db.QueryRowContext(ctx, query, fingerprint))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSSHKeyNotFound
+		}
+		return nil, err
+	}
+	return k, nil
+}
+
+// ListByUserID retrieves a user's SSH keys, oldest first
+func (r *PostgresRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*SSHKey, error) {
+	query := `SELECT ` + sshKeyColumns + ` FROM ssh_keys WHERE user_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var keys []*SSHKey
+	for rows.Next() {
+		k, err := scanSSHKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// Delete removes one of a user's SSH keys
+func (r *PostgresRepository) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM ssh_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrSSHKeyNotFound
+	}
+	return nil
+}
+
+// TouchLastUsed records when an SSH key was last used
+func (r *PostgresRepository) TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE ssh_keys SET last_used_at = $1 WHERE id = $2`, at, id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSSHKey(row scanner) (*SSHKey, error) {
+	k := &SSHKey{}
+	var lastUsedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.PublicKey, &k.Fingerprint, &k.CreatedAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	return k, nil
+}
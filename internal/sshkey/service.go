@@ -0,0 +1,169 @@
+package sshkey
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/user"
+)
+
+// lastUsedResolution limits how often use of a key is written back
+const lastUsedResolution = 5 * time.Minute
+
+// minRSABits is the smallest RSA key accepted
+const minRSABits = 2048
+
+// Service manages users' SSH keys and authenticates clients that use them
+type Service struct {
+	repo        Repository
+	userService *user.Service
+	audit       audit.Recorder
+}
+
+// NewService creates a new SSH key service
+func NewService(repo Repository, userService *user.Service, recorder audit.Recorder) *Service {
+	return &Service{repo: repo, userService: userService, audit: recorder}
+}
+
+// Add registers a public key for the user. The key's comment names it
+// unless a name is given.
+func (s *Service) Add(ctx context.Context, userID uuid.UUID, input *AddSSHKeyInput) (*SSHKey, error) {
+	key, err := ParsePublicKey(input.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if input.Name == "" {
+		_, comment, _, _, _ := ssh.ParseAuthorizedKey([]byte(input.PublicKey))
+		input.Name = comment
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	k := &SSHKey{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Name:        input.Name,
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repo.Create(ctx, k); err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, audit.ActionSSHKeyAdded, k)
+
+	return k, nil
+}
+
+// List lists the user's SSH keys
+func (s *Service) List(ctx context.Context, userID uuid.UUID) ([]*SSHKey, error) {
+	return s.repo.ListByUserID(ctx, userID)
+}
+
+// Delete removes one of the user's SSH keys
+func (s *Service) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	if err := s.repo.Delete(ctx, id, userID); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.ActionSSHKeyDeleted, &SSHKey{ID: id, UserID: userID})
+
+	return nil
+}
+
+// Authenticate returns the user signing in with an email and public key.
+// It returns ErrInvalidCredentials unless the key is registered to the
+// account with that email, and user.ErrAccountDisabled for disabled
+// accounts. The caller must have checked that the client holds the
+// private key.
+func (s *Service) Authenticate(ctx context.Context, email string, key ssh.PublicKey) (*user.User, error) {
+	k, err := s.repo.GetByFingerprint(ctx, ssh.FingerprintSHA256(key))
+	if err != nil {
+		if errors.Is(err, ErrSSHKeyNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if !bytes.Equal(wireFormat(k), key.Marshal()) {
+		return nil, ErrInvalidCredentials
+	}
+
+	u, err := s.userService.GetByID(ctx, k.UserID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if !strings.EqualFold(u.Email, email) {
+		return nil, ErrInvalidCredentials
+	}
+	if u.IsDisabled() {
+		return nil, user.ErrAccountDisabled
+	}
+
+	now := time.Now()
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) > lastUsedResolution {
+		if err := s.repo.TouchLastUsed(ctx, k.ID, now); err != nil {
+			log.Printf("Failed to record use of SSH key %s: %v", k.ID, err)
+		}
+	}
+
+	return u, nil
+}
+
+// ParsePublicKey parses a single public key in authorized_keys format.
+// Certificates and RSA keys shorter than 2048 bits are rejected.
+func ParsePublicKey(line string) (ssh.PublicKey, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.ContainsAny(line, "\r\n") {
+		return nil, ErrInvalidPublicKey
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	if _, ok := key.(*ssh.Certificate); ok {
+		return nil, ErrInvalidPublicKey
+	}
+	if cryptoKey, ok := key.(ssh.CryptoPublicKey); ok {
+		if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSABits {
+			return nil, ErrWeakPublicKey
+		}
+	}
+	return key, nil
+}
+
+// wireFormat returns a stored key as clients present it
+func wireFormat(k *SSHKey) []byte {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k.PublicKey))
+	if err != nil {
+		return nil
+	}
+	return key.Marshal()
+}
+
+// record writes an audit event for a change to an SSH key
+func (s *Service) record(ctx context.Context, action string, k *SSHKey) {
+	event := &audit.Event{
+		ActorID:    k.UserID,
+		Action:     action,
+		TargetType: audit.TargetSSHKey,
+		TargetID:   k.ID.String(),
+	}
+	if k.Fingerprint != "" {
+		event.Metadata = map[string]string{"name": k.Name, "fingerprint": k.Fingerprint}
+	}
+	s.audit.Record(ctx, event)
+}
@@ -9,4 +9,11 @@ var (
 	ErrPasswordRequired = errors.New("password is required")
 	ErrPasswordTooShort = errors.New("password must be at least 8 characters")
 	ErrInvalidPassword  = errors.New("invalid password")
+
+	ErrDisplayNameTooLong = errors.New("display name must be at most 255 characters")
+	ErrAccountDisabled    = errors.New("account is disabled")
+
+	ErrEmailNotVerified     = errors.New("email address is not verified")
+	ErrEmailAlreadyVerified = errors.New("email address is already verified")
+	ErrEmailMismatch        = errors.New("email address has changed since verification was requested")
 )
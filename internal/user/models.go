@@ -8,11 +8,52 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	Email        string    `json:"email" db:"email"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Email           string     `json:"email" db:"email"`
+	DisplayName     string     `json:"display_name" db:"display_name"`
+	ExternalID      string     `json:"external_id,omitempty" db:"external_id"` // Set by SCIM provisioning
+	PasswordHash    string     `json:"-" db:"password_hash"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+	IsAdmin         bool       `json:"is_admin" db:"is_admin"`
+	DisabledAt      *time.Time `json:"disabled_at,omitempty" db:"disabled_at"`
+	TokenGeneration int        `json:"-" db:"token_generation"` // Refresh tokens from earlier generations are revoked
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// IsEmailVerified reports whether the user has verified their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// IsDisabled reports whether the account has been disabled by an administrator
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// ListOptions controls user listing and search
+type ListOptions struct {
+	Query      string // Case-insensitive substring of email or display name
+	Email      string // Case-insensitive exact email match
+	ExternalID string // Exact external ID match
+	Limit      int
+	Offset     int
+}
+
+// VerificationPolicy controls what unverified accounts are allowed to do
+type VerificationPolicy string
+
+const (
+	// VerificationPolicyOff places no restrictions on unverified accounts
+	VerificationPolicyOff VerificationPolicy = "off"
+	// VerificationPolicyRestricted lets unverified accounts log in and read,
+	// but blocks uploads and group invites until the email is verified
+	VerificationPolicyRestricted VerificationPolicy = "restricted"
+)
+
+// Valid reports whether p is a known policy
+func (p VerificationPolicy) Valid() bool {
+	return p == VerificationPolicyOff || p == VerificationPolicyRestricted
 }
 
 // CreateUserInput represents the input for creating a new user
@@ -26,10 +67,27 @@ func (c *CreateUserInput) Validate() error {
 	if c.Email == "" {
 		return ErrEmailRequired
 	}
-	if c.Password == "" {
+	return validatePassword(c.Password)
+}
+
+// UpdateProfileInput represents the editable profile fields
+type UpdateProfileInput struct {
+	DisplayName string `json:"display_name"`
+}
+
+// Validate validates the update profile input
+func (u *UpdateProfileInput) Validate() error {
+	if len(u.DisplayName) > 255 {
+		return ErrDisplayNameTooLong
+	}
+	return nil
+}
+
+func validatePassword(password string) error {
+	if password == "" {
 		return ErrPasswordRequired
 	}
-	if len(c.Password) < 8 {
+	if len(password) < 8 {
 		return ErrPasswordTooShort
 	}
 	return nil
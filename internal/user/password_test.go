@@ -0,0 +1,138 @@
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams keeps the tests fast; production uses DefaultArgon2Params
+var testParams = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHasher_HashAndVerify(t *testing.T) {
+	h := NewPasswordHasher(testParams)
+
+	hash, err := h.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("unexpected hash format: %s", hash)
+	}
+
+	ok, needsRehash, err := h.Verify("correct horse battery staple", hash)
+	if err != nil {
+		t.Fatalf("failed to verify password: %v", err)
+	}
+	if !ok {
+		t.Error("expected password to match")
+	}
+	if needsRehash {
+		t.Error("expected no rehash for current parameters")
+	}
+
+	ok, _, err = h.Verify("wrong password", hash)
+	if err != nil {
+		t.Fatalf("failed to verify password: %v", err)
+	}
+	if ok {
+		t.Error("expected wrong password not to match")
+	}
+}
+
+func TestPasswordHasher_SaltsAreUnique(t *testing.T) {
+	h := NewPasswordHasher(testParams)
+
+	first, err := h.Hash("password123")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	second, err := h.Hash("password123")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	if first == second {
+		t.Error("expected different hashes for the same password")
+	}
+}
+
+func TestPasswordHasher_LongPasswordsAreNotTruncated(t *testing.T) {
+	h := NewPasswordHasher(testParams)
+
+	long := strings.Repeat("a", 100)
+	hash, err := h.Hash(long)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	// bcrypt would consider these equal because it only uses 72 bytes
+	ok, _, err := h.Verify(strings.Repeat("a", 72)+strings.Repeat("b", 28), hash)
+	if err != nil {
+		t.Fatalf("failed to verify password: %v", err)
+	}
+	if ok {
+		t.Error("expected passwords differing after 72 bytes not to match")
+	}
+}
+
+func TestPasswordHasher_BcryptNeedsRehash(t *testing.T) {
+	h := NewPasswordHasher(testParams)
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to create bcrypt hash: %v", err)
+	}
+
+	ok, needsRehash, err := h.Verify("password123", string(legacy))
+	if err != nil {
+		t.Fatalf("failed to verify password: %v", err)
+	}
+	if !ok {
+		t.Error("expected bcrypt password to match")
+	}
+	if !needsRehash {
+		t.Error("expected bcrypt hash to need rehash")
+	}
+
+	ok, needsRehash, err = h.Verify("wrong password", string(legacy))
+	if err != nil {
+		t.Fatalf("failed to verify password: %v", err)
+	}
+	if ok || needsRehash {
+		t.Error("expected wrong password not to match or need rehash")
+	}
+}
+
+func TestPasswordHasher_OutdatedParamsNeedRehash(t *testing.T) {
+	old := NewPasswordHasher(testParams)
+	hash, err := old.Hash("password123")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	stronger := testParams
+	stronger.Iterations = 2
+	h := NewPasswordHasher(stronger)
+
+	ok, needsRehash, err := h.Verify("password123", hash)
+	if err != nil {
+		t.Fatalf("failed to verify password: %v", err)
+	}
+	if !ok {
+		t.Error("expected password to match with old parameters")
+	}
+	if !needsRehash {
+		t.Error("expected outdated parameters to need rehash")
+	}
+}
+
+func TestPasswordHasher_MalformedHash(t *testing.T) {
+	h := NewPasswordHasher(testParams)
+
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$m=1024", "$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		if _, _, err := h.Verify("password123", hash); err == nil {
+			t.Errorf("expected error for malformed hash %q", hash)
+		}
+	}
+}
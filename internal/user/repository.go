@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/pagination"
 )
 
 // Repository defines the interface for user data operations
@@ -15,6 +17,14 @@ type Repository interface {
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	Update(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	List(ctx context.Context, opts *ListOptions) ([]*User, int, error)
+	SetAdmin(ctx context.Context, id uuid.UUID, isAdmin bool) error
+	SetDisabledAt(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error
+	// RevokeTokens invalidates the refresh tokens issued to the user so far
+	RevokeTokens(ctx context.Context, id uuid.UUID) error
+	// RehashPassword replaces the user's password hash with newHash if it is
+	// still oldHash, leaving a password changed in the meantime alone
+	RehashPassword(ctx context.Context, id uuid.UUID, oldHash, newHash string) error
 }
 
 // PostgresRepository implements Repository using PostgreSQL
@@ -30,11 +40,13 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 // Create inserts a new user into the database
 func (r *PostgresRepository) Create(ctx context.Context, user *User) error {
 	query := `
-		INSERT INTO users (id, email, password_hash, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO users (id, email, display_name, external_id, password_hash, email_verified_at, is_admin,
+			created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9)
 	`
 	_, err := r.db.ExecContext(ctx, query,
-		user.ID, user.Email, user.PasswordHash, user.CreatedAt, user.UpdatedAt)
+		user.ID, user.Email, user.DisplayName, user.ExternalID, user.PasswordHash, user.EmailVerifiedAt,
+		user.IsAdmin, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
 		// Check for unique constraint violation
 		if isUniqueViolation(err) {
@@ -48,13 +60,15 @@ func (r *PostgresRepository) Create(ctx context.Context, user *User) error {
 // GetByID retrieves a user by ID
 func (r *PostgresRepository) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
 	query := `
-		SELECT id, email, password_hash, created_at, updated_at
+		SELECT id, email, display_name, COALESCE(external_id, ''), password_hash, email_verified_at,
+			is_admin, disabled_at, token_generation, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
 	user := &User{}
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+		&user.ID, &user.Email, &user.DisplayName, &user.ExternalID, &user.PasswordHash, &user.EmailVerifiedAt,
+		&user.IsAdmin, &user.DisabledAt, &user.TokenGeneration, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -67,13 +81,15 @@ func (r *PostgresRepository) GetByID(ctx context.Context, id uuid.UUID) (*User,
 // GetByEmail retrieves a user by email
 func (r *PostgresRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, email, password_hash, created_at, updated_at
+		SELECT id, email, display_name, COALESCE(external_id, ''), password_hash, email_verified_at,
+			is_admin, disabled_at, token_generation, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
 	user := &User{}
 	err := r.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+		&user.ID, &user.Email, &user.DisplayName, &user.ExternalID, &user.PasswordHash, &user.EmailVerifiedAt,
+		&user.IsAdmin, &user.DisabledAt, &user.TokenGeneration, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -87,10 +103,12 @@ func (r *PostgresRepository) GetByEmail(ctx context.Context, email string) (*Use
 func (r *PostgresRepository) Update(ctx context.Context, user *User) error {
 	query := `
 		UPDATE users
-		SET email = $1, password_hash = $2, updated_at = NOW()
-		WHERE id = $3
+		SET email = $1, display_name = $2, external_id = NULLIF($3, ''), password_hash = $4,
+			email_verified_at = $5, updated_at = NOW()
+		WHERE id = $6
 	`
-	result, err := r.db.ExecContext(ctx, query, user.Email, user.PasswordHash, user.ID)
+	result, err := r.db.ExecContext(ctx, query,
+		user.Email, user.DisplayName, user.ExternalID, user.PasswordHash, user.EmailVerifiedAt, user.ID)
 	if err != nil {
 		if isUniqueViolation(err) {
 			return ErrEmailExists
@@ -124,6 +142,89 @@ func (r *PostgresRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// List retrieves users matching the options, newest first, along with the
+// total number of matches
+func (r *PostgresRepository) List(ctx context.Context, opts *ListOptions) ([]*User, int, error) {
+	query := `
+		SELECT id, email, display_name, COALESCE(external_id, ''), password_hash, email_verified_at,
+			is_admin, disabled_at, token_generation, created_at, updated_at, COUNT(*) OVER()
+		FROM users
+		WHERE ($1 = '' OR email ILIKE $1 OR display_name ILIKE $1)
+			AND ($4 = '' OR LOWER(email) = LOWER($4))
+			AND ($5 = '' OR external_id = $5)
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3
+	`
+	pattern := ""
+	if opts.Query != "" {
+		pattern = "%" + pagination.EscapeLike(opts.Query) + "%"
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, pattern, opts.Limit, opts.Offset, opts.Email, opts.ExternalID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var users []*User
+	total := 0
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(
+			&user.ID, &user.Email, &user.DisplayName, &user.ExternalID, &user.PasswordHash, &user.EmailVerifiedAt,
+			&user.IsAdmin, &user.DisabledAt, &user.TokenGeneration, &user.CreatedAt, &user.UpdatedAt, &total); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// SetAdmin grants or revokes site administrator rights
+func (r *PostgresRepository) SetAdmin(ctx context.Context, id uuid.UUID, isAdmin bool) error {
+	query := `UPDATE users SET is_admin = $1, updated_at = NOW() WHERE id = $2`
+	return r.execOne(ctx, query, isAdmin, id)
+}
+
+// SetDisabledAt disables the account, or re-enables it when disabledAt is nil
+func (r *PostgresRepository) SetDisabledAt(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error {
+	query := `UPDATE users SET disabled_at = $1, updated_at = NOW() WHERE id = $2`
+	return r.execOne(ctx, query, disabledAt, id)
+}
+
+// RevokeTokens bumps the user's token generation, which refresh tokens
+// issued before now no longer match
+func (r *PostgresRepository) RevokeTokens(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE users SET token_generation = token_generation + 1, updated_at = NOW() WHERE id = $1`
+	return r.execOne(ctx, query, id)
+}
+
+// RehashPassword replaces only the password hash, so a login upgrading the
+// hash cannot overwrite a profile or email change made at the same time.
+// No rows are updated if the password changed since oldHash was read, which
+// is not an error.
+func (r *PostgresRepository) RehashPassword(ctx context.Context, id uuid.UUID, oldHash, newHash string) error {
+	query := `UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2 AND password_hash = $3`
+	_, err := r.db.ExecContext(ctx, query, newHash, id, oldHash)
+	return err
+}
+
+// execOne runs an update that must affect exactly one user
+func (r *PostgresRepository) execOne(ctx context.Context, query string, args ...interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
 // isUniqueViolation checks if the error is a unique constraint violation
 func isUniqueViolation(err error) bool {
 	// PostgreSQL unique violation error code is 23505
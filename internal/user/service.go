@@ -2,20 +2,22 @@ package user
 
 import (
 	"context"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Service provides user-related business logic
 type Service struct {
-	repo Repository
+	repo   Repository
+	hasher *PasswordHasher
+	policy VerificationPolicy
 }
 
 // NewService creates a new user service
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo Repository, hasher *PasswordHasher, policy VerificationPolicy) *Service {
+	return &Service{repo: repo, hasher: hasher, policy: policy}
 }
 
 // Register creates a new user with hashed password
@@ -25,7 +27,7 @@ func (s *Service) Register(ctx context.Context, input *CreateUserInput) (*User,
 	}
 
 	// Hash the password
-	hashedPassword, err := hashPassword(input.Password)
+	hashedPassword, err := s.hasher.Hash(input.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -53,9 +55,30 @@ func (s *Service) Authenticate(ctx context.Context, email, password string) (*Us
 		return nil, err
 	}
 
-	if !checkPassword(password, user.PasswordHash) {
+	ok, needsRehash, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
 		return nil, ErrInvalidPassword
 	}
+	if user.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+
+	// Upgrade legacy or outdated hashes while the plaintext is available.
+	// Failure here must not block the login.
+	if needsRehash {
+		if rehashed, err := s.hasher.Hash(password); err != nil {
+			log.Printf("Failed to rehash password for user %s: %v", user.ID, err)
+		} else {
+			if err := s.repo.RehashPassword(ctx, user.ID, user.PasswordHash, rehashed); err != nil {
+				log.Printf("Failed to store rehashed password for user %s: %v", user.ID, err)
+			} else {
+				user.PasswordHash = rehashed
+			}
+		}
+	}
 
 	return user, nil
 }
@@ -70,27 +93,225 @@ func (s *Service) GetByEmail(ctx context.Context, email string) (*User, error) {
 	return s.repo.GetByEmail(ctx, email)
 }
 
-// hashPassword hashes a password using bcrypt
-func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// UpdateProfile updates the user's editable profile fields
+func (s *Service) UpdateProfile(ctx context.Context, id uuid.UUID, input *UpdateProfileInput) (*User, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.DisplayName = input.DisplayName
+	if err := s.repo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ChangePassword replaces the user's password after confirming the current
+// one, and revokes the refresh tokens issued before the change
+func (s *Service) ChangePassword(ctx context.Context, id uuid.UUID, currentPassword, newPassword string) error {
+	user, err := s.checkCurrentPassword(ctx, id, currentPassword)
+	if err != nil {
+		return err
+	}
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	user.PasswordHash = hashedPassword
+	if err := s.repo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	// Sessions started with the old password must sign in again
+	return s.repo.RevokeTokens(ctx, id)
+}
+
+// ChangeEmail replaces the user's email after confirming the current
+// password. The new address starts out unverified.
+func (s *Service) ChangeEmail(ctx context.Context, id uuid.UUID, currentPassword, newEmail string) (*User, error) {
+	if newEmail == "" {
+		return nil, ErrEmailRequired
+	}
+
+	user, err := s.checkCurrentPassword(ctx, id, currentPassword)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if user.Email == newEmail {
+		return user, nil
+	}
+
+	user.Email = newEmail
+	user.EmailVerifiedAt = nil
+	if err := s.repo.Update(ctx, user); err != nil {
+		return nil, err
 	}
-	return string(bytes), nil
+	return user, nil
 }
 
-// checkPassword compares a password with a hash
-func checkPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// Delete removes the user. Callers are responsible for confirming the
+// user's password and resolving group ownership first.
+func (s *Service) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// CheckPassword confirms the user's current password without logging in
+func (s *Service) CheckPassword(ctx context.Context, id uuid.UUID, password string) error {
+	_, err := s.checkCurrentPassword(ctx, id, password)
+	return err
+}
+
+func (s *Service) checkCurrentPassword(ctx context.Context, id uuid.UUID, password string) (*User, error) {
+	if password == "" {
+		return nil, ErrPasswordRequired
+	}
+
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, _, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidPassword
+	}
+	return user, nil
+}
+
+// VerifyEmail marks the user's email as verified. The email must match the
+// one the verification was issued for, so stale links cannot verify an
+// address the user has since changed.
+func (s *Service) VerifyEmail(ctx context.Context, id uuid.UUID, email string) (*User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Email != email {
+		return nil, ErrEmailMismatch
+	}
+	if user.IsEmailVerified() {
+		return user, nil
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	if err := s.repo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// RequireVerifiedEmail returns ErrEmailNotVerified if the verification policy
+// forbids the user from performing write actions such as uploads and invites
+func (s *Service) RequireVerifiedEmail(ctx context.Context, id uuid.UUID) error {
+	if s.policy != VerificationPolicyRestricted {
+		return nil
+	}
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !user.IsEmailVerified() {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// CheckActive returns ErrAccountDisabled if the user has been disabled, or
+// ErrUserNotFound if the account no longer exists
+func (s *Service) CheckActive(ctx context.Context, id uuid.UUID) error {
+	_, err := s.GetActive(ctx, id)
+	return err
+}
+
+// GetActive retrieves a user, failing like CheckActive if the account is
+// disabled or gone
+func (s *Service) GetActive(ctx context.Context, id uuid.UUID) (*User, error) {
+	user, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+	return user, nil
+}
+
+// List retrieves users matching the options along with the total count
+func (s *Service) List(ctx context.Context, opts *ListOptions) ([]*User, int, error) {
+	if opts.Limit <= 0 || opts.Limit > 200 {
+		opts.Limit = 50
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+	return s.repo.List(ctx, opts)
+}
+
+// SetDisabled disables or re-enables a user's account
+func (s *Service) SetDisabled(ctx context.Context, id uuid.UUID, disabled bool) (*User, error) {
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now()
+		disabledAt = &now
+	}
+	if err := s.repo.SetDisabledAt(ctx, id, disabledAt); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+// SetAdmin grants or revokes site administrator rights
+func (s *Service) SetAdmin(ctx context.Context, id uuid.UUID, isAdmin bool) (*User, error) {
+	if err := s.repo.SetAdmin(ctx, id, isAdmin); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+// EnsureAdmins grants site administrator rights to the existing accounts with
+// the given emails. Unknown emails are skipped.
+func (s *Service) EnsureAdmins(ctx context.Context, emails []string) error {
+	for _, email := range emails {
+		user, err := s.repo.GetByEmail(ctx, email)
+		if err != nil {
+			if err == ErrUserNotFound {
+				log.Printf("Bootstrap admin %s has not registered yet", email)
+				continue
+			}
+			return err
+		}
+		if user.IsAdmin {
+			continue
+		}
+		if err := s.repo.SetAdmin(ctx, user.ID, true); err != nil {
+			return err
+		}
+		log.Printf("Granted site admin to %s", email)
+	}
+	return nil
 }
 
 // HashPassword is exported for testing
 func HashPassword(password string) (string, error) {
-	return hashPassword(password)
+	return NewPasswordHasher(DefaultArgon2Params()).Hash(password)
 }
 
 // CheckPassword is exported for testing
 func CheckPassword(password, hash string) bool {
-	return checkPassword(password, hash)
+	ok, _, err := NewPasswordHasher(DefaultArgon2Params()).Verify(password, hash)
+	return err == nil && ok
 }
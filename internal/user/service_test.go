@@ -0,0 +1,213 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memRepo is an in-memory Repository
+type memRepo struct {
+	Repository
+	mu    sync.Mutex
+	users map[uuid.UUID]*User
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{users: make(map[uuid.UUID]*User)}
+}
+
+func (m *memRepo) Create(ctx context.Context, u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *u
+	m.users[u.ID] = &copied
+	return nil
+}
+
+func (m *memRepo) GetByID(ctx context.Context, id uuid.UUID) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (m *memRepo) GetByEmail(ctx context.Context, email string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Email == email {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (m *memRepo) Update(ctx context.Context, u *User) error {
+	return m.Create(ctx, u)
+}
+
+func (m *memRepo) RehashPassword(ctx context.Context, id uuid.UUID, oldHash, newHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.users[id]; ok && u.PasswordHash == oldHash {
+		u.PasswordHash = newHash
+	}
+	return nil
+}
+
+// racingRepo runs change after a user is read by email, as if another
+// request updated the account while a login checked the password
+type racingRepo struct {
+	*memRepo
+	change func(u *User)
+}
+
+func (r *racingRepo) GetByEmail(ctx context.Context, email string) (*User, error) {
+	u, err := r.memRepo.GetByEmail(ctx, email)
+	if err == nil && r.change != nil {
+		r.mu.Lock()
+		r.change(r.users[u.ID])
+		r.mu.Unlock()
+	}
+	return u, err
+}
+
+// newTestUser registers a user with the password "password123"
+func newTestUser(t *testing.T, svc *Service, email string) *User {
+	t.Helper()
+	u, err := svc.Register(context.Background(), &CreateUserInput{Email: email, Password: "password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestAuthenticateRehashKeepsConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	legacy, err := NewPasswordHasher(testParams).Hash("password123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stronger := testParams
+	stronger.Iterations = 2
+	hasher := NewPasswordHasher(stronger)
+
+	repo := &racingRepo{memRepo: newMemRepo()}
+	u := &User{ID: uuid.New(), Email: "a@example.com", PasswordHash: legacy}
+	_ = repo.Create(ctx, u)
+	svc := NewService(repo, hasher, VerificationPolicyOff)
+
+	// A profile edit racing the login survives the rehash
+	repo.change = func(u *User) { u.DisplayName = "Renamed" }
+	if _, err := svc.Authenticate(ctx, "a@example.com", "password123"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	stored, _ := repo.GetByID(ctx, u.ID)
+	if stored.DisplayName != "Renamed" {
+		t.Errorf("display name = %q, want the concurrent edit kept", stored.DisplayName)
+	}
+	if stored.PasswordHash == legacy {
+		t.Error("password was not rehashed")
+	}
+	if ok, needsRehash, _ := hasher.Verify("password123", stored.PasswordHash); !ok || needsRehash {
+		t.Errorf("rehashed password ok = %v, needsRehash = %v", ok, needsRehash)
+	}
+
+	// A password change racing the login is not undone
+	_ = repo.Create(ctx, &User{ID: u.ID, Email: u.Email, PasswordHash: legacy})
+	changed, err := hasher.Hash("new-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.change = func(u *User) { u.PasswordHash = changed }
+	if _, err := svc.Authenticate(ctx, "a@example.com", "password123"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if stored, _ := repo.GetByID(ctx, u.ID); stored.PasswordHash != changed {
+		t.Error("rehash overwrote a concurrent password change")
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	svc := NewService(newMemRepo(), NewPasswordHasher(testParams), VerificationPolicyRestricted)
+	ctx := context.Background()
+	u := newTestUser(t, svc, "old@example.com")
+
+	// A link issued for the old address cannot verify the new one
+	if _, err := svc.ChangeEmail(ctx, u.ID, "password123", "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.VerifyEmail(ctx, u.ID, "old@example.com"); !errors.Is(err, ErrEmailMismatch) {
+		t.Fatalf("VerifyEmail(old address) error = %v, want ErrEmailMismatch", err)
+	}
+	if got, _ := svc.GetByID(ctx, u.ID); got.IsEmailVerified() {
+		t.Fatal("stale link verified the new address")
+	}
+
+	verified, err := svc.VerifyEmail(ctx, u.ID, "new@example.com")
+	if err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if !verified.IsEmailVerified() {
+		t.Fatal("email not verified")
+	}
+
+	// Verifying again keeps the original time
+	again, err := svc.VerifyEmail(ctx, u.ID, "new@example.com")
+	if err != nil {
+		t.Fatalf("VerifyEmail(already verified): %v", err)
+	}
+	if !again.EmailVerifiedAt.Equal(*verified.EmailVerifiedAt) {
+		t.Errorf("verified at = %v, want %v", again.EmailVerifiedAt, verified.EmailVerifiedAt)
+	}
+
+	// Changing the address again starts it out unverified
+	changed, err := svc.ChangeEmail(ctx, u.ID, "password123", "newer@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.IsEmailVerified() {
+		t.Error("changed address is verified")
+	}
+
+	if _, err := svc.VerifyEmail(ctx, uuid.New(), "new@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("VerifyEmail(unknown user) error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	repo := newMemRepo()
+	unverified := &User{ID: uuid.New(), Email: "unverified@example.com"}
+	verified := &User{ID: uuid.New(), Email: "verified@example.com", EmailVerifiedAt: &now}
+	_ = repo.Create(ctx, unverified)
+	_ = repo.Create(ctx, verified)
+
+	tests := []struct {
+		policy VerificationPolicy
+		id     uuid.UUID
+		want   error
+	}{
+		{VerificationPolicyRestricted, unverified.ID, ErrEmailNotVerified},
+		{VerificationPolicyRestricted, verified.ID, nil},
+		{VerificationPolicyRestricted, uuid.New(), ErrUserNotFound},
+		{VerificationPolicyOff, unverified.ID, nil},
+	}
+	for _, tc := range tests {
+		svc := NewService(repo, nil, tc.policy)
+		if err := svc.RequireVerifiedEmail(ctx, tc.id); !errors.Is(err, tc.want) {
+			t.Errorf("policy %q: RequireVerifiedEmail error = %v, want %v", tc.policy, err, tc.want)
+		}
+	}
+}
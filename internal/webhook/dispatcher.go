@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/testifysec/dropbox-clone/internal/queue"
+)
+
+// DispatcherConfig controls delivery attempts
+type DispatcherConfig struct {
+	BatchSize    int           // Deliveries claimed and sent concurrently per poll
+	PollInterval time.Duration // Wait between polls when the queue is empty
+	Timeout      time.Duration // Per-request timeout
+	MaxAttempts  int           // Attempts before a delivery is marked failed
+	BackoffBase  time.Duration // Delay after the first failed attempt
+	BackoffMax   time.Duration
+	// AllowPrivateNetworks permits deliveries to loopback, private and
+	// link-local addresses. Leave off in production so subscriptions cannot
+	// reach internal services.
+	AllowPrivateNetworks bool
+}
+
+// Dispatcher sends queued deliveries. Any number of dispatchers, in one or
+// many replicas, may drain the same queue.
+type Dispatcher struct {
+	repo   Repository
+	cfg    DispatcherConfig
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewDispatcher creates a new Dispatcher
+func NewDispatcher(repo Repository, cfg DispatcherConfig) *Dispatcher {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateNetworks {
+		// Check the resolved address at connect time, so DNS cannot be used
+		// to point an approved hostname at an internal service
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Dispatcher{
+		repo: repo,
+		cfg:  cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			// Receivers must answer at the registered URL
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		now: time.Now,
+	}
+}
+
+// Run delivers queued webhooks until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	runner := &queue.Runner[*Delivery]{
+		Name:         "webhook deliveries",
+		BatchSize:    d.cfg.BatchSize,
+		PollInterval: d.cfg.PollInterval,
+		Lease:        d.cfg.Timeout + time.Minute,
+		Claim:        d.repo.ClaimDueDeliveries,
+		Handle:       d.deliver,
+	}
+	runner.Run(ctx)
+}
+
+// deliver makes one attempt and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery *Delivery) {
+	attempt := &Attempt{
+		Attempts:    delivery.Attempts + 1,
+		AttemptedAt: d.now(),
+	}
+
+	sub, err := d.repo.GetSubscription(ctx, delivery.SubscriptionID)
+	switch {
+	case errors.Is(err, ErrSubscriptionNotFound):
+		return // Deleted along with its deliveries
+	case err != nil:
+		attempt.Error = err.Error()
+	case !sub.Active:
+		attempt.Error = "webhook is disabled"
+		attempt.Attempts = delivery.Attempts
+		attempt.Status = StatusFailed
+		attempt.NextAttemptAt = attempt.AttemptedAt
+	default:
+		attempt.ResponseStatus, err = d.send(ctx, sub, delivery)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+	}
+
+	if attempt.Status == "" {
+		switch {
+		case attempt.Error == "":
+			attempt.Status = StatusSucceeded
+			attempt.NextAttemptAt = attempt.AttemptedAt
+		case attempt.Attempts >= d.cfg.MaxAttempts:
+			attempt.Status = StatusFailed
+			attempt.NextAttemptAt = attempt.AttemptedAt
+		default:
+			attempt.Status = StatusPending
+			attempt.NextAttemptAt = attempt.AttemptedAt.Add(jitter(queue.Backoff(attempt.Attempts, d.cfg.BackoffBase, d.cfg.BackoffMax)))
+		}
+	}
+
+	if err := d.repo.RecordAttempt(context.WithoutCancel(ctx), delivery.ID, attempt); err != nil {
+		log.Printf("Failed to record webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send posts the payload and returns the response status. Any non-2xx
+// response is an error.
+func (d *Dispatcher) send(ctx context.Context, sub *Subscription, delivery *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dropbox-clone-webhooks/1.0")
+	req.Header.Set("X-Webhook-Id", delivery.ID.String())
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, d.now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// jitter spreads retries by up to 10% so failed receivers are not hit by
+// synchronized bursts
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int64N(int64(d)/10+1))
+}
+
+// isPublicIP reports whether ip is a globally routable unicast address
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() &&
+		// Carrier-grade NAT (RFC 6598)
+		!(ip.To4() != nil && ip.To4()[0] == 100 && ip.To4()[1]&0xc0 == 64)
+}
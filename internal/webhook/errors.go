@@ -0,0 +1,15 @@
+package webhook
+
+import "errors"
+
+var (
+	ErrSubscriptionNotFound = errors.New("webhook not found")
+	ErrDeliveryNotFound     = errors.New("delivery not found")
+	ErrURLRequired          = errors.New("url is required")
+	ErrInvalidURL           = errors.New("url must be an absolute http or https URL")
+	ErrInvalidEventType     = errors.New("unknown event type")
+	ErrSecretTooShort       = errors.New("secret must be at least 16 characters")
+	ErrInvalidSignature     = errors.New("invalid webhook signature")
+	ErrSignatureExpired     = errors.New("webhook signature timestamp is outside the tolerance")
+	ErrForbiddenAddress     = errors.New("webhook address is not allowed")
+)
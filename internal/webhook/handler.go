@@ -0,0 +1,327 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/auth"
+	"github.com/testifysec/dropbox-clone/internal/group"
+)
+
+// Handler handles webhook management requests
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new webhook handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// SubscriptionResponse represents a webhook in API responses
+type SubscriptionResponse struct {
+	ID         string   `json:"id"`
+	GroupID    string   `json:"group_id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"` // Only returned on creation
+	EventTypes []string `json:"event_types"`
+	Active     bool     `json:"active"`
+	CreatedBy  string   `json:"created_by"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// DeliveryResponse represents a delivery log entry in API responses
+type DeliveryResponse struct {
+	ID             string          `json:"id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  string          `json:"next_attempt_at,omitempty"` // Only set while pending
+	LastAttemptAt  string          `json:"last_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+}
+
+// ListDeliveriesResponse represents a page of the delivery log
+type ListDeliveriesResponse struct {
+	Deliveries []DeliveryResponse `json:"deliveries"`
+	Total      int                `json:"total"`
+	Limit      int                `json:"limit"`
+	Offset     int                `json:"offset"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Create handles POST /groups/{groupId}/webhooks
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, groupID, ok := parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input CreateSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.service.CreateSubscription(r.Context(), groupID, userID, &input)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	response := toSubscriptionResponse(sub)
+	response.Secret = sub.Secret
+	respondJSON(w, http.StatusCreated, response)
+}
+
+// List handles GET /groups/{groupId}/webhooks
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	userID, groupID, ok := parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	subs, err := h.service.ListSubscriptions(r.Context(), groupID, userID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	response := make([]SubscriptionResponse, len(subs))
+	for i, sub := range subs {
+		response[i] = toSubscriptionResponse(sub)
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// Get handles GET /groups/{groupId}/webhooks/{webhookId}
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, groupID, ok := parseRequest(w, r)
+	if !ok {
+		return
+	}
+	subID, ok := parseID(w, r, "webhookId", "Invalid webhook ID")
+	if !ok {
+		return
+	}
+
+	sub, err := h.service.GetSubscription(r.Context(), groupID, subID, userID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toSubscriptionResponse(sub))
+}
+
+// Update handles PATCH /groups/{groupId}/webhooks/{webhookId}
+func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	userID, groupID, ok := parseRequest(w, r)
+	if !ok {
+		return
+	}
+	subID, ok := parseID(w, r, "webhookId", "Invalid webhook ID")
+	if !ok {
+		return
+	}
+
+	var input UpdateSubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.service.UpdateSubscription(r.Context(), groupID, subID, userID, &input)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toSubscriptionResponse(sub))
+}
+
+// Delete handles DELETE /groups/{groupId}/webhooks/{webhookId}
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, groupID, ok := parseRequest(w, r)
+	if !ok {
+		return
+	}
+	subID, ok := parseID(w, r, "webhookId", "Invalid webhook ID")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteSubscription(r.Context(), groupID, subID, userID); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries handles GET /groups/{groupId}/webhooks/{webhookId}/deliveries
+func (h *Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, groupID, ok := parseRequest(w, r)
+	if !ok {
+		return
+	}
+	subID, ok := parseID(w, r, "webhookId", "Invalid webhook ID")
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset = max(offset, 0)
+
+	deliveries, total, err := h.service.ListDeliveries(r.Context(), groupID, subID, userID, limit, offset)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	response := ListDeliveriesResponse{
+		Deliveries: make([]DeliveryResponse, len(deliveries)),
+		Total:      total,
+		Limit:      limit,
+		Offset:     offset,
+	}
+	for i, d := range deliveries {
+		response.Deliveries[i] = toDeliveryResponse(d)
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
+
+// Redeliver handles POST /groups/{groupId}/webhooks/{webhookId}/deliveries/{deliveryId}/redeliver
+func (h *Handler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	userID, groupID, ok := parseRequest(w, r)
+	if !ok {
+		return
+	}
+	subID, ok := parseID(w, r, "webhookId", "Invalid webhook ID")
+	if !ok {
+		return
+	}
+	deliveryID, ok := parseID(w, r, "deliveryId", "Invalid delivery ID")
+	if !ok {
+		return
+	}
+
+	delivery, err := h.service.Redeliver(r.Context(), groupID, subID, deliveryID, userID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusAccepted, toDeliveryResponse(delivery))
+}
+
+// Helper functions
+
+// parseRequest extracts the authenticated user and the group from the path
+func parseRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := auth.GetUserID(r.Context())
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return uuid.Nil, uuid.Nil, false
+	}
+	groupID, ok := parseID(w, r, "groupId", "Invalid group ID")
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, groupID, true
+}
+
+func parseID(w http.ResponseWriter, r *http.Request, param, message string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, param))
+	if err != nil {
+		respondError(w, message, http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func handleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, group.ErrNotMember):
+		respondError(w, "You are not a member of this group", http.StatusForbidden)
+	case errors.Is(err, group.ErrNotAdmin):
+		respondError(w, "Only admins can manage webhooks", http.StatusForbidden)
+	case errors.Is(err, ErrSubscriptionNotFound):
+		respondError(w, "Webhook not found", http.StatusNotFound)
+	case errors.Is(err, ErrDeliveryNotFound):
+		respondError(w, "Delivery not found", http.StatusNotFound)
+	case errors.Is(err, ErrURLRequired), errors.Is(err, ErrInvalidURL), errors.Is(err, ErrInvalidEventType),
+		errors.Is(err, ErrSecretTooShort):
+		respondError(w, err.Error(), http.StatusBadRequest)
+	default:
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+func toSubscriptionResponse(sub *Subscription) SubscriptionResponse {
+	response := SubscriptionResponse{
+		ID:         sub.ID.String(),
+		GroupID:    sub.GroupID.String(),
+		URL:        sub.URL,
+		EventTypes: sub.EventTypes,
+		Active:     sub.Active,
+		CreatedAt:  sub.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if response.EventTypes == nil {
+		response.EventTypes = []string{}
+	}
+	if sub.CreatedBy != uuid.Nil {
+		response.CreatedBy = sub.CreatedBy.String()
+	}
+	return response
+}
+
+func toDeliveryResponse(d *Delivery) DeliveryResponse {
+	response := DeliveryResponse{
+		ID:             d.ID.String(),
+		EventID:        d.EventID.String(),
+		EventType:      d.EventType,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		ResponseStatus: d.ResponseStatus,
+		LastError:      d.LastError,
+		CreatedAt:      d.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if d.Status == StatusPending {
+		response.NextAttemptAt = d.NextAttemptAt.UTC().Format(time.RFC3339)
+	}
+	if d.LastAttemptAt != nil {
+		response.LastAttemptAt = d.LastAttemptAt.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+func respondJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func respondError(w http.ResponseWriter, message string, status int) {
+	respondJSON(w, status, ErrorResponse{Error: message})
+}
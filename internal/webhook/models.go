@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/events"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed" // Gave up after the maximum number of attempts
+)
+
+// Subscription is a group's registration for event notifications
+type Subscription struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	GroupID    uuid.UUID `json:"group_id" db:"group_id"`
+	URL        string    `json:"url" db:"url"`
+	Secret     string    `json:"-" db:"secret"`
+	EventTypes []string  `json:"event_types" db:"event_types"` // Empty matches every type
+	Active     bool      `json:"active" db:"active"`
+	CreatedBy  uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// Matches reports whether the subscription wants events of the given type
+func (s *Subscription) Matches(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is a single event queued for, or sent to, a subscription
+type Delivery struct {
+	ID             uuid.UUID       `json:"id" db:"id"`
+	SubscriptionID uuid.UUID       `json:"subscription_id" db:"subscription_id"`
+	EventID        uuid.UUID       `json:"event_id" db:"event_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty" db:"last_attempt_at"`
+	ResponseStatus int             `json:"response_status,omitempty" db:"response_status"`
+	LastError      string          `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+}
+
+// Attempt is the outcome of one delivery attempt
+type Attempt struct {
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	AttemptedAt    time.Time
+	ResponseStatus int
+	Error          string
+}
+
+// CreateSubscriptionInput represents the input for creating a subscription
+type CreateSubscriptionInput struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret"` // Optional; generated when empty
+}
+
+// Validate validates the create subscription input
+func (c *CreateSubscriptionInput) Validate() error {
+	if c.URL == "" {
+		return ErrURLRequired
+	}
+	if err := validateURL(c.URL); err != nil {
+		return err
+	}
+	if c.Secret != "" && len(c.Secret) < 16 {
+		return ErrSecretTooShort
+	}
+	return validateEventTypes(c.EventTypes)
+}
+
+// UpdateSubscriptionInput represents the editable subscription fields. Nil
+// fields are left unchanged.
+type UpdateSubscriptionInput struct {
+	URL        *string   `json:"url"`
+	EventTypes *[]string `json:"event_types"`
+	Active     *bool     `json:"active"`
+}
+
+// Validate validates the update subscription input
+func (u *UpdateSubscriptionInput) Validate() error {
+	if u.URL != nil {
+		if err := validateURL(*u.URL); err != nil {
+			return err
+		}
+	}
+	if u.EventTypes != nil {
+		return validateEventTypes(*u.EventTypes)
+	}
+	return nil
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+func validateEventTypes(types []string) error {
+	for _, t := range types {
+		if !events.ValidType(t) {
+			return ErrInvalidEventType
+		}
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/testifysec/dropbox-clone/internal/secretbox"
+)
+
+// Repository defines the interface for webhook subscriptions and the
+// delivery queue
+type Repository interface {
+	CreateSubscription(ctx context.Context, sub *Subscription) error
+	GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	UpdateSubscription(ctx context.Context, sub *Subscription) error
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+	ListSubscriptions(ctx context.Context, groupID uuid.UUID) ([]*Subscription, error)
+	// ListActiveSubscriptions returns the group's active subscriptions that
+	// match the event type
+	ListActiveSubscriptions(ctx context.Context, groupID uuid.UUID, eventType string) ([]*Subscription, error)
+
+	CreateDelivery(ctx context.Context, delivery *Delivery) error
+	GetDelivery(ctx context.Context, id uuid.UUID) (*Delivery, error)
+	ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit, offset int) ([]*Delivery, int, error)
+	// ClaimDueDeliveries locks up to limit pending deliveries that are due and
+	// pushes their next attempt out by lease, so a worker that crashes
+	// mid-delivery does not lose them. Concurrent workers skip each other's
+	// claims.
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*Delivery, error)
+	RecordAttempt(ctx context.Context, id uuid.UUID, attempt *Attempt) error
+}
+
+// PostgresRepository implements Repository using PostgreSQL. Signing
+// secrets are encrypted at rest.
+type PostgresRepository struct {
+	db      *sql.DB
+	secrets *secretbox.Box
+}
+
+// NewPostgresRepository creates a new PostgresRepository that encrypts
+// signing secrets with secrets
+func NewPostgresRepository(db *sql.DB, secrets *secretbox.Box) *PostgresRepository {
+	return &PostgresRepository{db: db, secrets: secrets}
+}
+
+// secret holds the secrets of subscriptions created before they were
+// encrypted, until SealPlaintextSecrets moves them to secret_ciphertext
+const subscriptionColumns = `id, group_id, url, secret, secret_ciphertext, event_types, active, created_by, created_at`
+
+const deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_attempt_at, response_status, last_error, created_at`
+
+// CreateSubscription inserts a new subscription
+func (r *PostgresRepository) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	ciphertext, err := r.secrets.Seal(sub.ID.String(), sub.Secret)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO webhook_subscriptions (id, group_id, url, secret_ciphertext, event_types, active, created_by,
+			created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err = r.db.ExecContext(ctx, query,
+		sub.ID, sub.GroupID, sub.URL, ciphertext, pq.Array(sub.EventTypes), sub.Active, sub.CreatedBy, sub.CreatedAt)
+	return err
+}
+
+// GetSubscription retrieves a subscription by ID
+func (r *PostgresRepository) GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+	sub, err := r.scanSubscription(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, err
+	}
+	return sub, nil
+}
+
+// UpdateSubscription updates a subscription's URL, event types and state
+func (r *PostgresRepository) UpdateSubscription(ctx context.Context, sub *Subscription) error {
+	query := `UPDATE webhook_subscriptions SET url = $1, event_types = $2, active = $3 WHERE id = $4`
+	result, err := r.db.ExecContext(ctx, query, sub.URL, pq.Array(sub.EventTypes), sub.Active, sub.ID)
+	if err != nil {
+		return err
+	}
+	return expectOne(result, ErrSubscriptionNotFound)
+}
+
+// DeleteSubscription removes a subscription and its delivery log
+func (r *PostgresRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return expectOne(result, ErrSubscriptionNotFound)
+}
+
+// ListSubscriptions retrieves a group's subscriptions
+func (r *PostgresRepository) ListSubscriptions(ctx context.Context, groupID uuid.UUID) ([]*Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions WHERE group_id = $1 ORDER BY created_at`
+	return r.querySubscriptions(ctx, query, groupID)
+}
+
+// ListActiveSubscriptions retrieves a group's active subscriptions for an
+// event type
+func (r *PostgresRepository) ListActiveSubscriptions(ctx context.Context, groupID uuid.UUID, eventType string) ([]*Subscription, error) {
+	query := `
+		SELECT ` + subscriptionColumns + `
+		FROM webhook_subscriptions
+		WHERE group_id = $1 AND active AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+	`
+	return r.querySubscriptions(ctx, query, groupID, eventType)
+}
+
+// SealPlaintextSecrets encrypts the secrets of subscriptions created before
+// secrets were encrypted, returning how many it sealed
+func (r *PostgresRepository) SealPlaintextSecrets(ctx context.Context) (int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, secret FROM webhook_subscriptions WHERE secret IS NOT NULL`)
+	if err != nil {
+		return 0, err
+	}
+	plaintexts := make(map[uuid.UUID]string)
+	for rows.Next() {
+		var id uuid.UUID
+		var secret string
+		if err := rows.Scan(&id, &secret); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		plaintexts[id] = secret
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	_ = rows.Close()
+
+	sealed := 0
+	for id, secret := range plaintexts {
+		ciphertext, err := r.secrets.Seal(id.String(), secret)
+		if err != nil {
+			return sealed, err
+		}
+		query := `UPDATE webhook_subscriptions SET secret_ciphertext = $2, secret = NULL WHERE id = $1 AND secret = $3`
+		result, err := r.db.ExecContext(ctx, query, id, ciphertext, secret)
+		if err != nil {
+			return sealed, err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 1 {
+			sealed++
+		}
+	}
+	return sealed, nil
+}
+
+func (r *PostgresRepository) querySubscriptions(ctx context.Context, query string, args ...interface{}) ([]*Subscription, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var subs []*Subscription
+	for rows.Next() {
+		sub, err := r.scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// CreateDelivery enqueues a delivery
+func (r *PostgresRepository) CreateDelivery(ctx context.Context, d *Delivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status, next_attempt_at,
+			created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		d.ID, d.SubscriptionID, d.EventID, d.EventType, []byte(d.Payload), d.Status, d.NextAttemptAt, d.CreatedAt)
+	return err
+}
+
+// GetDelivery retrieves a delivery by ID
+func (r *PostgresRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*Delivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+	d, err := scanDelivery(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+	return d, nil
+}
+
+// ListDeliveries retrieves a subscription's delivery log, newest first
+func (r *PostgresRepository) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit, offset int) ([]*Delivery, int, error) {
+	query := `
+		SELECT ` + deliveryColumns + `, COUNT(*) OVER()
+		FROM webhook_deliveries
+		WHERE subscription_id = $1
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, subscriptionID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var deliveries []*Delivery
+	total := 0
+	for rows.Next() {
+		d, err := scanDelivery(rows, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, total, rows.Err()
+}
+
+// ClaimDueDeliveries leases due deliveries using FOR UPDATE SKIP LOCKED
+func (r *PostgresRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*Delivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + deliveryColumns
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var deliveries []*Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordAttempt stores the outcome of a delivery attempt
+func (r *PostgresRepository) RecordAttempt(ctx context.Context, id uuid.UUID, a *Attempt) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3, last_attempt_at = $4,
+			response_status = NULLIF($5, 0), last_error = $6
+		WHERE id = $7
+	`
+	result, err := r.db.ExecContext(ctx, query,
+		a.Status, a.Attempts, a.NextAttemptAt, a.AttemptedAt, a.ResponseStatus, a.Error, id)
+	if err != nil {
+		return err
+	}
+	return expectOne(result, ErrDeliveryNotFound)
+}
+
+// Helper functions
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSubscription scans a subscription row, decrypting its secret
+func (r *PostgresRepository) scanSubscription(row scanner) (*Subscription, error) {
+	sub := &Subscription{}
+	var plaintext sql.NullString
+	var ciphertext []byte
+	err := row.Scan(&sub.ID, &sub.GroupID, &sub.URL, &plaintext, &ciphertext, pq.Array(&sub.EventTypes), &sub.Active,
+		&sub.CreatedBy, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if ciphertext == nil {
+		sub.Secret = plaintext.String
+		return sub, nil
+	}
+	if sub.Secret, err = r.secrets.Open(sub.ID.String(), ciphertext); err != nil {
+		return nil, fmt.Errorf("decrypt secret of webhook %s: %w", sub.ID, err)
+	}
+	return sub, nil
+}
+
+// scanDelivery scans a delivery row, followed by any extra columns in dest
+func scanDelivery(row scanner, dest ...interface{}) (*Delivery, error) {
+	d := &Delivery{}
+	var payload []byte
+	var responseStatus sql.NullInt64
+	columns := append([]interface{}{
+		&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastAttemptAt, &responseStatus, &d.LastError, &d.CreatedAt,
+	}, dest...)
+	if err := row.Scan(columns...); err != nil {
+		return nil, err
+	}
+	d.Payload = payload
+	d.ResponseStatus = int(responseStatus.Int64)
+	return d, nil
+}
+
+func expectOne(result sql.Result, notFound error) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound
+	}
+	return nil
+}
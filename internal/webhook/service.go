@@ -0,0 +1,250 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/testifysec/dropbox-clone/internal/audit"
+	"github.com/testifysec/dropbox-clone/internal/events"
+	"github.com/testifysec/dropbox-clone/internal/group"
+)
+
+// Service manages webhook subscriptions and enqueues deliveries for
+// published events. Managing a group's webhooks requires the group admin
+// role, since subscriptions receive every matching event in the group.
+type Service struct {
+	repo         Repository
+	groupService *group.Service
+	audit        audit.Recorder
+}
+
+// NewService creates a new webhook service
+func NewService(repo Repository, groupService *group.Service, recorder audit.Recorder) *Service {
+	return &Service{repo: repo, groupService: groupService, audit: recorder}
+}
+
+// CreateSubscription registers a webhook for a group. The returned
+// subscription carries its signing secret, which is not shown again.
+func (s *Service) CreateSubscription(ctx context.Context, groupID, requestingUserID uuid.UUID, input *CreateSubscriptionInput) (*Subscription, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.requireAdmin(ctx, groupID, requestingUserID); err != nil {
+		return nil, err
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	sub := &Subscription{
+		ID:         uuid.New(),
+		GroupID:    groupID,
+		URL:        input.URL,
+		Secret:     secret,
+		EventTypes: input.EventTypes,
+		Active:     true,
+		CreatedBy:  requestingUserID,
+		CreatedAt:  time.Now(),
+	}
+	if sub.EventTypes == nil {
+		sub.EventTypes = []string{}
+	}
+
+	if err := s.repo.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(ctx, &audit.Event{
+		ActorID:    requestingUserID,
+		Action:     audit.ActionWebhookCreated,
+		GroupID:    groupID,
+		TargetType: audit.TargetWebhook,
+		TargetID:   sub.ID.String(),
+		Metadata:   map[string]string{"url": sub.URL},
+	})
+
+	return sub, nil
+}
+
+// ListSubscriptions lists a group's webhooks
+func (s *Service) ListSubscriptions(ctx context.Context, groupID, requestingUserID uuid.UUID) ([]*Subscription, error) {
+	if err := s.requireAdmin(ctx, groupID, requestingUserID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListSubscriptions(ctx, groupID)
+}
+
+// GetSubscription retrieves one of a group's webhooks
+func (s *Service) GetSubscription(ctx context.Context, groupID, subscriptionID, requestingUserID uuid.UUID) (*Subscription, error) {
+	if err := s.requireAdmin(ctx, groupID, requestingUserID); err != nil {
+		return nil, err
+	}
+	return s.getSubscription(ctx, groupID, subscriptionID)
+}
+
+// UpdateSubscription changes a webhook's URL, event types or active state
+func (s *Service) UpdateSubscription(ctx context.Context, groupID, subscriptionID, requestingUserID uuid.UUID, input *UpdateSubscriptionInput) (*Subscription, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	sub, err := s.GetSubscription(ctx, groupID, subscriptionID, requestingUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.URL != nil {
+		sub.URL = *input.URL
+	}
+	if input.EventTypes != nil {
+		sub.EventTypes = *input.EventTypes
+		if sub.EventTypes == nil {
+			sub.EventTypes = []string{}
+		}
+	}
+	if input.Active != nil {
+		sub.Active = *input.Active
+	}
+
+	if err := s.repo.UpdateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// DeleteSubscription removes a webhook and its delivery log
+func (s *Service) DeleteSubscription(ctx context.Context, groupID, subscriptionID, requestingUserID uuid.UUID) error {
+	sub, err := s.GetSubscription(ctx, groupID, subscriptionID, requestingUserID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteSubscription(ctx, sub.ID); err != nil {
+		return err
+	}
+
+	s.audit.Record(ctx, &audit.Event{
+		ActorID:    requestingUserID,
+		Action:     audit.ActionWebhookDeleted,
+		GroupID:    groupID,
+		TargetType: audit.TargetWebhook,
+		TargetID:   sub.ID.String(),
+		Metadata:   map[string]string{"url": sub.URL},
+	})
+
+	return nil
+}
+
+// ListDeliveries lists a webhook's delivery log
+func (s *Service) ListDeliveries(ctx context.Context, groupID, subscriptionID, requestingUserID uuid.UUID, limit, offset int) ([]*Delivery, int, error) {
+	sub, err := s.GetSubscription(ctx, groupID, subscriptionID, requestingUserID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListDeliveries(ctx, sub.ID, limit, offset)
+}
+
+// Redeliver queues a new delivery of a logged delivery's payload. The
+// original entry is kept so the log shows every attempt.
+func (s *Service) Redeliver(ctx context.Context, groupID, subscriptionID, deliveryID, requestingUserID uuid.UUID) (*Delivery, error) {
+	sub, err := s.GetSubscription(ctx, groupID, subscriptionID, requestingUserID)
+	if err != nil {
+		return nil, err
+	}
+	original, err := s.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if original.SubscriptionID != sub.ID {
+		return nil, ErrDeliveryNotFound
+	}
+
+	delivery := newDelivery(sub.ID, original.EventID, original.EventType, original.Payload)
+	if err := s.repo.CreateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// HandleEvent enqueues a delivery of the event for every matching active
+// subscription in the event's group. It is registered with the event bus.
+func (s *Service) HandleEvent(ctx context.Context, event *events.Event) {
+	subs, err := s.repo.ListActiveSubscriptions(ctx, event.GroupID, event.Type)
+	if err != nil {
+		log.Printf("Failed to load webhooks for %s event: %v", event.Type, err)
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", event.Type, err)
+		return
+	}
+
+	for _, sub := range subs {
+		if err := s.repo.CreateDelivery(ctx, newDelivery(sub.ID, event.ID, event.Type, payload)); err != nil {
+			log.Printf("Failed to enqueue webhook delivery for subscription %s: %v", sub.ID, err)
+		}
+	}
+}
+
+func (s *Service) requireAdmin(ctx context.Context, groupID, userID uuid.UUID) error {
+	membership, err := s.groupService.GetMembership(ctx, groupID, userID)
+	if err != nil {
+		return err
+	}
+	if membership.Role != group.RoleAdmin {
+		return group.ErrNotAdmin
+	}
+	return nil
+}
+
+func (s *Service) getSubscription(ctx context.Context, groupID, subscriptionID uuid.UUID) (*Subscription, error) {
+	sub, err := s.repo.GetSubscription(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if sub.GroupID != groupID {
+		return nil, ErrSubscriptionNotFound
+	}
+	return sub, nil
+}
+
+func newDelivery(subscriptionID, eventID uuid.UUID, eventType string, payload json.RawMessage) *Delivery {
+	now := time.Now()
+	return &Delivery{
+		ID:             uuid.New(),
+		SubscriptionID: subscriptionID,
+		EventID:        eventID,
+		EventType:      eventType,
+		Payload:        payload,
+		Status:         StatusPending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+	}
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
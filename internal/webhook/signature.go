@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the delivery signature. Its value has the form
+// "t=<unix seconds>,v1=<hex HMAC-SHA256>", where the MAC covers
+// "<unix seconds>.<request body>" keyed with the subscription secret.
+// Receivers should recompute the MAC and reject stale timestamps to prevent
+// replays.
+const SignatureHeader = "X-Webhook-Signature"
+
+// Sign returns the signature header value for a body sent at time t
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + computeMAC(secret, ts, body)
+}
+
+// Verify checks a signature header against the body. Signatures whose
+// timestamp differs from now by more than tolerance are rejected.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts string
+	var macs []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			macs = append(macs, value)
+		}
+	}
+	if ts == "" || len(macs) == 0 {
+		return ErrInvalidSignature
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(sec, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	expected := computeMAC(secret, ts, body)
+	for _, mac := range macs {
+		if hmac.Equal([]byte(mac), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func computeMAC(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%s.", ts)
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
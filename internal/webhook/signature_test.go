@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := "whsec_test-secret-value"
+	body := []byte(`{"type":"file.created"}`)
+	sentAt := time.Unix(1700000000, 0)
+	header := Sign(secret, sentAt, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", secret, header, body, sentAt.Add(time.Minute), nil},
+		{"wrong secret", "whsec_other-secret-value", header, body, sentAt, ErrInvalidSignature},
+		{"tampered body", secret, header, []byte(`{"type":"file.deleted"}`), sentAt, ErrInvalidSignature},
+		{"expired", secret, header, body, sentAt.Add(10 * time.Minute), ErrSignatureExpired},
+		{"from the future", secret, header, body, sentAt.Add(-10 * time.Minute), ErrSignatureExpired},
+		{"missing mac", secret, "t=1700000000", body, sentAt, ErrInvalidSignature},
+		{"malformed", secret, "garbage", body, sentAt, ErrInvalidSignature},
+		{"rotated secret", secret, header + ",v1=deadbeef", body, sentAt, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+-- Track when a user proved ownership of their email address. Accounts
+-- created before verification existed could never have verified, so treat
+-- them as verified rather than locking them out of uploads. The backfill
+-- only runs when the column is added, so re-running this migration never
+-- verifies accounts that signed up since.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'email_verified_at'
+    ) THEN
+        ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE;
+        UPDATE users SET email_verified_at = COALESCE(created_at, NOW());
+    END IF;
+END $$;
@@ -0,0 +1,9 @@
+-- Failed authentication attempts, keyed by account or client IP
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key VARCHAR(512) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    blocked_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failure_at ON login_attempts(last_failure_at);
@@ -0,0 +1,2 @@
+-- Optional human-readable name shown instead of the email address
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(255) NOT NULL DEFAULT '';
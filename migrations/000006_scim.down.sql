@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_groups_name;
+DROP INDEX IF EXISTS idx_users_email_lower;
+DROP INDEX IF EXISTS idx_groups_external_id;
+DROP INDEX IF EXISTS idx_users_external_id;
+ALTER TABLE groups DROP COLUMN IF EXISTS external_id;
+ALTER TABLE users DROP COLUMN IF EXISTS external_id;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_group_events_occurred_at;
+DROP INDEX IF EXISTS idx_group_events_group_id;
+DROP TABLE IF EXISTS group_events;
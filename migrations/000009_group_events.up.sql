@@ -0,0 +1,15 @@
+-- Recent group events, kept so real-time clients can resume from the last
+-- event they saw. seq orders events across replicas; rows are pruned after
+-- the configured retention.
+CREATE TABLE IF NOT EXISTS group_events (
+    seq BIGSERIAL PRIMARY KEY,
+    id UUID NOT NULL UNIQUE,
+    type VARCHAR(64) NOT NULL,
+    group_id UUID NOT NULL,
+    actor_id UUID,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_events_group_id ON group_events(group_id, seq);
+CREATE INDEX IF NOT EXISTS idx_group_events_occurred_at ON group_events(occurred_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS file_changes;
+ALTER TABLE groups DROP COLUMN IF EXISTS change_seq;
@@ -0,0 +1,19 @@
+-- Per-group change counter. Bumping it takes the group's row lock, so
+-- journal entries commit in sequence order.
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS change_seq BIGINT NOT NULL DEFAULT 0;
+
+-- Change journal for delta sync. Each entry snapshots the file's metadata;
+-- deletes are kept as tombstones.
+CREATE TABLE IF NOT EXISTS file_changes (
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    seq BIGINT NOT NULL,
+    file_id UUID NOT NULL,
+    change VARCHAR(16) NOT NULL CHECK (change IN ('add', 'modify', 'delete')),
+    name VARCHAR(255) NOT NULL,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    uploaded_by UUID,
+    created_at TIMESTAMP WITH TIME ZONE,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (group_id, seq)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_app_passwords_user_id;
+DROP TABLE IF EXISTS app_passwords;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS s3_multipart_parts;
+DROP INDEX IF EXISTS idx_s3_multipart_uploads_created_at;
+DROP TABLE IF EXISTS s3_multipart_uploads;
+DROP INDEX IF EXISTS idx_access_keys_user_id;
+DROP TABLE IF EXISTS access_keys;
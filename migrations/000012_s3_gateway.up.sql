@@ -0,0 +1,36 @@
+-- Access keys sign requests to the S3-compatible gateway with AWS
+-- Signature Version 4. SigV4 needs the secret itself to verify a signature,
+-- so secrets are stored encrypted rather than hashed.
+CREATE TABLE IF NOT EXISTS access_keys (
+    id VARCHAR(20) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    secret_ciphertext BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_keys_user_id ON access_keys(user_id, created_at);
+
+-- Multipart uploads in progress through the gateway. Parts are staged in
+-- object storage and become a file only when the upload is completed.
+CREATE TABLE IF NOT EXISTS s3_multipart_uploads (
+    id UUID PRIMARY KEY,
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    object_key VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_s3_multipart_uploads_created_at ON s3_multipart_uploads(created_at);
+
+CREATE TABLE IF NOT EXISTS s3_multipart_parts (
+    upload_id UUID NOT NULL REFERENCES s3_multipart_uploads(id) ON DELETE CASCADE,
+    part_number INTEGER NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    etag CHAR(32) NOT NULL,
+    storage_key TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (upload_id, part_number)
+);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_user_groups_group_joined_at;
+
+DROP INDEX IF EXISTS idx_files_group_content_type;
+DROP INDEX IF EXISTS idx_files_group_uploaded_by;
+DROP INDEX IF EXISTS idx_files_group_created_at;
+DROP INDEX IF EXISTS idx_files_group_size;
+DROP INDEX IF EXISTS idx_files_group_name;
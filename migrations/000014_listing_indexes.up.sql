@@ -0,0 +1,10 @@
+-- Indexes for keyset-paginated listings. Each sort order is read through
+-- an index on (scope, sort key, id) so a page costs the same however deep
+-- it is.
+CREATE INDEX IF NOT EXISTS idx_files_group_name ON files(group_id, name, id);
+CREATE INDEX IF NOT EXISTS idx_files_group_size ON files(group_id, size_bytes, id);
+CREATE INDEX IF NOT EXISTS idx_files_group_created_at ON files(group_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_files_group_uploaded_by ON files(group_id, uploaded_by, created_at);
+CREATE INDEX IF NOT EXISTS idx_files_group_content_type ON files(group_id, content_type text_pattern_ops);
+
+CREATE INDEX IF NOT EXISTS idx_user_groups_group_joined_at ON user_groups(group_id, joined_at, user_id);
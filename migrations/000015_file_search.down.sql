@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_files_name_trgm;
+DROP INDEX IF EXISTS idx_files_name_tsv;
+
+ALTER TABLE files DROP COLUMN IF EXISTS name_tsv;
@@ -0,0 +1,10 @@
+-- File name search. Names are split into words on anything that is not a
+-- letter or digit, so "q3-report_final.pdf" matches "report", and indexed
+-- for full-text prefix matching. Trigrams cover typos and substrings.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS name_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', regexp_replace(name, '[^[:alnum:]]+', ' ', 'g'))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_files_name_tsv ON files USING GIN (name_tsv);
+CREATE INDEX IF NOT EXISTS idx_files_name_trgm ON files USING GIN (name gin_trgm_ops);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_file_index_jobs_next_attempt_at;
+DROP TABLE IF EXISTS file_index_jobs;
+
+DROP INDEX IF EXISTS idx_files_content_tsv;
+ALTER TABLE files DROP COLUMN IF EXISTS content_tsv;
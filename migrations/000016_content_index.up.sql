@@ -0,0 +1,18 @@
+-- Full-text index of the text extracted from files' contents. Extraction
+-- happens in the background: every file gets a job when it is created, and
+-- indexers claim due jobs, retrying failures with a growing delay.
+ALTER TABLE files ADD COLUMN IF NOT EXISTS content_tsv tsvector;
+
+CREATE INDEX IF NOT EXISTS idx_files_content_tsv ON files USING GIN (content_tsv);
+
+CREATE TABLE IF NOT EXISTS file_index_jobs (
+    file_id UUID PRIMARY KEY REFERENCES files(id) ON DELETE CASCADE,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_index_jobs_next_attempt_at ON file_index_jobs(next_attempt_at);
+
+-- Index the files uploaded before content indexing existed
+INSERT INTO file_index_jobs (file_id) SELECT id FROM files ON CONFLICT DO NOTHING;
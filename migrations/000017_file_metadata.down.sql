@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS group_metadata_fields;
+
+DROP INDEX IF EXISTS idx_files_metadata;
+DROP INDEX IF EXISTS idx_files_tags;
+
+ALTER TABLE files DROP COLUMN IF EXISTS metadata;
+ALTER TABLE files DROP COLUMN IF EXISTS tags;
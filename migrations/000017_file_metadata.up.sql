@@ -0,0 +1,19 @@
+-- User-defined tags and typed key-value metadata on files. Tags are stored
+-- lower-cased; metadata values are JSON strings, numbers or booleans.
+ALTER TABLE files ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE files ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_files_tags ON files USING GIN (tags);
+CREATE INDEX IF NOT EXISTS idx_files_metadata ON files USING GIN (metadata);
+
+-- Per-group metadata schema. Fields type-check the keys they define, and
+-- required fields must be set on upload; other keys are free-form.
+CREATE TABLE IF NOT EXISTS group_metadata_fields (
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    key VARCHAR(64) NOT NULL,
+    type VARCHAR(16) NOT NULL CHECK (type IN ('string', 'number', 'boolean', 'date')),
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    description TEXT NOT NULL DEFAULT '',
+    position INT NOT NULL,
+    PRIMARY KEY (group_id, key)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_file_thumbnail_jobs_next_attempt_at;
+DROP TABLE IF EXISTS file_thumbnail_jobs;
+
+DROP TABLE IF EXISTS file_thumbnails;
@@ -0,0 +1,26 @@
+-- Thumbnails of uploaded images, stored alongside the originals under
+-- thumbnails/{group_id}/{file_id}/{size}. Rendering happens in the
+-- background: every image gets a job when it is created, and thumbnailers
+-- claim due jobs like indexers do.
+CREATE TABLE IF NOT EXISTS file_thumbnails (
+    file_id UUID PRIMARY KEY REFERENCES files(id) ON DELETE CASCADE,
+    sizes INT[] NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS file_thumbnail_jobs (
+    file_id UUID PRIMARY KEY REFERENCES files(id) ON DELETE CASCADE,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_thumbnail_jobs_next_attempt_at ON file_thumbnail_jobs(next_attempt_at);
+
+-- Thumbnail the images uploaded before thumbnails existed
+INSERT INTO file_thumbnail_jobs (file_id)
+SELECT id FROM files
+WHERE lower(content_type) ~ '^image/(jpeg|png|gif|webp)'
+   OR lower(name) ~ '\.(jpe?g|png|gif|webp)$'
+ON CONFLICT DO NOTHING;
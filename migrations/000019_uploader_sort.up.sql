@@ -0,0 +1,4 @@
+-- Files sort by uploader ID rather than email, so the order can be read
+-- through an index instead of joining users and sorting every row. Files
+-- whose uploader was deleted sort as the nil UUID.
+CREATE INDEX IF NOT EXISTS idx_files_group_uploader ON files(group_id, (COALESCE(uploaded_by, '00000000-0000-0000-0000-000000000000'::uuid)), id);
@@ -0,0 +1,3 @@
+-- Refresh tokens carry the generation they were issued under; bumping it
+-- revokes them
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_generation INTEGER NOT NULL DEFAULT 0;
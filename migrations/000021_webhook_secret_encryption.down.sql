@@ -0,0 +1,5 @@
+-- Encrypted secrets cannot be recovered here, so their subscriptions are
+-- disabled until given a new secret
+UPDATE webhook_subscriptions SET secret = '', active = FALSE WHERE secret IS NULL;
+ALTER TABLE webhook_subscriptions ALTER COLUMN secret SET NOT NULL;
+ALTER TABLE webhook_subscriptions DROP COLUMN IF EXISTS secret_ciphertext;
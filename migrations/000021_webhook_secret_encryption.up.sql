@@ -0,0 +1,5 @@
+-- Webhook signing secrets are stored encrypted with a key derived from the
+-- server secret. The server encrypts secrets stored in the clear by earlier
+-- versions when it starts, clearing the secret column.
+ALTER TABLE webhook_subscriptions ADD COLUMN IF NOT EXISTS secret_ciphertext BYTEA;
+ALTER TABLE webhook_subscriptions ALTER COLUMN secret DROP NOT NULL;
@@ -0,0 +1,5 @@
+// Package dropboxv1 contains the gRPC API's messages and services,
+// generated from the definitions in proto/dropbox/v1.
+package dropboxv1
+
+//go:generate protoc -I ../../../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative dropbox/v1/auth.proto dropbox/v1/groups.proto dropbox/v1/files.proto
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Me returns the current user's profile and groups
+func (c *Client) Me(ctx context.Context) (*Profile, error) {
+	return c.profile(ctx, &request{method: http.MethodGet, path: "/me"})
+}
+
+// UpdateProfile sets the current user's display name
+func (c *Client) UpdateProfile(ctx context.Context, displayName string) (*Profile, error) {
+	return c.profile(ctx, &request{
+		method:   http.MethodPatch,
+		path:     "/me",
+		jsonBody: map[string]string{"display_name": displayName},
+	})
+}
+
+// ChangePassword changes the current user's password
+func (c *Client) ChangePassword(ctx context.Context, currentPassword, newPassword string) error {
+	return c.do(ctx, &request{
+		method:   http.MethodPut,
+		path:     "/me/password",
+		jsonBody: map[string]string{"current_password": currentPassword, "new_password": newPassword},
+	}, nil)
+}
+
+// ChangeEmail changes the current user's email address, which must then be
+// verified again
+func (c *Client) ChangeEmail(ctx context.Context, email, currentPassword string) (*Profile, error) {
+	return c.profile(ctx, &request{
+		method:   http.MethodPut,
+		path:     "/me/email",
+		jsonBody: map[string]string{"email": email, "current_password": currentPassword},
+	})
+}
+
+// DeleteAccount deletes the current user's account
+func (c *Client) DeleteAccount(ctx context.Context, currentPassword string) error {
+	return c.do(ctx, &request{
+		method:   http.MethodDelete,
+		path:     "/me",
+		jsonBody: map[string]string{"current_password": currentPassword},
+	}, nil)
+}
+
+// VerifyEmail confirms an email address with the token from a verification
+// link
+func (c *Client) VerifyEmail(ctx context.Context, token string) (*EmailVerification, error) {
+	var result EmailVerification
+	req := &request{method: http.MethodGet, path: "/auth/verify-email", query: map[string]string{"token": token}, public: true}
+	if err := c.do(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ResendVerification sends the current user a new verification link
+func (c *Client) ResendVerification(ctx context.Context) error {
+	return c.do(ctx, &request{method: http.MethodPost, path: "/auth/verify-email/resend"}, nil)
+}
+
+// CreateAppPassword creates an app password for a client. The password is
+// only returned now.
+func (c *Client) CreateAppPassword(ctx context.Context, name string) (*AppPassword, error) {
+	var p AppPassword
+	req := &request{method: http.MethodPost, path: "/me/app-passwords", jsonBody: map[string]string{"name": name}}
+	if err := c.do(ctx, req, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListAppPasswords lists the current user's app passwords
+func (c *Client) ListAppPasswords(ctx context.Context) ([]AppPassword, error) {
+	var passwords []AppPassword
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/me/app-passwords"}, &passwords); err != nil {
+		return nil, err
+	}
+	return passwords, nil
+}
+
+// RevokeAppPassword deletes one of the current user's app passwords
+func (c *Client) RevokeAppPassword(ctx context.Context, id string) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: "/me/app-passwords/" + url.PathEscape(id)}, nil)
+}
+
+// CreateAccessKey creates an access key for the S3 gateway. The secret is
+// only returned now.
+func (c *Client) CreateAccessKey(ctx context.Context, name string) (*AccessKey, error) {
+	var k AccessKey
+	req := &request{method: http.MethodPost, path: "/me/access-keys", jsonBody: map[string]string{"name": name}}
+	if err := c.do(ctx, req, &k); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// ListAccessKeys lists the current user's access keys
+func (c *Client) ListAccessKeys(ctx context.Context) ([]AccessKey, error) {
+	var keys []AccessKey
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/me/access-keys"}, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// DeleteAccessKey deletes one of the current user's access keys
+func (c *Client) DeleteAccessKey(ctx context.Context, accessKeyID string) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: "/me/access-keys/" + url.PathEscape(accessKeyID)}, nil)
+}
+
+// AddSSHKey registers a public key, given as a line from an
+// authorized_keys or .pub file, for signing in to the SFTP listener. An
+// empty name uses the key's comment.
+func (c *Client) AddSSHKey(ctx context.Context, name, publicKey string) (*SSHKey, error) {
+	var k SSHKey
+	body := map[string]string{"name": name, "public_key": publicKey}
+	if err := c.do(ctx, &request{method: http.MethodPost, path: "/me/ssh-keys", jsonBody: body}, &k); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// ListSSHKeys lists the current user's SSH keys
+func (c *Client) ListSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	var keys []SSHKey
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/me/ssh-keys"}, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// DeleteSSHKey deletes one of the current user's SSH keys
+func (c *Client) DeleteSSHKey(ctx context.Context, id string) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: "/me/ssh-keys/" + url.PathEscape(id)}, nil)
+}
+
+func (c *Client) profile(ctx context.Context, req *request) (*Profile, error) {
+	var profile Profile
+	if err := c.do(ctx, req, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
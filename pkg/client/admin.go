@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The calls in this file require a site administrator
+
+// AdminStats returns instance-wide totals
+func (c *Client) AdminStats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/admin/stats"}, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// AdminListUsers lists and searches users
+func (c *Client) AdminListUsers(ctx context.Context, opts ListOptions) (*AdminUserList, error) {
+	var list AdminUserList
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/admin/users", query: opts.query()}, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// AdminGetUser returns a user
+func (c *Client) AdminGetUser(ctx context.Context, userID string) (*AdminUser, error) {
+	return c.adminUser(ctx, http.MethodGet, userID, "", nil)
+}
+
+// AdminDisableUser disables a user's account and signs it out
+func (c *Client) AdminDisableUser(ctx context.Context, userID string) (*AdminUser, error) {
+	return c.adminUser(ctx, http.MethodPost, userID, "/disable", nil)
+}
+
+// AdminEnableUser re-enables a disabled account
+func (c *Client) AdminEnableUser(ctx context.Context, userID string) (*AdminUser, error) {
+	return c.adminUser(ctx, http.MethodPost, userID, "/enable", nil)
+}
+
+// AdminSetAdmin grants or revokes site administrator rights
+func (c *Client) AdminSetAdmin(ctx context.Context, userID string, isAdmin bool) (*AdminUser, error) {
+	return c.adminUser(ctx, http.MethodPut, userID, "/admin", map[string]bool{"is_admin": isAdmin})
+}
+
+// AdminUnlockUser clears a login lockout on a user's account
+func (c *Client) AdminUnlockUser(ctx context.Context, userID string) error {
+	return c.do(ctx, &request{method: http.MethodPost, path: adminUserPath(userID) + "/unlock"}, nil)
+}
+
+// AdminListGroups lists and searches all groups
+func (c *Client) AdminListGroups(ctx context.Context, opts ListOptions) (*AdminGroupList, error) {
+	var list AdminGroupList
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/admin/groups", query: opts.query()}, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// AdminDeleteGroup deletes a group and its files
+func (c *Client) AdminDeleteGroup(ctx context.Context, groupID string) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: "/admin/groups/" + url.PathEscape(groupID)}, nil)
+}
+
+// AuditLog queries the audit log, newest first
+func (c *Client) AuditLog(ctx context.Context, q AuditQuery) (*AuditEventList, error) {
+	query := map[string]string{
+		"group_id": q.GroupID,
+		"actor_id": q.ActorID,
+		"action":   q.Action,
+		"limit":    formatLimit(q.Limit),
+		"offset":   formatLimit(q.Offset),
+	}
+	if !q.Since.IsZero() {
+		query["since"] = q.Since.Format(time.RFC3339)
+	}
+	if !q.Until.IsZero() {
+		query["until"] = q.Until.Format(time.RFC3339)
+	}
+
+	var list AuditEventList
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/admin/audit", query: query}, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// VerifyAuditLog checks the integrity of the audit log's hash chain
+func (c *Client) VerifyAuditLog(ctx context.Context) (*AuditVerification, error) {
+	var result AuditVerification
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/admin/audit/verify"}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) adminUser(ctx context.Context, method, userID, suffix string, body interface{}) (*AdminUser, error) {
+	var u AdminUser
+	req := &request{method: method, path: adminUserPath(userID) + suffix, jsonBody: body}
+	if err := c.do(ctx, req, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func adminUserPath(userID string) string {
+	return "/admin/users/" + url.PathEscape(userID)
+}
+
+func (o ListOptions) query() map[string]string {
+	return map[string]string{"q": o.Query, "limit": formatLimit(o.Limit), "offset": formatLimit(o.Offset)}
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Register creates an account and logs in as it
+func (c *Client) Register(ctx context.Context, email, password string) (*AuthResponse, error) {
+	return c.authenticate(ctx, "/auth/register", map[string]string{"email": email, "password": password})
+}
+
+// Login authenticates with an email and password
+func (c *Client) Login(ctx context.Context, email, password string) (*AuthResponse, error) {
+	return c.authenticate(ctx, "/auth/login", map[string]string{"email": email, "password": password})
+}
+
+// Refresh exchanges the refresh token for a new token pair
+func (c *Client) Refresh(ctx context.Context) (*AuthResponse, error) {
+	token := c.Token()
+	if token == nil || token.RefreshToken == "" {
+		return nil, ErrNotLoggedIn
+	}
+	return c.authenticate(ctx, "/auth/refresh", map[string]string{"refresh_token": token.RefreshToken})
+}
+
+func (c *Client) authenticate(ctx context.Context, path string, body interface{}) (*AuthResponse, error) {
+	var resp AuthResponse
+	err := c.do(ctx, &request{method: http.MethodPost, path: path, jsonBody: body, public: true}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	c.setToken(&resp)
+	return &resp, nil
+}
@@ -0,0 +1,344 @@
+// Package client is a Go client for the dropbox-clone HTTP API.
+//
+// A Client holds the caller's token and refreshes the access token through
+// /auth/refresh before it expires. Use WithTokenHandler to persist refreshed
+// tokens. Idempotent calls are retried when the server is unavailable.
+// Errors from the API are *APIError values that match the sentinel errors
+// in this package, e.g. errors.Is(err, client.ErrFileNotFound).
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// refreshMargin is how long before expiry the access token is refreshed
+	refreshMargin = 30 * time.Second
+
+	// DefaultRetries is how many times idempotent calls are retried
+	DefaultRetries = 3
+
+	retryBaseDelay = 250 * time.Millisecond
+	maxRetryDelay  = 30 * time.Second
+)
+
+// Client calls the API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	onToken    func(*Token)
+	retries    int
+
+	mu        sync.Mutex
+	token     *Token
+	refreshMu sync.Mutex // Serializes refreshes so a token is only rotated once
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetries sets how many times idempotent calls (GET, PUT and DELETE)
+// are retried after a network error or a 429, 502, 503 or 504 response
+func WithRetries(n int) Option {
+	return func(c *Client) { c.retries = max(n, 0) }
+}
+
+// WithToken sets the credentials to authenticate with
+func WithToken(token *Token) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithTokenHandler registers a function called with the new token after
+// every login or refresh
+func WithTokenHandler(fn func(*Token)) Option {
+	return func(c *Client) { c.onToken = fn }
+}
+
+// New creates a client for the server at baseURL, e.g.
+// "https://files.example.com"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/") + "/api/v1",
+		httpClient: http.DefaultClient,
+		retries:    DefaultRetries,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token returns a copy of the current credentials, or nil when logged out
+func (c *Client) Token() *Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == nil {
+		return nil
+	}
+	t := *c.token
+	return &t
+}
+
+// request describes an API call. Bodies are either JSON, buffered so the
+// call can be replayed after a token refresh, or a stream sent as is.
+type request struct {
+	method      string
+	path        string
+	query       map[string]string
+	jsonBody    interface{}
+	body        io.Reader
+	contentType string
+	header      map[string]string
+	public      bool // Sent without credentials
+}
+
+// replayable reports whether the request can be sent again
+func (r *request) replayable() bool {
+	return r.body == nil
+}
+
+// idempotent reports whether the request can be retried without risk of
+// applying it twice
+func (r *request) idempotent() bool {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return r.replayable()
+	}
+	return false
+}
+
+// do sends the request and decodes a JSON response into out. A nil out
+// discards the body.
+func (c *Client) do(ctx context.Context, req *request, out interface{}) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// doPage is do for a paginated listing. It returns the token for the next
+// page, which is empty on the last page.
+func (c *Client) doPage(ctx context.Context, req *request, out interface{}) (string, error) {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return "", fmt.Errorf("decoding response: %w", err)
+	}
+	return resp.Header.Get("X-Next-Page-Token"), nil
+}
+
+// send sends the request and returns a successful response, whose body the
+// caller must close. Error responses are returned as *APIError.
+func (c *Client) send(ctx context.Context, req *request) (*http.Response, error) {
+	var payload []byte
+	if req.jsonBody != nil {
+		var err error
+		if payload, err = json.Marshal(req.jsonBody); err != nil {
+			return nil, err
+		}
+	}
+
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		httpReq, err := c.newRequest(ctx, req, payload)
+		if err != nil {
+			return nil, err
+		}
+		if !req.public {
+			token, err := c.validToken(ctx, refreshed)
+			if err != nil {
+				return nil, err
+			}
+			httpReq.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := c.httpClient.Do(httpReq)
+		if err != nil {
+			if ctx.Err() != nil || !c.shouldRetry(req, attempt) {
+				return nil, err
+			}
+			if err := sleep(ctx, retryDelay(attempt, 0)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		apiErr := readError(resp)
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && !req.public && !refreshed && req.replayable():
+			// The access token may have been revoked early; refresh once
+			// and try again
+			refreshed = true
+			continue
+		case retryableStatus(resp.StatusCode) && c.shouldRetry(req, attempt):
+			if err := sleep(ctx, retryDelay(attempt, retryAfter(resp))); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return nil, apiErr
+	}
+}
+
+func (c *Client) shouldRetry(req *request, attempt int) bool {
+	return req.idempotent() && attempt < c.retries
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryDelay returns an exponential backoff for the attempt, or the
+// server's Retry-After when longer
+func retryDelay(attempt int, after time.Duration) time.Duration {
+	delay := retryBaseDelay << min(attempt, 10)
+	return min(max(delay, after), maxRetryDelay)
+}
+
+// retryAfter parses a Retry-After header given in seconds
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, req *request, payload []byte) (*http.Request, error) {
+	var body io.Reader
+	contentType := req.contentType
+	switch {
+	case payload != nil:
+		body = bytes.NewReader(payload)
+		contentType = "application/json"
+	case req.body != nil:
+		body = req.body
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range req.header {
+		httpReq.Header.Set(k, v)
+	}
+	if len(req.query) > 0 {
+		q := httpReq.URL.Query()
+		for k, v := range req.query {
+			if v != "" {
+				q.Set(k, v)
+			}
+		}
+		httpReq.URL.RawQuery = q.Encode()
+	}
+	return httpReq, nil
+}
+
+// validToken returns an access token, refreshing it first when it is about
+// to expire or force is set
+func (c *Client) validToken(ctx context.Context, force bool) (string, error) {
+	c.mu.Lock()
+	token := c.token
+	c.mu.Unlock()
+
+	if token == nil {
+		return "", ErrNotLoggedIn
+	}
+	expiring := !token.ExpiresAt.IsZero() && time.Until(token.ExpiresAt) < refreshMargin
+	if (!force && !expiring) || token.RefreshToken == "" {
+		return token.AccessToken, nil
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if current := c.Token(); current != nil && current.AccessToken != token.AccessToken {
+		return current.AccessToken, nil // Refreshed by another call meanwhile
+	}
+	if _, err := c.Refresh(ctx); err != nil {
+		return "", err
+	}
+	return c.Token().AccessToken, nil
+}
+
+// setToken stores credentials from an auth response
+func (c *Client) setToken(resp *AuthResponse) {
+	token := &Token{AccessToken: resp.AccessToken, RefreshToken: resp.RefreshToken}
+	if t, err := time.Parse(time.RFC3339, resp.ExpiresAt); err == nil {
+		token.ExpiresAt = t
+	}
+
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+
+	if c.onToken != nil {
+		t := *token
+		c.onToken(&t)
+	}
+}
+
+func readError(resp *http.Response) error {
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+		message = errResp.Error
+	}
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return newAPIError(resp.StatusCode, message)
+}
@@ -0,0 +1,355 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func respond(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func respondErr(w http.ResponseWriter, status int, message string) {
+	respond(w, status, map[string]string{"error": message})
+}
+
+func authResponse(access string, expires time.Time) AuthResponse {
+	return AuthResponse{
+		User:         &User{ID: "u1", Email: "a@example.com"},
+		AccessToken:  access,
+		RefreshToken: "refresh-" + access,
+		ExpiresAt:    expires.UTC().Format(time.RFC3339),
+	}
+}
+
+func TestRefreshesRejectedToken(t *testing.T) {
+	var refreshes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/auth/refresh":
+			refreshes.Add(1)
+			respond(w, http.StatusOK, authResponse("new", time.Now().Add(time.Hour)))
+		case "/api/v1/groups":
+			if r.Header.Get("Authorization") != "Bearer new" {
+				respondErr(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			respond(w, http.StatusOK, []Group{{ID: "g1", Name: "team"}})
+		}
+	}))
+	defer srv.Close()
+
+	var saved *Token
+	c := New(srv.URL,
+		WithToken(&Token{AccessToken: "old", RefreshToken: "r", ExpiresAt: time.Now().Add(time.Hour)}),
+		WithTokenHandler(func(tok *Token) { saved = tok }))
+
+	groups, err := c.ListGroups(context.Background())
+	if err != nil {
+		t.Fatalf("ListGroups: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Name != "team" {
+		t.Errorf("groups = %+v", groups)
+	}
+	if refreshes.Load() != 1 {
+		t.Errorf("refreshes = %d, want 1", refreshes.Load())
+	}
+	if saved == nil || saved.AccessToken != "new" || c.Token().AccessToken != "new" {
+		t.Errorf("refreshed token not stored: %+v", saved)
+	}
+}
+
+func TestRefreshesExpiringToken(t *testing.T) {
+	var refreshes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/auth/refresh" {
+			refreshes.Add(1)
+			respond(w, http.StatusOK, authResponse("new", time.Now().Add(time.Hour)))
+			return
+		}
+		respond(w, http.StatusOK, []Group{})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithToken(&Token{AccessToken: "old", RefreshToken: "r", ExpiresAt: time.Now().Add(time.Second)}))
+	for range 3 {
+		if _, err := c.ListGroups(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if refreshes.Load() != 1 {
+		t.Errorf("refreshes = %d, want 1", refreshes.Load())
+	}
+}
+
+func TestRetriesIdempotentCalls(t *testing.T) {
+	var gets, posts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posts.Add(1)
+			respondErr(w, http.StatusServiceUnavailable, "Service Unavailable")
+			return
+		}
+		if gets.Add(1) < 3 {
+			respondErr(w, http.StatusServiceUnavailable, "Service Unavailable")
+			return
+		}
+		respond(w, http.StatusOK, []Group{})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithToken(&Token{AccessToken: "t"}))
+	if _, err := c.ListGroups(context.Background()); err != nil {
+		t.Fatalf("ListGroups: %v", err)
+	}
+	if gets.Load() != 3 {
+		t.Errorf("GET attempts = %d, want 3", gets.Load())
+	}
+
+	if _, err := c.CreateGroup(context.Background(), "x"); err == nil {
+		t.Fatal("CreateGroup succeeded")
+	}
+	if posts.Load() != 1 {
+		t.Errorf("POST attempts = %d, want 1", posts.Load())
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		respondErr(w, http.StatusBadGateway, "Bad Gateway")
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithToken(&Token{AccessToken: "t"}), WithRetries(1))
+	_, err := c.ListGroups(context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("err = %v, want HTTP 502", err)
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("attempts = %d, want 2", attempts.Load())
+	}
+}
+
+func TestSentinelErrors(t *testing.T) {
+	tests := []struct {
+		status  int
+		message string
+		want    error
+	}{
+		{http.StatusForbidden, "You are not a member of this group", ErrNotMember},
+		{http.StatusNotFound, "File not found", ErrFileNotFound},
+		{http.StatusNotFound, "Group not found", ErrGroupNotFound},
+		{http.StatusConflict, "User is already a member", ErrAlreadyMember},
+		{http.StatusForbidden, "Only admins can add members", ErrForbidden},
+		{http.StatusUnauthorized, "Invalid email or password", ErrInvalidCredentials},
+		{http.StatusTooManyRequests, "Account is temporarily locked due to too many failed attempts", ErrAccountLocked},
+		{http.StatusGone, "cursor is no longer valid; restart with a full listing", ErrCursorReset},
+		{http.StatusRequestEntityTooLarge, "File exceeds maximum size (1 GB)", ErrFileTooLarge},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			respondErr(w, tt.status, tt.message)
+		}))
+		c := New(srv.URL, WithToken(&Token{AccessToken: "t"}), WithRetries(0))
+		err := c.DeleteFile(context.Background(), "g", "f")
+		srv.Close()
+
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%q: err = %v, want %v", tt.message, err, tt.want)
+		}
+		if !strings.Contains(fmt.Sprint(err), tt.message) {
+			t.Errorf("%q: err = %v, want the server's message", tt.message, err)
+		}
+	}
+}
+
+func TestNotLoggedIn(t *testing.T) {
+	c := New("http://127.0.0.1:0")
+	if _, err := c.ListGroups(context.Background()); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("err = %v, want ErrNotLoggedIn", err)
+	}
+}
+
+func TestLoginStoresToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/auth/login":
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["email"] != "a@example.com" || body["password"] != "secret" {
+				respondErr(w, http.StatusUnauthorized, "Invalid credentials")
+				return
+			}
+			respond(w, http.StatusOK, authResponse("fresh", time.Now().Add(time.Hour)))
+		case "/api/v1/groups":
+			if r.Header.Get("Authorization") != "Bearer fresh" {
+				respondErr(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			respond(w, http.StatusOK, []Group{})
+		}
+	}))
+	defer srv.Close()
+
+	var saved *Token
+	c := New(srv.URL, WithTokenHandler(func(tok *Token) { saved = tok }))
+	if _, err := c.Login(context.Background(), "a@example.com", "wrong"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Login(wrong password) error = %v, want ErrUnauthorized", err)
+	}
+	if saved != nil || c.Token() != nil {
+		t.Fatalf("failed login stored a token: %+v", saved)
+	}
+
+	if _, err := c.Login(context.Background(), "a@example.com", "secret"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if saved == nil || saved.AccessToken != "fresh" || saved.RefreshToken != "refresh-fresh" || saved.ExpiresAt.IsZero() {
+		t.Fatalf("saved token = %+v", saved)
+	}
+	if _, err := c.ListGroups(context.Background()); err != nil {
+		t.Errorf("ListGroups after login: %v", err)
+	}
+}
+
+func TestCredentialsSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dbx", "credentials.json")
+
+	creds, err := LoadCredentials(path)
+	if err != nil || creds.Token != nil {
+		t.Fatalf("LoadCredentials(missing) = %+v, %v", creds, err)
+	}
+
+	creds = &Credentials{
+		Server: "https://dbx.example.com",
+		Email:  "a@example.com",
+		Token:  &Token{AccessToken: "a", RefreshToken: "r", ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Second)},
+	}
+	if err := creds.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("credentials mode = %v, want 0600", perm)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("config dir holds %d entries, want only the credentials", len(entries))
+	}
+
+	loaded, err := LoadCredentials(path)
+	if err != nil {
+		t.Fatalf("LoadCredentials: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, creds) {
+		t.Errorf("loaded = %+v, want %+v", loaded, creds)
+	}
+
+	if err := RemoveCredentials(path); err != nil {
+		t.Fatalf("RemoveCredentials: %v", err)
+	}
+	if err := RemoveCredentials(path); err != nil {
+		t.Errorf("RemoveCredentials(missing) error = %v", err)
+	}
+}
+
+func TestUploadStreamsMultipart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			respondErr(w, http.StatusBadRequest, "Failed to parse form")
+			return
+		}
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			respondErr(w, http.StatusBadRequest, "File is required")
+			return
+		}
+		data, _ := io.ReadAll(f)
+		var metadata map[string]interface{}
+		if v := r.FormValue("metadata"); v != "" {
+			_ = json.Unmarshal([]byte(v), &metadata)
+		}
+		respond(w, http.StatusCreated, File{
+			ID:          "f1",
+			Name:        r.FormValue("name"),
+			SizeBytes:   int64(len(data)),
+			ContentType: header.Header.Get("Content-Type"),
+			Tags:        r.MultipartForm.Value["tags"],
+			Metadata:    metadata,
+		})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithToken(&Token{AccessToken: "t"}))
+	file, err := c.Upload(context.Background(), "g", "docs/report.txt", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if file.Name != "docs/report.txt" || file.SizeBytes != 5 || !strings.HasPrefix(file.ContentType, "text/plain") {
+		t.Errorf("file = %+v", file)
+	}
+
+	file, err = c.UploadWith(context.Background(), "g", "report.txt", strings.NewReader("hello"), UploadOptions{
+		Tags:     []string{"q3", "final"},
+		Metadata: map[string]interface{}{"project": "apollo", "build": 42},
+	})
+	if err != nil {
+		t.Fatalf("UploadWith: %v", err)
+	}
+	if !reflect.DeepEqual(file.Tags, []string{"q3", "final"}) || file.Metadata["project"] != "apollo" || file.Metadata["build"] != 42.0 {
+		t.Errorf("file = %+v", file)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Last-Event-ID") != "4" {
+			http.Error(w, "missing Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "retry: 3000\n\n: heartbeat\n\n")
+		_, _ = io.WriteString(w, "id: 5\nevent: file.uploaded\ndata: {\"id\":\"e5\",\"type\":\"file.uploaded\",\"group_id\":\"g\"}\n\n")
+		_, _ = io.WriteString(w, "id: 6\r\nevent: file.deleted\r\ndata: {\"id\":\"e6\",\r\ndata: \"type\":\"file.deleted\"}\r\n\r\n")
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithToken(&Token{AccessToken: "t"}))
+	stream, err := c.StreamEvents(context.Background(), "4")
+	if err != nil {
+		t.Fatalf("StreamEvents: %v", err)
+	}
+	defer func() { _ = stream.Close() }()
+
+	for _, want := range []struct{ id, typ, lastID string }{{"e5", "file.uploaded", "5"}, {"e6", "file.deleted", "6"}} {
+		event, err := stream.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if event.ID != want.id || event.Type != want.typ || stream.LastEventID() != want.lastID {
+			t.Errorf("event = %+v, last ID %s; want %s %s, last ID %s", event, stream.LastEventID(), want.id, want.typ, want.lastID)
+		}
+	}
+	if _, err := stream.Next(); err != io.EOF {
+		t.Errorf("Next at end = %v, want io.EOF", err)
+	}
+}
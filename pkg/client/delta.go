@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Delta entry tags
+const (
+	TagAdded    = "added"
+	TagModified = "modified"
+	TagDeleted  = "deleted"
+)
+
+// DeltaEntry is a file's state as of a delta page. Deleted entries carry
+// only the ID and last name.
+type DeltaEntry struct {
+	Tag         string `json:"tag"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	SizeBytes   int64  `json:"size_bytes"`
+	ContentType string `json:"content_type"`
+	UploadedBy  string `json:"uploaded_by"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// DeltaPage is a page of changes. Continue from Cursor while HasMore is
+// set; afterwards Cursor marks the current state.
+type DeltaPage struct {
+	Entries []DeltaEntry `json:"entries"`
+	Cursor  string       `json:"cursor"`
+	HasMore bool         `json:"has_more"`
+}
+
+// LongpollResult reports which groups changed after their cursors
+type LongpollResult struct {
+	Changes bool     `json:"changes"`
+	Groups  []string `json:"groups"`
+}
+
+// ListDelta starts a full listing of a group's files. A limit of zero uses
+// the server's default page size.
+func (c *Client) ListDelta(ctx context.Context, groupID string, limit int) (*DeltaPage, error) {
+	return c.delta(ctx, deltaPath(groupID), map[string]string{"limit": formatLimit(limit)})
+}
+
+// ContinueDelta returns the changes after cursor. It returns an error
+// matching ErrCursorReset when the cursor must be replaced by a new listing.
+func (c *Client) ContinueDelta(ctx context.Context, groupID, cursor string, limit int) (*DeltaPage, error) {
+	return c.delta(ctx, deltaPath(groupID)+"/continue", map[string]string{"cursor": cursor, "limit": formatLimit(limit)})
+}
+
+// LatestCursor returns a cursor for the group's current state without
+// listing its files
+func (c *Client) LatestCursor(ctx context.Context, groupID string) (string, error) {
+	var resp struct {
+		Cursor string `json:"cursor"`
+	}
+	if err := c.do(ctx, &request{method: http.MethodGet, path: deltaPath(groupID) + "/latest_cursor"}, &resp); err != nil {
+		return "", err
+	}
+	return resp.Cursor, nil
+}
+
+// Longpoll waits up to timeout for changes after any of the cursors. The
+// server caps the timeout; the HTTP client must allow at least as long.
+func (c *Client) Longpoll(ctx context.Context, cursors []string, timeout time.Duration) (*LongpollResult, error) {
+	var result LongpollResult
+	req := &request{
+		method:   http.MethodPost,
+		path:     "/delta/longpoll",
+		jsonBody: map[string]interface{}{"cursors": cursors, "timeout": int(timeout / time.Second)},
+	}
+	if err := c.do(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) delta(ctx context.Context, path string, query map[string]string) (*DeltaPage, error) {
+	var page DeltaPage
+	if err := c.do(ctx, &request{method: http.MethodGet, path: path, query: query}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func deltaPath(groupID string) string {
+	return "/groups/" + url.PathEscape(groupID) + "/delta"
+}
+
+// formatLimit formats a limit or offset query parameter, omitting zero
+func formatLimit(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors reported by the API, for use with errors.Is. The *APIError
+// returned by calls wraps one of these when the response is recognised.
+var (
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrInvalidCredentials   = errors.New("invalid email or password")
+	ErrAccountDisabled      = errors.New("account is disabled")
+	ErrAccountLocked        = errors.New("account is temporarily locked")
+	ErrEmailExists          = errors.New("email already exists")
+	ErrEmailNotVerified     = errors.New("email address must be verified")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	ErrIncorrectPassword    = errors.New("current password is incorrect")
+	ErrForbidden            = errors.New("admin rights required")
+	ErrNotMember            = errors.New("not a member of this group")
+	ErrAlreadyMember        = errors.New("user is already a member")
+	ErrMemberNotFound       = errors.New("user is not a member of this group")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrGroupNotFound        = errors.New("group not found")
+	ErrFileNotFound         = errors.New("file not found")
+	ErrFileTooLarge         = errors.New("file is too large")
+	ErrNoThumbnail          = errors.New("no thumbnail is available for this file")
+	ErrNoPreview            = errors.New("this file cannot be previewed")
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrDeliveryNotFound     = errors.New("delivery not found")
+	ErrAppPasswordNotFound  = errors.New("app password not found")
+	ErrAccessKeyNotFound    = errors.New("access key not found")
+	ErrSSHKeyNotFound       = errors.New("SSH key not found")
+	ErrSSHKeyExists         = errors.New("SSH key is already in use")
+	ErrCursorReset          = errors.New("cursor is no longer valid")
+)
+
+// ErrNotLoggedIn is returned by authenticated calls on a client without a
+// token
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// errorMessages maps the API's error messages to sentinel errors
+var errorMessages = map[string]error{
+	"Unauthorized":                            ErrUnauthorized,
+	"Invalid email or password":               ErrInvalidCredentials,
+	"Invalid refresh token":                   ErrUnauthorized,
+	"Refresh token has expired":               ErrUnauthorized,
+	"Account is disabled":                     ErrAccountDisabled,
+	"Email already exists":                    ErrEmailExists,
+	"Email address must be verified":          ErrEmailNotVerified,
+	"Email is already verified":               ErrEmailAlreadyVerified,
+	"Current password is incorrect":           ErrIncorrectPassword,
+	"Site administrator access required":      ErrForbidden,
+	"Only admins can add members":             ErrForbidden,
+	"Only admins can remove members":          ErrForbidden,
+	"Only admins can manage webhooks":         ErrForbidden,
+	"You are not a member of this group":      ErrNotMember,
+	"User is already a member":                ErrAlreadyMember,
+	"User is not a member of this group":      ErrMemberNotFound,
+	"User not found":                          ErrUserNotFound,
+	"Group not found":                         ErrGroupNotFound,
+	"File not found":                          ErrFileNotFound,
+	"No thumbnail is available for this file": ErrNoThumbnail,
+	"This file cannot be previewed":           ErrNoPreview,
+	"Webhook not found":                       ErrWebhookNotFound,
+	"Delivery not found":                      ErrDeliveryNotFound,
+	"App password not found":                  ErrAppPasswordNotFound,
+	"Access key not found":                    ErrAccessKeyNotFound,
+	"SSH key not found":                       ErrSSHKeyNotFound,
+	"SSH key is already in use":               ErrSSHKeyExists,
+}
+
+// statusErrors maps status codes to sentinel errors for responses whose
+// message is not recognised
+var statusErrors = map[int]error{
+	http.StatusUnauthorized:          ErrUnauthorized,
+	http.StatusGone:                  ErrCursorReset,
+	http.StatusRequestEntityTooLarge: ErrFileTooLarge,
+	http.StatusTooManyRequests:       ErrAccountLocked,
+}
+
+// APIError is an error response from the API
+type APIError struct {
+	StatusCode int
+	Message    string
+	Err        error // Matching sentinel error, if any
+}
+
+func newAPIError(status int, message string) *APIError {
+	err, ok := errorMessages[message]
+	if !ok {
+		err = statusErrors[status]
+	}
+	return &APIError{StatusCode: status, Message: message, Err: err}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
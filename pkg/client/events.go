@@ -0,0 +1,104 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Event is a change in one of the user's groups
+type Event struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	GroupID    string                 `json:"group_id"`
+	ActorID    string                 `json:"actor_id"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// EventStream reads the user's events as they happen. It does not
+// reconnect; to resume after an error, open a new stream from
+// LastEventID.
+type EventStream struct {
+	body        io.ReadCloser
+	reader      *bufio.Reader
+	lastEventID string
+}
+
+// StreamEvents opens a stream of events in the user's groups. A non-empty
+// lastEventID first replays the events after it that the server retains.
+func (c *Client) StreamEvents(ctx context.Context, lastEventID string) (*EventStream, error) {
+	req := &request{method: http.MethodGet, path: "/events", header: map[string]string{"Accept": "text/event-stream"}}
+	if lastEventID != "" {
+		req.header["Last-Event-ID"] = lastEventID
+	}
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &EventStream{body: resp.Body, reader: bufio.NewReader(resp.Body), lastEventID: lastEventID}, nil
+}
+
+// Next blocks until the next event arrives. It returns io.EOF when the
+// server closes the stream.
+func (s *EventStream) Next() (*Event, error) {
+	var id, data strings.Builder
+	hasID := false
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" {
+				return nil, io.EOF
+			}
+			if err != io.EOF {
+				return nil, err
+			}
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			// A blank line ends the message; comments and retry hints have
+			// no data and are skipped
+			if data.Len() == 0 {
+				continue
+			}
+			if hasID {
+				s.lastEventID = id.String()
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+				return nil, fmt.Errorf("decoding event: %w", err)
+			}
+			return &event, nil
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id.Reset()
+			id.WriteString(value)
+			hasID = true
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+}
+
+// LastEventID returns the ID of the last event read, for resuming
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Close closes the stream
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,332 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListFiles lists all of a group's files, newest first, fetching as many
+// pages as it takes
+func (c *Client) ListFiles(ctx context.Context, groupID string) ([]File, error) {
+	var files []File
+	opts := FileListOptions{Limit: maxPageSize}
+	for {
+		page, err := c.ListFilesPage(ctx, groupID, opts)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, page.Files...)
+		if page.NextPageToken == "" {
+			return files, nil
+		}
+		opts.PageToken = page.NextPageToken
+	}
+}
+
+// ListFilesPage lists a page of a group's files, sorted and filtered by
+// opts
+func (c *Client) ListFilesPage(ctx context.Context, groupID string, opts FileListOptions) (*FilePage, error) {
+	var page FilePage
+	token, err := c.doPage(ctx, &request{method: http.MethodGet, path: filesPath(groupID), query: opts.query()}, &page.Files)
+	if err != nil {
+		return nil, err
+	}
+	page.NextPageToken = token
+	return &page, nil
+}
+
+// Search finds files by name across the user's groups
+func (c *Client) Search(ctx context.Context, q SearchQuery) (*SearchResults, error) {
+	query := map[string]string{
+		"q":            q.Query,
+		"group_id":     q.GroupID,
+		"content_type": q.ContentType,
+		"uploaded_by":  q.UploadedBy,
+		"limit":        formatLimit(q.Limit),
+		"offset":       formatLimit(q.Offset),
+	}
+	if !q.CreatedAfter.IsZero() {
+		query["created_after"] = q.CreatedAfter.Format(time.RFC3339)
+	}
+	if !q.CreatedBefore.IsZero() {
+		query["created_before"] = q.CreatedBefore.Format(time.RFC3339)
+	}
+
+	var results SearchResults
+	if err := c.do(ctx, &request{method: http.MethodGet, path: "/search", query: query}, &results); err != nil {
+		return nil, err
+	}
+	return &results, nil
+}
+
+// Reindex queues a group's files for content indexing and returns how many
+// were queued. Only group admins may reindex.
+func (c *Client) Reindex(ctx context.Context, groupID string) (int64, error) {
+	var resp struct {
+		Queued int64 `json:"queued"`
+	}
+	req := &request{method: http.MethodPost, path: "/groups/" + url.PathEscape(groupID) + "/reindex"}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Queued, nil
+}
+
+func (o FileListOptions) query() map[string]string {
+	query := map[string]string{
+		"limit":        formatLimit(o.Limit),
+		"page_token":   o.PageToken,
+		"sort":         o.Sort,
+		"order":        o.Order,
+		"content_type": o.ContentType,
+		"uploaded_by":  o.UploadedBy,
+	}
+	if o.MinSize != nil {
+		query["min_size"] = strconv.FormatInt(*o.MinSize, 10)
+	}
+	if o.MaxSize != nil {
+		query["max_size"] = strconv.FormatInt(*o.MaxSize, 10)
+	}
+	if !o.CreatedAfter.IsZero() {
+		query["created_after"] = o.CreatedAfter.Format(time.RFC3339)
+	}
+	if !o.CreatedBefore.IsZero() {
+		query["created_before"] = o.CreatedBefore.Format(time.RFC3339)
+	}
+	if len(o.Tags) > 0 {
+		query["tag"] = strings.Join(o.Tags, ",")
+	}
+	for key, value := range o.Metadata {
+		query["metadata["+key+"]"] = value
+	}
+	return query
+}
+
+// Upload streams r to the group as a file named name, which may contain
+// slashes. The content type is derived from the name's extension.
+func (c *Client) Upload(ctx context.Context, groupID, name string, r io.Reader) (*File, error) {
+	return c.UploadWith(ctx, groupID, name, r, UploadOptions{})
+}
+
+// UploadWith uploads like Upload, setting the file's tags and metadata
+func (c *Client) UploadWith(ctx context.Context, groupID, name string, r io.Reader, opts UploadOptions) (*File, error) {
+	var metadata []byte
+	if len(opts.Metadata) > 0 {
+		var err error
+		if metadata, err = json.Marshal(opts.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// Encode the multipart body while it is sent rather than buffering it
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		// The name field keeps any directories, which the server would strip
+		// from the part's filename
+		err := mw.WriteField("name", name)
+		for _, tag := range opts.Tags {
+			if err == nil {
+				err = mw.WriteField("tags", tag)
+			}
+		}
+		if err == nil && metadata != nil {
+			err = mw.WriteField("metadata", string(metadata))
+		}
+		var part io.Writer
+		if err == nil {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", `form-data; name="file"; filename="`+escapeQuotes(path.Base(name))+`"`)
+			header.Set("Content-Type", contentType)
+			part, err = mw.CreatePart(header)
+		}
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	defer func() { _ = pr.Close() }()
+
+	var file File
+	req := &request{
+		method:      http.MethodPost,
+		path:        filesPath(groupID),
+		body:        pr,
+		contentType: mw.FormDataContentType(),
+	}
+	if err := c.do(ctx, req, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Download streams a file's contents to w and returns the number of bytes
+// written
+func (c *Client) Download(ctx context.Context, groupID, fileID string, w io.Writer) (int64, error) {
+	body, err := c.OpenFile(ctx, groupID, fileID)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = body.Close() }()
+	return io.Copy(w, body)
+}
+
+// OpenFile opens a file's contents for reading. The caller must close it.
+func (c *Client) OpenFile(ctx context.Context, groupID, fileID string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, &request{method: http.MethodGet, path: filesPath(groupID) + "/" + url.PathEscape(fileID)})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// OpenThumbnail opens a scaled copy of an image: size is "small",
+// "medium", "large" or a number of pixels, and "" means medium. It returns
+// the thumbnail's content type; the caller must close the body. Files
+// without thumbnails fail with ErrNoThumbnail.
+func (c *Client) OpenThumbnail(ctx context.Context, groupID, fileID, size string) (io.ReadCloser, string, error) {
+	req := &request{method: http.MethodGet, path: filesPath(groupID) + "/" + url.PathEscape(fileID) + "/thumbnail"}
+	if size != "" {
+		req.query = map[string]string{"size": size}
+	}
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+// Preview renders a text, markdown or source file as a standalone HTML
+// page, reporting whether it was cut short. Other files fail with
+// ErrNoPreview.
+func (c *Client) Preview(ctx context.Context, groupID, fileID string) ([]byte, bool, error) {
+	resp, err := c.send(ctx, &request{method: http.MethodGet, path: filesPath(groupID) + "/" + url.PathEscape(fileID) + "/preview"})
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return page, resp.Header.Get("X-Preview-Truncated") == "true", nil
+}
+
+// DeleteFile deletes a file
+func (c *Client) DeleteFile(ctx context.Context, groupID, fileID string) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: filesPath(groupID) + "/" + url.PathEscape(fileID)}, nil)
+}
+
+// RenameFile changes a file's name
+func (c *Client) RenameFile(ctx context.Context, groupID, fileID, name string) (*File, error) {
+	var file File
+	req := &request{
+		method:   http.MethodPatch,
+		path:     filesPath(groupID) + "/" + url.PathEscape(fileID),
+		jsonBody: map[string]string{"name": name},
+	}
+	if err := c.do(ctx, req, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// SetFileTags replaces a file's tags
+func (c *Client) SetFileTags(ctx context.Context, groupID, fileID string, tags []string) (*File, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	var file File
+	req := &request{
+		method:   http.MethodPut,
+		path:     filesPath(groupID) + "/" + url.PathEscape(fileID) + "/tags",
+		jsonBody: map[string][]string{"tags": tags},
+	}
+	if err := c.do(ctx, req, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// UpdateFileMetadata changes a file's metadata. Keys mapped to nil are
+// removed and the others are set; keys not in patch are left alone.
+func (c *Client) UpdateFileMetadata(ctx context.Context, groupID, fileID string, patch map[string]interface{}) (*File, error) {
+	var file File
+	req := &request{
+		method:   http.MethodPatch,
+		path:     filesPath(groupID) + "/" + url.PathEscape(fileID) + "/metadata",
+		jsonBody: patch,
+	}
+	if err := c.do(ctx, req, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetMetadataSchema returns a group's metadata fields
+func (c *Client) GetMetadataSchema(ctx context.Context, groupID string) ([]MetadataField, error) {
+	var resp struct {
+		Fields []MetadataField `json:"fields"`
+	}
+	req := &request{method: http.MethodGet, path: "/groups/" + url.PathEscape(groupID) + "/metadata-schema"}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Fields, nil
+}
+
+// SetMetadataSchema replaces a group's metadata fields. Only group admins
+// may change the schema.
+func (c *Client) SetMetadataSchema(ctx context.Context, groupID string, fields []MetadataField) ([]MetadataField, error) {
+	if fields == nil {
+		fields = []MetadataField{}
+	}
+	var resp struct {
+		Fields []MetadataField `json:"fields"`
+	}
+	req := &request{
+		method:   http.MethodPut,
+		path:     "/groups/" + url.PathEscape(groupID) + "/metadata-schema",
+		jsonBody: map[string][]MetadataField{"fields": fields},
+	}
+	if err := c.do(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Fields, nil
+}
+
+// ShareFile creates a temporary download link for a file
+func (c *Client) ShareFile(ctx context.Context, groupID, fileID string) (*ShareLink, error) {
+	var link ShareLink
+	req := &request{method: http.MethodPost, path: filesPath(groupID) + "/" + url.PathEscape(fileID) + "/share"}
+	if err := c.do(ctx, req, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func filesPath(groupID string) string {
+	return "/groups/" + url.PathEscape(groupID) + "/files"
+}
+
+func escapeQuotes(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
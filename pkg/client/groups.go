@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListGroups lists all the groups the user belongs to, newest first,
+// fetching as many pages as it takes
+func (c *Client) ListGroups(ctx context.Context) ([]Group, error) {
+	var groups []Group
+	query := map[string]string{"limit": formatLimit(maxPageSize)}
+	for {
+		var page []Group
+		token, err := c.doPage(ctx, &request{method: http.MethodGet, path: "/groups", query: query}, &page)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, page...)
+		if token == "" {
+			return groups, nil
+		}
+		query["page_token"] = token
+	}
+}
+
+// ListMembers lists a page of a group's members, sorted and filtered by
+// opts
+func (c *Client) ListMembers(ctx context.Context, groupID string, opts MemberListOptions) (*MemberPage, error) {
+	var page MemberPage
+	query := map[string]string{
+		"limit":      formatLimit(opts.Limit),
+		"page_token": opts.PageToken,
+		"sort":       opts.Sort,
+		"order":      opts.Order,
+		"role":       opts.Role,
+	}
+	req := &request{method: http.MethodGet, path: "/groups/" + url.PathEscape(groupID) + "/members", query: query}
+	token, err := c.doPage(ctx, req, &page.Members)
+	if err != nil {
+		return nil, err
+	}
+	page.NextPageToken = token
+	return &page, nil
+}
+
+// CreateGroup creates a group with the user as its admin
+func (c *Client) CreateGroup(ctx context.Context, name string) (*Group, error) {
+	var group Group
+	err := c.do(ctx, &request{method: http.MethodPost, path: "/groups", jsonBody: map[string]string{"name": name}}, &group)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// AddMember adds a user to a group with the role "admin" or "member"
+func (c *Client) AddMember(ctx context.Context, groupID, userID, role string) (*Membership, error) {
+	var membership Membership
+	req := &request{
+		method:   http.MethodPost,
+		path:     "/groups/" + url.PathEscape(groupID) + "/members",
+		jsonBody: map[string]string{"user_id": userID, "role": role},
+	}
+	if err := c.do(ctx, req, &membership); err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// RemoveMember removes a user from a group
+func (c *Client) RemoveMember(ctx context.Context, groupID, userID string) error {
+	path := "/groups/" + url.PathEscape(groupID) + "/members/" + url.PathEscape(userID)
+	return c.do(ctx, &request{method: http.MethodDelete, path: path}, nil)
+}
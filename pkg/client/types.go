@@ -0,0 +1,354 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Token holds API credentials. Clients refresh the access token with the
+// refresh token shortly before ExpiresAt.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// User is an account
+type User struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// AuthResponse is returned by login, registration and token refresh
+type AuthResponse struct {
+	User         *User  `json:"user"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    string `json:"expires_at"`
+}
+
+// Group is a group the user belongs to
+type Group struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedBy string `json:"created_by"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Membership is a user's membership in a group
+type Membership struct {
+	UserID   string `json:"user_id"`
+	GroupID  string `json:"group_id"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joined_at"`
+	Email    string `json:"email,omitempty"` // Only set by ListMembers
+}
+
+// MemberListOptions sorts, filters and pages a group's members. Zero fields
+// take the server's defaults.
+type MemberListOptions struct {
+	Limit     int
+	PageToken string // From the previous page
+	Sort      string // "joined_at" or "email"
+	Order     string // "asc" or "desc"
+	Role      string // "admin" or "member"
+}
+
+// MemberPage is a page of a group's members. NextPageToken is empty on the
+// last page.
+type MemberPage struct {
+	Members       []Membership
+	NextPageToken string
+}
+
+// File is a file's metadata
+type File struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	SizeBytes   int64                  `json:"size_bytes"`
+	ContentType string                 `json:"content_type"`
+	GroupID     string                 `json:"group_id"`
+	UploadedBy  string                 `json:"uploaded_by"`
+	CreatedAt   string                 `json:"created_at"`
+	Tags        []string               `json:"tags"`
+	Metadata    map[string]interface{} `json:"metadata"` // Strings, numbers (float64) and booleans
+}
+
+// UploadOptions sets an upload's tags and metadata. Metadata values are
+// strings, numbers or booleans, and must satisfy the group's schema.
+type UploadOptions struct {
+	Tags     []string
+	Metadata map[string]interface{}
+}
+
+// MetadataField is a field in a group's metadata schema. Type is "string",
+// "number", "boolean" or "date" (YYYY-MM-DD).
+type MetadataField struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required"`
+	Description string `json:"description,omitempty"`
+}
+
+// ShareLink is a temporary download link for a file
+type ShareLink struct {
+	URL string `json:"url"`
+}
+
+// Profile is the current user's account
+type Profile struct {
+	ID            string            `json:"id"`
+	Email         string            `json:"email"`
+	EmailVerified bool              `json:"email_verified"`
+	DisplayName   string            `json:"display_name"`
+	CreatedAt     string            `json:"created_at"`
+	Groups        []GroupMembership `json:"groups"`
+}
+
+// AppPassword is a credential for WebDAV and other clients that sign in
+// with HTTP Basic auth. Password is only set when it is created.
+type AppPassword struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Password   string `json:"password,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+}
+
+// AccessKey is a credential for the S3 gateway. SecretAccessKey is only
+// set when it is created.
+type AccessKey struct {
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	Name            string `json:"name"`
+	CreatedAt       string `json:"created_at"`
+	LastUsedAt      string `json:"last_used_at,omitempty"`
+}
+
+// SSHKey is a public key for the SFTP listener
+type SSHKey struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	PublicKey   string `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+	CreatedAt   string `json:"created_at"`
+	LastUsedAt  string `json:"last_used_at,omitempty"`
+}
+
+// GroupMembership is one of the current user's groups
+type GroupMembership struct {
+	GroupID   string `json:"group_id"`
+	GroupName string `json:"group_name"`
+	Role      string `json:"role"`
+	JoinedAt  string `json:"joined_at"`
+}
+
+// EmailVerification is the result of following a verification link
+type EmailVerification struct {
+	Email      string `json:"email"`
+	VerifiedAt string `json:"verified_at"`
+}
+
+// maxPageSize is the most entries the server returns in a page
+const maxPageSize = 1000
+
+// FileListOptions sorts, filters and pages a group's files. Zero fields
+// take the server's defaults.
+type FileListOptions struct {
+	Limit         int
+	PageToken     string // From the previous page
+	Sort          string // "created_at", "name", "size" or "uploader"
+	Order         string // "asc" or "desc"
+	ContentType   string // Exact, or a prefix ending in a slash such as "image/"
+	UploadedBy    string // User ID
+	MinSize       *int64
+	MaxSize       *int64
+	CreatedAfter  time.Time         // Inclusive
+	CreatedBefore time.Time         // Exclusive
+	Tags          []string          // Files with all of these tags
+	Metadata      map[string]string // Files whose metadata values read as these strings
+}
+
+// FilePage is a page of a group's files. NextPageToken is empty on the last
+// page.
+type FilePage struct {
+	Files         []File
+	NextPageToken string
+}
+
+// SearchQuery is a file search across the user's groups. Zero fields are
+// not filtered on.
+type SearchQuery struct {
+	Query         string
+	GroupID       string
+	ContentType   string // Exact, or a prefix ending in a slash such as "image/"
+	UploadedBy    string // User ID
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Limit         int
+	Offset        int
+}
+
+// SearchResult is a file matching a search. Highlight is the file's name
+// as HTML with the matched words in <mark> elements.
+type SearchResult struct {
+	File           File    `json:"file"`
+	Highlight      string  `json:"highlight"`
+	Rank           float64 `json:"rank"`
+	MatchedContent bool    `json:"matched_content"` // The file's indexed content matched
+}
+
+// SearchResults is a page of search results, best match first
+type SearchResults struct {
+	Results []SearchResult `json:"results"`
+	HasMore bool           `json:"has_more"`
+}
+
+// ListOptions pages and filters admin listings
+type ListOptions struct {
+	Query  string // Search text
+	Limit  int
+	Offset int
+}
+
+// AdminUser is a user as seen by site administrators
+type AdminUser struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	DisplayName   string `json:"display_name"`
+	EmailVerified bool   `json:"email_verified"`
+	IsAdmin       bool   `json:"is_admin"`
+	Disabled      bool   `json:"disabled"`
+	DisabledAt    string `json:"disabled_at,omitempty"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// AdminUserList is a page of users
+type AdminUserList struct {
+	Users []AdminUser `json:"users"`
+	Total int         `json:"total"`
+}
+
+// AdminGroup is a group with usage totals
+type AdminGroup struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	CreatedBy   string `json:"created_by"`
+	CreatedAt   string `json:"created_at"`
+	MemberCount int    `json:"member_count"`
+	FileCount   int    `json:"file_count"`
+	TotalBytes  int64  `json:"total_bytes"`
+}
+
+// AdminGroupList is a page of groups
+type AdminGroupList struct {
+	Groups []AdminGroup `json:"groups"`
+	Total  int          `json:"total"`
+}
+
+// Stats are instance-wide totals
+type Stats struct {
+	Users         int   `json:"users"`
+	DisabledUsers int   `json:"disabled_users"`
+	Admins        int   `json:"admins"`
+	VerifiedUsers int   `json:"verified_users"`
+	Groups        int   `json:"groups"`
+	Files         int   `json:"files"`
+	TotalBytes    int64 `json:"total_bytes"`
+}
+
+// AuditQuery filters the audit log. Zero values are ignored.
+type AuditQuery struct {
+	GroupID string
+	ActorID string
+	Action  string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+	Offset  int
+}
+
+// AuditEvent is an audit log entry
+type AuditEvent struct {
+	ID         int64             `json:"id"`
+	OccurredAt string            `json:"occurred_at"`
+	ActorID    string            `json:"actor_id,omitempty"`
+	Action     string            `json:"action"`
+	GroupID    string            `json:"group_id,omitempty"`
+	TargetType string            `json:"target_type,omitempty"`
+	TargetID   string            `json:"target_id,omitempty"`
+	IP         string            `json:"ip,omitempty"`
+	UserAgent  string            `json:"user_agent,omitempty"`
+	RequestID  string            `json:"request_id,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Hash       string            `json:"hash"`
+}
+
+// AuditEventList is a page of audit events
+type AuditEventList struct {
+	Events []AuditEvent `json:"events"`
+	Total  int          `json:"total"`
+}
+
+// AuditVerification is the result of checking the audit log's hash chain
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	LastID   int64  `json:"last_id"`
+	LastHash string `json:"last_hash"`
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Webhook is a group's webhook subscription
+type Webhook struct {
+	ID         string   `json:"id"`
+	GroupID    string   `json:"group_id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"` // Only returned on creation
+	EventTypes []string `json:"event_types"`
+	Active     bool     `json:"active"`
+	CreatedBy  string   `json:"created_by"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// CreateWebhookInput describes a new webhook. An empty secret is generated
+// by the server; no event types subscribes to all of them.
+type CreateWebhookInput struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret,omitempty"`
+}
+
+// UpdateWebhookInput changes the fields that are set
+type UpdateWebhookInput struct {
+	URL        *string   `json:"url,omitempty"`
+	EventTypes *[]string `json:"event_types,omitempty"`
+	Active     *bool     `json:"active,omitempty"`
+}
+
+// WebhookDelivery is an attempt, or series of attempts, to deliver an event
+// to a webhook
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  string          `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  string          `json:"last_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+}
+
+// WebhookDeliveryList is a page of deliveries
+type WebhookDeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Total      int               `json:"total"`
+	Limit      int               `json:"limit"`
+	Offset     int               `json:"offset"`
+}
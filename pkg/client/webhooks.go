@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CreateWebhook subscribes a URL to a group's events. The returned webhook
+// carries the signing secret, which is not shown again.
+func (c *Client) CreateWebhook(ctx context.Context, groupID string, input CreateWebhookInput) (*Webhook, error) {
+	return c.webhook(ctx, &request{method: http.MethodPost, path: webhooksPath(groupID), jsonBody: input})
+}
+
+// ListWebhooks lists a group's webhooks
+func (c *Client) ListWebhooks(ctx context.Context, groupID string) ([]Webhook, error) {
+	var webhooks []Webhook
+	err := c.do(ctx, &request{method: http.MethodGet, path: webhooksPath(groupID)}, &webhooks)
+	return webhooks, err
+}
+
+// GetWebhook returns a webhook
+func (c *Client) GetWebhook(ctx context.Context, groupID, webhookID string) (*Webhook, error) {
+	return c.webhook(ctx, &request{method: http.MethodGet, path: webhookPath(groupID, webhookID)})
+}
+
+// UpdateWebhook changes a webhook's URL, event types or active flag
+func (c *Client) UpdateWebhook(ctx context.Context, groupID, webhookID string, input UpdateWebhookInput) (*Webhook, error) {
+	return c.webhook(ctx, &request{method: http.MethodPatch, path: webhookPath(groupID, webhookID), jsonBody: input})
+}
+
+// DeleteWebhook deletes a webhook
+func (c *Client) DeleteWebhook(ctx context.Context, groupID, webhookID string) error {
+	return c.do(ctx, &request{method: http.MethodDelete, path: webhookPath(groupID, webhookID)}, nil)
+}
+
+// ListWebhookDeliveries lists a webhook's deliveries, newest first
+func (c *Client) ListWebhookDeliveries(ctx context.Context, groupID, webhookID string, limit, offset int) (*WebhookDeliveryList, error) {
+	var list WebhookDeliveryList
+	req := &request{
+		method: http.MethodGet,
+		path:   webhookPath(groupID, webhookID) + "/deliveries",
+		query:  map[string]string{"limit": formatLimit(limit), "offset": formatLimit(offset)},
+	}
+	if err := c.do(ctx, req, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// RedeliverWebhook queues a delivery to be sent again
+func (c *Client) RedeliverWebhook(ctx context.Context, groupID, webhookID, deliveryID string) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	req := &request{
+		method: http.MethodPost,
+		path:   webhookPath(groupID, webhookID) + "/deliveries/" + url.PathEscape(deliveryID) + "/redeliver",
+	}
+	if err := c.do(ctx, req, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (c *Client) webhook(ctx context.Context, req *request) (*Webhook, error) {
+	var webhook Webhook
+	if err := c.do(ctx, req, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func webhooksPath(groupID string) string {
+	return "/groups/" + url.PathEscape(groupID) + "/webhooks"
+}
+
+func webhookPath(groupID, webhookID string) string {
+	return webhooksPath(groupID) + "/" + url.PathEscape(webhookID)
+}